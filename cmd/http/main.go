@@ -10,11 +10,14 @@ import (
 	"os"
 
 	xrf "xrf197ilz35aq0"
+	"xrf197ilz35aq0/core/model/rung"
 	"xrf197ilz35aq0/core/repository"
 	"xrf197ilz35aq0/core/service"
 	"xrf197ilz35aq0/internal"
 	"xrf197ilz35aq0/internal/dependency"
+	"xrf197ilz35aq0/internal/encryption"
 	xrfErr "xrf197ilz35aq0/internal/error"
+	"xrf197ilz35aq0/internal/token"
 	"xrf197ilz35aq0/server/http"
 	"xrf197ilz35aq0/storage/mongo"
 )
@@ -83,31 +86,120 @@ func main() {
 		return
 	}
 
+	invitationRepo, err := repository.NewInvitationRepository(mongoDB, logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
+	}
+
+	auditRepo, err := repository.NewAuditRepository(mongoDB, logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
+	}
+
+	roleRepo, err := repository.NewRoleRepository(mongoDB, logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
+	}
+
+	magnitudeConfig := config.Trust.Magnitude
+	magnitudeStrategy, err := rung.NewMagnitudeStrategy(magnitudeConfig.Algorithm, magnitudeConfig.HalfLife, magnitudeConfig.MaxTradeWeight)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
+	}
+
+	ratingDecay, err := rung.NewDecay(config.Trust.Rating.HalfLife)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
+	}
+
+	scoring := rung.Scoring{Decay: ratingDecay, Strategy: magnitudeStrategy}
+	rungRepo, err := repository.NewRungRepository(mongoDB, logger, scoring)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
+	}
+
+	consentRepo, err := repository.NewConsentRepository(mongoDB, logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
+	}
+
 	userRepo := repository.NewUserRepository(mongoDB, logger)
-	settingRepo := repository.NewSettingsRepository(mongoDB, logger)
+	settingRepo, err := repository.NewSettingsRepository(mongoDB, logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
+	}
 
 	allRepos := &repository.Repositories{
 		PermissionRepo: permissionRepo,
 		UserRepo:       userRepo,
 		OrgRepo:        orgRepo,
 		SettingsRepo:   settingRepo,
+		InvitationRepo: invitationRepo,
+		AuditRepo:      auditRepo,
+		RoleRepo:       roleRepo,
+		RungRepo:       rungRepo,
+		ConsentRepo:    consentRepo,
+	}
+
+	// create the signer for session tokens
+	tokenSigner, err := sessionTokenSigner(config)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
+	}
+
+	keyConfig := config.Security.KeyEncryption
+	keyProvider, err := encryption.NewKeyProvider(keyConfig.Provider, keyConfig.Source)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
 	}
 
 	// create services
-	permService := service.NewPermissionService(logger, permissionRepo)
-	orgService := service.NewOrganizationService(config.Security, logger, allRepos)
-	settingsService := service.NewSettingService(logger, settingRepo, backgroundCtx, config.Security)
-	userService := service.NewUserService(logger, settingsService, userRepo, backgroundCtx, config.Security)
+	orgAuthorizer := service.NewOrgAuthorizer(config.Security, logger, allRepos)
+	permService := service.NewPermissionService(logger, orgAuthorizer, allRepos)
+	roleService := service.NewRoleService(logger, orgAuthorizer, allRepos)
+	rungService := service.NewRungService(logger, allRepos)
+	rankingService := service.NewRankingService(logger, orgAuthorizer, allRepos)
+	orgService := service.NewAuthorizedOrgService(service.NewOrganizationService(config.Security, logger, allRepos), orgAuthorizer)
+	invitationService := service.NewInvitationService(config.Security, logger, orgAuthorizer, allRepos)
+	settingsService := service.NewSettingService(logger, settingRepo, backgroundCtx, config.Security, keyProvider)
+	userService := service.NewUserService(logger, settingsService, userRepo, tokenSigner, backgroundCtx, config.Security)
+
+	// rotate the users' data keys in the background, off-peak. Re-encryption is deferred: nothing stored is encrypted
+	// with the data keys yet, so no ReEncrypter is registered and every rotation adds the replaced key to the user's
+	// previous keys. A store encrypting with the data keys must register its ReEncrypter here (see
+	// service.ReEncryptStream) so they can be retired
+	rotationConfig := config.Security.KeyRotation
+	keyRotationService := service.NewKeyRotationService(logger, rotationConfig, settingRepo, keyProvider)
+	keyRotationScheduler, err := service.NewKeyRotationScheduler(logger, rotationConfig, keyRotationService)
+	if err != nil {
+		logger.Error(fmt.Sprintf("appStarted=false :: err%s", err.Error()))
+		return
+	}
+	go keyRotationScheduler.Run(backgroundCtx)
 
 	services := http.Services{
 		OrgService:        orgService,
 		UserService:       userService,
 		PermissionService: permService,
+		InvitationService: invitationService,
+		RoleService:       roleService,
+		RungService:       rungService,
+		RankingService:    rankingService,
 	}
 
 	// create the router and start the server
 	router := mux.NewRouter().StrictSlash(true)
-	server := http.NewHttpServer(logger, router, config, services, backgroundCtx)
+	server := http.NewHttpServer(logger, router, config, services, tokenSigner, backgroundCtx)
 	server.Start()
 }
 
@@ -131,3 +223,15 @@ func mongoUri(config xrf.Config) (string, error) {
 		mongoConfig.AppName,
 	), nil
 }
+
+func sessionTokenSigner(config xrf.Config) (*token.Signer, error) {
+	sessionConfig := config.Security.Session
+	secret := os.Getenv(sessionConfig.Secret)
+	if secret == "" {
+		return nil, &xrfErr.Internal{
+			Source:  "cmd/cli/main#sessionTokenSigner",
+			Message: fmt.Sprintf("missing session secret environment variable %s", sessionConfig.Secret),
+		}
+	}
+	return token.NewSigner([]byte(secret), sessionConfig.ExpiresAfter)
+}
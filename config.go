@@ -31,8 +31,65 @@ type PasswordConfig struct {
 	Memory uint32 `yaml:"memory"`
 }
 
+// SessionConfig configures the tokens issued when a user logs in.
+// Secret is the name of the environment variable holding the token signing secret
+type SessionConfig struct {
+	Secret       string        `yaml:"secret"`
+	ExpiresAfter time.Duration `yaml:"expiresAfter"`
+}
+
+// InvitationConfig configures how long an org invitation can be accepted for
+type InvitationConfig struct {
+	ExpiresAfter time.Duration `yaml:"expiresAfter"`
+}
+
+// KeyEncryptionConfig configures where the key-encryption key that wraps the users' data keys comes from.
+// Provider is one of env or file, Source is the name of the environment variable or the path of the file
+type KeyEncryptionConfig struct {
+	Provider string `yaml:"provider"`
+	Source   string `yaml:"source"`
+}
+
+// KeyRotationConfig schedules the rotation of the users' data keys. Runs only start between WindowStart and
+// WindowEnd (hours of the day in UTC) so rotations happen off-peak, a window that ends before it starts spans midnight.
+// LeaseFor is how long an instance holds a user's settings while rotating, before another instance may retry
+type KeyRotationConfig struct {
+	Interval    time.Duration `yaml:"interval"`
+	WindowStart int           `yaml:"windowStart"`
+	WindowEnd   int           `yaml:"windowEnd"`
+	BatchSize   int           `yaml:"batchSize"`
+	LeaseFor    time.Duration `yaml:"leaseFor"`
+}
+
+// Security configures authentication, authorization and encryption.
+// Admins are the ids of the users allowed to manage global permissions, which authorization in every org relies on
 type Security struct {
-	PasswordConfig PasswordConfig `yaml:"passwordHash"`
+	Admins         []string            `yaml:"admins"`
+	PasswordConfig PasswordConfig      `yaml:"passwordHash"`
+	Session        SessionConfig       `yaml:"session"`
+	Invitation     InvitationConfig    `yaml:"invitation"`
+	KeyEncryption  KeyEncryptionConfig `yaml:"keyEncryption"`
+	KeyRotation    KeyRotationConfig   `yaml:"keyRotation"`
+}
+
+// MagnitudeConfig configures how the trust magnitude of a rung is calculated when a rating is given, rungs are
+// ranked by the magnitude as of their last rating. Algorithm is one of weighted (default) or average, HalfLife and
+// MaxTradeWeight only apply to weighted
+type MagnitudeConfig struct {
+	Algorithm      string        `yaml:"algorithm"`
+	HalfLife       time.Duration `yaml:"halfLife"`
+	MaxTradeWeight int           `yaml:"maxTradeWeight"`
+}
+
+// RatingConfig configures how much less a customer's older ratings count than their newest one, a HalfLife of 0
+// counts them all the same
+type RatingConfig struct {
+	HalfLife time.Duration `yaml:"halfLife"`
+}
+
+type TrustConfig struct {
+	Rating    RatingConfig    `yaml:"rating"`
+	Magnitude MagnitudeConfig `yaml:"magnitude"`
 }
 
 type MongoConfig struct {
@@ -64,6 +121,7 @@ type Config struct {
 	Database    Database          `yaml:"database"`
 	Application ApplicationConfig `yaml:"application"`
 	Security    Security          `yaml:"security"`
+	Trust       TrustConfig       `yaml:"trust"`
 }
 
 func NewConfig(env string) (Config, error) {
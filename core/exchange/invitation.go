@@ -0,0 +1,24 @@
+package exchange
+
+import "time"
+
+type InvitationRequest struct {
+	Email       string   `json:"email"`
+	Permissions []string `json:"permissions"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+// InvitationResponse only has the Token when the invitation is created, it can't be read afterward
+type InvitationResponse struct {
+	InvitationId string    `json:"invitationId"`
+	OrgId        string    `json:"orgId"`
+	Email        string    `json:"email"`
+	Permissions  []string  `json:"permissions"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	Token        string    `json:"token,omitempty"`
+}
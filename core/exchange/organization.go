@@ -22,14 +22,64 @@ type OrgRequest struct {
 	IsAnonymous bool               `json:"isAnonymous"`
 }
 
+// OrgUpdateRequest is a partial update, only the fields present in the request are changed
+type OrgUpdateRequest struct {
+	Name        *string `json:"name"`
+	Category    *string `json:"category"`
+	Description *string `json:"description"`
+	IsAnonymous *bool   `json:"isAnonymous"`
+}
+
+// UserOrgResponse is an org the user is a member of, with the user's membership
+type UserOrgResponse struct {
+	OrgResponse
+	IsOwner              bool     `json:"isOwner"`
+	Permissions          []string `json:"permissions"`
+	Roles                []string `json:"roles"`
+	GrantedPermissions   []string `json:"grantedPermissions"`
+	EffectivePermissions []string `json:"effectivePermissions"`
+}
+
+// OrgListRequest filters the orgs listed, zero values don't filter
+type OrgListRequest struct {
+	Category      string
+	IsAnonymous   *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MemberOnly    bool
+	Cursor        string
+	Limit         int
+}
+
 type OrgMemberRequest struct {
 	Owner       bool     `json:"owner"`
 	Email       string   `json:"email"`
 	Permissions []string `json:"permissions"`
+	Roles       []string `json:"roles"` // role names
 }
 
-type OrgMemberResponse struct {
-	Email       string   `json:"email"`
-	UserId      string   `json:"userId"`
+// OrgMemberPermissionsRequest replaces all the permissions a member has
+type OrgMemberPermissionsRequest struct {
 	Permissions []string `json:"permissions"`
 }
+
+// OrgMemberRolesRequest replaces all the roles a member has
+type OrgMemberRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// OwnershipTransferRequest names the member that takes over the caller's ownership
+type OwnershipTransferRequest struct {
+	UserId string `json:"userId"`
+}
+
+// OrgMemberResponse shows the permissions granted directly and through roles, GrantedPermissions is their union
+// and EffectivePermissions adds every permission they imply
+type OrgMemberResponse struct {
+	Email                string   `json:"email"`
+	UserId               string   `json:"userId"`
+	Permissions          []string `json:"permissions"`
+	Roles                []string `json:"roles"`
+	GrantedPermissions   []string `json:"grantedPermissions"`
+	EffectivePermissions []string `json:"effectivePermissions"`
+}
@@ -0,0 +1,9 @@
+package exchange
+
+// Page is one page of a list, NextCursor is the cursor of the next page when HasMore is true
+type Page[T any] struct {
+	Items      []T
+	Limit      int
+	HasMore    bool
+	NextCursor string
+}
@@ -7,8 +7,68 @@ type PermissionRequest struct {
 	Description string `json:"description"`
 }
 
+// PermissionUpdateRequest is a partial update, only the fields present in the request are changed
+type PermissionUpdateRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// PermissionImpliesRequest replaces the permissions a permission implies, names or wildcards such as "ORG_*"
+type PermissionImpliesRequest struct {
+	Implies []string `json:"implies"`
+}
+
+type PermissionListRequest struct {
+	Cursor string
+	Limit  int
+}
+
 type PermissionResponse struct {
+	Id          string     `json:"permissionId"`
+	OrgId       string     `json:"orgId,omitempty"`
 	Name        string     `json:"name"`
 	UpdatedAt   model.Time `json:"updatedAt"`
 	Description string     `json:"description"`
+	Implies     []string   `json:"implies"`
+}
+
+// RoleRequest names the permissions the role bundles
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type RoleListRequest struct {
+	Cursor string
+	Limit  int
+}
+
+type RoleResponse struct {
+	Id          string     `json:"roleId"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Permissions []string   `json:"permissions"`
+	UpdatedAt   model.Time `json:"updatedAt"`
+}
+
+// PermissionDeleteResponse reports a permission delete, a refused delete lists the orgs and roles still using the
+// permission
+type PermissionDeleteResponse struct {
+	PermissionId     string          `json:"permissionId"`
+	Deleted          bool            `json:"deleted"`
+	Cascade          bool            `json:"cascade"`
+	UpdatedOrgs      int64           `json:"updatedOrgs"`
+	ReferencingOrgs  []OrgReference  `json:"referencingOrgs,omitempty"`
+	ReferencingRoles []RoleReference `json:"referencingRoles,omitempty"`
+}
+
+type OrgReference struct {
+	OrgId       string `json:"orgId"`
+	DisplayName string `json:"displayName"`
+}
+
+type RoleReference struct {
+	RoleId string `json:"roleId"`
+	Name   string `json:"name"`
 }
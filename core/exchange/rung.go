@@ -0,0 +1,92 @@
+package exchange
+
+import "time"
+
+// ConsentRequest is the customer agreeing to their trades with a user being captured in the user's rung
+type ConsentRequest struct {
+	Method    string `json:"method"`
+	UserAgent string `json:"-"` // taken from the request
+}
+
+type ConsentResponse struct {
+	ConsentId string     `json:"consentId"`
+	UserId    string     `json:"userId"` // owner of the rung
+	Status    string     `json:"status"`
+	Method    string     `json:"method"`
+	UserAgent string     `json:"userAgent"`
+	GivenAt   time.Time  `json:"givenAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// TradeTrailRequest is the customer's rating of a trade, rating a trade again replaces the rating
+type TradeTrailRequest struct {
+	TradeId string `json:"tradeId"`
+	Rating  int    `json:"rating"`
+	Comment string `json:"comment"`
+}
+
+type RungResponse struct {
+	UserId    string          `json:"userId"`
+	Magnitude int             `json:"magnitude"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	Trails    []TrailResponse `json:"trails"`
+}
+
+type TrailResponse struct {
+	CustomerId string    `json:"customerId"`
+	Score      float64   `json:"score"`
+	Trades     int       `json:"trades"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// RungHistoryRequest is the time range [From, To) of a rung's timeline, Bucket (day or week) downsamples it
+type RungHistoryRequest struct {
+	From   *time.Time
+	To     *time.Time
+	Bucket string
+}
+
+type RungHistoryResponse struct {
+	UserId string                  `json:"userId"`
+	From   time.Time               `json:"from"`
+	To     time.Time               `json:"to"`
+	Bucket string                  `json:"bucket,omitempty"`
+	Points []TimelinePointResponse `json:"points"`
+}
+
+// TimelinePointResponse is the magnitude at the end of a bucket, or at a change when not downsampled
+type TimelinePointResponse struct {
+	At        time.Time `json:"at"`
+	Magnitude int       `json:"magnitude"`
+	Min       int       `json:"min"`
+	Max       int       `json:"max"`
+	Changes   int       `json:"changes"`
+}
+
+// LeaderboardRequest ranks every rung unless OrgId limits it to the org's members
+type LeaderboardRequest struct {
+	OrgId string
+	Limit int
+}
+
+type LeaderboardResponse struct {
+	OrgId   string             `json:"orgId,omitempty"`
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+// LeaderboardEntry users with the same magnitude share a rank
+type LeaderboardEntry struct {
+	Rank      int64  `json:"rank"`
+	UserId    string `json:"userId"`
+	Magnitude int    `json:"magnitude"`
+}
+
+// StandingResponse Percentile is the percentage of ranked users with a lower magnitude, ties count half
+type StandingResponse struct {
+	UserId     string  `json:"userId"`
+	OrgId      string  `json:"orgId,omitempty"`
+	Magnitude  int     `json:"magnitude"`
+	Rank       int64   `json:"rank"`
+	Percentile float64 `json:"percentile"`
+	Ranked     int64   `json:"ranked"`
+}
@@ -75,6 +75,48 @@ func (u *UserRequest) String() string {
 	return fmt.Sprintf("{firstName:%s, lastName%s, anonymous=%t}", u.FirstName, u.LastName, u.Anonymous)
 }
 
+type LoginRequest struct {
+	Email    string                `json:"email"`
+	Password custom.Secret[string] `json:"password"`
+}
+
+func (l *LoginRequest) UnmarshalJSON(bytes []byte) error {
+	externalClientErr = &xrfErr.External{}
+	externalClientErr.Source = "core/exchange/LoginRequest#UnmarshalJSON"
+	aux := &struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}{}
+	if err := json.Unmarshal(bytes, &aux); err != nil {
+		externalClientErr.Message = "Failed to unmarshal JSON"
+		return externalClientErr
+	}
+
+	if aux.Email == "" {
+		externalClientErr.Message = "Invalid or missing email address"
+		return externalClientErr
+	}
+	if aux.Password == "" {
+		externalClientErr.Message = "Invalid or missing password"
+		return externalClientErr
+	}
+
+	l.Email = aux.Email
+	l.Password = *custom.NewSecret(aux.Password)
+	return nil
+}
+
+func (l *LoginRequest) String() string {
+	return fmt.Sprintf("{email:%s}", l.Email)
+}
+
+type LoginResponse struct {
+	UserId    string    `json:"userId"`
+	Token     string    `json:"token"`
+	TokenType string    `json:"tokenType"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 type UserResponse struct {
 	UserId    string                `json:"userId"`
 	FirstName string                `json:"firstName,omitempty"`
@@ -101,10 +143,9 @@ func (s *SettingRequest) String() string {
 }
 
 type SettingResponse struct {
-	CreatedAt     time.Time             `json:"createdAt"`
-	UpdatedAt     time.Time             `json:"updatedAt"`
-	EncryptionKey custom.Secret[string] `json:"encryptionKey"`
-	RotateKey     bool                  `json:"rotateKey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	RotateKey bool      `json:"rotateKey"`
 }
 
 func (s *SettingResponse) MarshalJSON() ([]byte, error) {
@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strconv"
+	"time"
+	"xrf197ilz35aq0/internal/random"
+)
+
+type Action string
+
+const (
+	PermissionDeleted       Action = "PERMISSION_DELETED"
+	PermissionDeleteRefused Action = "PERMISSION_DELETE_REFUSED"
+	PermissionResource             = "permission"
+)
+
+// Entry records an action taken on a resource, who took it and when. Entries are never updated
+type Entry struct {
+	Id           string             `bson:"auditId" json:"auditId"`
+	Action       Action             `bson:"action" json:"action"`
+	ActorFp      string             `bson:"actorFp" json:"-"`
+	ResourceType string             `bson:"resourceType" json:"resourceType"`
+	ResourceId   string             `bson:"resourceId" json:"resourceId"`
+	Details      map[string]any     `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	MongoID      primitive.ObjectID `bson:"_id,omitempty" bson:"_id"` // MongoDB's ObjectID (internal)
+}
+
+func CreateEntry(action Action, actorFp string, resourceType string, resourceId string, details map[string]any) *Entry {
+	return &Entry{
+		Id:           strconv.FormatInt(random.PositiveInt64(), 10),
+		Action:       action,
+		ActorFp:      actorFp,
+		ResourceType: resourceType,
+		ResourceId:   resourceId,
+		Details:      details,
+		CreatedAt:    time.Now(),
+	}
+}
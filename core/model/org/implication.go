@@ -0,0 +1,168 @@
+package org
+
+import (
+	"slices"
+	"strings"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+// Wildcard ends an implication pattern, "ORG_*" implies every permission whose name starts with "ORG_" and "*"
+// implies every permission. A permission is never implied by its own wildcard
+const Wildcard = "*"
+
+// IsWildcard tells if an implication rule is a name pattern rather than a permission id
+func IsWildcard(rule string) bool {
+	return strings.HasSuffix(rule, Wildcard)
+}
+
+// PermissionGraph evaluates implication rules, it is built from every permission visible in an org (global and
+// org-scoped) so wildcards can be expanded
+type PermissionGraph struct {
+	permissions map[string]Permission // permissionId: permission
+	names       []string
+	byName      map[string]string // name: permissionId
+}
+
+func NewPermissionGraph(permissions []Permission) *PermissionGraph {
+	graph := &PermissionGraph{
+		permissions: make(map[string]Permission, len(permissions)),
+		byName:      make(map[string]string, len(permissions)),
+	}
+	for _, permission := range permissions {
+		graph.permissions[permission.Id] = permission
+		// org-scoped permissions shadow global ones with the same name
+		if shadowing, ok := graph.byName[permission.Name]; !ok || permission.OrgId != "" && graph.permissions[shadowing].OrgId == "" {
+			graph.byName[permission.Name] = permission.Id
+		}
+	}
+	for name := range graph.byName {
+		graph.names = append(graph.names, name)
+	}
+	slices.Sort(graph.names)
+	return graph
+}
+
+// Effective resolves the granted permission ids transitively, the result holds the granted ids first then the
+// implied ones. Unknown ids are kept as granted but imply nothing
+func (g *PermissionGraph) Effective(granted []string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(granted))
+	queue := make([]string, 0, len(granted))
+	for _, permissionId := range granted {
+		if !seen[permissionId] {
+			seen[permissionId] = true
+			result = append(result, permissionId)
+			queue = append(queue, permissionId)
+		}
+	}
+	for len(queue) > 0 {
+		permissionId := queue[0]
+		queue = queue[1:]
+		for _, implied := range g.implied(permissionId, g.permissions[permissionId].Implies) {
+			if !seen[implied] {
+				seen[implied] = true
+				result = append(result, implied)
+				queue = append(queue, implied)
+			}
+		}
+	}
+	return result
+}
+
+// Id returns the id of the permission with the name, org-scoped permissions shadow global ones
+func (g *PermissionGraph) Id(name string) (string, bool) {
+	permissionId, ok := g.byName[name]
+	return permissionId, ok
+}
+
+// Names returns the names of the permission ids, unknown ids are left out
+func (g *PermissionGraph) Names(permissionIds []string) []string {
+	result := make([]string, 0, len(permissionIds))
+	for _, permissionId := range permissionIds {
+		if permission, ok := g.permissions[permissionId]; ok {
+			result = append(result, permission.Name)
+		}
+	}
+	return result
+}
+
+// FindCycle returns the names along a cycle the rules would create if permissionId implied them, nil if there's none
+func (g *PermissionGraph) FindCycle(permissionId string, rules []string) []string {
+	var path []string
+	visiting := map[string]bool{permissionId: true}
+	done := make(map[string]bool)
+
+	var visit func(id string, rules []string) bool
+	visit = func(id string, rules []string) bool {
+		path = append(path, g.permissions[id].Name)
+		for _, next := range g.implied(id, rules) {
+			if visiting[next] {
+				path = append(path, g.permissions[next].Name)
+				return true
+			}
+			if done[next] {
+				continue
+			}
+			visiting[next] = true
+			if visit(next, g.permissions[next].Implies) {
+				return true
+			}
+			visiting[next] = false
+			done[next] = true
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if visit(permissionId, rules) {
+		// the cycle starts at the permission visited twice
+		start := slices.Index(path, path[len(path)-1])
+		return path[start:]
+	}
+	return nil
+}
+
+// implied expands the rules of a permission to permission ids
+func (g *PermissionGraph) implied(permissionId string, rules []string) []string {
+	result := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if !IsWildcard(rule) {
+			if _, ok := g.permissions[rule]; ok && rule != permissionId {
+				result = append(result, rule)
+			}
+			continue
+		}
+		prefix := strings.TrimSuffix(rule, Wildcard)
+		for _, name := range g.names {
+			if strings.HasPrefix(name, prefix) && g.byName[name] != permissionId {
+				result = append(result, g.byName[name])
+			}
+		}
+	}
+	return result
+}
+
+// ValidateImplication checks the rules a permission would have, rules are permission ids or wildcards
+func (g *PermissionGraph) ValidateImplication(permissionId string, rules []string) error {
+	externalErr := &xrfErr.External{Source: "core/model/org/implication#validateImplication"}
+	if _, ok := g.permissions[permissionId]; !ok {
+		externalErr.Message = "permission not found"
+		return externalErr
+	}
+	for _, rule := range rules {
+		if IsWildcard(rule) {
+			prefix := strings.TrimSuffix(rule, Wildcard)
+			if strings.Contains(prefix, Wildcard) || (prefix != "" && !strings.HasSuffix(prefix, "_")) {
+				externalErr.Message = "wildcards should be '*' or a name prefix ending with '_*' e.g. 'ORG_*'"
+				return externalErr
+			}
+		} else if _, ok := g.permissions[rule]; !ok {
+			externalErr.Message = "permission implies an unknown permission"
+			return externalErr
+		}
+	}
+	if cycle := g.FindCycle(permissionId, rules); cycle != nil {
+		externalErr.Message = "permission implications can't form a cycle: " + strings.Join(cycle, " -> ")
+		return externalErr
+	}
+	return nil
+}
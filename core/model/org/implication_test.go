@@ -0,0 +1,64 @@
+package org
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPermissionGraph(t *testing.T) {
+	read := Permission{Id: "1", Name: "ORG_READ"}
+	write := Permission{Id: "2", Name: "ORG_WRITE", Implies: []string{"1"}}
+	admin := Permission{Id: "3", Name: "ORG_ADMIN", Implies: []string{"2"}}
+	super := Permission{Id: "4", Name: "SUPER", Implies: []string{"ORG_*"}}
+	billing := Permission{Id: "5", Name: "BILLING_READ"}
+	graph := NewPermissionGraph([]Permission{read, write, admin, super, billing})
+
+	t.Run("resolves implications transitively", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			granted []string
+			want    []string
+		}{
+			{name: "nothing granted", granted: []string{}, want: []string{}},
+			{name: "no implications", granted: []string{"1"}, want: []string{"1"}},
+			{name: "transitive implications", granted: []string{"3"}, want: []string{"3", "2", "1"}},
+			{name: "wildcard implications", granted: []string{"4", "5"}, want: []string{"4", "5", "3", "1", "2"}},
+			{name: "unknown permissions imply nothing", granted: []string{"000"}, want: []string{"000"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.want, graph.Effective(tt.granted))
+			})
+		}
+	})
+
+	t.Run("validates implication rules", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			permissionId string
+			rules        []string
+			wantErr      bool
+		}{
+			{name: "implies an existing permission", permissionId: billing.Id, rules: []string{read.Id}},
+			{name: "implies a prefix", permissionId: billing.Id, rules: []string{"ORG_*"}},
+			{name: "own wildcard isn't a cycle", permissionId: admin.Id, rules: []string{"ORG_*"}},
+			{name: "direct cycle", permissionId: read.Id, rules: []string{write.Id}, wantErr: true},
+			{name: "transitive cycle", permissionId: read.Id, rules: []string{admin.Id}, wantErr: true},
+			{name: "cycle through a wildcard", permissionId: read.Id, rules: []string{"*"}, wantErr: true},
+			{name: "unknown permission", permissionId: read.Id, rules: []string{"000"}, wantErr: true},
+			{name: "wildcard inside a name", permissionId: billing.Id, rules: []string{"ORG*"}, wantErr: true},
+			{name: "unknown implying permission", permissionId: "000", rules: []string{}, wantErr: true},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := graph.ValidateImplication(tt.permissionId, tt.rules)
+				assert.Equal(t, tt.wantErr, err != nil, err)
+			})
+		}
+	})
+
+	t.Run("reports the cycle", func(t *testing.T) {
+		assert.Equal(t, []string{"ORG_READ", "ORG_ADMIN", "ORG_WRITE", "ORG_READ"}, graph.FindCycle(read.Id, []string{admin.Id}))
+		assert.Nil(t, graph.FindCycle(billing.Id, []string{"*"}))
+	})
+}
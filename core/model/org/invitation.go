@@ -0,0 +1,91 @@
+package org
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	"xrf197ilz35aq0/internal/random"
+)
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "PENDING"
+	InvitationAccepted InvitationStatus = "ACCEPTED"
+	InvitationRevoked  InvitationStatus = "REVOKED"
+)
+
+const invitationTokenSize = 32
+
+// Invitation lets someone that may not have an account yet join an org. Only the hash of the
+// invitation token is stored, the token itself is handed out once when the invitation is created
+type Invitation struct {
+	Id          string             `bson:"invitationId" json:"invitationId"`
+	OrgId       string             `bson:"orgId" json:"orgId"`
+	Email       string             `bson:"email" json:"email"`
+	Permissions []string           `bson:"permissions" json:"permissions"` // permission ids the invitee gets as a member
+	TokenHash   string             `bson:"tokenHash" json:"-"`
+	Status      InvitationStatus   `bson:"status" json:"status"`
+	InvitedBy   string             `bson:"invitedBy" json:"-"` // fingerprint of the owner that sent the invitation
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ExpiresAt   time.Time          `bson:"expiresAt" json:"expiresAt"`
+	MongoID     primitive.ObjectID `bson:"_id,omitempty" bson:"_id"` // MongoDB's ObjectID (internal)
+}
+
+// CreateInvitation returns the invitation and the token the invitee needs to accept it
+func CreateInvitation(orgId string, email string, permissions []string, invitedBy string, expiresAfter time.Duration) (*Invitation, string, error) {
+	externalErr := &xrfErr.External{Source: "core/model/org/invitation#createInvitation"}
+	email = NormalizeEmail(email)
+	if _, err := mail.ParseAddress(email); err != nil {
+		externalErr.Message = "invalid invitee email"
+		return nil, "", externalErr
+	}
+	if orgId == "" || invitedBy == "" {
+		externalErr.Message = "an invitation needs an org and the owner sending it"
+		return nil, "", externalErr
+	}
+	if expiresAfter <= 0 {
+		return nil, "", &xrfErr.Internal{Source: "core/model/org/invitation#createInvitation", Message: "invitations must expire"}
+	}
+
+	tokenBytes := make([]byte, invitationTokenSize)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, "", &xrfErr.Internal{Source: "core/model/org/invitation#createInvitation", Message: "failed to create invitation token", Err: err}
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	now := time.Now()
+	return &Invitation{
+		Id:          strconv.FormatInt(random.PositiveInt64(), 10),
+		OrgId:       orgId,
+		Email:       email,
+		Permissions: permissions,
+		TokenHash:   HashInvitationToken(token),
+		Status:      InvitationPending,
+		InvitedBy:   invitedBy,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		ExpiresAt:   now.Add(expiresAfter),
+	}, token, nil
+}
+
+func (i *Invitation) IsExpired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt)
+}
+
+func HashInvitationToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
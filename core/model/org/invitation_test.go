@@ -0,0 +1,50 @@
+package org
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCreateInvitation(t *testing.T) {
+	tests := []struct {
+		name         string
+		orgId        string
+		email        string
+		invitedBy    string
+		expiresAfter time.Duration
+		wantErr      bool
+	}{
+		{name: "Valid invitation", orgId: "123", email: " Invitee@XRF.com ", invitedBy: "ownerFp", expiresAfter: time.Hour, wantErr: false},
+		{name: "Invalid email", orgId: "123", email: "invitee", invitedBy: "ownerFp", expiresAfter: time.Hour, wantErr: true},
+		{name: "Missing org", orgId: "", email: "invitee@xrf.com", invitedBy: "ownerFp", expiresAfter: time.Hour, wantErr: true},
+		{name: "Missing inviter", orgId: "123", email: "invitee@xrf.com", invitedBy: "", expiresAfter: time.Hour, wantErr: true},
+		{name: "Never expires", orgId: "123", email: "invitee@xrf.com", invitedBy: "ownerFp", expiresAfter: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, token, err := CreateInvitation(tt.orgId, tt.email, []string{}, tt.invitedBy, tt.expiresAfter)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				assert.Empty(t, token)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "invitee@xrf.com", got.Email)
+				assert.Equal(t, InvitationPending, got.Status)
+				assert.NotEqual(t, token, got.TokenHash)
+				assert.Equal(t, HashInvitationToken(token), got.TokenHash)
+				assert.False(t, got.IsExpired(time.Now()))
+				assert.True(t, got.IsExpired(got.ExpiresAt))
+			}
+		})
+	}
+}
+
+func TestCreateInvitationTokensAreUnique(t *testing.T) {
+	_, first, err := CreateInvitation("123", "invitee@xrf.com", nil, "ownerFp", time.Hour)
+	assert.NoError(t, err)
+	_, second, err := CreateInvitation("123", "invitee@xrf.com", nil, "ownerFp", time.Hour)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
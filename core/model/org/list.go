@@ -0,0 +1,79 @@
+package org
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// Cursor points at the last org of a page. Orgs are listed newest first and orgs created at
+// the same time are ordered by id, so the position of an org in the list never changes
+type Cursor struct {
+	CreatedAt time.Time `json:"createdAt"`
+	OrgId     string    `json:"orgId"`
+}
+
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(encoded string) (*Cursor, error) {
+	invalidCursorErr := &xrfErr.External{Source: "core/model/org/list#decodeCursor", Message: "invalid cursor"}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalidCursorErr
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.OrgId == "" || cursor.CreatedAt.IsZero() {
+		return nil, invalidCursorErr
+	}
+	return &cursor, nil
+}
+
+func CursorOf(organization *Organization) *Cursor {
+	return &Cursor{CreatedAt: organization.CreatedAt, OrgId: organization.Id}
+}
+
+// ListFilter selects the orgs a user can see. Anonymous orgs are only visible to their members
+type ListFilter struct {
+	ViewerFp      string
+	Category      string
+	IsAnonymous   *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MemberOnly    bool // only orgs the viewer is a member of
+	After         *Cursor
+	Limit         int
+}
+
+func CreateListFilter(viewerFp string, limit int, cursor string) (*ListFilter, error) {
+	externalErr := &xrfErr.External{Source: "core/model/org/list#createListFilter"}
+	if viewerFp == "" {
+		externalErr.Message = "orgs can only be listed by a user"
+		return nil, externalErr
+	}
+	if limit < 0 || limit > MaxListLimit {
+		externalErr.Message = "limit must be between 1 and 100"
+		return nil, externalErr
+	}
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+
+	filter := &ListFilter{ViewerFp: viewerFp, Limit: limit}
+	if cursor != "" {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+	return filter, nil
+}
@@ -0,0 +1,51 @@
+package org
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := &Cursor{CreatedAt: time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC), OrgId: "123"}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	assert.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.OrgId, decoded.OrgId)
+
+	for _, invalid := range []string{"not base64!", "e30", (&Cursor{OrgId: "123"}).Encode()} {
+		_, err := DecodeCursor(invalid)
+		assert.Error(t, err)
+	}
+}
+
+func TestCreateListFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		viewerFp  string
+		limit     int
+		cursor    string
+		wantLimit int
+		wantErr   bool
+	}{
+		{name: "Default limit", viewerFp: "viewerFp", limit: 0, wantLimit: DefaultListLimit},
+		{name: "Custom limit", viewerFp: "viewerFp", limit: 5, wantLimit: 5},
+		{name: "Limit too big", viewerFp: "viewerFp", limit: MaxListLimit + 1, wantErr: true},
+		{name: "Negative limit", viewerFp: "viewerFp", limit: -1, wantErr: true},
+		{name: "Missing viewer", viewerFp: "", wantErr: true},
+		{name: "Invalid cursor", viewerFp: "viewerFp", cursor: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CreateListFilter(tt.viewerFp, tt.limit, tt.cursor)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantLimit, got.Limit)
+			}
+		})
+	}
+}
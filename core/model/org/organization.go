@@ -2,6 +2,7 @@ package org
 
 import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -13,8 +14,31 @@ var externalError *xrfErr.External
 
 type Member struct {
 	Fingerprint string   `json:"-" bson:"fingerPrint"`
-	Owner       bool     `json:"isOwner" bson:"owner"` // org can have multiple owners
-	Permissions []string `json:"permissions" bson:"permissions"`
+	Owner       bool     `json:"isOwner" bson:"owner"`           // org can have multiple owners
+	Permissions []string `json:"permissions" bson:"permissions"` // directly granted permission ids
+	Roles       []string `json:"roles" bson:"roles,omitempty"`   // role ids, each grants the role's permissions
+}
+
+// GrantedPermissions is the union of the member's direct permissions and the permissions of their roles,
+// permissions these imply are resolved by a PermissionGraph. roles may hold roles the member doesn't have, those are ignored
+func (m Member) GrantedPermissions(roles []Role) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(m.Permissions))
+	add := func(permissionIds []string) {
+		for _, permissionId := range permissionIds {
+			if !seen[permissionId] {
+				seen[permissionId] = true
+				result = append(result, permissionId)
+			}
+		}
+	}
+	add(m.Permissions)
+	for _, role := range roles {
+		if slices.Contains(m.Roles, role.Id) {
+			add(role.Permissions)
+		}
+	}
+	return result
 }
 
 type Organization struct {
@@ -25,9 +49,12 @@ type Organization struct {
 	IsAnonymous bool               `bson:"isAnonymous" json:"isAnonymous"`
 	Description string             `bson:"description" json:"description"`
 	Members     map[string]Member  `bson:"members" json:"members"`
+	MemberFps   []string           `bson:"memberFps" json:"-"` // keys of Members, indexed to find a user's orgs
 	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
 	MongoID     primitive.ObjectID `bson:"_id,omitempty" bson:"_id"` // MongoDB's ObjectID (internal)
+
+	OwnershipHistory []OwnershipChange `bson:"ownershipHistory,omitempty" json:"ownershipHistory"`
 }
 
 func CreateOrganization(name string, category string, desc string, anonymous bool, members map[string]Member) (*Organization, error) {
@@ -36,12 +63,15 @@ func CreateOrganization(name string, category string, desc string, anonymous boo
 		externalError.Message = "At least one member is required"
 		return nil, externalError
 	}
-	if len(name) < 2 || len(name) > 20 {
-		externalError.Message = "Name must be between 2 and 20 characters long"
-		return nil, externalError
+	if err := validateName(name); err != nil {
+		return nil, err
 	}
 	now := time.Now()
 	orgId := createOrgId()
+	memberFps := make([]string, 0, len(members))
+	for userFp := range members {
+		memberFps = append(memberFps, userFp)
+	}
 
 	return &Organization{
 		Id:          orgId,
@@ -50,12 +80,50 @@ func CreateOrganization(name string, category string, desc string, anonymous boo
 		Description: desc,
 		DisplayName: name,
 		Members:     members,
+		MemberFps:   memberFps,
 		Category:    category,
 		IsAnonymous: anonymous,
 		Name:        strings.ToLower(name),
 	}, nil
 }
 
+// Update holds the org fields to change, nil fields are left unchanged
+type Update struct {
+	DisplayName *string
+	Category    *string
+	Description *string
+	IsAnonymous *bool
+	UpdatedAt   time.Time
+}
+
+// Name is the unique (lowercase) name derived from the new display name
+func (u *Update) Name() string {
+	if u.DisplayName == nil {
+		return ""
+	}
+	return strings.ToLower(*u.DisplayName)
+}
+
+func CreateUpdate(displayName *string, category *string, desc *string, anonymous *bool) (*Update, error) {
+	externalError = &xrfErr.External{}
+	if displayName == nil && category == nil && desc == nil && anonymous == nil {
+		externalError.Message = "At least one field to update is required"
+		return nil, externalError
+	}
+	if displayName != nil {
+		if err := validateName(*displayName); err != nil {
+			return nil, err
+		}
+	}
+	return &Update{
+		Category:    category,
+		Description: desc,
+		IsAnonymous: anonymous,
+		DisplayName: displayName,
+		UpdatedAt:   time.Now(),
+	}, nil
+}
+
 func CreateMember(userFp string, isOwner bool, permissions []string) *Member {
 	return &Member{
 		Fingerprint: userFp,
@@ -64,6 +132,13 @@ func CreateMember(userFp string, isOwner bool, permissions []string) *Member {
 	}
 }
 
+func validateName(name string) error {
+	if len(name) < 2 || len(name) > 20 {
+		return &xrfErr.External{Message: "Name must be between 2 and 20 characters long"}
+	}
+	return nil
+}
+
 func createOrgId() string {
 	return strconv.FormatInt(random.PositiveInt64(), 10)
 }
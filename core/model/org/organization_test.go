@@ -44,3 +44,38 @@ func TestCreateOrganization(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateUpdate(t *testing.T) {
+	validName := "xrfNewName"
+	tooLongName := "xrfNameThatIsWayTooLong"
+	category := "finance"
+	anonymous := true
+
+	tests := []struct {
+		name        string
+		displayName *string
+		category    *string
+		anonymous   *bool
+		wantErr     bool
+	}{
+		{name: "Nothing to update", wantErr: true},
+		{name: "Invalid display name", displayName: &tooLongName, wantErr: true},
+		{name: "Valid display name", displayName: &validName, wantErr: false},
+		{name: "Only category and anonymity", category: &category, anonymous: &anonymous, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CreateUpdate(tt.displayName, tt.category, nil, tt.anonymous)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+			} else {
+				assert.NoError(t, err)
+				assert.False(t, got.UpdatedAt.IsZero())
+				if tt.displayName != nil {
+					assert.Equal(t, "xrfnewname", got.Name())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package org
+
+import (
+	"time"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+type OwnershipAction string
+
+const (
+	PromoteOwner  OwnershipAction = "PROMOTE"
+	DemoteOwner   OwnershipAction = "DEMOTE"
+	TransferOwner OwnershipAction = "TRANSFER" // the owner making the change hands their ownership to the member
+)
+
+// OwnershipChange records who changed a member's ownership of an org and when
+type OwnershipChange struct {
+	Action    OwnershipAction `bson:"action" json:"action"`
+	UserFp    string          `bson:"userFp" json:"-"`    // member gaining or losing ownership
+	ChangedBy string          `bson:"changedBy" json:"-"` // owner that made the change
+	ChangedAt time.Time       `bson:"changedAt" json:"changedAt"`
+}
+
+func CreateOwnershipChange(action OwnershipAction, userFp string, changedBy string) (*OwnershipChange, error) {
+	if userFp == "" || changedBy == "" {
+		return nil, &xrfErr.External{Message: "ownership change needs a member and the owner making the change"}
+	}
+	switch action {
+	case PromoteOwner, DemoteOwner:
+	case TransferOwner:
+		if userFp == changedBy {
+			return nil, &xrfErr.External{Message: "ownership can not be transferred to yourself"}
+		}
+	default:
+		return nil, &xrfErr.External{Message: "unknown ownership action"}
+	}
+	return &OwnershipChange{
+		Action:    action,
+		UserFp:    userFp,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now(),
+	}, nil
+}
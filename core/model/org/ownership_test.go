@@ -0,0 +1,38 @@
+package org
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCreateOwnershipChange(t *testing.T) {
+	tests := []struct {
+		name      string
+		action    OwnershipAction
+		userFp    string
+		changedBy string
+		wantErr   bool
+	}{
+		{name: "Promote a member", action: PromoteOwner, userFp: "memberFp", changedBy: "ownerFp", wantErr: false},
+		{name: "Demote yourself", action: DemoteOwner, userFp: "ownerFp", changedBy: "ownerFp", wantErr: false},
+		{name: "Transfer to a member", action: TransferOwner, userFp: "memberFp", changedBy: "ownerFp", wantErr: false},
+		{name: "Transfer to yourself", action: TransferOwner, userFp: "ownerFp", changedBy: "ownerFp", wantErr: true},
+		{name: "Missing member", action: PromoteOwner, userFp: "", changedBy: "ownerFp", wantErr: true},
+		{name: "Missing owner", action: PromoteOwner, userFp: "memberFp", changedBy: "", wantErr: true},
+		{name: "Unknown action", action: "RENAME", userFp: "memberFp", changedBy: "ownerFp", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CreateOwnershipChange(tt.action, tt.userFp, tt.changedBy)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.action, got.Action)
+				assert.Equal(t, tt.changedBy, got.ChangedBy)
+				assert.False(t, got.ChangedAt.IsZero())
+			}
+		})
+	}
+}
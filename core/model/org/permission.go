@@ -5,16 +5,28 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	xrfErr "xrf197ilz35aq0/internal/error"
 	"xrf197ilz35aq0/internal/random"
 )
 
+// Permissions checked before acting on an org, owners are allowed to perform every action
+const (
+	ReadPermission    = "ORG_READ"
+	WritePermission   = "ORG_WRITE"
+	MembersPermission = "ORG_MEMBERS"
+)
+
+// Permission is global unless OrgId is set, org-scoped permissions can only be granted to members of that org
+// and shadow a global permission with the same name there
 type Permission struct {
+	OrgId       string             `json:"orgId,omitempty" bson:"orgId,omitempty"`
 	Name        string             `json:"name" bson:"name"`
 	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
 	Description string             `json:"description" bson:"description"`
 	MongoID     primitive.ObjectID `bson:"_id,omitempty" bson:"_id"` // MongoDB's ObjectID (internal)
 	Id          string             `json:"permissionId" bson:"permissionId"`
+	Implies     []string           `json:"implies" bson:"implies,omitempty"` // permission ids or wildcards, see Wildcard
 }
 
 func CreatePermission(name, description string) *Permission {
@@ -29,6 +41,28 @@ func CreatePermission(name, description string) *Permission {
 	}
 }
 
+// Update changes the name and/or description of the permission, nil values are left unchanged
+func (p *Permission) Update(name *string, description *string) error {
+	if name == nil && description == nil {
+		return &xrfErr.External{Message: "nothing to update"}
+	}
+	if name != nil {
+		p.Name = strings.ToUpper(*name)
+	}
+	if description != nil {
+		p.Description = *description
+	}
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// CreateOrgPermission creates a permission scoped to the org
+func CreateOrgPermission(orgId, name, description string) *Permission {
+	permission := CreatePermission(name, description)
+	permission.OrgId = orgId
+	return permission
+}
+
 func createPermissionId() string {
 	return strconv.FormatInt(random.PositiveInt64(), 10)
 }
@@ -0,0 +1,24 @@
+package org
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPermissionUpdate(t *testing.T) {
+	name := "org_view"
+	description := "view the org"
+
+	permission := CreatePermission(ReadPermission, "read the org")
+	createdAt := permission.UpdatedAt
+	assert.Error(t, permission.Update(nil, nil))
+
+	assert.NoError(t, permission.Update(&name, nil))
+	assert.Equal(t, "ORG_VIEW", permission.Name)
+	assert.Equal(t, "read the org", permission.Description)
+
+	assert.NoError(t, permission.Update(nil, &description))
+	assert.Equal(t, "ORG_VIEW", permission.Name)
+	assert.Equal(t, description, permission.Description)
+	assert.False(t, permission.UpdatedAt.Before(createdAt))
+}
@@ -0,0 +1,36 @@
+package org
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strconv"
+	"strings"
+	"time"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	"xrf197ilz35aq0/internal/random"
+)
+
+// Role is a named bundle of permissions, members assigned a role are granted all of its permissions
+type Role struct {
+	Id          string             `json:"roleId" bson:"roleId"`
+	Name        string             `json:"name" bson:"name"`
+	Description string             `json:"description" bson:"description"`
+	Permissions []string           `json:"permissions" bson:"permissions"` // permission ids
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+	MongoID     primitive.ObjectID `bson:"_id,omitempty" bson:"_id"` // MongoDB's ObjectID (internal)
+}
+
+func CreateRole(name string, description string, permissionIds []string) (*Role, error) {
+	if len(permissionIds) == 0 {
+		return nil, &xrfErr.External{Source: "core/model/org/role#createRole", Message: "a role should grant at least one permission"}
+	}
+	now := time.Now()
+	return &Role{
+		Id:          strconv.FormatInt(random.PositiveInt64(), 10),
+		Name:        strings.ToUpper(name),
+		Description: description,
+		Permissions: permissionIds,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
@@ -0,0 +1,37 @@
+package org
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCreateRole(t *testing.T) {
+	_, err := CreateRole("org_admin", "", nil)
+	assert.Error(t, err)
+
+	role, err := CreateRole("org_admin", "administers the org", []string{"1", "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ORG_ADMIN", role.Name)
+	assert.NotEmpty(t, role.Id)
+}
+
+func TestMemberGrantedPermissions(t *testing.T) {
+	admin := Role{Id: "admin", Permissions: []string{"read", "write", "invite"}}
+	viewer := Role{Id: "viewer", Permissions: []string{"read"}}
+
+	tests := []struct {
+		name   string
+		member Member
+		want   []string
+	}{
+		{name: "direct grants only", member: Member{Permissions: []string{"read"}}, want: []string{"read"}},
+		{name: "role grants only", member: Member{Permissions: []string{}, Roles: []string{"admin"}}, want: []string{"read", "write", "invite"}},
+		{name: "union without duplicates", member: Member{Permissions: []string{"write", "delete"}, Roles: []string{"admin", "viewer"}}, want: []string{"write", "delete", "read", "invite"}},
+		{name: "ignores roles the member doesn't have", member: Member{Permissions: []string{"delete"}, Roles: []string{"viewer"}}, want: []string{"delete", "read"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.member.GrantedPermissions([]Role{admin, viewer}))
+		})
+	}
+}
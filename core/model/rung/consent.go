@@ -0,0 +1,83 @@
+package rung
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strconv"
+	"strings"
+	"time"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	"xrf197ilz35aq0/internal/random"
+)
+
+type ConsentStatus string
+
+const (
+	ConsentGiven   ConsentStatus = "GIVEN"
+	ConsentRevoked ConsentStatus = "REVOKED"
+)
+
+// ConsentMethod is how the customer agreed to their trades being captured
+type ConsentMethod string
+
+const (
+	ConsentWeb    ConsentMethod = "WEB"
+	ConsentMobile ConsentMethod = "MOBILE"
+	ConsentApi    ConsentMethod = "API"
+)
+
+var consentMethods = []ConsentMethod{ConsentWeb, ConsentMobile, ConsentApi}
+
+// Consent is a customer's (buyer) agreement to have their trades with the owner (seller) captured in the owner's rung.
+// A customer has at most one given consent per owner, revoking it keeps the record
+type Consent struct {
+	Id         string             `bson:"consentId" json:"consentId"`
+	CustomerFp string             `bson:"customerFp" json:"-"`
+	OwnerFp    string             `bson:"ownerFp" json:"-"`
+	Status     ConsentStatus      `bson:"status" json:"status"`
+	Method     ConsentMethod      `bson:"method" json:"method"`
+	UserAgent  string             `bson:"userAgent" json:"userAgent"` // client the consent was given from
+	GivenAt    time.Time          `bson:"givenAt" json:"givenAt"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	MongoID    primitive.ObjectID `bson:"_id,omitempty" bson:"_id"` // MongoDB's ObjectID (internal)
+}
+
+func (c *Consent) IsValid() bool {
+	return c.Status == ConsentGiven && c.RevokedAt == nil
+}
+
+func CreateConsent(customerFp string, ownerFp string, method string, userAgent string) (*Consent, error) {
+	externalErr := &xrfErr.External{Source: "core/model/rung/consent#createConsent"}
+	if customerFp == "" || ownerFp == "" {
+		externalErr.Message = "consent needs a customer and the owner of the rung"
+		return nil, externalErr
+	}
+	if customerFp == ownerFp {
+		externalErr.Message = "users can't consent to trades with themselves"
+		return nil, externalErr
+	}
+
+	consentMethod := ConsentMethod(strings.ToUpper(strings.TrimSpace(method)))
+	if !isConsentMethod(consentMethod) {
+		externalErr.Message = "consent method should be one of WEB, MOBILE or API"
+		return nil, externalErr
+	}
+
+	return &Consent{
+		Id:         strconv.FormatInt(random.PositiveInt64(), 10),
+		CustomerFp: customerFp,
+		OwnerFp:    ownerFp,
+		Status:     ConsentGiven,
+		Method:     consentMethod,
+		UserAgent:  userAgent,
+		GivenAt:    time.Now(),
+	}, nil
+}
+
+func isConsentMethod(method ConsentMethod) bool {
+	for _, consentMethod := range consentMethods {
+		if consentMethod == method {
+			return true
+		}
+	}
+	return false
+}
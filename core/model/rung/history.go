@@ -0,0 +1,93 @@
+package rung
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+// Snapshot is a rung's magnitude right after it changed, snapshots are only ever appended
+type Snapshot struct {
+	RungId     int64              `bson:"rungId"`
+	OwnerFp    string             `bson:"ownerFp"`
+	Magnitude  int                `bson:"magnitude"`
+	Previous   int                `bson:"previousMagnitude"`
+	RecordedAt time.Time          `bson:"recordedAt"`
+	MongoID    primitive.ObjectID `bson:"_id,omitempty" bson:"_id"` // MongoDB's ObjectID (internal)
+}
+
+func NewSnapshot(rung *Rung, previous int) *Snapshot {
+	return &Snapshot{
+		RungId:     rung.id,
+		OwnerFp:    rung.ownerFP,
+		Magnitude:  rung.magnitude,
+		Previous:   previous,
+		RecordedAt: rung.updated,
+	}
+}
+
+// Bucket is the length of time the snapshots of a timeline are downsampled to
+type Bucket string
+
+const (
+	NoBucket     Bucket = ""
+	DailyBucket  Bucket = "day"
+	WeeklyBucket Bucket = "week"
+)
+
+func ParseBucket(bucket string) (Bucket, error) {
+	switch Bucket(bucket) {
+	case NoBucket, DailyBucket, WeeklyBucket:
+		return Bucket(bucket), nil
+	default:
+		return NoBucket, &xrfErr.External{Source: "core/model/rung/history#parseBucket", Message: "bucket should be one of day or week"}
+	}
+}
+
+// start of the (UTC) bucket at is in, weeks start on monday
+func (b Bucket) start(at time.Time) time.Time {
+	at = at.UTC()
+	switch b {
+	case DailyBucket:
+		return time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	case WeeklyBucket:
+		day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+		daysSinceMonday := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -daysSinceMonday)
+	default:
+		return at
+	}
+}
+
+// TimelinePoint summarises the magnitude changes of a bucket, Magnitude is the magnitude at the end of it
+type TimelinePoint struct {
+	At        time.Time
+	Magnitude int
+	Min       int
+	Max       int
+	Changes   int
+}
+
+// Downsample turns snapshots (oldest first) into one point per bucket that had changes, NoBucket keeps every snapshot
+func Downsample(snapshots []Snapshot, bucket Bucket) []TimelinePoint {
+	points := make([]TimelinePoint, 0)
+	for _, snapshot := range snapshots {
+		at := bucket.start(snapshot.RecordedAt)
+		last := len(points) - 1
+		if bucket != NoBucket && last >= 0 && points[last].At.Equal(at) {
+			points[last].Magnitude = snapshot.Magnitude
+			points[last].Min = min(points[last].Min, snapshot.Magnitude)
+			points[last].Max = max(points[last].Max, snapshot.Magnitude)
+			points[last].Changes++
+			continue
+		}
+		points = append(points, TimelinePoint{
+			At:        at,
+			Magnitude: snapshot.Magnitude,
+			Min:       snapshot.Magnitude,
+			Max:       snapshot.Magnitude,
+			Changes:   1,
+		})
+	}
+	return points
+}
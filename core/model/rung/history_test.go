@@ -0,0 +1,76 @@
+package rung_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"xrf197ilz35aq0/core/model/rung"
+	"xrf197ilz35aq0/internal"
+)
+
+func TestDownsample(t *testing.T) {
+	// a wednesday
+	start := time.Date(2024, time.March, 6, 9, 0, 0, 0, time.UTC)
+	snapshots := []rung.Snapshot{
+		{Magnitude: 50, RecordedAt: start},
+		{Magnitude: 70, RecordedAt: start.Add(2 * time.Hour)},
+		{Magnitude: 60, RecordedAt: start.Add(3 * time.Hour)},
+		{Magnitude: 65, RecordedAt: start.Add(24 * time.Hour)},
+		{Magnitude: 40, RecordedAt: start.Add(6 * 24 * time.Hour)},
+	}
+
+	tests := []struct {
+		name     string
+		bucket   rung.Bucket
+		expected []rung.TimelinePoint
+	}{
+		{
+			name:   "no bucket keeps every change",
+			bucket: rung.NoBucket,
+			expected: []rung.TimelinePoint{
+				{At: start, Magnitude: 50, Min: 50, Max: 50, Changes: 1},
+				{At: start.Add(2 * time.Hour), Magnitude: 70, Min: 70, Max: 70, Changes: 1},
+				{At: start.Add(3 * time.Hour), Magnitude: 60, Min: 60, Max: 60, Changes: 1},
+				{At: start.Add(24 * time.Hour), Magnitude: 65, Min: 65, Max: 65, Changes: 1},
+				{At: start.Add(6 * 24 * time.Hour), Magnitude: 40, Min: 40, Max: 40, Changes: 1},
+			},
+		},
+		{
+			name:   "daily buckets end with the last change of the day",
+			bucket: rung.DailyBucket,
+			expected: []rung.TimelinePoint{
+				{At: time.Date(2024, time.March, 6, 0, 0, 0, 0, time.UTC), Magnitude: 60, Min: 50, Max: 70, Changes: 3},
+				{At: time.Date(2024, time.March, 7, 0, 0, 0, 0, time.UTC), Magnitude: 65, Min: 65, Max: 65, Changes: 1},
+				{At: time.Date(2024, time.March, 12, 0, 0, 0, 0, time.UTC), Magnitude: 40, Min: 40, Max: 40, Changes: 1},
+			},
+		},
+		{
+			name:   "weekly buckets start on monday",
+			bucket: rung.WeeklyBucket,
+			expected: []rung.TimelinePoint{
+				{At: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC), Magnitude: 65, Min: 50, Max: 70, Changes: 4},
+				{At: time.Date(2024, time.March, 11, 0, 0, 0, 0, time.UTC), Magnitude: 40, Min: 40, Max: 40, Changes: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, rung.Downsample(snapshots, tt.bucket))
+		})
+	}
+
+	t.Run("no snapshots have no points", func(t *testing.T) {
+		assert.Empty(t, rung.Downsample(nil, rung.DailyBucket))
+	})
+}
+
+func TestParseBucket(t *testing.T) {
+	for _, bucket := range []string{"", "day", "week"} {
+		parsed, err := rung.ParseBucket(bucket)
+		internal.AssertNoError(t, err)
+		assert.Equal(t, rung.Bucket(bucket), parsed)
+	}
+	_, err := rung.ParseBucket("month")
+	internal.AssertError(t, err)
+}
@@ -0,0 +1,101 @@
+package rung
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// magnitudeScale maps an average rating (scoreMin - scoreMax) onto a magnitude (0 - MaxMagnitude)
+const magnitudeScale = 10
+
+const MaxMagnitude = scoreMax * magnitudeScale
+
+// Magnitude algorithms that can be configured
+const (
+	WeightedAlgorithm = "weighted"
+	AverageAlgorithm  = "average"
+)
+
+// TrailStats is what a MagnitudeStrategy knows about one customer's trail
+type TrailStats struct {
+	Trades    int
+	Rating    float64   // decay weighted average rating of the trades
+	UpdatedAt time.Time // when the newest rating was given
+}
+
+// Scoring is how a rung's trails are scored and combined into its magnitude
+type Scoring struct {
+	Decay    Decay
+	Strategy MagnitudeStrategy
+}
+
+// MagnitudeStrategy calculates a rung's trust magnitude from the trails of all its customers
+type MagnitudeStrategy interface {
+	Magnitude(trails []TrailStats, now time.Time) int
+}
+
+// WeightedMagnitude is the weighted average of the customers' ratings. A customer counts once per trade up to
+// MaxTradeWeight and a trail counts half as much as one last rated HalfLife later, so repeat customers and those that
+// rated last matter most. The weights are relative to each other, a magnitude doesn't decay while no rating is given
+type WeightedMagnitude struct {
+	HalfLife       time.Duration // 0 weighs trails the same whenever they were last rated
+	MaxTradeWeight int           // 0 doesn't cap the trade weight
+}
+
+func (w WeightedMagnitude) Magnitude(trails []TrailStats, now time.Time) int {
+	var total, weights float64
+	for _, trail := range trails {
+		if trail.Trades == 0 {
+			continue
+		}
+		weight := float64(trail.Trades)
+		if w.MaxTradeWeight > 0 {
+			weight = min(weight, float64(w.MaxTradeWeight))
+		}
+		if w.HalfLife > 0 {
+			age := max(now.Sub(trail.UpdatedAt), 0)
+			weight *= math.Pow(0.5, float64(age)/float64(w.HalfLife))
+		}
+		total += weight * trail.Rating
+		weights += weight
+	}
+	return toMagnitude(total, weights)
+}
+
+// AverageMagnitude is the average of the customers' ratings, every customer counts the same
+type AverageMagnitude struct{}
+
+func (AverageMagnitude) Magnitude(trails []TrailStats, _ time.Time) int {
+	var total, customers float64
+	for _, trail := range trails {
+		if trail.Trades == 0 {
+			continue
+		}
+		total += trail.Rating
+		customers++
+	}
+	return toMagnitude(total, customers)
+}
+
+func toMagnitude(total, weights float64) int {
+	if weights == 0 {
+		return 0
+	}
+	return int(math.Round(total / weights * magnitudeScale))
+}
+
+// NewMagnitudeStrategy returns the strategy for the configured algorithm, WeightedAlgorithm is the default
+func NewMagnitudeStrategy(algorithm string, halfLife time.Duration, maxTradeWeight int) (MagnitudeStrategy, error) {
+	switch algorithm {
+	case WeightedAlgorithm, "":
+		if halfLife < 0 || maxTradeWeight < 0 {
+			return nil, fmt.Errorf("magnitude halfLife and maxTradeWeight can't be negative")
+		}
+		return WeightedMagnitude{HalfLife: halfLife, MaxTradeWeight: maxTradeWeight}, nil
+	case AverageAlgorithm:
+		return AverageMagnitude{}, nil
+	default:
+		return nil, fmt.Errorf("unknown magnitude algorithm '%s'", algorithm)
+	}
+}
@@ -0,0 +1,161 @@
+package rung_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"xrf197ilz35aq0/core/model/rung"
+	"xrf197ilz35aq0/internal"
+)
+
+const halfLife = 30 * 24 * time.Hour
+
+var testStrategy = rung.WeightedMagnitude{HalfLife: halfLife, MaxTradeWeight: 5}
+
+var testScoring = rung.Scoring{Decay: testDecay, Strategy: testStrategy}
+
+func TestMagnitudeGolden(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	uncapped := rung.WeightedMagnitude{HalfLife: halfLife}
+
+	tests := []struct {
+		name     string
+		strategy rung.MagnitudeStrategy
+		trails   []rung.TrailStats
+		expected int
+	}{
+		{
+			name:     "no trails",
+			strategy: testStrategy,
+			expected: 0,
+		},
+		{
+			name:     "single trade",
+			strategy: testStrategy,
+			trails:   []rung.TrailStats{{Trades: 1, Rating: 8, UpdatedAt: now}},
+			expected: 80,
+		},
+		{
+			name:     "repeat customer weighs more",
+			strategy: testStrategy,
+			trails: []rung.TrailStats{
+				{Trades: 4, Rating: 9, UpdatedAt: now},
+				{Trades: 1, Rating: 3, UpdatedAt: now},
+			},
+			expected: 78,
+		},
+		{
+			name:     "average weighs every customer the same",
+			strategy: rung.AverageMagnitude{},
+			trails: []rung.TrailStats{
+				{Trades: 4, Rating: 9, UpdatedAt: now},
+				{Trades: 1, Rating: 3, UpdatedAt: now},
+			},
+			expected: 60,
+		},
+		{
+			name:     "trade weight is capped",
+			strategy: testStrategy,
+			trails: []rung.TrailStats{
+				{Trades: 20, Rating: 10, UpdatedAt: now},
+				{Trades: 5, Rating: 4, UpdatedAt: now},
+			},
+			expected: 70,
+		},
+		{
+			name:     "trade weight is uncapped",
+			strategy: uncapped,
+			trails: []rung.TrailStats{
+				{Trades: 20, Rating: 10, UpdatedAt: now},
+				{Trades: 5, Rating: 4, UpdatedAt: now},
+			},
+			expected: 88,
+		},
+		{
+			name:     "trail one half life old counts half",
+			strategy: testStrategy,
+			trails: []rung.TrailStats{
+				{Trades: 1, Rating: 10, UpdatedAt: now.Add(-halfLife)},
+				{Trades: 1, Rating: 4, UpdatedAt: now},
+			},
+			expected: 60,
+		},
+		{
+			name:     "trail two half lives old counts a quarter",
+			strategy: testStrategy,
+			trails: []rung.TrailStats{
+				{Trades: 1, Rating: 10, UpdatedAt: now.Add(-2 * halfLife)},
+				{Trades: 1, Rating: 4, UpdatedAt: now},
+			},
+			expected: 52,
+		},
+		{
+			name:     "trail updated in the future is not boosted",
+			strategy: testStrategy,
+			trails: []rung.TrailStats{
+				{Trades: 1, Rating: 10, UpdatedAt: now.Add(time.Hour)},
+				{Trades: 1, Rating: 0, UpdatedAt: now},
+			},
+			expected: 50,
+		},
+		{
+			name:     "trails without trades are ignored",
+			strategy: testStrategy,
+			trails: []rung.TrailStats{
+				{Trades: 0, UpdatedAt: now},
+				{Trades: 1, Rating: 6, UpdatedAt: now},
+			},
+			expected: 60,
+		},
+		{
+			name:     "top rating is the max magnitude",
+			strategy: testStrategy,
+			trails:   []rung.TrailStats{{Trades: 3, Rating: 10, UpdatedAt: now.Add(-halfLife)}},
+			expected: rung.MaxMagnitude,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.strategy.Magnitude(tt.trails, now))
+		})
+	}
+}
+
+func TestMagnitudeDoesNotDecayWithoutRatings(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	trails := []rung.TrailStats{
+		{Trades: 2, Rating: 9, UpdatedAt: now.Add(-halfLife)},
+		{Trades: 1, Rating: 3, UpdatedAt: now},
+	}
+	magnitude := testStrategy.Magnitude(trails, now)
+	assert.Equal(t, magnitude, testStrategy.Magnitude(trails, now.Add(10*halfLife)))
+}
+
+func TestNewMagnitudeStrategy(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		halfLife  time.Duration
+		expected  rung.MagnitudeStrategy
+		wantErr   bool
+	}{
+		{name: "weighted is the default", halfLife: halfLife, expected: rung.WeightedMagnitude{HalfLife: halfLife, MaxTradeWeight: 5}},
+		{name: "weighted", algorithm: rung.WeightedAlgorithm, halfLife: halfLife, expected: rung.WeightedMagnitude{HalfLife: halfLife, MaxTradeWeight: 5}},
+		{name: "average", algorithm: rung.AverageAlgorithm, expected: rung.AverageMagnitude{}},
+		{name: "negative half life", algorithm: rung.WeightedAlgorithm, halfLife: -halfLife, wantErr: true},
+		{name: "unknown algorithm", algorithm: "median", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := rung.NewMagnitudeStrategy(tt.algorithm, tt.halfLife, 5)
+			if tt.wantErr {
+				internal.AssertError(t, err)
+				return
+			}
+			internal.AssertNoError(t, err)
+			assert.Equal(t, tt.expected, strategy)
+		})
+	}
+}
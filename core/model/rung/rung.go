@@ -1,6 +1,7 @@
 package rung
 
 import (
+	"go.mongodb.org/mongo-driver/bson"
 	"time"
 	"xrf197ilz35aq0/internal/random"
 )
@@ -8,29 +9,76 @@ import (
 // Rung has a 1:1 relationship with the User's table
 // there can only be one of this for a user at a time
 // it calculates the trust magnitude based off trades with other users
-// there should be consent from the buyer (User) to all them to be captured in the rung
+// trades are only captured with the buyer's (customer) Consent
 type Rung struct {
 	id          int64
-	magnitude   int
+	magnitude   int   // as of the last rating, it doesn't change until the next one
+	version     int64 // incremented on every save, concurrent updates of a stale rung are rejected
 	updated     time.Time
 	created     time.Time
 	ownerFP     string
 	tradeTrails map[string]Trail // customer: rungTrails
 }
 
-func (r *Rung) AddTradeTrail(customerFP string, tradeId string, metadata TrailMetaData) (bool, error) {
+// rungDocument is how a Rung is stored in mongo
+type rungDocument struct {
+	Id          int64            `bson:"rungId"`
+	OwnerFP     string           `bson:"ownerFp"`
+	Magnitude   int              `bson:"magnitude"`
+	Version     int64            `bson:"version"`
+	Created     time.Time        `bson:"createdAt"`
+	Updated     time.Time        `bson:"updatedAt"`
+	TradeTrails map[string]Trail `bson:"tradeTrails"`
+}
+
+func (r *Rung) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(rungDocument{
+		Id:          r.id,
+		OwnerFP:     r.ownerFP,
+		Magnitude:   r.magnitude,
+		Version:     r.version,
+		Created:     r.created,
+		Updated:     r.updated,
+		TradeTrails: r.tradeTrails,
+	})
+}
+
+func (r *Rung) UnmarshalBSON(data []byte) error {
+	var doc rungDocument
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.TradeTrails == nil {
+		doc.TradeTrails = make(map[string]Trail)
+	}
+	*r = Rung{
+		id:          doc.Id,
+		ownerFP:     doc.OwnerFP,
+		magnitude:   doc.Magnitude,
+		version:     doc.Version,
+		created:     doc.Created,
+		updated:     doc.Updated,
+		tradeTrails: doc.TradeTrails,
+	}
+	return nil
+}
+
+// AddTradeTrail records the customer's rating of a trade and recalculates the magnitude with the given scoring,
+// it returns false if the trade already had that rating
+func (r *Rung) AddTradeTrail(customerFP string, tradeId string, metadata TrailMetaData, scoring Scoring) (bool, error) {
 	tradeTrail, ok := r.tradeTrails[customerFP]
 
 	isRungTrailUpdated := false
 	if ok {
-		updated, err := tradeTrail.UpdateMetaData(tradeId, metadata)
+		updated, err := tradeTrail.UpdateMetaData(tradeId, metadata, scoring.Decay)
 		if err != nil {
 			return false, err
 		}
+		r.tradeTrails[customerFP] = tradeTrail
 		isRungTrailUpdated = updated
 	} else {
 		rungTrail := NewRungTrail()
-		_, err := rungTrail.UpdateMetaData(tradeId, metadata)
+		_, err := rungTrail.UpdateMetaData(tradeId, metadata, scoring.Decay)
 		if err != nil {
 			return false, err
 		}
@@ -39,11 +87,23 @@ func (r *Rung) AddTradeTrail(customerFP string, tradeId string, metadata TrailMe
 	}
 
 	if isRungTrailUpdated {
-		r.calculateMagnitude()
 		r.updated = time.Now()
+		r.magnitude = r.MagnitudeAt(r.updated, scoring)
 	}
 
-	return true, nil
+	return isRungTrailUpdated, nil
+}
+
+func (r *Rung) Id() int64 {
+	return r.id
+}
+
+func (r *Rung) OwnerFP() string {
+	return r.ownerFP
+}
+
+func (r *Rung) Version() int64 {
+	return r.version
 }
 
 func (r *Rung) Magnitude() int {
@@ -62,10 +122,13 @@ func (r *Rung) TradeTrails() map[string]Trail {
 	return r.tradeTrails
 }
 
-func (r *Rung) calculateMagnitude() {
-	if len(r.tradeTrails) > 0 {
-
+// MagnitudeAt recalculates the magnitude from the ratings given up to at
+func (r *Rung) MagnitudeAt(at time.Time, scoring Scoring) int {
+	trails := make([]TrailStats, 0, len(r.tradeTrails))
+	for _, trail := range r.tradeTrails {
+		trails = append(trails, trail.Stats(at, scoring.Decay))
 	}
+	return scoring.Strategy.Magnitude(trails, at)
 }
 
 func NewRung(ownerFingerprint string) *Rung {
@@ -2,7 +2,9 @@ package rung_test
 
 import (
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 	"testing"
+	"time"
 	"xrf197ilz35aq0/core/model/rung"
 )
 
@@ -25,7 +27,7 @@ func TestRungAddTradeTrail(t *testing.T) {
 		tradeId := "polly"
 		newRung := rung.NewRung(randomUserFP)
 
-		_, err := newRung.AddTradeTrail(customerFP, tradeId, validMetadataTrail)
+		_, err := newRung.AddTradeTrail(customerFP, tradeId, validMetadataTrail, testScoring)
 		assert.NoError(t, err)
 
 		if len(newRung.TradeTrails()) <= 0 {
@@ -39,9 +41,9 @@ func TestRungAddTradeTrail(t *testing.T) {
 		newRung := rung.NewRung(randomUserFP)
 		tradeId := "polly"
 
-		_, err := newRung.AddTradeTrail(customerFP, tradeId, validMetadataTrail)
+		_, err := newRung.AddTradeTrail(customerFP, tradeId, validMetadataTrail, testScoring)
 		assert.NoError(t, err)
-		_, err = newRung.AddTradeTrail(customerFP, tradeId, validMetadataTrail)
+		_, err = newRung.AddTradeTrail(customerFP, tradeId, validMetadataTrail, testScoring)
 		assert.NoError(t, err)
 
 		if len(newRung.TradeTrails()) > 1 {
@@ -49,3 +51,60 @@ func TestRungAddTradeTrail(t *testing.T) {
 		}
 	})
 }
+
+func TestRungAddTradeTrailUpdatesRating(t *testing.T) {
+	newRung := rung.NewRung("finger-printed")
+	updatedRating := rung.TrailMetaData{Rating: 7, Comment: "changed my mind"}
+
+	updated, err := newRung.AddTradeTrail("pretty-printed", "polly", validMetadataTrail, testScoring)
+	assert.NoError(t, err)
+	assert.True(t, updated)
+
+	updated, err = newRung.AddTradeTrail("pretty-printed", "polly", validMetadataTrail, testScoring)
+	assert.NoError(t, err)
+	assert.False(t, updated)
+
+	updated, err = newRung.AddTradeTrail("pretty-printed", "polly", updatedRating, testScoring)
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	trail := newRung.TradeTrails()["pretty-printed"]
+	assert.Equal(t, float64(updatedRating.Rating), trail.Score())
+	assert.Equal(t, 70, newRung.Magnitude())
+}
+
+func TestRungMagnitudeAt(t *testing.T) {
+	now := time.Now()
+	newRung := rung.NewRung("finger-printed")
+	_, err := newRung.AddTradeTrail("pretty-printed", "polly", rung.TrailMetaData{Rating: 4, RatedAt: now.Add(-48 * time.Hour)}, testScoring)
+	assert.NoError(t, err)
+	_, err = newRung.AddTradeTrail("other-printed", "molly", rung.TrailMetaData{Rating: 10, RatedAt: now}, testScoring)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, newRung.MagnitudeAt(now.Add(-72*time.Hour), testScoring))
+	assert.Equal(t, 40, newRung.MagnitudeAt(now.Add(-24*time.Hour), testScoring))
+	assert.Equal(t, newRung.Magnitude(), newRung.MagnitudeAt(newRung.Updated(), testScoring))
+}
+
+func TestRungBSON(t *testing.T) {
+	newRung := rung.NewRung("finger-printed")
+	_, err := newRung.AddTradeTrail("pretty-printed", "polly", validMetadataTrail, testScoring)
+	assert.NoError(t, err)
+
+	data, err := bson.Marshal(newRung)
+	assert.NoError(t, err)
+
+	var decoded rung.Rung
+	assert.NoError(t, bson.Unmarshal(data, &decoded))
+	assert.Equal(t, newRung.Id(), decoded.Id())
+	assert.Equal(t, newRung.OwnerFP(), decoded.OwnerFP())
+	assert.Equal(t, newRung.Version(), decoded.Version())
+	assert.Equal(t, newRung.Magnitude(), decoded.Magnitude())
+	assert.Len(t, decoded.TradeTrails(), 1)
+	trail := decoded.TradeTrails()["pretty-printed"]
+	assert.Equal(t, float64(validMetadataTrail.Rating), trail.Score())
+
+	raw := bson.Raw(data)
+	assert.Equal(t, "finger-printed", raw.Lookup("ownerFp").StringValue())
+	assert.Equal(t, int32(validMetadataTrail.Rating), raw.Lookup("tradeTrails", "pretty-printed", "trades", "polly", "rating").Int32())
+	assert.False(t, raw.Lookup("tradeTrails", "pretty-printed", "trades", "polly", "ratedAt").Time().IsZero())
+}
@@ -0,0 +1,23 @@
+package rung
+
+// Standing is where a rung's magnitude stands among a set of rungs (all of them or an org's members)
+type Standing struct {
+	Magnitude int
+	Above     int64 // rungs with a higher magnitude
+	Equal     int64 // rungs with the same magnitude, this rung included
+	Total     int64
+}
+
+// Rank is the 1-based position of the rung, rungs with the same magnitude share it
+func (s Standing) Rank() int64 {
+	return s.Above + 1
+}
+
+// Percentile is the percentage of rungs with a lower magnitude, rungs with the same magnitude count half
+func (s Standing) Percentile() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	below := s.Total - s.Above - s.Equal
+	return (float64(below) + float64(s.Equal)/2) / float64(s.Total) * 100
+}
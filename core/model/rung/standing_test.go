@@ -0,0 +1,28 @@
+package rung_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"xrf197ilz35aq0/core/model/rung"
+)
+
+func TestStanding(t *testing.T) {
+	tests := []struct {
+		name       string
+		standing   rung.Standing
+		rank       int64
+		percentile float64
+	}{
+		{name: "no rungs", standing: rung.Standing{}, rank: 1, percentile: 0},
+		{name: "only rung", standing: rung.Standing{Equal: 1, Total: 1}, rank: 1, percentile: 50},
+		{name: "top of four", standing: rung.Standing{Equal: 1, Total: 4}, rank: 1, percentile: 87.5},
+		{name: "bottom of four", standing: rung.Standing{Above: 3, Equal: 1, Total: 4}, rank: 4, percentile: 12.5},
+		{name: "ties share a rank", standing: rung.Standing{Above: 1, Equal: 2, Total: 4}, rank: 2, percentile: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.rank, tt.standing.Rank())
+			assert.InDelta(t, tt.percentile, tt.standing.Percentile(), 1e-9)
+		})
+	}
+}
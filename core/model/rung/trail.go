@@ -2,20 +2,24 @@ package rung
 
 import (
 	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"math"
 	"time"
 	error2 "xrf197ilz35aq0/internal/error"
 	"xrf197ilz35aq0/internal/random"
 )
 
 type TrailMetaData struct {
-	Rating  int
-	Comment string
+	Rating  int       `bson:"rating"`
+	Comment string    `bson:"comment"`
+	RatedAt time.Time `bson:"ratedAt"` // set to the time it's recorded if empty, re-ratings keep the first one
 }
 
 func (t *TrailMetaData) String() string {
-	return fmt.Sprintf("TrailMetaData{Rating: %d, Comment: %s}", t.Rating, t.Comment)
+	return fmt.Sprintf("TrailMetaData{Rating: %d, Comment: %s, RatedAt: %s}", t.Rating, t.Comment, t.RatedAt)
 }
 
+// IsEqual compares the rating and comment, the same rating given again isn't a new rating
 func (t *TrailMetaData) IsEqual(other TrailMetaData) bool {
 	return t.Comment == other.Comment && t.Rating == other.Rating
 }
@@ -25,18 +29,87 @@ const (
 	scoreMax = 10
 )
 
+// Decay weighs ratings by their age, a rating counts half as much as one given HalfLife later.
+// A HalfLife of 0 weighs all ratings the same
+type Decay struct {
+	HalfLife time.Duration
+}
+
+// weight of a rating given at ratedAt relative to one given at newest
+func (d Decay) weight(ratedAt, newest time.Time) float64 {
+	if d.HalfLife <= 0 {
+		return 1
+	}
+	age := max(newest.Sub(ratedAt), 0)
+	return math.Pow(0.5, float64(age)/float64(d.HalfLife))
+}
+
+func NewDecay(halfLife time.Duration) (Decay, error) {
+	if halfLife < 0 {
+		return Decay{}, fmt.Errorf("rating halfLife can't be negative")
+	}
+	return Decay{HalfLife: halfLife}, nil
+}
+
 type Trail struct {
 	id       int64
-	score    int
+	score    float64 // score as of the last update
 	created  time.Time
 	updated  time.Time
 	tradeIds map[string]TrailMetaData // a set metadata trade trails
 }
 
-func (rt *Trail) UpdateMetaData(tradeId string, metadata TrailMetaData) (bool, error) {
+// trailDocument is how a Trail is stored in mongo
+type trailDocument struct {
+	Id       int64                    `bson:"trailId"`
+	Score    float64                  `bson:"score"`
+	Created  time.Time                `bson:"createdAt"`
+	Updated  time.Time                `bson:"updatedAt"`
+	TradeIds map[string]TrailMetaData `bson:"trades"`
+}
+
+func (rt Trail) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(trailDocument{
+		Id:       rt.id,
+		Score:    rt.score,
+		Created:  rt.created,
+		Updated:  rt.updated,
+		TradeIds: rt.tradeIds,
+	})
+}
+
+func (rt *Trail) UnmarshalBSON(data []byte) error {
+	var doc trailDocument
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.TradeIds == nil {
+		doc.TradeIds = make(map[string]TrailMetaData)
+	}
+	// ratings saved before they were timestamped count as given when the trail was created
+	for tradeId, metadata := range doc.TradeIds {
+		if metadata.RatedAt.IsZero() {
+			metadata.RatedAt = doc.Created
+			doc.TradeIds[tradeId] = metadata
+		}
+	}
+	*rt = Trail{
+		id:       doc.Id,
+		score:    doc.Score,
+		created:  doc.Created,
+		updated:  doc.Updated,
+		tradeIds: doc.TradeIds,
+	}
+	return nil
+}
+
+func (rt *Trail) UpdateMetaData(tradeId string, metadata TrailMetaData, decay Decay) (bool, error) {
 	if metadata.Rating < scoreMin || metadata.Rating > scoreMax {
 		return false, &error2.External{Message: "Trail Rating out of bounds"}
 	}
+	if metadata.RatedAt.IsZero() {
+		metadata.RatedAt = time.Now()
+	}
 
 	trailMetaData, ok := rt.tradeIds[tradeId]
 	isUpdated := false
@@ -45,36 +118,66 @@ func (rt *Trail) UpdateMetaData(tradeId string, metadata TrailMetaData) (bool, e
 		rt.tradeIds[tradeId] = metadata
 		isUpdated = true
 	} else if !trailMetaData.IsEqual(metadata) {
-		trailMetaData.Rating = metadata.Rating
-		trailMetaData.Comment = metadata.Comment
+		// the trade was rated when it was first rated, past scores keep counting it
+		metadata.RatedAt = trailMetaData.RatedAt
+		rt.tradeIds[tradeId] = metadata
 		isUpdated = true
 	}
 
 	if isUpdated {
 		rt.updated = time.Now()
-		rt.calculateScore()
+		rt.score = rt.ScoreAt(rt.updated, decay)
 	}
 
 	return isUpdated, nil
 }
 
-func (rt *Trail) Score() int {
+func (rt *Trail) Score() float64 {
 	return rt.score
 }
 
+func (rt *Trail) Trades() int {
+	return len(rt.tradeIds)
+}
+
 func (rt *Trail) UpdatedAt() time.Time {
 	return rt.updated
 }
 
-func (rt *Trail) calculateScore() {
-	newScore := 0
-	if len(rt.tradeIds) > 0 {
-		for _, trailMetaData := range rt.tradeIds {
-			newScore += trailMetaData.Rating
+// ScoreAt is the decay weighted average of the ratings given up to at, so a past score can be recalculated.
+// Ratings keep the time they were first given, those changed after at are counted with their current value
+func (rt *Trail) ScoreAt(at time.Time, decay Decay) float64 {
+	return rt.Stats(at, decay).Rating
+}
+
+// Stats summarises the ratings given up to at for a MagnitudeStrategy
+func (rt *Trail) Stats(at time.Time, decay Decay) TrailStats {
+	stats := TrailStats{}
+	for _, trailMetaData := range rt.tradeIds {
+		if trailMetaData.RatedAt.After(at) {
+			continue
+		}
+		stats.Trades++
+		if trailMetaData.RatedAt.After(stats.UpdatedAt) {
+			stats.UpdatedAt = trailMetaData.RatedAt
+		}
+	}
+	if stats.Trades == 0 {
+		return stats
+	}
+
+	// weights are relative to the newest rating, older ones would otherwise underflow to 0
+	var total, weights float64
+	for _, trailMetaData := range rt.tradeIds {
+		if trailMetaData.RatedAt.After(at) {
+			continue
 		}
+		weight := decay.weight(trailMetaData.RatedAt, stats.UpdatedAt)
+		total += weight * float64(trailMetaData.Rating)
+		weights += weight
 	}
-	// average of the score
-	rt.score = newScore / len(rt.tradeIds)
+	stats.Rating = total / weights
+	return stats
 }
 
 func NewRungTrail() *Trail {
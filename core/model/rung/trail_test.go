@@ -1,8 +1,10 @@
 package rung_test
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 	"xrf197ilz35aq0/core/model/rung"
 	"xrf197ilz35aq0/internal"
 )
@@ -19,6 +21,8 @@ var maxRatingMetadataTrail = rung.TrailMetaData{
 
 var tradeId = "someId"
 
+var testDecay = rung.Decay{HalfLife: 365 * 24 * time.Hour}
+
 func TestNewRungTrail(t *testing.T) {
 	t.Run("should return a new RungTrail struct", func(t *testing.T) {
 		trail := rung.NewRungTrail()
@@ -29,33 +33,124 @@ func TestNewRungTrail(t *testing.T) {
 func TestRungTrailUpdateMetaData(t *testing.T) {
 	t.Run("should update the metadata", func(t *testing.T) {
 		trail := rung.NewRungTrail()
-		updated, err := trail.UpdateMetaData(tradeId, validMetadataTrail)
+		updated, err := trail.UpdateMetaData(tradeId, validMetadataTrail, testDecay)
 		internal.AssertNoError(t, err)
 		assert.True(t, updated)
 	})
 
 	t.Run("should return an error if rating is out of bound", func(t *testing.T) {
 		trail := rung.NewRungTrail()
-		_, err := trail.UpdateMetaData(tradeId, maxRatingMetadataTrail)
+		_, err := trail.UpdateMetaData(tradeId, maxRatingMetadataTrail, testDecay)
 		internal.AssertError(t, err)
 	})
 
 	t.Run("should return not update if trail exists", func(t *testing.T) {
 		trail := rung.NewRungTrail()
-		_, err := trail.UpdateMetaData(tradeId, maxRatingMetadataTrail)
+		_, err := trail.UpdateMetaData(tradeId, maxRatingMetadataTrail, testDecay)
 		internal.AssertError(t, err)
 		firstUpdatedAt := trail.UpdatedAt()
 
-		updated, err := trail.UpdateMetaData(tradeId, maxRatingMetadataTrail)
+		updated, err := trail.UpdateMetaData(tradeId, maxRatingMetadataTrail, testDecay)
 		internal.AssertError(t, err)
 		assert.False(t, updated)
 		assert.Equal(t, trail.UpdatedAt(), firstUpdatedAt)
 	})
 }
 
-func assertExpectedTrailScore(t testing.TB, r rung.Trail, expectedScore int) {
+func TestTrailScoreDecay(t *testing.T) {
+	now := time.Now()
+	year := testDecay.HalfLife
+
+	tests := []struct {
+		name     string
+		decay    rung.Decay
+		ratings  []rung.TrailMetaData
+		expected float64
+	}{
+		{
+			name:     "average isn't truncated",
+			decay:    testDecay,
+			ratings:  []rung.TrailMetaData{{Rating: 7, RatedAt: now}, {Rating: 8, RatedAt: now}},
+			expected: 7.5,
+		},
+		{
+			name:     "rating a half life older counts half",
+			decay:    testDecay,
+			ratings:  []rung.TrailMetaData{{Rating: 1, RatedAt: now.Add(-year)}, {Rating: 10, RatedAt: now}},
+			expected: 7,
+		},
+		{
+			name:     "five year old rating barely counts",
+			decay:    testDecay,
+			ratings:  []rung.TrailMetaData{{Rating: 0, RatedAt: now.Add(-5 * year)}, {Rating: 10, RatedAt: now}},
+			expected: 10 / (1 + 1.0/32),
+		},
+		{
+			name:     "no decay weighs ratings the same",
+			decay:    rung.Decay{},
+			ratings:  []rung.TrailMetaData{{Rating: 0, RatedAt: now.Add(-5 * year)}, {Rating: 10, RatedAt: now}},
+			expected: 5,
+		},
+		{
+			name:     "ratings of the same age weigh the same",
+			decay:    testDecay,
+			ratings:  []rung.TrailMetaData{{Rating: 2, RatedAt: now.Add(-50 * year)}, {Rating: 4, RatedAt: now.Add(-50 * year)}},
+			expected: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trail := rung.NewRungTrail()
+			for i, rating := range tt.ratings {
+				_, err := trail.UpdateMetaData(fmt.Sprintf("trade-%d", i), rating, tt.decay)
+				internal.AssertNoError(t, err)
+			}
+			assert.InDelta(t, tt.expected, trail.Score(), 1e-9)
+		})
+	}
+}
+
+func TestTrailScoreAt(t *testing.T) {
+	now := time.Now()
+	trail := rung.NewRungTrail()
+	_, err := trail.UpdateMetaData("first", rung.TrailMetaData{Rating: 2, RatedAt: now.Add(-48 * time.Hour)}, testDecay)
+	internal.AssertNoError(t, err)
+	_, err = trail.UpdateMetaData("second", rung.TrailMetaData{Rating: 9, RatedAt: now}, testDecay)
+	internal.AssertNoError(t, err)
+
+	assert.Equal(t, 0.0, trail.ScoreAt(now.Add(-72*time.Hour), testDecay))
+	assert.Equal(t, 2.0, trail.ScoreAt(now.Add(-24*time.Hour), testDecay))
+	assert.Equal(t, trail.Score(), trail.ScoreAt(now, testDecay))
+
+	stats := trail.Stats(now.Add(-24*time.Hour), testDecay)
+	assert.Equal(t, 1, stats.Trades)
+	assert.Equal(t, now.Add(-48*time.Hour), stats.UpdatedAt)
+
+	t.Run("re-rated trades are counted with their current value since their first rating", func(t *testing.T) {
+		updated, err := trail.UpdateMetaData("first", rung.TrailMetaData{Rating: 6}, testDecay)
+		internal.AssertNoError(t, err)
+		assert.True(t, updated)
+
+		assert.Equal(t, 6.0, trail.ScoreAt(now.Add(-24*time.Hour), testDecay))
+		stats := trail.Stats(now.Add(-24*time.Hour), testDecay)
+		assert.Equal(t, 1, stats.Trades)
+		assert.Equal(t, now.Add(-48*time.Hour), stats.UpdatedAt)
+	})
+}
+
+func TestNewDecay(t *testing.T) {
+	decay, err := rung.NewDecay(time.Hour)
+	internal.AssertNoError(t, err)
+	assert.Equal(t, rung.Decay{HalfLife: time.Hour}, decay)
+
+	_, err = rung.NewDecay(-time.Hour)
+	internal.AssertError(t, err)
+}
+
+func assertExpectedTrailScore(t testing.TB, r rung.Trail, expectedScore float64) {
 	t.Helper()
 	if r.Score() != expectedScore {
-		t.Errorf("r.Score() = %d, want %d", r.Score(), expectedScore)
+		t.Errorf("r.Score() = %f, want %f", r.Score(), expectedScore)
 	}
 }
@@ -0,0 +1,72 @@
+package user
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WrappedDataKey is an earlier version of a user's data key, wrapped with the key-encryption key. It's kept
+// after a rotation until everything encrypted with it has been re-encrypted with the current version
+type WrappedDataKey struct {
+	Version    int       `bson:"version"`
+	WrappedKey string    `bson:"wrappedKey"`
+	RetiredAt  time.Time `bson:"retiredAt"`
+}
+
+// RotationLease is held by the instance rotating a user's key, an expired lease can be taken over by another one
+type RotationLease struct {
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// Keyring holds the unwrapped versions of a user's data key, it should only live as long as it's used
+type Keyring struct {
+	current int
+	keys    map[int][]byte // version: data key
+}
+
+func NewKeyring(current int, keys map[int][]byte) *Keyring {
+	return &Keyring{current: current, keys: keys}
+}
+
+// Current returns the version and key new data should be encrypted with
+func (k *Keyring) Current() (int, []byte) {
+	return k.current, k.keys[k.current]
+}
+
+func (k *Keyring) Key(version int) ([]byte, bool) {
+	key, ok := k.keys[version]
+	return key, ok
+}
+
+// Previous returns the versions older than the current one, oldest first
+func (k *Keyring) Previous() []int {
+	versions := make([]int, 0, len(k.keys))
+	for version := range k.keys {
+		if version != k.current {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// KeyId names a version of the data key in the envelopes encrypted with it
+func KeyId(version int) string {
+	return "v" + strconv.Itoa(version)
+}
+
+// Lookup finds a version of the data key by its KeyId, see encryption.DecryptWithLookup
+func (k *Keyring) Lookup(keyId string) ([]byte, bool) {
+	versionStr, ok := strings.CutPrefix(keyId, "v")
+	if !ok {
+		return nil, false
+	}
+	version, err := strconv.Atoi(versionStr)
+	if err != nil {
+		return nil, false
+	}
+	return k.Key(version)
+}
@@ -7,6 +7,9 @@ import (
 	xrfErr "xrf197ilz35aq0/internal/error"
 )
 
+// minRotationPeriod keeps keys of settings with an invalid rotation period from being rotated on every run
+const minRotationPeriod = 90 * 24 * time.Hour
+
 const (
 	defaultArgonTime    = 2
 	defaultArgonThreads = 5
@@ -23,8 +26,17 @@ type Settings struct {
 	EncryptAfter    time.Duration `bson:"encryptAfter"`
 	UserFingerprint string        `bson:"fingerPrint"`
 	LastModified    time.Time     `bson:"lastModified"`
-	EncryptionKey   string        `bson:"encryptionKey"`
-	UserKey         bool          `bson:"isUserKey"`
+	// the user's data key wrapped (encrypted) with the key-encryption key, see encryption.WrapKey
+	WrappedKey string `bson:"wrappedKey"`
+	KeyVersion int    `bson:"keyVersion"`
+	// earlier versions of the data key that data might still be encrypted with
+	PreviousKeys        []WrappedDataKey `bson:"previousKeys,omitempty"`
+	PendingReEncryption bool             `bson:"pendingReEncryption"`
+	RotateAt            time.Time        `bson:"rotateAt,omitempty"`
+	RotationLease       *RotationLease   `bson:"rotationLease,omitempty"`
+	// plaintext data key of settings saved before keys were wrapped, it's wrapped and removed on first use
+	LegacyKey string `bson:"encryptionKey,omitempty"`
+	UserKey   bool   `bson:"isUserKey"`
 
 	// Argon2 parameters
 	Time    uint8  `bson:"argon2Time"`
@@ -52,38 +64,71 @@ func (s *Settings) MarshalJSON() ([]byte, error) {
 		CreatedAt           time.Time     `json:"createdAt"`
 		EncryptAfter        time.Duration `json:"encryptAfter"`
 		LastModified        time.Time     `json:"lastModified"`
-		EncryptionKey       string        `json:"encryptionKey"`
 		UserKey             bool          `json:"userKey"`
 	}{
 		RotateEncryptionKey: s.RotateEncryptionKey,
 		CreatedAt:           s.CreatedAt,
 		EncryptAfter:        s.EncryptAfter,
 		LastModified:        s.LastModified,
-		EncryptionKey:       s.EncryptionKey,
 		UserKey:             s.UserKey,
 	})
 }
 
-func (s *Settings) Key() string {
-	return s.EncryptionKey
+func (s *Settings) IsRotationDue(now time.Time) bool {
+	return s.RotateEncryptionKey && !s.DueAt().After(now)
+}
+
+// DueAt is when the key should be rotated, settings saved before rotations were scheduled have no RotateAt and are
+// due EncryptAfter after they were created
+func (s *Settings) DueAt() time.Time {
+	if s.RotateAt.IsZero() {
+		return s.CreatedAt.Add(s.EncryptAfter)
+	}
+	return s.RotateAt
+}
+
+// NextRotation is when the key rotated at from should be rotated again
+func (s *Settings) NextRotation(from time.Time) time.Time {
+	return from.Add(max(s.EncryptAfter, minRotationPeriod))
 }
 
-func NewSettings(rotateEncKey bool, encryptAfter time.Duration, userFP, encryptionKey string) *Settings {
+// Rotate makes wrappedKey the current data key, the replaced one is kept until data is re-encrypted
+func (s *Settings) Rotate(wrappedKey string, now time.Time) {
+	if s.WrappedKey != "" {
+		s.PreviousKeys = append(s.PreviousKeys, WrappedDataKey{
+			Version:    s.KeyVersion,
+			WrappedKey: s.WrappedKey,
+			RetiredAt:  now,
+		})
+	}
+	s.WrappedKey = wrappedKey
+	s.KeyVersion++
+	s.PendingReEncryption = true
+	s.RotateAt = s.NextRotation(now)
+	s.LastModified = now
+}
+
+func NewSettings(rotateEncKey bool, encryptAfter time.Duration, userFP, wrappedKey string) *Settings {
 	now := time.Now()
 
 	threadsCount := uint8(runtime.NumCPU())
 	if threadsCount == 0 {
 		threadsCount = defaultArgonThreads
 	}
-	return &Settings{
+	settings := &Settings{
 		CreatedAt:           now,
 		LastModified:        now,
 		UserFingerprint:     userFP,
 		EncryptAfter:        encryptAfter,
 		RotateEncryptionKey: rotateEncKey,
-		EncryptionKey:       encryptionKey,
+		WrappedKey:          wrappedKey,
+		KeyVersion:          1,
 		Threads:             threadsCount,
 		Time:                defaultArgonTime,
 		Memory:              defaultArgonMemory,
 	}
+	if rotateEncKey {
+		settings.RotateAt = now.Add(encryptAfter)
+	}
+	return settings
 }
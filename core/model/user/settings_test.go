@@ -15,3 +15,54 @@ func TestNewSettings(t *testing.T) {
 		assert.NotNil(t, settings)
 	})
 }
+
+func TestSettingsRotate(t *testing.T) {
+	now := time.Date(2024, 3, 4, 2, 0, 0, 0, time.UTC)
+	settings := NewSettings(true, 120*24*time.Hour, "user-fingerprint", "wrapped-v1")
+	settings.RotateAt = now.Add(-time.Minute)
+	assert.True(t, settings.IsRotationDue(now))
+
+	settings.Rotate("wrapped-v2", now)
+	assert.False(t, settings.IsRotationDue(now))
+	assert.Equal(t, "wrapped-v2", settings.WrappedKey)
+	assert.Equal(t, 2, settings.KeyVersion)
+	assert.True(t, settings.PendingReEncryption)
+	assert.Equal(t, []WrappedDataKey{{Version: 1, WrappedKey: "wrapped-v1", RetiredAt: now}}, settings.PreviousKeys)
+	assert.Equal(t, now.Add(120*24*time.Hour), settings.RotateAt)
+
+	t.Run("invalid rotation periods wait the minimum period", func(t *testing.T) {
+		legacy := &Settings{RotateEncryptionKey: true, EncryptAfter: -time.Hour}
+		assert.Equal(t, now.Add(minRotationPeriod), legacy.NextRotation(now))
+	})
+	t.Run("settings saved before rotations were scheduled are due encryptAfter after they were created", func(t *testing.T) {
+		legacy := &Settings{RotateEncryptionKey: true, CreatedAt: now.Add(-2 * time.Hour), EncryptAfter: time.Hour}
+		assert.Equal(t, now.Add(-time.Hour), legacy.DueAt())
+		assert.True(t, legacy.IsRotationDue(now))
+
+		legacy.EncryptAfter = 3 * time.Hour
+		assert.False(t, legacy.IsRotationDue(now))
+	})
+	t.Run("keys aren't due when rotation is off", func(t *testing.T) {
+		off := NewSettings(false, 0, "user-fingerprint", "wrapped-v1")
+		off.RotateAt = now.Add(-time.Minute)
+		assert.False(t, off.IsRotationDue(now))
+	})
+}
+
+func TestKeyring(t *testing.T) {
+	keyring := NewKeyring(3, map[int][]byte{1: []byte("v1"), 3: []byte("v3"), 2: []byte("v2")})
+	version, key := keyring.Current()
+	assert.Equal(t, 3, version)
+	assert.Equal(t, []byte("v3"), key)
+	assert.Equal(t, []int{1, 2}, keyring.Previous())
+	_, ok := keyring.Key(4)
+	assert.False(t, ok)
+
+	key, ok = keyring.Lookup(KeyId(2))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v2"), key)
+	for _, keyId := range []string{"", "2", "v", "v4", "x2"} {
+		_, ok = keyring.Lookup(keyId)
+		assert.False(t, ok, keyId)
+	}
+}
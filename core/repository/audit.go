@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+	"xrf197ilz35aq0/core/model/audit"
+	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+type AuditRepository interface {
+	Record(entry *audit.Entry, ctx context.Context) error
+}
+
+type auditRepo struct {
+	db  *mongo.Database
+	log internal.Logger
+}
+
+// Record saves the entry, pass a mongo.SessionContext as ctx to record it as part of a transaction
+func (repo *auditRepo) Record(entry *audit.Entry, ctx context.Context) error {
+	return recordAudit(repo.db, entry, ctx)
+}
+
+func recordAudit(db *mongo.Database, entry *audit.Entry, ctx context.Context) error {
+	_, err := db.Collection(constants.AuditCollection).InsertOne(ctx, entry)
+	if err != nil {
+		return &xrfErr.Internal{Source: "core/repository/audit#record", Message: "Recording audit entry failed", Err: err}
+	}
+	return nil
+}
+
+func NewAuditRepository(db *mongo.Database, log internal.Logger) (AuditRepository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the history of a resource, newest first
+	err := createIndex(db, log, ctx, constants.AuditCollection, mongo.IndexModel{
+		Keys: bson.D{{Key: constants.ResourceType, Value: 1}, {Key: constants.ResourceId, Value: 1}, {Key: constants.CreatedAt, Value: -1}},
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createAuditIndex :: field='resourceType,resourceId,createdAt' :: err=%s", err))
+		return nil, err
+	}
+	return &auditRepo{db: db, log: log}, nil
+}
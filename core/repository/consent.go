@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"xrf197ilz35aq0/core/model/rung"
+	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+type ConsentRepository interface {
+	CreateConsent(consent *rung.Consent, ctx context.Context) (string, error)
+	// FindGivenConsent returns nil if the customer hasn't given (or has revoked) consent for the owner's rung
+	FindGivenConsent(customerFp string, ownerFp string, ctx context.Context) (*rung.Consent, error)
+	RevokeConsent(customerFp string, ownerFp string, ctx context.Context) error
+}
+
+type consentRepo struct {
+	db  *mongo.Database
+	log internal.Logger
+}
+
+func (repo *consentRepo) CreateConsent(consent *rung.Consent, ctx context.Context) (string, error) {
+	_, err := repo.db.Collection(constants.ConsentCol).InsertOne(ctx, consent)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return "", &xrfErr.External{Source: "core/repository/consent#createConsent", Message: "consent was already given"}
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=saveConsent :: err=%s", err))
+		return "", &xrfErr.Internal{Source: "core/repository/consent#createConsent", Message: "Creating consent failed", Err: err}
+	}
+	repo.log.Debug(fmt.Sprintf("event=saveConsent :: success=true :: consentId=%s", consent.Id))
+	return consent.Id, nil
+}
+
+func (repo *consentRepo) FindGivenConsent(customerFp string, ownerFp string, ctx context.Context) (*rung.Consent, error) {
+	filter := bson.M{constants.CustomerFp: customerFp, constants.OwnerFp: ownerFp, constants.Status: rung.ConsentGiven}
+
+	var consent rung.Consent
+	err := repo.db.Collection(constants.ConsentCol).FindOne(ctx, filter).Decode(&consent)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findGivenConsent :: ownerFp=%s :: err=%s", ownerFp, err))
+		return nil, &xrfErr.Internal{Source: "core/repository/consent#findGivenConsent", Message: "Failed to find consent", Err: err}
+	}
+	return &consent, nil
+}
+
+func (repo *consentRepo) RevokeConsent(customerFp string, ownerFp string, ctx context.Context) error {
+	filter := bson.M{constants.CustomerFp: customerFp, constants.OwnerFp: ownerFp, constants.Status: rung.ConsentGiven}
+	update := bson.M{"$set": bson.M{constants.Status: rung.ConsentRevoked, constants.RevokedAt: time.Now()}}
+
+	resp, err := repo.db.Collection(constants.ConsentCol).UpdateOne(ctx, filter, update)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=revokeConsent :: ownerFp=%s :: err=%s", ownerFp, err))
+		return &xrfErr.Internal{Source: "core/repository/consent#revokeConsent", Message: "Revoking consent failed", Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		return &xrfErr.External{Source: "core/repository/consent#revokeConsent", Message: constants.NotFoundConsentErrMsg}
+	}
+	return nil
+}
+
+func NewConsentRepository(db *mongo.Database, log internal.Logger) (ConsentRepository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// a customer can only have one given consent per rung owner, revoked ones are kept as a record
+	err := createIndex(db, log, ctx, constants.ConsentCol, mongo.IndexModel{
+		Keys: bson.D{{Key: constants.CustomerFp, Value: 1}, {Key: constants.OwnerFp, Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{constants.Status: rung.ConsentGiven}),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createConsentIndex :: field='customerFp,ownerFp' :: err=%s", err))
+		return nil, err
+	}
+	return &consentRepo{db: db, log: log}, nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -16,6 +17,12 @@ const (
 	Unique = "unique"
 )
 
+// mongo server error codes
+const (
+	namespaceNotFound = 26
+	indexNotFound     = 27
+)
+
 func createUniqueIndex(db *mongo.Database, log internal.Logger, ctx context.Context, colName, indexName string) error {
 	if err := validateDBCollection(colName); err != nil {
 		return err
@@ -88,6 +95,45 @@ func createUniqueIndex(db *mongo.Database, log internal.Logger, ctx context.Cont
 	return nil
 }
 
+// createIndex creates indexes that aren't a single unique field e.g. TTL or partial indexes.
+// Creating an index that already exists with the same options is a no-op in mongo
+func createIndex(db *mongo.Database, log internal.Logger, ctx context.Context, colName string, indexModel mongo.IndexModel) error {
+	if err := validateDBCollection(colName); err != nil {
+		return err
+	}
+	name, err := db.Collection(colName).Indexes().CreateOne(ctx, indexModel)
+	if err != nil {
+		return &xrfErr.Internal{
+			Err:     err,
+			Message: "Failed to create index",
+			Source:  "core/repository#createIndex",
+		}
+	}
+	log.Debug(fmt.Sprintf("Index '%s' exists in collection '%s'", name, colName))
+	return nil
+}
+
+// dropIndex drops the named index, indexes (or collections) that don't exist are ignored
+func dropIndex(db *mongo.Database, log internal.Logger, ctx context.Context, colName string, indexName string) error {
+	if err := validateDBCollection(colName); err != nil {
+		return err
+	}
+	_, err := db.Collection(colName).Indexes().DropOne(ctx, indexName)
+	var commandErr mongo.CommandError
+	if err != nil && errors.As(err, &commandErr) && (commandErr.Code == indexNotFound || commandErr.Code == namespaceNotFound) {
+		return nil
+	}
+	if err != nil {
+		return &xrfErr.Internal{
+			Err:     err,
+			Message: "Failed to drop index",
+			Source:  "core/repository#dropIndex",
+		}
+	}
+	log.Info(fmt.Sprintf("Index '%s' dropped from collection '%s'", indexName, colName))
+	return nil
+}
+
 func validateDBCollection(collectionName string) error {
 	notInList := true
 	for _, collection := range constants.AllCollections {
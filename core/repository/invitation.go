@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+type InvitationRepository interface {
+	CreateInvitation(invitation *org.Invitation, ctx context.Context) (string, error)
+	FindPendingInvitations(orgId string, ctx context.Context) ([]org.Invitation, error)
+	RevokeInvitation(orgId string, invitationId string, ctx context.Context) error
+	ClaimInvitation(tokenHash string, email string, ctx context.Context) (*org.Invitation, error)
+	ReleaseInvitation(invitationId string, ctx context.Context) error
+}
+
+type invitationRepo struct {
+	db  *mongo.Database
+	log internal.Logger
+}
+
+func (repo *invitationRepo) CreateInvitation(invitation *org.Invitation, ctx context.Context) (string, error) {
+	_, err := repo.db.Collection(constants.InvitationCol).InsertOne(ctx, invitation)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return "", &xrfErr.External{
+				Source:  "core/repository/invitation#createInvitation",
+				Message: fmt.Sprintf("'%s' already has a pending invitation to this org", invitation.Email),
+			}
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=saveInvitation :: orgId=%s :: err=%s", invitation.OrgId, err))
+		return "", &xrfErr.Internal{Source: "core/repository/invitation#createInvitation", Message: "Creating invitation failed", Err: err}
+	}
+	repo.log.Debug(fmt.Sprintf("event=saveInvitation :: success=true :: orgId=%s :: invitationId=%s", invitation.OrgId, invitation.Id))
+	return invitation.Id, nil
+}
+
+func (repo *invitationRepo) FindPendingInvitations(orgId string, ctx context.Context) ([]org.Invitation, error) {
+	internalErr := &xrfErr.Internal{Source: "core/repository/invitation#findPendingInvitations"}
+	filter := bson.M{
+		constants.OrgId:     orgId,
+		constants.Status:    org.InvitationPending,
+		constants.ExpiresAt: bson.M{"$gt": time.Now()},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: constants.CreatedAt, Value: -1}})
+
+	cursor, err := repo.db.Collection(constants.InvitationCol).Find(ctx, filter, opts)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findPendingInvitations :: orgId=%s :: err=%s", orgId, err))
+		internalErr.Err = err
+		internalErr.Message = "Error finding org invitations"
+		return nil, internalErr
+	}
+
+	invitations := make([]org.Invitation, 0)
+	if err := cursor.All(ctx, &invitations); err != nil {
+		internalErr.Err = err
+		internalErr.Message = "Failed to decode invitations"
+		return nil, internalErr
+	}
+	return invitations, nil
+}
+
+func (repo *invitationRepo) RevokeInvitation(orgId string, invitationId string, ctx context.Context) error {
+	filter := bson.M{constants.OrgId: orgId, constants.InvitationId: invitationId, constants.Status: org.InvitationPending}
+	update := bson.M{"$set": bson.M{constants.Status: org.InvitationRevoked, constants.UpdatedAt: time.Now()}}
+
+	resp, err := repo.db.Collection(constants.InvitationCol).UpdateOne(ctx, filter, update)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=revokeInvitation :: invitationId=%s :: err=%s", invitationId, err))
+		return &xrfErr.Internal{Source: "core/repository/invitation#revokeInvitation", Message: "Revoking invitation failed", Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		return &xrfErr.External{Source: "core/repository/invitation#revokeInvitation", Message: constants.NotFoundInvitationErrMsg}
+	}
+	return nil
+}
+
+// ClaimInvitation marks the pending invitation as accepted and returns it. The status change is the
+// update's filter, so an invitation token can only be used once even when it's accepted concurrently
+func (repo *invitationRepo) ClaimInvitation(tokenHash string, email string, ctx context.Context) (*org.Invitation, error) {
+	now := time.Now()
+	filter := bson.M{
+		constants.TokenHash: tokenHash,
+		constants.EMAIL:     email,
+		constants.Status:    org.InvitationPending,
+		constants.ExpiresAt: bson.M{"$gt": now}, // the TTL monitor only deletes expired invitations every minute
+	}
+	update := bson.M{"$set": bson.M{constants.Status: org.InvitationAccepted, constants.UpdatedAt: now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var invitation org.Invitation
+	err := repo.db.Collection(constants.InvitationCol).FindOneAndUpdate(ctx, filter, update, opts).Decode(&invitation)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &xrfErr.External{Source: "core/repository/invitation#claimInvitation", Message: constants.NotFoundInvitationErrMsg}
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=claimInvitation :: err=%s", err))
+		return nil, &xrfErr.Internal{Source: "core/repository/invitation#claimInvitation", Message: "Claiming invitation failed", Err: err}
+	}
+	return &invitation, nil
+}
+
+// ReleaseInvitation puts back a claimed invitation that could not be turned into a membership
+func (repo *invitationRepo) ReleaseInvitation(invitationId string, ctx context.Context) error {
+	filter := bson.M{constants.InvitationId: invitationId, constants.Status: org.InvitationAccepted}
+	update := bson.M{"$set": bson.M{constants.Status: org.InvitationPending, constants.UpdatedAt: time.Now()}}
+
+	_, err := repo.db.Collection(constants.InvitationCol).UpdateOne(ctx, filter, update)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=releaseInvitation :: invitationId=%s :: err=%s", invitationId, err))
+		return &xrfErr.Internal{Source: "core/repository/invitation#releaseInvitation", Message: "Releasing invitation failed", Err: err}
+	}
+	return nil
+}
+
+func NewInvitationRepository(db *mongo.Database, log internal.Logger) (InvitationRepository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := createIndex(db, log, ctx, constants.InvitationCol, mongo.IndexModel{
+		Keys:    bson.D{{Key: constants.InvitationId, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createInvitationIndex :: field='invitationId' :: err=%s", err))
+		return nil, err
+	}
+	err = createIndex(db, log, ctx, constants.InvitationCol, mongo.IndexModel{
+		Keys:    bson.D{{Key: constants.TokenHash, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createInvitationIndex :: field='tokenHash' :: err=%s", err))
+		return nil, err
+	}
+
+	// mongo deletes invitations once they expire
+	err = createIndex(db, log, ctx, constants.InvitationCol, mongo.IndexModel{
+		Keys:    bson.D{{Key: constants.ExpiresAt, Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createInvitationIndex :: field='expiresAt' :: err=%s", err))
+		return nil, err
+	}
+
+	// an email can only have one pending invitation per org
+	err = createIndex(db, log, ctx, constants.InvitationCol, mongo.IndexModel{
+		Keys: bson.D{{Key: constants.OrgId, Value: 1}, {Key: constants.EMAIL, Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{constants.Status: org.InvitationPending}),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createInvitationIndex :: field='orgId,email' :: err=%s", err))
+		return nil, err
+	}
+	return &invitationRepo{db: db, log: log}, nil
+}
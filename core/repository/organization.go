@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
 	"xrf197ilz35aq0/core/model/org"
 	"xrf197ilz35aq0/internal"
@@ -16,6 +17,16 @@ import (
 type OrganizationRepository interface {
 	Create(organization *org.Organization, ctx context.Context) (string, error)
 	GetOrgById(id string, ctx context.Context) (*org.Organization, error)
+	FindOrgMember(orgId string, userFp string, ctx context.Context) (*org.Member, error)
+	UpdateOrg(orgId string, update *org.Update, ctx context.Context) (*org.Organization, error)
+	AddMembers(orgId string, members []org.Member, ctx context.Context) error
+	RemoveMember(orgId string, userFp string, ctx context.Context) error
+	SetMemberPermissions(orgId string, userFp string, permissionIds []string, ctx context.Context) error
+	SetMemberRoles(orgId string, userFp string, roleIds []string, ctx context.Context) error
+	ChangeOwnership(orgId string, change *org.OwnershipChange, ctx context.Context) error
+	FindOrgs(filter *org.ListFilter, ctx context.Context) ([]org.Organization, error)
+	FindMemberOrgs(filter *org.ListFilter, ctx context.Context) ([]org.Organization, error)
+	FindOrgsWithPermission(permissionId string, limit int, ctx context.Context) ([]org.Organization, error)
 }
 
 type orgRepo struct {
@@ -71,6 +82,413 @@ func (repo *orgRepo) GetOrgById(id string, ctx context.Context) (*org.Organizati
 	return &result, nil
 }
 
+// UpdateOrg sets only the fields present in the update and returns the updated org
+func (repo *orgRepo) UpdateOrg(orgId string, update *org.Update, ctx context.Context) (*org.Organization, error) {
+	internalErr := &xrfErr.Internal{}
+	externalError := &xrfErr.External{}
+	internalErr.Source = "core/repository/organization#updateOrg"
+
+	fields := bson.M{constants.UpdatedAt: update.UpdatedAt}
+	if update.DisplayName != nil {
+		fields[constants.DisplayName] = *update.DisplayName
+		fields[constants.NAME] = update.Name()
+	}
+	if update.Category != nil {
+		fields[constants.Category] = *update.Category
+	}
+	if update.Description != nil {
+		fields[constants.Description] = *update.Description
+	}
+	if update.IsAnonymous != nil {
+		fields[constants.IsAnonymous] = *update.IsAnonymous
+	}
+
+	filter := bson.M{constants.OrgId: orgId}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var result org.Organization
+	resp := repo.db.Collection(constants.OrgCollection).FindOneAndUpdate(ctx, filter, bson.M{"$set": fields}, opts)
+
+	if resp.Err() != nil {
+		if errors.Is(resp.Err(), mongo.ErrNoDocuments) {
+			externalError.Message = constants.NotFoundOrgErrMsg
+			externalError.Err = errors.New(constants.NotFoundOrgErrMsg)
+			return nil, externalError
+		}
+		// the name has a unique index
+		if mongo.IsDuplicateKeyError(resp.Err()) {
+			externalError.Message = fmt.Sprintf("org with name '%s' already exists", *update.DisplayName)
+			return nil, externalError
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=updateOrg :: orgId=%s :: err=%s", orgId, resp.Err()))
+		internalErr.Err = resp.Err()
+		internalErr.Message = "Updating org in mongodb failed"
+		return nil, internalErr
+	}
+
+	if err := resp.Decode(&result); err != nil {
+		internalErr.Err = err
+		internalErr.Message = "Failed to decode org object"
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=updateOrg :: err=%s", err))
+		return nil, internalErr
+	}
+	repo.log.Debug(fmt.Sprintf("event=updateOrg :: success=true :: orgId=%s", orgId))
+	return &result, nil
+}
+
+// AddMembers adds all members in a single update, it fails without adding anyone if one of them is already a member
+func (repo *orgRepo) AddMembers(orgId string, members []org.Member, ctx context.Context) error {
+	if len(members) == 0 {
+		return nil
+	}
+	notMembers := bson.A{}
+	memberFps := bson.A{}
+	newMembers := bson.M{constants.UpdatedAt: time.Now()}
+	for _, member := range members {
+		memberField := memberPath(member.Fingerprint)
+		notMembers = append(notMembers, bson.M{memberField: bson.M{"$exists": false}})
+		newMembers[memberField] = member
+		memberFps = append(memberFps, member.Fingerprint)
+	}
+
+	filter := bson.M{constants.OrgId: orgId, "$and": notMembers}
+	update := bson.M{
+		"$set":      newMembers,
+		"$addToSet": bson.M{constants.MemberFps: bson.M{"$each": memberFps}},
+	}
+
+	resp, err := repo.db.Collection(constants.OrgCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=addOrgMembers :: orgId=%s :: err=%s", orgId, err))
+		return &xrfErr.Internal{Source: "core/repository/organization#addMembers", Message: "Adding org members failed", Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		if err := repo.orgExists(orgId, ctx); err != nil {
+			return err
+		}
+		return &xrfErr.External{Source: "core/repository/organization#addMembers", Message: "user is already a member of the organization"}
+	}
+	repo.log.Debug(fmt.Sprintf("event=addOrgMembers :: success=true :: orgId=%s :: count=%d", orgId, len(members)))
+	return nil
+}
+
+// RemoveMember removes the member unless they are the org's last owner.
+// The owner check is part of the update's filter so that it can't race with other membership changes
+func (repo *orgRepo) RemoveMember(orgId string, userFp string, ctx context.Context) error {
+	memberField := memberPath(userFp)
+	filter := bson.M{
+		constants.OrgId: orgId,
+		memberField:     bson.M{"$exists": true},
+		"$expr":         hasOtherOwnerExpr(userFp),
+	}
+	update := bson.M{
+		"$unset": bson.M{memberField: ""},
+		"$pull":  bson.M{constants.MemberFps: userFp},
+		"$set":   bson.M{constants.UpdatedAt: time.Now()},
+	}
+
+	resp, err := repo.db.Collection(constants.OrgCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=removeOrgMember :: orgId=%s :: err=%s", orgId, err))
+		return &xrfErr.Internal{Source: "core/repository/organization#removeMember", Message: "Removing org member failed", Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		return repo.memberUpdateFailure(orgId, userFp, ctx)
+	}
+	repo.log.Debug(fmt.Sprintf("event=removeOrgMember :: success=true :: orgId=%s", orgId))
+	return nil
+}
+
+// SetMemberPermissions replaces the member's directly granted permissions
+func (repo *orgRepo) SetMemberPermissions(orgId string, userFp string, permissionIds []string, ctx context.Context) error {
+	return repo.setMemberIds(orgId, userFp, constants.PERMISSIONS, permissionIds, ctx)
+}
+
+// SetMemberRoles replaces the member's roles
+func (repo *orgRepo) SetMemberRoles(orgId string, userFp string, roleIds []string, ctx context.Context) error {
+	return repo.setMemberIds(orgId, userFp, constants.ROLES, roleIds, ctx)
+}
+
+// setMemberIds replaces a list of ids (permissions or roles) held by the member
+func (repo *orgRepo) setMemberIds(orgId string, userFp string, field string, ids []string, ctx context.Context) error {
+	memberField := memberPath(userFp)
+	filter := bson.M{constants.OrgId: orgId, memberField: bson.M{"$exists": true}}
+	update := bson.M{"$set": bson.M{
+		fmt.Sprintf("%s.%s", memberField, field): ids,
+		constants.UpdatedAt:                      time.Now(),
+	}}
+
+	resp, err := repo.db.Collection(constants.OrgCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=setMemberIds :: orgId=%s :: field=%s :: err=%s", orgId, field, err))
+		return &xrfErr.Internal{Source: "core/repository/organization#setMemberIds", Message: fmt.Sprintf("Updating member %s failed", field), Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		return repo.memberUpdateFailure(orgId, userFp, ctx)
+	}
+	return nil
+}
+
+// ChangeOwnership applies and records the change in one update. The update only matches while the member making
+// the change is still an owner and, when someone loses ownership, while another owner remains
+func (repo *orgRepo) ChangeOwnership(orgId string, change *org.OwnershipChange, ctx context.Context) error {
+	userOwnerField := fmt.Sprintf("%s.%s", memberPath(change.UserFp), constants.OWNER)
+	changedByOwnerField := fmt.Sprintf("%s.%s", memberPath(change.ChangedBy), constants.OWNER)
+
+	filter := bson.M{
+		constants.OrgId:           orgId,
+		changedByOwnerField:       true,
+		memberPath(change.UserFp): bson.M{"$exists": true},
+	}
+	set := bson.M{constants.UpdatedAt: change.ChangedAt}
+	switch change.Action {
+	case org.PromoteOwner:
+		set[userOwnerField] = true
+	case org.DemoteOwner:
+		set[userOwnerField] = false
+		filter["$expr"] = hasOtherOwnerExpr(change.UserFp)
+	case org.TransferOwner:
+		set[userOwnerField] = true
+		set[changedByOwnerField] = false
+	}
+	update := bson.M{
+		"$set":  set,
+		"$push": bson.M{constants.OwnershipHistory: change},
+	}
+
+	resp, err := repo.db.Collection(constants.OrgCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=changeOwnership :: orgId=%s :: ownershipAction=%s :: err=%s", orgId, change.Action, err))
+		return &xrfErr.Internal{Source: "core/repository/organization#changeOwnership", Message: "Changing org ownership failed", Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		changedBy, err := repo.FindOrgMember(orgId, change.ChangedBy, ctx)
+		if err != nil {
+			return err
+		}
+		if changedBy == nil || !changedBy.Owner {
+			return &xrfErr.Forbidden{Source: "core/repository/organization#changeOwnership", Message: "only owners can change the ownership of an org"}
+		}
+		return repo.memberUpdateFailure(orgId, change.UserFp, ctx)
+	}
+	repo.log.Info(fmt.Sprintf("event=changeOwnership :: success=true :: orgId=%s :: ownershipAction=%s", orgId, change.Action))
+	return nil
+}
+
+// memberUpdateFailure finds out why an update to a member matched no org
+func (repo *orgRepo) memberUpdateFailure(orgId string, userFp string, ctx context.Context) error {
+	member, err := repo.FindOrgMember(orgId, userFp, ctx)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return &xrfErr.External{Source: "core/repository/organization", Message: constants.NotOrgMemberErrMsg}
+	}
+	return &xrfErr.External{Source: "core/repository/organization", Message: constants.LastOrgOwnerErrMsg}
+}
+
+func (repo *orgRepo) orgExists(orgId string, ctx context.Context) error {
+	count, err := repo.db.Collection(constants.OrgCollection).CountDocuments(ctx, bson.M{constants.OrgId: orgId})
+	if err != nil {
+		return &xrfErr.Internal{Source: "core/repository/organization#orgExists", Message: "Counting orgs failed", Err: err}
+	}
+	if count == 0 {
+		return &xrfErr.External{Message: constants.NotFoundOrgErrMsg, Err: errors.New(constants.NotFoundOrgErrMsg)}
+	}
+	return nil
+}
+
+func memberPath(userFp string) string {
+	return fmt.Sprintf("%s.%s", constants.MEMBERS, userFp)
+}
+
+// hasOtherOwnerExpr matches orgs that have at least one owner other than the given user
+func hasOtherOwnerExpr(userFp string) bson.M {
+	otherOwners := bson.M{"$filter": bson.M{
+		"input": bson.M{"$objectToArray": "$" + constants.MEMBERS},
+		"as":    "member",
+		"cond": bson.M{"$and": bson.A{
+			bson.M{"$ne": bson.A{"$$member.k", userFp}},
+			bson.M{"$eq": bson.A{"$$member.v." + constants.OWNER, true}},
+		}},
+	}}
+	return bson.M{"$gt": bson.A{bson.M{"$size": otherOwners}, 0}}
+}
+
+// FindOrgs returns up to filter.Limit orgs newest first, starting after the filter's cursor
+func (repo *orgRepo) FindOrgs(filter *org.ListFilter, ctx context.Context) ([]org.Organization, error) {
+	return repo.findOrgs(filter, nil, ctx)
+}
+
+// FindMemberOrgs returns the orgs the filter's viewer is a member of. Only the viewer's membership is read
+// from each org, so the orgs stay small for users that are members of many large orgs
+func (repo *orgRepo) FindMemberOrgs(filter *org.ListFilter, ctx context.Context) ([]org.Organization, error) {
+	memberFilter := *filter
+	memberFilter.MemberOnly = true
+	projection := bson.M{
+		constants.OrgId:             1,
+		constants.NAME:              1,
+		constants.DisplayName:       1,
+		constants.Category:          1,
+		constants.Description:       1,
+		constants.IsAnonymous:       1,
+		constants.CreatedAt:         1,
+		constants.UpdatedAt:         1,
+		constants.MemberFps:         1,
+		memberPath(filter.ViewerFp): 1,
+	}
+	orgs, err := repo.findOrgs(&memberFilter, projection, ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, foundOrg := range orgs {
+		if member, ok := foundOrg.Members[filter.ViewerFp]; ok {
+			member.Fingerprint = filter.ViewerFp
+			foundOrg.Members[filter.ViewerFp] = member
+		}
+	}
+	return orgs, nil
+}
+
+func (repo *orgRepo) findOrgs(filter *org.ListFilter, projection bson.M, ctx context.Context) ([]org.Organization, error) {
+	internalErr := &xrfErr.Internal{Source: "core/repository/organization#findOrgs"}
+	viewerIsMember := bson.M{constants.MemberFps: filter.ViewerFp}
+
+	conditions := bson.A{bson.M{"$or": bson.A{bson.M{constants.IsAnonymous: false}, viewerIsMember}}}
+	if filter.MemberOnly {
+		conditions = append(conditions, viewerIsMember)
+	}
+	if filter.Category != "" {
+		conditions = append(conditions, bson.M{constants.Category: filter.Category})
+	}
+	if filter.IsAnonymous != nil {
+		conditions = append(conditions, bson.M{constants.IsAnonymous: *filter.IsAnonymous})
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, bson.M{constants.CreatedAt: bson.M{"$gt": *filter.CreatedAfter}})
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, bson.M{constants.CreatedAt: bson.M{"$lt": *filter.CreatedBefore}})
+	}
+	if filter.After != nil {
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{constants.CreatedAt: bson.M{"$lt": filter.After.CreatedAt}},
+			bson.M{constants.CreatedAt: filter.After.CreatedAt, constants.OrgId: bson.M{"$lt": filter.After.OrgId}},
+		}})
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: constants.CreatedAt, Value: -1}, {Key: constants.OrgId, Value: -1}}).
+		SetLimit(int64(filter.Limit))
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+
+	cursor, err := repo.db.Collection(constants.OrgCollection).Find(ctx, bson.M{"$and": conditions}, opts)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findOrgs :: err=%s", err))
+		internalErr.Err = err
+		internalErr.Message = "Error finding orgs"
+		return nil, internalErr
+	}
+
+	orgs := make([]org.Organization, 0)
+	if err := cursor.All(ctx, &orgs); err != nil {
+		internalErr.Err = err
+		internalErr.Message = "Failed to decode orgs"
+		return nil, internalErr
+	}
+	return orgs, nil
+}
+
+// FindOrgsWithPermission returns the ids and names of orgs where a member holds the permission
+func (repo *orgRepo) FindOrgsWithPermission(permissionId string, limit int, ctx context.Context) ([]org.Organization, error) {
+	internalErr := &xrfErr.Internal{Source: "core/repository/organization#findOrgsWithPermission"}
+	filter := bson.M{"$expr": memberHasPermissionExpr(permissionId)}
+	opts := options.Find().
+		SetProjection(bson.M{constants.OrgId: 1, constants.NAME: 1, constants.DisplayName: 1}).
+		SetLimit(int64(limit))
+
+	cursor, err := repo.db.Collection(constants.OrgCollection).Find(ctx, filter, opts)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findOrgsWithPermission :: permissionId=%s :: err=%s", permissionId, err))
+		internalErr.Err = err
+		internalErr.Message = "Error finding orgs using the permission"
+		return nil, internalErr
+	}
+
+	orgs := make([]org.Organization, 0)
+	if err := cursor.All(ctx, &orgs); err != nil {
+		internalErr.Err = err
+		internalErr.Message = "Failed to decode orgs"
+		return nil, internalErr
+	}
+	return orgs, nil
+}
+
+// memberHasPermissionExpr matches orgs with at least one member holding the permission
+func memberHasPermissionExpr(permissionId string) bson.M {
+	return bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+		"input": bson.M{"$objectToArray": "$" + constants.MEMBERS},
+		"in":    bson.M{"$in": bson.A{permissionId, bson.M{"$ifNull": bson.A{"$$this.v." + constants.PERMISSIONS, bson.A{}}}}},
+	}}}}
+}
+
+// removePermissionFromMembers is a pipeline update that removes the permission from every member of an org
+func removePermissionFromMembers(permissionId string) mongo.Pipeline {
+	withoutPermission := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$$this.v." + constants.PERMISSIONS, bson.A{}}},
+		"as":    "permissionId",
+		"cond":  bson.M{"$ne": bson.A{"$$permissionId", permissionId}},
+	}}
+	members := bson.M{"$arrayToObject": bson.M{"$map": bson.M{
+		"input": bson.M{"$objectToArray": "$" + constants.MEMBERS},
+		"in": bson.M{
+			"k": "$$this.k",
+			"v": bson.M{"$mergeObjects": bson.A{"$$this.v", bson.M{constants.PERMISSIONS: withoutPermission}}},
+		},
+	}}}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{constants.MEMBERS: members, constants.UpdatedAt: "$$NOW"}}}}
+}
+
+// FindOrgMember returns the user's membership in the org, or nil if the user isn't a member.
+// Only the requested member is read from the members map
+func (repo *orgRepo) FindOrgMember(orgId string, userFp string, ctx context.Context) (*org.Member, error) {
+	internalErr := &xrfErr.Internal{}
+	externalError := &xrfErr.External{}
+	internalErr.Source = "core/repository/organization#findOrgMember"
+
+	memberField := memberPath(userFp)
+	filter := bson.M{constants.OrgId: orgId}
+	opts := options.FindOne().SetProjection(bson.M{constants.OrgId: 1, memberField: 1})
+
+	var result org.Organization
+	resp := repo.db.Collection(constants.OrgCollection).FindOne(ctx, filter, opts)
+
+	if resp.Err() != nil {
+		if errors.Is(resp.Err(), mongo.ErrNoDocuments) {
+			externalError.Message = constants.NotFoundOrgErrMsg
+			externalError.Err = errors.New(constants.NotFoundOrgErrMsg)
+			return nil, externalError
+		}
+		return nil, resp.Err()
+	}
+
+	if err := resp.Decode(&result); err != nil {
+		internalErr.Err = err
+		internalErr.Message = "Failed to decode org member"
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findOrgMember :: err=%s", err))
+		return nil, internalErr
+	}
+
+	member, ok := result.Members[userFp]
+	if !ok {
+		return nil, nil
+	}
+	member.Fingerprint = userFp
+	return &member, nil
+}
+
 func NewOrganizationRepository(db *mongo.Database, log internal.Logger) (OrganizationRepository, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -85,5 +503,45 @@ func NewOrganizationRepository(db *mongo.Database, log internal.Logger) (Organiz
 		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createOrgIndex :: field='Name' :: err=%s", err))
 		return nil, err
 	}
+	// orgs are listed newest first
+	err = createIndex(db, log, ctx, constants.OrgCollection, mongo.IndexModel{
+		Keys: bson.D{{Key: constants.CreatedAt, Value: -1}, {Key: constants.OrgId, Value: -1}},
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createOrgIndex :: field='createdAt,orgId' :: err=%s", err))
+		return nil, err
+	}
+	// a user's orgs, newest first
+	err = createIndex(db, log, ctx, constants.OrgCollection, mongo.IndexModel{
+		Keys: bson.D{{Key: constants.MemberFps, Value: 1}, {Key: constants.CreatedAt, Value: -1}, {Key: constants.OrgId, Value: -1}},
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createOrgIndex :: field='memberFps,createdAt,orgId' :: err=%s", err))
+		return nil, err
+	}
+	if err = backfillMemberFps(db, log, ctx); err != nil {
+		return nil, err
+	}
 	return &orgRepo{db: db, log: log}, nil
 }
+
+// backfillMemberFps sets memberFps on orgs created before it was added
+func backfillMemberFps(db *mongo.Database, log internal.Logger, ctx context.Context) error {
+	filter := bson.M{constants.MemberFps: bson.M{"$exists": false}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		constants.MemberFps: bson.M{"$map": bson.M{
+			"input": bson.M{"$objectToArray": "$" + constants.MEMBERS},
+			"in":    "$$this.k",
+		}},
+	}}}}
+
+	resp, err := db.Collection(constants.OrgCollection).UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=backfillMemberFps :: err=%s", err))
+		return &xrfErr.Internal{Source: "core/repository/organization#backfillMemberFps", Message: "Backfilling org member fingerprints failed", Err: err}
+	}
+	if resp.ModifiedCount > 0 {
+		log.Info(fmt.Sprintf("event=backfillMemberFps :: success=true :: count=%d", resp.ModifiedCount))
+	}
+	return nil
+}
@@ -7,7 +7,9 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
+	"xrf197ilz35aq0/core/model/audit"
 	"xrf197ilz35aq0/core/model/org"
 	"xrf197ilz35aq0/internal"
 	"xrf197ilz35aq0/internal/constants"
@@ -18,9 +20,14 @@ type PermissionRepository interface {
 	UpdatePermission(permission *org.Permission, ctx context.Context) error
 	CreatePermission(permission *org.Permission, ctx context.Context) (string, error)
 	FindPermissionById(id string, ctx context.Context) (*org.Permission, error)
-	FindPermissionByName(name string, ctx context.Context) (*org.Permission, error)
+	FindPermissionByName(orgId string, name string, ctx context.Context) (*org.Permission, error)
 	FindPermissionsByIds(ids []string, ctx context.Context) ([]org.Permission, error)
-	FindPermissionsByNames(names []string, ctx context.Context) ([]org.Permission, error)
+	FindPermissionsByNames(orgId string, names []string, ctx context.Context) ([]org.Permission, error)
+	FindPermissions(orgId string, afterName string, limit int, ctx context.Context) ([]org.Permission, error)
+	FindOrgPermissions(orgId string, ctx context.Context) ([]org.Permission, error)
+	FindPermissionsVisibleIn(orgIds []string, ctx context.Context) ([]org.Permission, error)
+	SetPermissionImplies(id string, implies []string, ctx context.Context) error
+	DeletePermission(id string, cascade bool, entry *audit.Entry, ctx context.Context) (int64, error)
 }
 
 type permissionsRepo struct {
@@ -35,7 +42,7 @@ func (repo *permissionsRepo) CreatePermission(permission *org.Permission, ctx co
 	if err != nil {
 		// Check for the duplicate key error
 		if mongo.IsDuplicateKeyError(err) {
-			repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createPermission :: err=duplicateName :: name=%s", permission.Name))
+			repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createPermission :: err=duplicateName :: orgId=%s :: name=%s", permission.OrgId, permission.Name))
 			externalError.Message = "permission name already exists"
 			return "", externalError
 		}
@@ -49,27 +56,130 @@ func (repo *permissionsRepo) CreatePermission(permission *org.Permission, ctx co
 	return document.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
+// UpdatePermission saves the permission's name and description
 func (repo *permissionsRepo) UpdatePermission(permission *org.Permission, ctx context.Context) error {
-	//TODO implement me
-	panic("implement me")
+	filter := bson.M{constants.PermissionId: permission.Id}
+	update := bson.M{"$set": bson.M{
+		constants.NAME:        permission.Name,
+		constants.Description: permission.Description,
+		constants.UpdatedAt:   permission.UpdatedAt,
+	}}
+
+	resp, err := repo.db.Collection(constants.PermissionsCol).UpdateOne(ctx, filter, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=updatePermission :: err=duplicateName :: name=%s", permission.Name))
+			return &xrfErr.External{Source: "core/repository/permission#updatePermission", Message: "permission name already exists"}
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=updatePermission :: permissionId=%s :: err=%s", permission.Id, err))
+		return &xrfErr.Internal{Source: "core/repository/permission#updatePermission", Message: "Updating permission failed", Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		return &xrfErr.External{Source: "core/repository/permission#updatePermission", Message: constants.NotFoundPermissionErrMsg}
+	}
+	return nil
+}
+
+// DeletePermission deletes the permission and records the audit entry in one transaction, returning the number of
+// orgs whose members lost the permission. Without cascade the delete is refused if any member or role still holds
+// it, with cascade it is first removed from every member, role and pending invitation.
+func (repo *permissionsRepo) DeletePermission(id string, cascade bool, entry *audit.Entry, ctx context.Context) (int64, error) {
+	source := "core/repository/permission#deletePermission"
+	session, err := repo.db.Client().StartSession()
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=startSession :: permissionId=%s :: err=%s", id, err))
+		return 0, &xrfErr.Internal{Source: source, Message: "Starting mongodb session failed", Err: err}
+	}
+	defer session.EndSession(ctx)
+
+	updatedOrgs, err := session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		orgs := repo.db.Collection(constants.OrgCollection)
+		referenced := bson.M{"$expr": memberHasPermissionExpr(id)}
+
+		var updated int64
+		if cascade {
+			resp, err := orgs.UpdateMany(sessCtx, referenced, removePermissionFromMembers(id))
+			if err != nil {
+				return nil, err
+			}
+			updated = resp.ModifiedCount
+
+			pull := bson.M{"$pull": bson.M{constants.PERMISSIONS: id}, "$set": bson.M{constants.UpdatedAt: time.Now()}}
+			if _, err := repo.db.Collection(constants.RoleCol).UpdateMany(sessCtx, bson.M{constants.PERMISSIONS: id}, pull); err != nil {
+				return nil, err
+			}
+			pending := bson.M{constants.Status: org.InvitationPending, constants.PERMISSIONS: id}
+			if _, err := repo.db.Collection(constants.InvitationCol).UpdateMany(sessCtx, pending, pull); err != nil {
+				return nil, err
+			}
+		} else {
+			// a member may have been given the permission since the caller checked for references
+			count, err := orgs.CountDocuments(sessCtx, referenced, options.Count().SetLimit(1))
+			if err != nil {
+				return nil, err
+			}
+			roles, err := repo.db.Collection(constants.RoleCol).CountDocuments(sessCtx, bson.M{constants.PERMISSIONS: id}, options.Count().SetLimit(1))
+			if err != nil {
+				return nil, err
+			}
+			if count+roles > 0 {
+				return nil, &xrfErr.External{Source: source, Message: constants.PermissionInUseErrMsg}
+			}
+		}
+
+		permissions := repo.db.Collection(constants.PermissionsCol)
+		resp, err := permissions.DeleteOne(sessCtx, bson.M{constants.PermissionId: id})
+		if err != nil {
+			return nil, err
+		}
+		if resp.DeletedCount == 0 {
+			return nil, &xrfErr.External{Source: source, Message: constants.NotFoundPermissionErrMsg}
+		}
+		// implying a deleted permission means nothing
+		if _, err := permissions.UpdateMany(sessCtx, bson.M{constants.IMPLIES: id}, bson.M{"$pull": bson.M{constants.IMPLIES: id}}); err != nil {
+			return nil, err
+		}
+
+		if entry.Details == nil {
+			entry.Details = make(map[string]any)
+		}
+		entry.Details["updatedOrgs"] = updated
+		if err := recordAudit(repo.db, entry, sessCtx); err != nil {
+			return nil, err
+		}
+		return updated, nil
+	})
+	if err != nil {
+		var externalErr *xrfErr.External
+		if errors.As(err, &externalErr) {
+			return 0, externalErr
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=deletePermission :: permissionId=%s :: cascade=%t :: err=%s", id, cascade, err))
+		return 0, &xrfErr.Internal{Source: source, Message: "Deleting permission failed", Err: err}
+	}
+	repo.log.Info(fmt.Sprintf("event=deletePermission :: success=true :: permissionId=%s :: cascade=%t :: updatedOrgs=%d", id, cascade, updatedOrgs))
+	return updatedOrgs.(int64), nil
 }
 
 func (repo *permissionsRepo) FindPermissionById(id string, ctx context.Context) (*org.Permission, error) {
-	//TODO implement me
-	panic("implement me")
+	return repo.findPermission(bson.M{constants.PermissionId: id}, "findPermissionById", ctx)
 }
 
-func (repo *permissionsRepo) FindPermissionByName(name string, ctx context.Context) (*org.Permission, error) {
+// FindPermissionByName finds the permission defined in the org, orgId "" finds a global permission
+func (repo *permissionsRepo) FindPermissionByName(orgId string, name string, ctx context.Context) (*org.Permission, error) {
+	return repo.findPermission(bson.M{constants.OrgId: definedIn(orgId), constants.NAME: name}, "findPermissionByName", ctx)
+}
+
+func (repo *permissionsRepo) findPermission(filter bson.M, action string, ctx context.Context) (*org.Permission, error) {
 	var result org.Permission
 	internalErr := &xrfErr.Internal{}
 	externalError := &xrfErr.External{}
 
-	filter := bson.M{"name": name}
 	resp := repo.db.Collection(constants.PermissionsCol).FindOne(ctx, filter)
 
 	if resp.Err() != nil {
 		if errors.Is(resp.Err(), mongo.ErrNoDocuments) {
-			externalError.Message = "Permission not found"
+			externalError.Message = constants.NotFoundPermissionErrMsg
 			return nil, externalError
 		}
 		return nil, resp.Err()
@@ -78,27 +188,91 @@ func (repo *permissionsRepo) FindPermissionByName(name string, ctx context.Conte
 	if err := resp.Decode(&result); err != nil {
 		internalErr.Err = err
 		internalErr.Message = "Failed to decode permission object"
-		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=FindPermissionByName :: err=%s", err))
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=%s :: err=%s", action, err))
 		return nil, internalErr
 	}
 	return &result, nil
 }
 
-func (repo *permissionsRepo) FindPermissionsByNames(names []string, ctx context.Context) ([]org.Permission, error) {
-	return repo.findPermissionsByFilter(names, constants.NAME, ctx)
+// FindPermissions returns up to limit (0 for no limit) permissions defined in the org ordered by name, starting
+// after afterName. orgId "" returns global permissions
+func (repo *permissionsRepo) FindPermissions(orgId string, afterName string, limit int, ctx context.Context) ([]org.Permission, error) {
+	return repo.findPermissions(bson.M{constants.OrgId: definedIn(orgId)}, afterName, limit, ctx)
+}
+
+// FindOrgPermissions returns the global permissions and those scoped to the org, implication rules are evaluated
+// against all of them
+func (repo *permissionsRepo) FindOrgPermissions(orgId string, ctx context.Context) ([]org.Permission, error) {
+	return repo.findPermissions(bson.M{constants.OrgId: visibleIn(orgId)}, "", 0, ctx)
+}
+
+// FindPermissionsVisibleIn returns the global permissions and those scoped to any of the orgs, so the implication
+// rules of many orgs are evaluated with one query
+func (repo *permissionsRepo) FindPermissionsVisibleIn(orgIds []string, ctx context.Context) ([]org.Permission, error) {
+	visible := bson.A{nil, ""}
+	for _, orgId := range orgIds {
+		visible = append(visible, orgId)
+	}
+	return repo.findPermissions(bson.M{constants.OrgId: bson.M{"$in": visible}}, "", 0, ctx)
+}
+
+func (repo *permissionsRepo) findPermissions(filter bson.M, afterName string, limit int, ctx context.Context) ([]org.Permission, error) {
+	internalError := &xrfErr.Internal{Source: "core/repository/permission#findPermissions"}
+	if afterName != "" {
+		filter[constants.NAME] = bson.M{"$gt": afterName}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: constants.NAME, Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := repo.db.Collection(constants.PermissionsCol).Find(ctx, filter, opts)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findPermissions :: err=%s", err))
+		internalError.Message = "Failed to query permissions"
+		internalError.Err = err
+		return nil, internalError
+	}
+
+	permissions := make([]org.Permission, 0)
+	if err := cursor.All(ctx, &permissions); err != nil {
+		internalError.Err = err
+		internalError.Message = "Failed to decode permission objects"
+		return nil, internalError
+	}
+	return permissions, nil
+}
+
+// SetPermissionImplies replaces the implication rules of the permission
+func (repo *permissionsRepo) SetPermissionImplies(id string, implies []string, ctx context.Context) error {
+	filter := bson.M{constants.PermissionId: id}
+	update := bson.M{"$set": bson.M{constants.IMPLIES: implies, constants.UpdatedAt: time.Now()}}
+
+	resp, err := repo.db.Collection(constants.PermissionsCol).UpdateOne(ctx, filter, update)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=setPermissionImplies :: permissionId=%s :: err=%s", id, err))
+		return &xrfErr.Internal{Source: "core/repository/permission#setPermissionImplies", Message: "Updating permission implications failed", Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		return &xrfErr.External{Source: "core/repository/permission#setPermissionImplies", Message: constants.NotFoundPermissionErrMsg}
+	}
+	return nil
+}
+
+// FindPermissionsByNames finds the global and org-scoped permissions with the names, both are returned when an
+// org-scoped permission shadows a global one
+func (repo *permissionsRepo) FindPermissionsByNames(orgId string, names []string, ctx context.Context) ([]org.Permission, error) {
+	return repo.findPermissionsByFilter(names, constants.NAME, bson.M{constants.OrgId: visibleIn(orgId)}, ctx)
 }
 
 func (repo *permissionsRepo) FindPermissionsByIds(ids []string, ctx context.Context) ([]org.Permission, error) {
-	return repo.findPermissionsByFilter(ids, constants.PermissionId, ctx)
+	return repo.findPermissionsByFilter(ids, constants.PermissionId, bson.M{}, ctx)
 }
 
-func (repo *permissionsRepo) findPermissionsByFilter(values []string, filterBy string, ctx context.Context) ([]org.Permission, error) {
+func (repo *permissionsRepo) findPermissionsByFilter(values []string, filterBy string, filter bson.M, ctx context.Context) ([]org.Permission, error) {
 	if values == nil || len(values) == 0 {
 		return []org.Permission{}, nil
 	}
 	internalError := &xrfErr.Internal{}
 	// 1. Build query filter
-	filter := bson.M{filterBy: bson.M{"$in": values}}
+	filter[filterBy] = bson.M{"$in": values}
 
 	// 2. Query mongoDB
 	cursor, err := repo.db.Collection(constants.PermissionsCol).Find(ctx, filter)
@@ -122,10 +296,40 @@ func (repo *permissionsRepo) findPermissionsByFilter(values []string, filterBy s
 	return orgPermissions, nil
 }
 
+// definedIn matches permissions defined in the org, orgId "" matches global permissions which have no orgId
+func definedIn(orgId string) any {
+	if orgId == "" {
+		return bson.M{"$in": bson.A{nil, ""}}
+	}
+	return orgId
+}
+
+// visibleIn matches global permissions and those defined in the org
+func visibleIn(orgId string) bson.M {
+	return bson.M{"$in": bson.A{nil, "", orgId}}
+}
+
 func NewPermissionRepo(db *mongo.Database, log internal.Logger) (PermissionRepository, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if err := createUniqueIndex(db, log, ctx, constants.PermissionsCol, constants.NAME); err != nil {
+	// names used to be globally unique, they are now unique per org (global permissions have a null orgId)
+	if err := dropIndex(db, log, ctx, constants.PermissionsCol, constants.NAME+"_1"); err != nil {
+		return nil, err
+	}
+	err := createIndex(db, log, ctx, constants.PermissionsCol, mongo.IndexModel{
+		Keys:    bson.D{{Key: constants.OrgId, Value: 1}, {Key: constants.NAME, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createPermissionIndex :: field='orgId,name' :: err=%s", err))
+		return nil, err
+	}
+	err = createIndex(db, log, ctx, constants.PermissionsCol, mongo.IndexModel{
+		Keys:    bson.D{{Key: constants.PermissionId, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createPermissionIndex :: field='permissionId' :: err=%s", err))
 		return nil, err
 	}
 
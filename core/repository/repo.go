@@ -5,4 +5,9 @@ type Repositories struct {
 	UserRepo       UserRepository
 	OrgRepo        OrganizationRepository
 	SettingsRepo   SettingsRepository
+	InvitationRepo InvitationRepository
+	AuditRepo      AuditRepository
+	RoleRepo       RoleRepository
+	RungRepo       RungRepository
+	ConsentRepo    ConsentRepository
 }
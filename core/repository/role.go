@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+type RoleRepository interface {
+	CreateRole(role *org.Role, ctx context.Context) (string, error)
+	FindRoleById(id string, ctx context.Context) (*org.Role, error)
+	FindRolesByIds(ids []string, ctx context.Context) ([]org.Role, error)
+	FindRolesByNames(names []string, ctx context.Context) ([]org.Role, error)
+	FindRoles(afterName string, limit int, ctx context.Context) ([]org.Role, error)
+	FindRolesWithPermission(permissionId string, limit int, ctx context.Context) ([]org.Role, error)
+}
+
+type roleRepo struct {
+	db  *mongo.Database
+	log internal.Logger
+}
+
+func (repo *roleRepo) CreateRole(role *org.Role, ctx context.Context) (string, error) {
+	_, err := repo.db.Collection(constants.RoleCol).InsertOne(ctx, role)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createRole :: err=duplicateName :: name=%s", role.Name))
+			return "", &xrfErr.External{Source: "core/repository/role#createRole", Message: "role name already exists"}
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createRole :: err=%s", err))
+		return "", &xrfErr.Internal{Source: "core/repository/role#createRole", Message: "Creating new role in mongodb failed", Err: err}
+	}
+	repo.log.Debug(fmt.Sprintf("event=saveRole :: success=true :: roleId=%s", role.Id))
+	return role.Id, nil
+}
+
+func (repo *roleRepo) FindRoleById(id string, ctx context.Context) (*org.Role, error) {
+	var role org.Role
+	err := repo.db.Collection(constants.RoleCol).FindOne(ctx, bson.M{constants.RoleId: id}).Decode(&role)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &xrfErr.External{Source: "core/repository/role#findRoleById", Message: constants.NotFoundRoleErrMsg}
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findRoleById :: roleId=%s :: err=%s", id, err))
+		return nil, &xrfErr.Internal{Source: "core/repository/role#findRoleById", Message: "Failed to find role", Err: err}
+	}
+	return &role, nil
+}
+
+func (repo *roleRepo) FindRolesByIds(ids []string, ctx context.Context) ([]org.Role, error) {
+	if len(ids) == 0 {
+		return []org.Role{}, nil
+	}
+	return repo.findRoles(bson.M{constants.RoleId: bson.M{"$in": ids}}, options.Find(), ctx)
+}
+
+func (repo *roleRepo) FindRolesByNames(names []string, ctx context.Context) ([]org.Role, error) {
+	if len(names) == 0 {
+		return []org.Role{}, nil
+	}
+	return repo.findRoles(bson.M{constants.NAME: bson.M{"$in": names}}, options.Find(), ctx)
+}
+
+// FindRoles returns up to limit roles ordered by name, starting after afterName
+func (repo *roleRepo) FindRoles(afterName string, limit int, ctx context.Context) ([]org.Role, error) {
+	filter := bson.M{}
+	if afterName != "" {
+		filter[constants.NAME] = bson.M{"$gt": afterName}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: constants.NAME, Value: 1}}).SetLimit(int64(limit))
+	return repo.findRoles(filter, opts, ctx)
+}
+
+// FindRolesWithPermission returns up to limit roles bundling the permission ordered by name
+func (repo *roleRepo) FindRolesWithPermission(permissionId string, limit int, ctx context.Context) ([]org.Role, error) {
+	opts := options.Find().SetSort(bson.D{{Key: constants.NAME, Value: 1}}).SetLimit(int64(limit))
+	return repo.findRoles(bson.M{constants.PERMISSIONS: permissionId}, opts, ctx)
+}
+
+func (repo *roleRepo) findRoles(filter bson.M, opts *options.FindOptions, ctx context.Context) ([]org.Role, error) {
+	internalError := &xrfErr.Internal{Source: "core/repository/role#findRoles"}
+	cursor, err := repo.db.Collection(constants.RoleCol).Find(ctx, filter, opts)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findRoles :: err=%s", err))
+		internalError.Message = "Failed to query roles"
+		internalError.Err = err
+		return nil, internalError
+	}
+
+	roles := make([]org.Role, 0)
+	if err := cursor.All(ctx, &roles); err != nil {
+		internalError.Err = err
+		internalError.Message = "Failed to decode role objects"
+		return nil, internalError
+	}
+	return roles, nil
+}
+
+func NewRoleRepository(db *mongo.Database, log internal.Logger) (RoleRepository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, field := range []string{constants.NAME, constants.RoleId} {
+		err := createIndex(db, log, ctx, constants.RoleCol, mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createRoleIndex :: field='%s' :: err=%s", field, err))
+			return nil, err
+		}
+	}
+	return &roleRepo{db: db, log: log}, nil
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"xrf197ilz35aq0/core/model/rung"
+	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+// maxTrailUpdateAttempts is how many times a trade trail update is retried when another writer saved the rung first
+const maxTrailUpdateAttempts = 5
+
+// maxHistorySnapshots caps the snapshots read for a timeline, a narrower time range is needed past it
+const maxHistorySnapshots = 10_000
+
+type RungRepository interface {
+	CreateRung(rung *rung.Rung, ctx context.Context) (int64, error)
+	CreateRungIfMissing(ownerFp string, ctx context.Context) error
+	FindRungByOwner(ownerFp string, ctx context.Context) (*rung.Rung, error)
+	AddTradeTrail(ownerFp, customerFp, tradeId string, metadata rung.TrailMetaData, ctx context.Context) (*rung.Rung, error)
+	// FindHistory returns the owner's snapshots recorded in [from, to), oldest first
+	FindHistory(ownerFp string, from time.Time, to time.Time, ctx context.Context) ([]rung.Snapshot, error)
+	// FindTopRungs returns the rungs with the highest magnitude without their trails, only ownerFps' unless it's nil
+	FindTopRungs(ownerFps []string, limit int, ctx context.Context) ([]rung.Rung, error)
+	// FindStanding ranks the owner's rung among all rungs, only ownerFps' unless it's nil
+	FindStanding(ownerFp string, ownerFps []string, ctx context.Context) (*rung.Standing, error)
+}
+
+type rungRepo struct {
+	db      *mongo.Database
+	log     internal.Logger
+	scoring rung.Scoring
+}
+
+func (repo *rungRepo) CreateRung(rung *rung.Rung, ctx context.Context) (int64, error) {
+	_, err := repo.db.Collection(constants.RungCol).InsertOne(ctx, rung)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createRung :: err=duplicateOwner :: ownerFp=%s", rung.OwnerFP()))
+			return 0, &xrfErr.External{Source: "core/repository/rung#createRung", Message: "user already has a rung"}
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createRung :: err=%s", err))
+		return 0, &xrfErr.Internal{Source: "core/repository/rung#createRung", Message: "Creating new rung in mongodb failed", Err: err}
+	}
+	repo.log.Debug(fmt.Sprintf("event=saveRung :: success=true :: rungId=%d", rung.Id()))
+	return rung.Id(), nil
+}
+
+// CreateRungIfMissing creates an empty rung for the owner unless they already have one
+func (repo *rungRepo) CreateRungIfMissing(ownerFp string, ctx context.Context) error {
+	filter := bson.M{constants.OwnerFp: ownerFp}
+	update := bson.M{"$setOnInsert": rung.NewRung(ownerFp)}
+	_, err := repo.db.Collection(constants.RungCol).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	// a concurrent upsert for the same owner loses against the unique index, the rung exists either way
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createRungIfMissing :: ownerFp=%s :: err=%s", ownerFp, err))
+		return &xrfErr.Internal{Source: "core/repository/rung#createRungIfMissing", Message: "Creating rung failed", Err: err}
+	}
+	return nil
+}
+
+func (repo *rungRepo) FindRungByOwner(ownerFp string, ctx context.Context) (*rung.Rung, error) {
+	var ownerRung rung.Rung
+	err := repo.db.Collection(constants.RungCol).FindOne(ctx, bson.M{constants.OwnerFp: ownerFp}).Decode(&ownerRung)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &xrfErr.External{Source: "core/repository/rung#findRungByOwner", Message: constants.NotFoundRungErrMsg}
+		}
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findRungByOwner :: ownerFp=%s :: err=%s", ownerFp, err))
+		return nil, &xrfErr.Internal{Source: "core/repository/rung#findRungByOwner", Message: "Failed to find rung", Err: err}
+	}
+	return &ownerRung, nil
+}
+
+// AddTradeTrail applies the customer's trade rating to the owner's rung. Only the customer's trail is written and
+// the write is conditional on the rung version that was read, so a concurrent update makes this one reload and retry
+// instead of overwriting it. A change of magnitude is recorded in the rung's history along with the update
+func (repo *rungRepo) AddTradeTrail(ownerFp, customerFp, tradeId string, metadata rung.TrailMetaData, ctx context.Context) (*rung.Rung, error) {
+	// the customer fingerprint is used in a field path, so it can't contain path or operator characters
+	if customerFp == "" || strings.ContainsAny(customerFp, ".$") {
+		return nil, &xrfErr.External{Source: "core/repository/rung#addTradeTrail", Message: "invalid customer fingerprint"}
+	}
+
+	for attempt := 1; attempt <= maxTrailUpdateAttempts; attempt++ {
+		ownerRung, err := repo.FindRungByOwner(ownerFp, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		previous := ownerRung.Magnitude()
+		updated, err := ownerRung.AddTradeTrail(customerFp, tradeId, metadata, repo.scoring)
+		if err != nil {
+			return nil, err
+		}
+		if !updated {
+			return ownerRung, nil
+		}
+
+		saved, err := repo.saveTrail(ownerRung, customerFp, previous, ctx)
+		if err != nil {
+			repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=addTradeTrail :: ownerFp=%s :: err=%s", ownerFp, err))
+			return nil, &xrfErr.Internal{Source: "core/repository/rung#addTradeTrail", Message: "Failed to update rung", Err: err}
+		}
+		if saved != nil {
+			return saved, nil
+		}
+		repo.log.Warn(fmt.Sprintf("event=rungVersionConflict :: action=addTradeTrail :: ownerFp=%s :: attempt=%d", ownerFp, attempt))
+	}
+
+	return nil, &xrfErr.Internal{
+		Source:  "core/repository/rung#addTradeTrail",
+		Message: fmt.Sprintf("Rung kept changing, gave up after %d attempts", maxTrailUpdateAttempts),
+	}
+}
+
+// saveTrail writes the customer's trail of the rung unless the rung changed since it was read, nil is returned then
+func (repo *rungRepo) saveTrail(ownerRung *rung.Rung, customerFp string, previous int, ctx context.Context) (*rung.Rung, error) {
+	session, err := repo.db.Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	saved, err := session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		filter := bson.M{constants.OwnerFp: ownerRung.OwnerFP(), constants.Version: ownerRung.Version()}
+		update := bson.M{
+			"$set": bson.M{
+				constants.Magnitude:                      ownerRung.Magnitude(),
+				constants.UpdatedAt:                      ownerRung.Updated(),
+				constants.TradeTrails + "." + customerFp: ownerRung.TradeTrails()[customerFp],
+			},
+			"$inc": bson.M{constants.Version: 1},
+		}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		var saved rung.Rung
+		err := repo.db.Collection(constants.RungCol).FindOneAndUpdate(sessCtx, filter, update, opts).Decode(&saved)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return (*rung.Rung)(nil), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if saved.Magnitude() != previous {
+			snapshot := rung.NewSnapshot(&saved, previous)
+			if _, err := repo.db.Collection(constants.RungHistoryCol).InsertOne(sessCtx, snapshot); err != nil {
+				return nil, err
+			}
+		}
+		return &saved, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved.(*rung.Rung), nil
+}
+
+func (repo *rungRepo) FindHistory(ownerFp string, from time.Time, to time.Time, ctx context.Context) ([]rung.Snapshot, error) {
+	internalErr := &xrfErr.Internal{Source: "core/repository/rung#findHistory"}
+	filter := bson.M{constants.OwnerFp: ownerFp, constants.RecordedAt: bson.M{"$gte": from, "$lt": to}}
+	opts := options.Find().SetSort(bson.D{{Key: constants.RecordedAt, Value: 1}}).SetLimit(maxHistorySnapshots + 1)
+
+	cursor, err := repo.db.Collection(constants.RungHistoryCol).Find(ctx, filter, opts)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findHistory :: ownerFp=%s :: err=%s", ownerFp, err))
+		internalErr.Err = err
+		internalErr.Message = "Error finding rung history"
+		return nil, internalErr
+	}
+
+	snapshots := make([]rung.Snapshot, 0)
+	if err := cursor.All(ctx, &snapshots); err != nil {
+		internalErr.Err = err
+		internalErr.Message = "Failed to decode rung history"
+		return nil, internalErr
+	}
+	if len(snapshots) > maxHistorySnapshots {
+		return nil, &xrfErr.External{
+			Source:  "core/repository/rung#findHistory",
+			Message: fmt.Sprintf("more than %d changes in the time range, narrow it down", maxHistorySnapshots),
+		}
+	}
+	return snapshots, nil
+}
+
+// FindTopRungs returns the rungs with the highest magnitudes, as of each rung's last rating
+func (repo *rungRepo) FindTopRungs(ownerFps []string, limit int, ctx context.Context) ([]rung.Rung, error) {
+	internalErr := &xrfErr.Internal{Source: "core/repository/rung#findTopRungs"}
+	opts := options.Find().
+		SetSort(bson.D{{Key: constants.Magnitude, Value: -1}, {Key: constants.OwnerFp, Value: 1}}).
+		SetProjection(bson.M{constants.TradeTrails: 0}).
+		SetLimit(int64(limit))
+
+	cursor, err := repo.db.Collection(constants.RungCol).Find(ctx, ownersFilter(ownerFps), opts)
+	if err != nil {
+		repo.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=findTopRungs :: err=%s", err))
+		internalErr.Err = err
+		internalErr.Message = "Error finding top rungs"
+		return nil, internalErr
+	}
+
+	rungs := make([]rung.Rung, 0)
+	if err := cursor.All(ctx, &rungs); err != nil {
+		internalErr.Err = err
+		internalErr.Message = "Failed to decode rungs"
+		return nil, internalErr
+	}
+	return rungs, nil
+}
+
+// FindStanding counts the rungs above and level with the owner's on the magnitude index.
+// Every rung is counted from the collection's metadata, which can briefly lag after unclean shutdowns
+func (repo *rungRepo) FindStanding(ownerFp string, ownerFps []string, ctx context.Context) (*rung.Standing, error) {
+	internalErr := &xrfErr.Internal{Source: "core/repository/rung#findStanding"}
+	ownerRung, err := repo.FindRungByOwner(ownerFp, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := repo.db.Collection(constants.RungCol)
+	standing := &rung.Standing{Magnitude: ownerRung.Magnitude()}
+	above := ownersFilter(ownerFps)
+	above[constants.Magnitude] = bson.M{"$gt": standing.Magnitude}
+	if standing.Above, err = collection.CountDocuments(ctx, above); err != nil {
+		return nil, internalErr.WithErr("Error counting rungs", err)
+	}
+	equal := ownersFilter(ownerFps)
+	equal[constants.Magnitude] = standing.Magnitude
+	if standing.Equal, err = collection.CountDocuments(ctx, equal); err != nil {
+		return nil, internalErr.WithErr("Error counting rungs", err)
+	}
+
+	if ownerFps == nil {
+		standing.Total, err = collection.EstimatedDocumentCount(ctx)
+	} else {
+		standing.Total, err = collection.CountDocuments(ctx, ownersFilter(ownerFps))
+	}
+	if err != nil {
+		return nil, internalErr.WithErr("Error counting rungs", err)
+	}
+	// the estimate can trail the counts
+	standing.Total = max(standing.Total, standing.Above+standing.Equal)
+	return standing, nil
+}
+
+func ownersFilter(ownerFps []string) bson.M {
+	if ownerFps == nil {
+		return bson.M{}
+	}
+	return bson.M{constants.OwnerFp: bson.M{"$in": ownerFps}}
+}
+
+// NewRungRepository creates the rung repository, magnitudes of updated rungs are calculated with scoring
+func NewRungRepository(db *mongo.Database, log internal.Logger, scoring rung.Scoring) (RungRepository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// every owner has exactly one rung
+	err := createIndex(db, log, ctx, constants.RungCol, mongo.IndexModel{
+		Keys:    bson.D{{Key: constants.OwnerFp, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// rankings
+	err = createIndex(db, log, ctx, constants.RungCol, mongo.IndexModel{
+		Keys: bson.D{{Key: constants.Magnitude, Value: -1}, {Key: constants.OwnerFp, Value: 1}},
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createRungIndex :: field='magnitude,ownerFp' :: err=%s", err))
+		return nil, err
+	}
+	// the timeline of an owner
+	err = createIndex(db, log, ctx, constants.RungHistoryCol, mongo.IndexModel{
+		Keys: bson.D{{Key: constants.OwnerFp, Value: 1}, {Key: constants.RecordedAt, Value: 1}},
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createRungHistoryIndex :: field='ownerFp,recordedAt' :: err=%s", err))
+		return nil, err
+	}
+	return &rungRepo{db: db, log: log, scoring: scoring}, nil
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
 	"xrf197ilz35aq0/core/model/user"
 	"xrf197ilz35aq0/internal"
 	"xrf197ilz35aq0/internal/constants"
@@ -15,6 +17,18 @@ import (
 type SettingsRepository interface {
 	CreateSettings(settings *user.Settings, ctx context.Context) (any, error)
 	FetchUserSettings(ctx context.Context, userFP string) (settings *user.Settings, err error)
+	// RewrapKeys replaces the wrapped data keys of keyVersion (the current one and the previous ones if given) and
+	// drops any legacy plaintext key. Keys rotated or retired since they were read are left as they are
+	RewrapKeys(userFP string, keyVersion int, wrappedKey string, previousKeys []user.WrappedDataKey, ctx context.Context) error
+	// ClaimKeyRotation leases the settings of a user whose key is due for rotation (see user.Settings.DueAt), or whose
+	// data still has to be re-encrypted after one, to owner. Returns nil when there's nothing to claim
+	ClaimKeyRotation(owner string, leaseFor time.Duration, ctx context.Context) (*user.Settings, error)
+	// SaveRotatedKey stores a rotated key and drops any legacy plaintext key, it fails if owner lost the lease or the
+	// key was rotated since it was read
+	SaveRotatedKey(settings *user.Settings, previousVersion int, owner string, ctx context.Context) error
+	// CompleteKeyRotation releases owner's lease, the previous keys are dropped if retirePreviousKeys (once data has
+	// been re-encrypted with the current key) and kept otherwise
+	CompleteKeyRotation(userFP string, owner string, retirePreviousKeys bool, ctx context.Context) error
 }
 
 type settingsRepo struct {
@@ -27,7 +41,7 @@ func (sr *settingsRepo) FetchUserSettings(ctx context.Context, userFP string) (s
 	externalError := &xrfErr.External{}
 	internalErr.Source = "core/repository/settings#fetchUserSettings"
 
-	filter := bson.D{{"fingerPrint", userFP}}
+	filter := bson.D{{Key: constants.FINGERPRINT, Value: userFP}}
 	var userSettings user.Settings
 	resp := sr.db.Collection(constants.SettingsCollection).FindOne(ctx, filter)
 
@@ -62,9 +76,145 @@ func (sr *settingsRepo) CreateSettings(settings *user.Settings, ctx context.Cont
 	return document.InsertedID, nil
 }
 
-func NewSettingsRepository(db *mongo.Database, log internal.Logger) SettingsRepository {
+func (sr *settingsRepo) RewrapKeys(userFP string, keyVersion int, wrappedKey string, previousKeys []user.WrappedDataKey, ctx context.Context) error {
+	filter := bson.M{constants.FINGERPRINT: userFP, constants.KeyVersion: keyVersion}
+	if keyVersion == 0 {
+		// settings saved before keys were versioned have no version
+		filter[constants.KeyVersion] = bson.M{"$in": bson.A{0, nil}}
+	}
+	set := bson.M{constants.WrappedKey: wrappedKey, constants.LastModified: time.Now()}
+	if len(previousKeys) > 0 {
+		// a rotation completing since the keys were read retires them, they mustn't be stored again
+		versions := make(bson.A, 0, len(previousKeys))
+		for _, previous := range previousKeys {
+			versions = append(versions, previous.Version)
+		}
+		filter[constants.PreviousKeys+".version"] = bson.M{"$all": versions}
+		set[constants.PreviousKeys] = previousKeys
+	}
+	update := bson.M{"$set": set, "$unset": bson.M{constants.LegacyKey: ""}}
+
+	resp, err := sr.db.Collection(constants.SettingsCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		sr.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=rewrapKeys :: err=%s", err))
+		return &xrfErr.Internal{Source: "core/repository/settings#rewrapKeys", Message: "Updating user key failed", Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		sr.log.Info(fmt.Sprintf("event=rewrapKeys :: success=false :: keyVersion=%d :: message='keys were rotated since they were read'", keyVersion))
+	}
+	return nil
+}
+
+func (sr *settingsRepo) ClaimKeyRotation(owner string, leaseFor time.Duration, ctx context.Context) (*user.Settings, error) {
+	now := time.Now()
+	filter := bson.M{
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{constants.RotateKey: true, constants.RotateAt: bson.M{"$lte": now}},
+				// settings saved before rotations were scheduled are due encryptAfter (in nanoseconds) after they were created
+				bson.M{constants.RotateKey: true, constants.RotateAt: nil, "$expr": bson.M{"$lte": bson.A{
+					bson.M{"$add": bson.A{"$" + constants.CreatedAt, bson.M{"$divide": bson.A{"$" + constants.EncryptAfter, int64(time.Millisecond)}}}},
+					now,
+				}}},
+				bson.M{constants.PendingReEncrypt: true},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{constants.RotationLease: nil},
+				bson.M{constants.RotationLease + ".expiresAt": bson.M{"$lte": now}},
+			}},
+		},
+	}
+	lease := user.RotationLease{Owner: owner, ExpiresAt: now.Add(leaseFor)}
+	update := bson.M{"$set": bson.M{constants.RotationLease: lease}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var claimed user.Settings
+	err := sr.db.Collection(constants.SettingsCollection).FindOneAndUpdate(ctx, filter, update, opts).Decode(&claimed)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		sr.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=claimKeyRotation :: err=%s", err))
+		return nil, &xrfErr.Internal{Source: "core/repository/settings#claimKeyRotation", Message: "Claiming key rotation failed", Err: err}
+	}
+	return &claimed, nil
+}
+
+func (sr *settingsRepo) SaveRotatedKey(settings *user.Settings, previousVersion int, owner string, ctx context.Context) error {
+	filter := bson.M{
+		constants.FINGERPRINT:                  settings.UserFingerprint,
+		constants.KeyVersion:                   previousVersion,
+		constants.RotationLease + ".owner":     owner,
+		constants.RotationLease + ".expiresAt": bson.M{"$gt": time.Now()},
+	}
+	if previousVersion == 0 {
+		// settings saved before keys were versioned have no version
+		filter[constants.KeyVersion] = bson.M{"$in": bson.A{0, nil}}
+	}
+	update := bson.M{
+		"$set": bson.M{
+			constants.WrappedKey:       settings.WrappedKey,
+			constants.KeyVersion:       settings.KeyVersion,
+			constants.PreviousKeys:     settings.PreviousKeys,
+			constants.PendingReEncrypt: settings.PendingReEncryption,
+			constants.RotateAt:         settings.RotateAt,
+			constants.LastModified:     settings.LastModified,
+		},
+		"$unset": bson.M{constants.LegacyKey: ""},
+	}
+
+	resp, err := sr.db.Collection(constants.SettingsCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		sr.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=saveRotatedKey :: err=%s", err))
+		return &xrfErr.Internal{Source: "core/repository/settings#saveRotatedKey", Message: "Saving rotated key failed", Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		return &xrfErr.Internal{Source: "core/repository/settings#saveRotatedKey", Message: "key rotation lease was lost"}
+	}
+	return nil
+}
+
+func (sr *settingsRepo) CompleteKeyRotation(userFP string, owner string, retirePreviousKeys bool, ctx context.Context) error {
+	filter := bson.M{constants.FINGERPRINT: userFP, constants.RotationLease + ".owner": owner}
+	unset := bson.M{constants.RotationLease: ""}
+	if retirePreviousKeys {
+		unset[constants.PreviousKeys] = ""
+	}
+	update := bson.M{"$set": bson.M{constants.PendingReEncrypt: false}, "$unset": unset}
+
+	resp, err := sr.db.Collection(constants.SettingsCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		sr.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=completeKeyRotation :: err=%s", err))
+		return &xrfErr.Internal{Source: "core/repository/settings#completeKeyRotation", Message: "Completing key rotation failed", Err: err}
+	}
+	if resp.MatchedCount == 0 {
+		return &xrfErr.Internal{Source: "core/repository/settings#completeKeyRotation", Message: "key rotation lease was lost"}
+	}
+	return nil
+}
+
+func NewSettingsRepository(db *mongo.Database, log internal.Logger) (SettingsRepository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the key rotation job looks for keys that are due and rotations that haven't finished re-encrypting
+	err := createIndex(db, log, ctx, constants.SettingsCollection, mongo.IndexModel{
+		Keys: bson.D{{Key: constants.RotateKey, Value: 1}, {Key: constants.RotateAt, Value: 1}},
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createSettingsIndex :: field='rotateKey,rotateAt' :: err=%s", err))
+		return nil, err
+	}
+	err = createIndex(db, log, ctx, constants.SettingsCollection, mongo.IndexModel{
+		Keys:    bson.D{{Key: constants.PendingReEncrypt, Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{constants.PendingReEncrypt: true}),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("event=mongoDBFailure :: action=createSettingsIndex :: field=pendingReEncryption :: err=%s", err))
+		return nil, err
+	}
 	return &settingsRepo{
 		db:  db,
 		log: log,
-	}
+	}, nil
 }
@@ -15,6 +15,7 @@ import (
 type UserRepository interface {
 	CreateUser(user *user.User, ctx context.Context) (string, error)
 	GetUserById(userId string, ctx context.Context) (*user.User, error)
+	FindUserByEmail(email string, ctx context.Context) (*user.User, error)
 	FindUsersByEmails(emails []string, ctx context.Context) ([]user.User, error)
 	UpdatePassword(userFPrint string, newPassword string, ctx context.Context) (bool, error)
 	FindUsersByFingerPrints(fingerPrints []string, ctx context.Context) ([]user.User, error)
@@ -49,8 +50,8 @@ func (up *userRepo) UpdatePassword(userFPrint string, newPassword string, ctx co
 	}
 	internalErr := &xrfErr.Internal{}
 	internalErr.Source = "core/repository/user#updateUser"
-	filter := bson.D{{constants.FINGERPRINT, userFPrint}}
-	update := bson.D{{"$set", bson.D{{constants.PASSWORD, newPassword}}}}
+	filter := bson.D{{Key: constants.FINGERPRINT, Value: userFPrint}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: constants.PASSWORD, Value: newPassword}}}}
 
 	resp, err := up.db.Collection(constants.UserCollection).UpdateOne(ctx, filter, update)
 	if err != nil {
@@ -63,11 +64,17 @@ func (up *userRepo) UpdatePassword(userFPrint string, newPassword string, ctx co
 }
 
 func (up *userRepo) GetUserById(userId string, ctx context.Context) (*user.User, error) {
+	return up.findUser(bson.D{{Key: constants.USERID, Value: userId}}, "getUserById", ctx)
+}
+
+func (up *userRepo) FindUserByEmail(email string, ctx context.Context) (*user.User, error) {
+	return up.findUser(bson.D{{Key: constants.EMAIL, Value: email}}, "findUserByEmail", ctx)
+}
+
+func (up *userRepo) findUser(filter bson.D, action string, ctx context.Context) (*user.User, error) {
 	internalErr := &xrfErr.Internal{}
 	externalError := &xrfErr.External{}
-	internalErr.Source = "core/repository/user#getUserById"
-
-	filter := bson.D{{constants.USERID, userId}}
+	internalErr.Source = fmt.Sprintf("core/repository/user#%s", action)
 
 	var userResponse user.User
 	resp := up.db.Collection(constants.UserCollection).FindOne(ctx, filter)
@@ -83,7 +90,7 @@ func (up *userRepo) GetUserById(userId string, ctx context.Context) (*user.User,
 	if err := resp.Decode(&userResponse); err != nil {
 		internalErr.Err = err
 		internalErr.Message = "Failed to decode userResponse object"
-		up.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=getUserById :: err=%s", err))
+		up.log.Error(fmt.Sprintf("event=mongoDBFailure :: action=%s :: err=%s", action, err))
 		return nil, internalErr
 	}
 	return &userResponse, nil
@@ -105,7 +112,7 @@ func (up *userRepo) findUsersByFilter(values []string, filterBy string, ctx cont
 	internalErr := &xrfErr.Internal{}
 	internalErr.Source = "core/repository/user#findUsersByFilter"
 
-	filter := bson.D{{filterBy, bson.M{"$in": values}}}
+	filter := bson.D{{Key: filterBy, Value: bson.M{"$in": values}}}
 
 	var userResponse []user.User
 	cursor, err := up.db.Collection(constants.UserCollection).Find(ctx, filter)
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	xrf "xrf197ilz35aq0"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/core/repository"
+	"xrf197ilz35aq0/internal"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+// Authorizer answers whether the caller (the user fingerprint in ctx) may act on an org.
+// A caller is allowed if they are an owner of the org or if their membership holds the permission,
+// directly, through one of their roles or implied by another permission they hold
+type Authorizer interface {
+	Authorize(orgId string, permission string, ctx context.Context) error
+	AuthorizeOwner(orgId string, ctx context.Context) error
+	// AuthorizeAdmin only allows the configured admins, who manage what every org relies on (e.g. global permissions)
+	AuthorizeAdmin(ctx context.Context) error
+	// AuthorizeMemberChange allows removing the user or changing their permissions or roles, it takes the members
+	// permission and, when the user is an owner, ownership
+	AuthorizeMemberChange(orgId string, userId string, ctx context.Context) error
+	// AuthorizeGrant allows granting the permissions and roles (by name), callers that aren't owners can only grant
+	// what they hold themselves
+	AuthorizeGrant(orgId string, permissions []string, roles []string, ctx context.Context) error
+}
+
+type orgAuthorizer struct {
+	admins         []string // user ids
+	log            internal.Logger
+	userRepo       repository.UserRepository
+	orgRepo        repository.OrganizationRepository
+	roleRepo       repository.RoleRepository
+	permissionRepo repository.PermissionRepository
+}
+
+func (auth *orgAuthorizer) Authorize(orgId string, permission string, ctx context.Context) error {
+	member, err := auth.findCaller(orgId, ctx)
+	if err != nil {
+		return err
+	}
+	return auth.authorizeMember(orgId, member, permission, ctx)
+}
+
+func (auth *orgAuthorizer) authorizeMember(orgId string, member *org.Member, permission string, ctx context.Context) error {
+	forbiddenErr := &xrfErr.Forbidden{Source: "core/service/authorization#authorize"}
+	requestId := internal.RequestId(ctx)
+	if member.Owner {
+		return nil
+	}
+
+	graph, effective, err := auth.effectivePermissions(orgId, member, ctx)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(graph.Names(effective), permission) {
+		return nil
+	}
+
+	auth.log.Warn(fmt.Sprintf("event=authorize :: allowed=false :: requestId=%s :: orgId=%s :: reason=missingPermission :: permission=%s", requestId, orgId, permission))
+	forbiddenErr.Message = fmt.Sprintf("caller needs the '%s' permission or ownership of this organization", permission)
+	return forbiddenErr
+}
+
+// AuthorizeOwner only allows owners of the org, permissions held by the caller are not considered
+func (auth *orgAuthorizer) AuthorizeOwner(orgId string, ctx context.Context) error {
+	member, err := auth.findCaller(orgId, ctx)
+	if err != nil {
+		return err
+	}
+	if !member.Owner {
+		auth.log.Warn(fmt.Sprintf("event=authorize :: allowed=false :: requestId=%s :: orgId=%s :: reason=notOwner", internal.RequestId(ctx), orgId))
+		return &xrfErr.Forbidden{Source: "core/service/authorization#authorizeOwner", Message: "caller is not an owner of this organization"}
+	}
+	return nil
+}
+
+func (auth *orgAuthorizer) AuthorizeAdmin(ctx context.Context) error {
+	forbiddenErr := &xrfErr.Forbidden{Source: "core/service/authorization#authorizeAdmin"}
+	requestId := internal.RequestId(ctx)
+
+	callerFp, ok := internal.UserFingerprint(ctx)
+	if !ok {
+		forbiddenErr.Message = "caller is not authenticated"
+		return forbiddenErr
+	}
+	if len(auth.admins) > 0 {
+		callers, err := auth.userRepo.FindUsersByFingerPrints([]string{callerFp}, ctx)
+		if err != nil {
+			auth.log.Error(fmt.Sprintf("event=authorize :: action=findCaller :: requestId=%s :: err=%v", requestId, err))
+			return err
+		}
+		for _, caller := range callers {
+			if slices.Contains(auth.admins, caller.Id) {
+				return nil
+			}
+		}
+	}
+
+	auth.log.Warn(fmt.Sprintf("event=authorize :: allowed=false :: requestId=%s :: reason=notAdmin", requestId))
+	forbiddenErr.Message = "caller is not an admin"
+	return forbiddenErr
+}
+
+func (auth *orgAuthorizer) AuthorizeMemberChange(orgId string, userId string, ctx context.Context) error {
+	caller, err := auth.findCaller(orgId, ctx)
+	if err != nil {
+		return err
+	}
+	if caller.Owner {
+		return nil
+	}
+	if err = auth.authorizeMember(orgId, caller, org.MembersPermission, ctx); err != nil {
+		return err
+	}
+
+	savedUser, err := auth.userRepo.GetUserById(userId, ctx)
+	if err != nil {
+		return err
+	}
+	// users that aren't members are rejected by the change itself
+	target, err := auth.orgRepo.FindOrgMember(orgId, savedUser.FingerPrint, ctx)
+	if err != nil {
+		auth.log.Error(fmt.Sprintf("event=authorize :: action=findOrgMember :: requestId=%s :: orgId=%s :: err=%v", internal.RequestId(ctx), orgId, err))
+		return err
+	}
+	if target != nil && target.Owner {
+		auth.log.Warn(fmt.Sprintf("event=authorize :: allowed=false :: requestId=%s :: orgId=%s :: reason=targetIsOwner", internal.RequestId(ctx), orgId))
+		return &xrfErr.Forbidden{Source: "core/service/authorization#authorizeMemberChange", Message: "only owners can change the membership of an owner"}
+	}
+	return nil
+}
+
+func (auth *orgAuthorizer) AuthorizeGrant(orgId string, permissions []string, roles []string, ctx context.Context) error {
+	requestId := internal.RequestId(ctx)
+	if len(permissions) == 0 && len(roles) == 0 {
+		return nil
+	}
+	caller, err := auth.findCaller(orgId, ctx)
+	if err != nil {
+		return err
+	}
+	if caller.Owner {
+		return nil
+	}
+	graph, effective, err := auth.effectivePermissions(orgId, caller, ctx)
+	if err != nil {
+		return err
+	}
+
+	// unknown permissions and roles can't be held, so they're refused here too
+	notHeld := make([]string, 0)
+	for _, name := range permissions {
+		if permissionId, ok := graph.Id(name); !ok || !slices.Contains(effective, permissionId) {
+			notHeld = append(notHeld, name)
+		}
+	}
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, strings.ToUpper(role))
+	}
+	grantedRoles, err := auth.roleRepo.FindRolesByNames(names, ctx)
+	if err != nil {
+		auth.log.Error(fmt.Sprintf("event=authorize :: action=findRoles :: requestId=%s :: orgId=%s :: err=%v", requestId, orgId, err))
+		return err
+	}
+	for i, name := range names {
+		roleIndex := slices.IndexFunc(grantedRoles, func(role org.Role) bool { return role.Name == name })
+		if roleIndex < 0 || slices.ContainsFunc(grantedRoles[roleIndex].Permissions, func(permissionId string) bool {
+			return !slices.Contains(effective, permissionId)
+		}) {
+			notHeld = append(notHeld, roles[i])
+		}
+	}
+	if len(notHeld) == 0 {
+		return nil
+	}
+
+	auth.log.Warn(fmt.Sprintf("event=authorize :: allowed=false :: requestId=%s :: orgId=%s :: reason=grantNotHeld :: grants=%v", requestId, orgId, notHeld))
+	return &xrfErr.Forbidden{
+		Source:  "core/service/authorization#authorizeGrant",
+		Message: fmt.Sprintf("caller can't grant permissions or roles they don't hold: %v", notHeld),
+	}
+}
+
+// effectivePermissions returns the ids of the permissions the member holds, directly, through roles or implied,
+// with the graph they were resolved with
+func (auth *orgAuthorizer) effectivePermissions(orgId string, member *org.Member, ctx context.Context) (*org.PermissionGraph, []string, error) {
+	requestId := internal.RequestId(ctx)
+	memberRoles, err := auth.roleRepo.FindRolesByIds(member.Roles, ctx)
+	if err != nil {
+		auth.log.Error(fmt.Sprintf("event=authorize :: action=findRoles :: requestId=%s :: orgId=%s :: err=%v", requestId, orgId, err))
+		return nil, nil, err
+	}
+	allPermissions, err := auth.permissionRepo.FindOrgPermissions(orgId, ctx)
+	if err != nil {
+		auth.log.Error(fmt.Sprintf("event=authorize :: action=findPermissions :: requestId=%s :: orgId=%s :: err=%v", requestId, orgId, err))
+		return nil, nil, err
+	}
+	graph := org.NewPermissionGraph(allPermissions)
+	return graph, graph.Effective(member.GrantedPermissions(memberRoles)), nil
+}
+
+// findCaller returns the caller's membership of the org, callers that aren't members are forbidden
+func (auth *orgAuthorizer) findCaller(orgId string, ctx context.Context) (*org.Member, error) {
+	forbiddenErr := &xrfErr.Forbidden{Source: "core/service/authorization#findCaller"}
+	requestId := internal.RequestId(ctx)
+
+	callerFp, ok := internal.UserFingerprint(ctx)
+	if !ok {
+		forbiddenErr.Message = "caller is not authenticated"
+		return nil, forbiddenErr
+	}
+
+	member, err := auth.orgRepo.FindOrgMember(orgId, callerFp, ctx)
+	if err != nil {
+		auth.log.Error(fmt.Sprintf("event=authorize :: action=findOrgMember :: requestId=%s :: orgId=%s :: err=%v", requestId, orgId, err))
+		return nil, err
+	}
+	if member == nil {
+		auth.log.Warn(fmt.Sprintf("event=authorize :: allowed=false :: requestId=%s :: orgId=%s :: reason=notMember", requestId, orgId))
+		forbiddenErr.Message = "caller is not a member of this organization"
+		return nil, forbiddenErr
+	}
+	return member, nil
+}
+
+func NewOrgAuthorizer(config xrf.Security, logger internal.Logger, allRepos *repository.Repositories) Authorizer {
+	return &orgAuthorizer{
+		admins:         config.Admins,
+		log:            logger,
+		userRepo:       allRepos.UserRepo,
+		orgRepo:        allRepos.OrgRepo,
+		roleRepo:       allRepos.RoleRepo,
+		permissionRepo: allRepos.PermissionRepo,
+	}
+}
+
+// authorizedOrgService is an OrgService decorator that authorizes the caller before delegating to the wrapped service
+type authorizedOrgService struct {
+	orgService OrgService
+	authorizer Authorizer
+}
+
+func (aos *authorizedOrgService) CreateOrg(request exchange.OrgRequest, ctx context.Context) (string, error) {
+	return aos.orgService.CreateOrg(request, ctx)
+}
+
+func (aos *authorizedOrgService) GetOrgById(orgId string, ctx context.Context) (*exchange.OrgResponse, error) {
+	if err := aos.authorizer.Authorize(orgId, org.ReadPermission, ctx); err != nil {
+		return nil, err
+	}
+	return aos.orgService.GetOrgById(orgId, ctx)
+}
+
+func (aos *authorizedOrgService) UpdateOrg(orgId string, request exchange.OrgUpdateRequest, ctx context.Context) (*exchange.OrgResponse, error) {
+	if err := aos.authorizer.Authorize(orgId, org.WritePermission, ctx); err != nil {
+		return nil, err
+	}
+	return aos.orgService.UpdateOrg(orgId, request, ctx)
+}
+
+func (aos *authorizedOrgService) FindOrgMembers(orgId string, ctx context.Context) ([]exchange.OrgMemberResponse, error) {
+	if err := aos.authorizer.Authorize(orgId, org.ReadPermission, ctx); err != nil {
+		return nil, err
+	}
+	return aos.orgService.FindOrgMembers(orgId, ctx)
+}
+
+// AddMembers lets members with the members permission add other members with permissions and roles they hold
+// themselves, only owners can add new owners
+func (aos *authorizedOrgService) AddMembers(orgId string, request []exchange.OrgMemberRequest, ctx context.Context) error {
+	addsOwner := false
+	for _, member := range request {
+		addsOwner = addsOwner || member.Owner
+	}
+	var err error
+	if addsOwner {
+		err = aos.authorizer.AuthorizeOwner(orgId, ctx)
+	} else {
+		err = aos.authorizer.Authorize(orgId, org.MembersPermission, ctx)
+	}
+	if err != nil {
+		return err
+	}
+	for _, member := range request {
+		if err = aos.authorizer.AuthorizeGrant(orgId, member.Permissions, member.Roles, ctx); err != nil {
+			return err
+		}
+	}
+	return aos.orgService.AddMembers(orgId, request, ctx)
+}
+
+// RemoveMember lets members with the members permission remove other members, only owners can remove owners
+func (aos *authorizedOrgService) RemoveMember(orgId string, userId string, ctx context.Context) error {
+	if err := aos.authorizer.AuthorizeMemberChange(orgId, userId, ctx); err != nil {
+		return err
+	}
+	return aos.orgService.RemoveMember(orgId, userId, ctx)
+}
+
+func (aos *authorizedOrgService) UpdateMemberPermissions(orgId string, userId string, permissions []string, ctx context.Context) error {
+	if err := aos.authorizer.AuthorizeMemberChange(orgId, userId, ctx); err != nil {
+		return err
+	}
+	if err := aos.authorizer.AuthorizeGrant(orgId, permissions, nil, ctx); err != nil {
+		return err
+	}
+	return aos.orgService.UpdateMemberPermissions(orgId, userId, permissions, ctx)
+}
+
+func (aos *authorizedOrgService) UpdateMemberRoles(orgId string, userId string, roles []string, ctx context.Context) error {
+	if err := aos.authorizer.AuthorizeMemberChange(orgId, userId, ctx); err != nil {
+		return err
+	}
+	if err := aos.authorizer.AuthorizeGrant(orgId, nil, roles, ctx); err != nil {
+		return err
+	}
+	return aos.orgService.UpdateMemberRoles(orgId, userId, roles, ctx)
+}
+
+func (aos *authorizedOrgService) PromoteOwner(orgId string, userId string, ctx context.Context) error {
+	if err := aos.authorizer.AuthorizeOwner(orgId, ctx); err != nil {
+		return err
+	}
+	return aos.orgService.PromoteOwner(orgId, userId, ctx)
+}
+
+func (aos *authorizedOrgService) DemoteOwner(orgId string, userId string, ctx context.Context) error {
+	if err := aos.authorizer.AuthorizeOwner(orgId, ctx); err != nil {
+		return err
+	}
+	return aos.orgService.DemoteOwner(orgId, userId, ctx)
+}
+
+func (aos *authorizedOrgService) TransferOwnership(orgId string, userId string, ctx context.Context) error {
+	if err := aos.authorizer.AuthorizeOwner(orgId, ctx); err != nil {
+		return err
+	}
+	return aos.orgService.TransferOwnership(orgId, userId, ctx)
+}
+
+// ListOrgs only lists orgs the caller can see, anonymous orgs are only listed for their members
+func (aos *authorizedOrgService) ListOrgs(request exchange.OrgListRequest, ctx context.Context) (*exchange.Page[exchange.OrgResponse], error) {
+	return aos.orgService.ListOrgs(request, ctx)
+}
+
+// FindUserOrgs only lets users list their own orgs, which the service checks once it knows the user
+func (aos *authorizedOrgService) FindUserOrgs(userId string, request exchange.OrgListRequest, ctx context.Context) (*exchange.Page[exchange.UserOrgResponse], error) {
+	return aos.orgService.FindUserOrgs(userId, request, ctx)
+}
+
+func NewAuthorizedOrgService(orgService OrgService, authorizer Authorizer) OrgService {
+	return &authorizedOrgService{
+		orgService: orgService,
+		authorizer: authorizer,
+	}
+}
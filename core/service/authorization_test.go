@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/core/model/user"
+	"xrf197ilz35aq0/core/repository"
+	xrf "xrf197ilz35aq0/internal"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	xrfTest "xrf197ilz35aq0/internal/tests"
+)
+
+const (
+	ownerFp       = "ownerTestFingerPrint"
+	readerFp      = "readerTestFingerPrint"
+	writerFp      = "writerTestFingerPrint"
+	outsiderFp    = "outsiderTestFingerPrint"
+	adminFp       = "adminTestFingerPrint"
+	editorFp      = "editorTestFingerPrint"
+	managerFp     = "managerTestFingerPrint"
+	authTestOrgId = "123456789"
+)
+
+var (
+	readPermission    = *org.CreatePermission(org.ReadPermission, "read org")
+	writePermission   = *org.CreatePermission(org.WritePermission, "write org")
+	membersPermission = *org.CreatePermission(org.MembersPermission, "manage org members")
+	adminPermission   = org.Permission{Id: "111111111", Name: "ORG_ADMIN", Implies: []string{"ORG_*"}}
+	editorRole        = org.Role{Id: "987654321", Name: "ORG_EDITOR", Permissions: []string{readPermission.Id, writePermission.Id}}
+)
+
+func newAuthTestRepos() *repository.Repositories {
+	members := map[string]org.Member{
+		ownerFp:   *org.CreateMember(ownerFp, true, []string{}),
+		readerFp:  *org.CreateMember(readerFp, false, []string{readPermission.Id}),
+		writerFp:  *org.CreateMember(writerFp, false, []string{writePermission.Id}),
+		editorFp:  {Fingerprint: editorFp, Permissions: []string{}, Roles: []string{editorRole.Id}},
+		adminFp:   *org.CreateMember(adminFp, false, []string{adminPermission.Id}),
+		managerFp: *org.CreateMember(managerFp, false, []string{membersPermission.Id, readPermission.Id}),
+	}
+	testOrg, _ := org.CreateOrganization("xrfAuthOrg", "", "", false, members)
+	testOrg.Id = authTestOrgId
+
+	// users' ids are their fingerprints
+	userRepo := xrfTest.NewUserRepositoryMock()
+	for memberFp := range members {
+		_, _ = userRepo.CreateUser(&user.User{Id: memberFp, FingerPrint: memberFp, Email: memberFp + "@xrf.com"}, context.TODO())
+	}
+	return &repository.Repositories{
+		UserRepo:       userRepo,
+		OrgRepo:        xrfTest.NewOrgRepositoryMock(testOrg),
+		RoleRepo:       xrfTest.NewRoleRepositoryMock(editorRole),
+		PermissionRepo: xrfTest.NewPermissionRepositoryMock(readPermission, writePermission, membersPermission, adminPermission),
+	}
+}
+
+func TestOrgAuthorizerAuthorize(t *testing.T) {
+	authorizer := NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), newAuthTestRepos())
+
+	tests := []struct {
+		name          string
+		orgId         string
+		callerFp      string
+		permission    string
+		wantErr       bool
+		wantForbidden bool
+	}{
+		{name: "owner is allowed without the permission", orgId: authTestOrgId, callerFp: ownerFp, permission: org.ReadPermission},
+		{name: "member holding the permission is allowed", orgId: authTestOrgId, callerFp: readerFp, permission: org.ReadPermission},
+		{name: "member with a role granting the permission is allowed", orgId: authTestOrgId, callerFp: editorFp, permission: org.ReadPermission},
+		{name: "member holding a permission implying it is allowed", orgId: authTestOrgId, callerFp: adminFp, permission: org.WritePermission},
+		{name: "member without the permission is forbidden", orgId: authTestOrgId, callerFp: writerFp, permission: org.ReadPermission, wantErr: true, wantForbidden: true},
+		{name: "non member is forbidden", orgId: authTestOrgId, callerFp: outsiderFp, permission: org.ReadPermission, wantErr: true, wantForbidden: true},
+		{name: "unauthenticated caller is forbidden", orgId: authTestOrgId, callerFp: "", permission: org.ReadPermission, wantErr: true, wantForbidden: true},
+		{name: "unknown org is not found", orgId: "000", callerFp: ownerFp, permission: org.ReadPermission, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			if tt.callerFp != "" {
+				ctx = xrf.WithUserFingerprint(ctx, tt.callerFp)
+			}
+
+			err := authorizer.Authorize(tt.orgId, tt.permission, ctx)
+			if !tt.wantErr {
+				xrf.AssertNoError(t, err)
+				return
+			}
+			xrf.AssertError(t, err)
+			var forbiddenErr *xrfErr.Forbidden
+			assert.Equal(t, tt.wantForbidden, errors.As(err, &forbiddenErr))
+		})
+	}
+}
+
+type orgServiceStub struct {
+	called int
+}
+
+func (o *orgServiceStub) FindOrgMembers(_ string, _ context.Context) ([]exchange.OrgMemberResponse, error) {
+	o.called++
+	return []exchange.OrgMemberResponse{}, nil
+}
+
+func (o *orgServiceStub) CreateOrg(_ exchange.OrgRequest, _ context.Context) (string, error) {
+	o.called++
+	return authTestOrgId, nil
+}
+
+func (o *orgServiceStub) GetOrgById(_ string, _ context.Context) (*exchange.OrgResponse, error) {
+	o.called++
+	return &exchange.OrgResponse{}, nil
+}
+
+func (o *orgServiceStub) UpdateOrg(_ string, _ exchange.OrgUpdateRequest, _ context.Context) (*exchange.OrgResponse, error) {
+	o.called++
+	return &exchange.OrgResponse{}, nil
+}
+
+func (o *orgServiceStub) AddMembers(_ string, _ []exchange.OrgMemberRequest, _ context.Context) error {
+	o.called++
+	return nil
+}
+
+func (o *orgServiceStub) RemoveMember(_ string, _ string, _ context.Context) error {
+	o.called++
+	return nil
+}
+
+func (o *orgServiceStub) UpdateMemberPermissions(_ string, _ string, _ []string, _ context.Context) error {
+	o.called++
+	return nil
+}
+
+func (o *orgServiceStub) UpdateMemberRoles(_ string, _ string, _ []string, _ context.Context) error {
+	o.called++
+	return nil
+}
+
+func (o *orgServiceStub) PromoteOwner(_ string, _ string, _ context.Context) error {
+	o.called++
+	return nil
+}
+
+func (o *orgServiceStub) DemoteOwner(_ string, _ string, _ context.Context) error {
+	o.called++
+	return nil
+}
+
+func (o *orgServiceStub) TransferOwnership(_ string, _ string, _ context.Context) error {
+	o.called++
+	return nil
+}
+
+func (o *orgServiceStub) ListOrgs(_ exchange.OrgListRequest, _ context.Context) (*exchange.Page[exchange.OrgResponse], error) {
+	o.called++
+	return &exchange.Page[exchange.OrgResponse]{}, nil
+}
+
+func (o *orgServiceStub) FindUserOrgs(_ string, _ exchange.OrgListRequest, _ context.Context) (*exchange.Page[exchange.UserOrgResponse], error) {
+	o.called++
+	return &exchange.Page[exchange.UserOrgResponse]{}, nil
+}
+
+func TestAuthorizedOrgService(t *testing.T) {
+	authorizer := NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), newAuthTestRepos())
+
+	t.Run("delegates when the caller is authorized", func(t *testing.T) {
+		stub := &orgServiceStub{}
+		orgService := NewAuthorizedOrgService(stub, authorizer)
+
+		_, err := orgService.FindOrgMembers(authTestOrgId, xrf.WithUserFingerprint(context.TODO(), readerFp))
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, stub.called)
+	})
+
+	t.Run("does not delegate when the caller is forbidden", func(t *testing.T) {
+		stub := &orgServiceStub{}
+		orgService := NewAuthorizedOrgService(stub, authorizer)
+
+		_, err := orgService.GetOrgById(authTestOrgId, xrf.WithUserFingerprint(context.TODO(), outsiderFp))
+		xrf.AssertError(t, err)
+		assert.Equal(t, 0, stub.called)
+	})
+
+	t.Run("only owners and writers can update the org", func(t *testing.T) {
+		stub := &orgServiceStub{}
+		orgService := NewAuthorizedOrgService(stub, authorizer)
+
+		_, err := orgService.UpdateOrg(authTestOrgId, exchange.OrgUpdateRequest{}, xrf.WithUserFingerprint(context.TODO(), readerFp))
+		xrf.AssertError(t, err)
+		_, err = orgService.UpdateOrg(authTestOrgId, exchange.OrgUpdateRequest{}, xrf.WithUserFingerprint(context.TODO(), writerFp))
+		xrf.AssertNoError(t, err)
+		_, err = orgService.UpdateOrg(authTestOrgId, exchange.OrgUpdateRequest{}, xrf.WithUserFingerprint(context.TODO(), ownerFp))
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 2, stub.called)
+	})
+
+	t.Run("members can only be managed by owners or with the members permission", func(t *testing.T) {
+		stub := &orgServiceStub{}
+		orgService := NewAuthorizedOrgService(stub, authorizer)
+
+		err := orgService.RemoveMember(authTestOrgId, "1234", xrf.WithUserFingerprint(context.TODO(), writerFp))
+		xrf.AssertError(t, err)
+		err = orgService.AddMembers(authTestOrgId, nil, xrf.WithUserFingerprint(context.TODO(), readerFp))
+		xrf.AssertError(t, err)
+		err = orgService.UpdateMemberPermissions(authTestOrgId, "1234", nil, xrf.WithUserFingerprint(context.TODO(), ownerFp))
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, stub.called)
+	})
+
+	t.Run("only owners can change ownership or add owners", func(t *testing.T) {
+		stub := &orgServiceStub{}
+		orgService := NewAuthorizedOrgService(stub, authorizer)
+		writerCtx := xrf.WithUserFingerprint(context.TODO(), writerFp)
+
+		xrf.AssertError(t, orgService.PromoteOwner(authTestOrgId, "1234", writerCtx))
+		xrf.AssertError(t, orgService.DemoteOwner(authTestOrgId, "1234", writerCtx))
+		xrf.AssertError(t, orgService.TransferOwnership(authTestOrgId, "1234", writerCtx))
+		xrf.AssertNoError(t, orgService.TransferOwnership(authTestOrgId, "1234", xrf.WithUserFingerprint(context.TODO(), ownerFp)))
+		assert.Equal(t, 1, stub.called)
+	})
+
+	t.Run("only owners can change owners", func(t *testing.T) {
+		stub := &orgServiceStub{}
+		orgService := NewAuthorizedOrgService(stub, authorizer)
+		managerCtx := xrf.WithUserFingerprint(context.TODO(), managerFp)
+
+		err := orgService.RemoveMember(authTestOrgId, ownerFp, managerCtx)
+		var forbiddenErr *xrfErr.Forbidden
+		assert.True(t, errors.As(err, &forbiddenErr))
+		xrf.AssertError(t, orgService.UpdateMemberPermissions(authTestOrgId, ownerFp, []string{org.ReadPermission}, managerCtx))
+		xrf.AssertError(t, orgService.UpdateMemberRoles(authTestOrgId, ownerFp, []string{}, managerCtx))
+		xrf.AssertNoError(t, orgService.RemoveMember(authTestOrgId, readerFp, managerCtx))
+		assert.Equal(t, 1, stub.called)
+	})
+}
+
+func TestAuthorizedOrgServiceGrants(t *testing.T) {
+	authorizer := NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), newAuthTestRepos())
+	managerCtx := xrf.WithUserFingerprint(context.TODO(), managerFp)
+	ownerCtx := xrf.WithUserFingerprint(context.TODO(), ownerFp)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		grant   func(orgService OrgService, ctx context.Context) error
+		wantErr bool
+	}{
+		{
+			name: "members can grant permissions they hold",
+			ctx:  managerCtx,
+			grant: func(orgService OrgService, ctx context.Context) error {
+				return orgService.UpdateMemberPermissions(authTestOrgId, writerFp, []string{org.ReadPermission, org.MembersPermission}, ctx)
+			},
+		},
+		{
+			name: "members can't grant permissions they don't hold",
+			ctx:  managerCtx,
+			grant: func(orgService OrgService, ctx context.Context) error {
+				return orgService.UpdateMemberPermissions(authTestOrgId, readerFp, []string{org.ReadPermission, org.WritePermission}, ctx)
+			},
+			wantErr: true,
+		},
+		{
+			name: "members can't grant themselves permissions they don't hold",
+			ctx:  managerCtx,
+			grant: func(orgService OrgService, ctx context.Context) error {
+				return orgService.UpdateMemberPermissions(authTestOrgId, managerFp, []string{org.MembersPermission, "ORG_ADMIN"}, ctx)
+			},
+			wantErr: true,
+		},
+		{
+			name: "members can't grant roles with permissions they don't hold",
+			ctx:  managerCtx,
+			grant: func(orgService OrgService, ctx context.Context) error {
+				return orgService.UpdateMemberRoles(authTestOrgId, readerFp, []string{"org_editor"}, ctx)
+			},
+			wantErr: true,
+		},
+		{
+			name: "members can't add members with permissions they don't hold",
+			ctx:  managerCtx,
+			grant: func(orgService OrgService, ctx context.Context) error {
+				return orgService.AddMembers(authTestOrgId, []exchange.OrgMemberRequest{
+					{Email: "new@xrf.com", Permissions: []string{org.WritePermission}},
+				}, ctx)
+			},
+			wantErr: true,
+		},
+		{
+			name: "owners can grant any permission or role",
+			ctx:  ownerCtx,
+			grant: func(orgService OrgService, ctx context.Context) error {
+				return orgService.UpdateMemberRoles(authTestOrgId, readerFp, []string{"ORG_EDITOR"}, ctx)
+			},
+		},
+		{
+			name: "members holding a permission implying others can grant them",
+			ctx:  xrf.WithUserFingerprint(context.TODO(), adminFp),
+			grant: func(orgService OrgService, ctx context.Context) error {
+				return orgService.UpdateMemberRoles(authTestOrgId, readerFp, []string{"ORG_EDITOR"}, ctx)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &orgServiceStub{}
+			err := tt.grant(NewAuthorizedOrgService(stub, authorizer), tt.ctx)
+			if !tt.wantErr {
+				xrf.AssertNoError(t, err)
+				assert.Equal(t, 1, stub.called)
+				return
+			}
+			var forbiddenErr *xrfErr.Forbidden
+			assert.True(t, errors.As(err, &forbiddenErr))
+			assert.Equal(t, 0, stub.called)
+		})
+	}
+}
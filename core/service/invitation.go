@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	xrf "xrf197ilz35aq0"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/core/repository"
+	"xrf197ilz35aq0/internal"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+// InvitationService invites people to an org by email, the invitee joins the org when they accept
+// the invitation with an account that has the invited email
+type InvitationService interface {
+	InviteMember(orgId string, request exchange.InvitationRequest, ctx context.Context) (*exchange.InvitationResponse, error)
+	FindPendingInvitations(orgId string, ctx context.Context) ([]exchange.InvitationResponse, error)
+	RevokeInvitation(orgId string, invitationId string, ctx context.Context) error
+	AcceptInvitation(request exchange.AcceptInvitationRequest, ctx context.Context) (string, error)
+}
+
+type invitationService struct {
+	config         xrf.InvitationConfig
+	log            internal.Logger
+	authorizer     Authorizer
+	orgRepo        repository.OrganizationRepository
+	userRepo       repository.UserRepository
+	permissionRepo repository.PermissionRepository
+	invitationRepo repository.InvitationRepository
+}
+
+func (is *invitationService) InviteMember(orgId string, request exchange.InvitationRequest, ctx context.Context) (*exchange.InvitationResponse, error) {
+	if err := is.authorizer.AuthorizeOwner(orgId, ctx); err != nil {
+		return nil, err
+	}
+	callerFp, _ := internal.UserFingerprint(ctx)
+
+	if err := is.rejectMember(orgId, request.Email, ctx); err != nil {
+		return nil, err
+	}
+	permissionMap, err := validatePermissions(orgId, request.Permissions, is.permissionRepo, is.log, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation, token, err := org.CreateInvitation(orgId, request.Email, getUserPermissions(permissionMap, request.Permissions), callerFp, is.config.ExpiresAfter)
+	if err != nil {
+		return nil, err
+	}
+	_, err = is.invitationRepo.CreateInvitation(invitation, ctx)
+	if err != nil {
+		is.log.Error(fmt.Sprintf("event=inviteMemberFailure :: orgId=%s :: err=%v", orgId, err))
+		return nil, err
+	}
+
+	response := toInvitationResponse(invitation, request.Permissions)
+	response.Token = token
+	return response, nil
+}
+
+// rejectMember fails if the email belongs to a user that's already a member of the org
+func (is *invitationService) rejectMember(orgId string, email string, ctx context.Context) error {
+	foundUsers, err := is.userRepo.FindUsersByEmails([]string{org.NormalizeEmail(email)}, ctx)
+	if err != nil {
+		return err
+	}
+	for _, foundUser := range foundUsers {
+		member, err := is.orgRepo.FindOrgMember(orgId, foundUser.FingerPrint, ctx)
+		if err != nil {
+			return err
+		}
+		if member != nil {
+			return &xrfErr.External{Source: "service/invitation#rejectMember", Message: "user is already a member of the organization"}
+		}
+	}
+	return nil
+}
+
+func (is *invitationService) FindPendingInvitations(orgId string, ctx context.Context) ([]exchange.InvitationResponse, error) {
+	if err := is.authorizer.AuthorizeOwner(orgId, ctx); err != nil {
+		return nil, err
+	}
+	invitations, err := is.invitationRepo.FindPendingInvitations(orgId, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	permissionIds := make([]string, 0)
+	for _, invitation := range invitations {
+		permissionIds = append(permissionIds, invitation.Permissions...)
+	}
+	savedPermissions, err := is.permissionRepo.FindPermissionsByIds(permissionIds, ctx)
+	if err != nil {
+		is.log.Error(fmt.Sprintf("event=findPendingInvitations :: action=findPermissions :: orgId=%s :: err=%v", orgId, err))
+		return nil, err
+	}
+	permissionNames := make(map[string]string)
+	for _, permission := range savedPermissions {
+		permissionNames[permission.Id] = permission.Name
+	}
+
+	response := make([]exchange.InvitationResponse, 0)
+	for _, invitation := range invitations {
+		names := make([]string, 0)
+		for _, permissionId := range invitation.Permissions {
+			if name, ok := permissionNames[permissionId]; ok {
+				names = append(names, name)
+			}
+		}
+		response = append(response, *toInvitationResponse(&invitation, names))
+	}
+	return response, nil
+}
+
+func (is *invitationService) RevokeInvitation(orgId string, invitationId string, ctx context.Context) error {
+	if err := is.authorizer.AuthorizeOwner(orgId, ctx); err != nil {
+		return err
+	}
+	err := is.invitationRepo.RevokeInvitation(orgId, invitationId, ctx)
+	if err != nil {
+		is.log.Error(fmt.Sprintf("event=revokeInvitationFailure :: orgId=%s :: invitationId=%s :: err=%v", orgId, invitationId, err))
+		return err
+	}
+	return nil
+}
+
+// AcceptInvitation makes the caller a member of the org they were invited to and returns the org's id
+func (is *invitationService) AcceptInvitation(request exchange.AcceptInvitationRequest, ctx context.Context) (string, error) {
+	callerFp, ok := internal.UserFingerprint(ctx)
+	if !ok {
+		return "", &xrfErr.Forbidden{Source: "service/invitation#acceptInvitation", Message: "caller is not authenticated"}
+	}
+	if request.Token == "" {
+		return "", &xrfErr.External{Source: "service/invitation#acceptInvitation", Message: "invitation token is required"}
+	}
+
+	callers, err := is.userRepo.FindUsersByFingerPrints([]string{callerFp}, ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(callers) == 0 {
+		return "", &xrfErr.Forbidden{Source: "service/invitation#acceptInvitation", Message: "caller is not authenticated"}
+	}
+
+	invitation, err := is.invitationRepo.ClaimInvitation(org.HashInvitationToken(request.Token), org.NormalizeEmail(callers[0].Email), ctx)
+	if err != nil {
+		return "", err
+	}
+
+	member := org.CreateMember(callerFp, false, invitation.Permissions)
+	err = is.orgRepo.AddMembers(invitation.OrgId, []org.Member{*member}, ctx)
+	if err != nil {
+		is.log.Error(fmt.Sprintf("event=acceptInvitationFailure :: orgId=%s :: invitationId=%s :: err=%v", invitation.OrgId, invitation.Id, err))
+		if releaseErr := is.invitationRepo.ReleaseInvitation(invitation.Id, ctx); releaseErr != nil {
+			is.log.Error(fmt.Sprintf("event=releaseInvitationFailure :: invitationId=%s :: err=%v", invitation.Id, releaseErr))
+		}
+		return "", err
+	}
+	is.log.Info(fmt.Sprintf("event=acceptInvitation :: success=true :: orgId=%s :: invitationId=%s", invitation.OrgId, invitation.Id))
+	return invitation.OrgId, nil
+}
+
+func toInvitationResponse(invitation *org.Invitation, permissionNames []string) *exchange.InvitationResponse {
+	if permissionNames == nil {
+		permissionNames = []string{}
+	}
+	return &exchange.InvitationResponse{
+		InvitationId: invitation.Id,
+		OrgId:        invitation.OrgId,
+		Email:        invitation.Email,
+		Permissions:  permissionNames,
+		Status:       string(invitation.Status),
+		CreatedAt:    invitation.CreatedAt,
+		ExpiresAt:    invitation.ExpiresAt,
+	}
+}
+
+func NewInvitationService(config xrf.Security, logger internal.Logger, authorizer Authorizer, allRepos *repository.Repositories) InvitationService {
+	return &invitationService{
+		config:         config.Invitation,
+		log:            logger,
+		authorizer:     authorizer,
+		orgRepo:        allRepos.OrgRepo,
+		userRepo:       allRepos.UserRepo,
+		permissionRepo: allRepos.PermissionRepo,
+		invitationRepo: allRepos.InvitationRepo,
+	}
+}
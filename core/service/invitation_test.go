@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/core/model/user"
+	xrf "xrf197ilz35aq0/internal"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	xrfTest "xrf197ilz35aq0/internal/tests"
+)
+
+func TestInvitationService(t *testing.T) {
+	const inviteeFp = "inviteeTestFingerPrint"
+	repos := newOrgTestRepos()
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(readPermission)
+	repos.InvitationRepo = xrfTest.NewInvitationRepositoryMock()
+
+	testOrg := newTestOrg(t, "xrfInvites", map[string]org.Member{
+		ownerFp:  *org.CreateMember(ownerFp, true, []string{}),
+		writerFp: *org.CreateMember(writerFp, false, []string{}),
+	})
+	_, err := repos.OrgRepo.Create(testOrg, context.TODO())
+	xrf.AssertNoError(t, err)
+	for _, testUser := range []*user.User{
+		{Id: "1", FingerPrint: ownerFp, Email: "owner@xrf.com"},
+		{Id: "2", FingerPrint: writerFp, Email: "member@xrf.com"},
+	} {
+		_, err := repos.UserRepo.CreateUser(testUser, context.TODO())
+		xrf.AssertNoError(t, err)
+	}
+
+	invitationService := NewInvitationService(securityConfig, xrf.NewTestLogger(), NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), repos), repos)
+	ownerCtx := xrf.WithUserFingerprint(context.TODO(), ownerFp)
+	memberCtx := xrf.WithUserFingerprint(context.TODO(), writerFp)
+	inviteeCtx := xrf.WithUserFingerprint(context.TODO(), inviteeFp)
+	request := exchange.InvitationRequest{Email: "Invitee@xrf.com", Permissions: []string{org.ReadPermission}}
+
+	var token string
+	t.Run("only owners can invite", func(t *testing.T) {
+		_, err := invitationService.InviteMember(testOrg.Id, request, memberCtx)
+		var forbiddenErr *xrfErr.Forbidden
+		assert.True(t, errors.As(err, &forbiddenErr))
+	})
+
+	t.Run("rejects members and unknown permissions", func(t *testing.T) {
+		_, err := invitationService.InviteMember(testOrg.Id, exchange.InvitationRequest{Email: "member@xrf.com"}, ownerCtx)
+		xrf.AssertError(t, err)
+		_, err = invitationService.InviteMember(testOrg.Id, exchange.InvitationRequest{Email: "new@xrf.com", Permissions: []string{"ORG_UNKNOWN"}}, ownerCtx)
+		xrf.AssertError(t, err)
+	})
+
+	t.Run("owner invites an email without an account", func(t *testing.T) {
+		invitation, err := invitationService.InviteMember(testOrg.Id, request, ownerCtx)
+		xrf.AssertNoError(t, err)
+		assert.NotEmpty(t, invitation.Token)
+		assert.Equal(t, "invitee@xrf.com", invitation.Email)
+		token = invitation.Token
+
+		_, err = invitationService.InviteMember(testOrg.Id, request, ownerCtx)
+		xrf.AssertError(t, err)
+
+		pending, err := invitationService.FindPendingInvitations(testOrg.Id, ownerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Len(t, pending, 1)
+		assert.Equal(t, []string{org.ReadPermission}, pending[0].Permissions)
+		assert.Empty(t, pending[0].Token)
+	})
+
+	t.Run("invitation can only be accepted by the invited email", func(t *testing.T) {
+		_, err := invitationService.AcceptInvitation(exchange.AcceptInvitationRequest{Token: token}, inviteeCtx)
+		xrf.AssertError(t, err) // invitee hasn't signed up yet
+
+		_, err = invitationService.AcceptInvitation(exchange.AcceptInvitationRequest{Token: token}, memberCtx)
+		xrf.AssertError(t, err)
+	})
+
+	t.Run("invitee becomes a member once after signing up", func(t *testing.T) {
+		_, err := repos.UserRepo.CreateUser(&user.User{Id: "3", FingerPrint: inviteeFp, Email: "invitee@xrf.com"}, context.TODO())
+		xrf.AssertNoError(t, err)
+
+		orgId, err := invitationService.AcceptInvitation(exchange.AcceptInvitationRequest{Token: token}, inviteeCtx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, testOrg.Id, orgId)
+
+		member, err := repos.OrgRepo.FindOrgMember(testOrg.Id, inviteeFp, context.TODO())
+		xrf.AssertNoError(t, err)
+		assert.False(t, member.Owner)
+		assert.Equal(t, []string{readPermission.Id}, member.Permissions)
+
+		_, err = invitationService.AcceptInvitation(exchange.AcceptInvitationRequest{Token: token}, inviteeCtx)
+		xrf.AssertError(t, err)
+	})
+
+	t.Run("revoked and expired invitations can't be accepted", func(t *testing.T) {
+		revoked, err := invitationService.InviteMember(testOrg.Id, exchange.InvitationRequest{Email: "revoked@xrf.com"}, ownerCtx)
+		xrf.AssertNoError(t, err)
+		xrf.AssertNoError(t, invitationService.RevokeInvitation(testOrg.Id, revoked.InvitationId, ownerCtx))
+		xrf.AssertError(t, invitationService.RevokeInvitation(testOrg.Id, revoked.InvitationId, ownerCtx))
+
+		expired, expiredToken, err := org.CreateInvitation(testOrg.Id, "expired@xrf.com", nil, ownerFp, time.Hour)
+		xrf.AssertNoError(t, err)
+		expired.ExpiresAt = time.Now().Add(-time.Minute)
+		_, err = repos.InvitationRepo.CreateInvitation(expired, context.TODO())
+		xrf.AssertNoError(t, err)
+
+		for _, testUser := range []*user.User{
+			{Id: "4", FingerPrint: "revokedFp", Email: "revoked@xrf.com"},
+			{Id: "5", FingerPrint: "expiredFp", Email: "expired@xrf.com"},
+		} {
+			_, err := repos.UserRepo.CreateUser(testUser, context.TODO())
+			xrf.AssertNoError(t, err)
+		}
+		_, err = invitationService.AcceptInvitation(exchange.AcceptInvitationRequest{Token: revoked.Token}, xrf.WithUserFingerprint(context.TODO(), "revokedFp"))
+		xrf.AssertError(t, err)
+		_, err = invitationService.AcceptInvitation(exchange.AcceptInvitationRequest{Token: expiredToken}, xrf.WithUserFingerprint(context.TODO(), "expiredFp"))
+		xrf.AssertError(t, err)
+
+		pending, err := invitationService.FindPendingInvitations(testOrg.Id, ownerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Empty(t, pending)
+	})
+}
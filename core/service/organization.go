@@ -11,6 +11,7 @@ import (
 	"xrf197ilz35aq0/core/model/user"
 	"xrf197ilz35aq0/core/repository"
 	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
 	xrfErr "xrf197ilz35aq0/internal/error"
 )
 
@@ -18,6 +19,16 @@ type OrgService interface {
 	FindOrgMembers(orgId string, ctx context.Context) ([]exchange.OrgMemberResponse, error)
 	CreateOrg(request exchange.OrgRequest, ctx context.Context) (string, error)
 	GetOrgById(orgId string, ctx context.Context) (*exchange.OrgResponse, error)
+	UpdateOrg(orgId string, request exchange.OrgUpdateRequest, ctx context.Context) (*exchange.OrgResponse, error)
+	AddMembers(orgId string, request []exchange.OrgMemberRequest, ctx context.Context) error
+	RemoveMember(orgId string, userId string, ctx context.Context) error
+	UpdateMemberPermissions(orgId string, userId string, permissions []string, ctx context.Context) error
+	UpdateMemberRoles(orgId string, userId string, roles []string, ctx context.Context) error
+	PromoteOwner(orgId string, userId string, ctx context.Context) error
+	DemoteOwner(orgId string, userId string, ctx context.Context) error
+	TransferOwnership(orgId string, userId string, ctx context.Context) error
+	ListOrgs(request exchange.OrgListRequest, ctx context.Context) (*exchange.Page[exchange.OrgResponse], error)
+	FindUserOrgs(userId string, request exchange.OrgListRequest, ctx context.Context) (*exchange.Page[exchange.UserOrgResponse], error)
 }
 
 type organizationService struct {
@@ -26,6 +37,7 @@ type organizationService struct {
 	userRepo       repository.UserRepository
 	permissionRepo repository.PermissionRepository
 	orgRepo        repository.OrganizationRepository
+	roleRepo       repository.RoleRepository
 }
 
 func (os *organizationService) CreateOrg(request exchange.OrgRequest, ctx context.Context) (string, error) {
@@ -35,10 +47,13 @@ func (os *organizationService) CreateOrg(request exchange.OrgRequest, ctx contex
 		return "", err
 	}
 
-	orgMembers, err := os.validateAndCreateMembers(request.Members, ctx)
+	orgMembers, err := os.validateAndCreateMembers("", request.Members, ctx)
 	if err != nil {
 		return "", err
 	}
+	if !hasOwner(orgMembers) {
+		return "", &xrfErr.External{Source: "service/organization#createOrg", Message: constants.LastOrgOwnerErrMsg}
+	}
 
 	newOrg, err := org.CreateOrganization(request.Name, request.Category, request.Description, request.IsAnonymous, orgMembers)
 	if err != nil {
@@ -62,29 +77,285 @@ func (os *organizationService) GetOrgById(orgId string, ctx context.Context) (*e
 	return toOrgResponse(savedOrg), nil
 }
 
+func (os *organizationService) UpdateOrg(orgId string, request exchange.OrgUpdateRequest, ctx context.Context) (*exchange.OrgResponse, error) {
+	if orgId == "" {
+		return nil, &xrfErr.External{Source: "service/organizationService#updateOrg", Message: "Invalid org id"}
+	}
+	if request.Name != nil {
+		name := strings.TrimSpace(*request.Name)
+		if err := validateOrgName(name); err != nil {
+			return nil, err
+		}
+		request.Name = &name
+	}
+
+	update, err := org.CreateUpdate(request.Name, request.Category, request.Description, request.IsAnonymous)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedOrg, err := os.orgRepo.UpdateOrg(orgId, update, ctx)
+	if err != nil {
+		os.log.Error(fmt.Sprintf("event=updateOrgFailure :: orgId=%s :: err=%v", orgId, err))
+		return nil, err
+	}
+	return toOrgResponse(updatedOrg), nil
+}
+
+func (os *organizationService) AddMembers(orgId string, request []exchange.OrgMemberRequest, ctx context.Context) error {
+	if orgId == "" {
+		return &xrfErr.External{Source: "service/organizationService#addMembers", Message: "Invalid org id"}
+	}
+	orgMembers, err := os.validateAndCreateMembers(orgId, request, ctx)
+	if err != nil {
+		return err
+	}
+
+	newMembers := make([]org.Member, 0, len(orgMembers))
+	for _, member := range orgMembers {
+		newMembers = append(newMembers, member)
+	}
+	err = os.orgRepo.AddMembers(orgId, newMembers, ctx)
+	if err != nil {
+		os.log.Error(fmt.Sprintf("event=addOrgMembersFailure :: orgId=%s :: err=%v", orgId, err))
+		return err
+	}
+	return nil
+}
+
+func (os *organizationService) RemoveMember(orgId string, userId string, ctx context.Context) error {
+	userFp, err := os.findMemberFingerPrint(orgId, userId, ctx)
+	if err != nil {
+		return err
+	}
+	err = os.orgRepo.RemoveMember(orgId, userFp, ctx)
+	if err != nil {
+		os.log.Error(fmt.Sprintf("event=removeOrgMemberFailure :: orgId=%s :: userId=%s :: err=%v", orgId, userId, err))
+		return err
+	}
+	return nil
+}
+
+func (os *organizationService) UpdateMemberPermissions(orgId string, userId string, permissions []string, ctx context.Context) error {
+	userFp, err := os.findMemberFingerPrint(orgId, userId, ctx)
+	if err != nil {
+		return err
+	}
+	permissionMap, err := os.validatePermissions(orgId, permissions, ctx)
+	if err != nil {
+		return err
+	}
+	err = os.orgRepo.SetMemberPermissions(orgId, userFp, getUserPermissions(permissionMap, permissions), ctx)
+	if err != nil {
+		os.log.Error(fmt.Sprintf("event=updateMemberPermissionsFailure :: orgId=%s :: userId=%s :: err=%v", orgId, userId, err))
+		return err
+	}
+	return nil
+}
+
+func (os *organizationService) UpdateMemberRoles(orgId string, userId string, roles []string, ctx context.Context) error {
+	userFp, err := os.findMemberFingerPrint(orgId, userId, ctx)
+	if err != nil {
+		return err
+	}
+	roleMap, err := os.validateRoles(roles, ctx)
+	if err != nil {
+		return err
+	}
+	err = os.orgRepo.SetMemberRoles(orgId, userFp, getUserPermissions(roleMap, roles), ctx)
+	if err != nil {
+		os.log.Error(fmt.Sprintf("event=updateMemberRolesFailure :: orgId=%s :: userId=%s :: err=%v", orgId, userId, err))
+		return err
+	}
+	return nil
+}
+
+func (os *organizationService) PromoteOwner(orgId string, userId string, ctx context.Context) error {
+	return os.changeOwnership(org.PromoteOwner, orgId, userId, ctx)
+}
+
+func (os *organizationService) DemoteOwner(orgId string, userId string, ctx context.Context) error {
+	return os.changeOwnership(org.DemoteOwner, orgId, userId, ctx)
+}
+
+// TransferOwnership makes the user an owner and removes the ownership of the caller
+func (os *organizationService) TransferOwnership(orgId string, userId string, ctx context.Context) error {
+	return os.changeOwnership(org.TransferOwner, orgId, userId, ctx)
+}
+
+func (os *organizationService) changeOwnership(action org.OwnershipAction, orgId string, userId string, ctx context.Context) error {
+	callerFp, ok := internal.UserFingerprint(ctx)
+	if !ok {
+		return &xrfErr.Forbidden{Source: "service/organizationService#changeOwnership", Message: "caller is not authenticated"}
+	}
+	userFp, err := os.findMemberFingerPrint(orgId, userId, ctx)
+	if err != nil {
+		return err
+	}
+
+	change, err := org.CreateOwnershipChange(action, userFp, callerFp)
+	if err != nil {
+		return err
+	}
+	err = os.orgRepo.ChangeOwnership(orgId, change, ctx)
+	if err != nil {
+		os.log.Error(fmt.Sprintf("event=changeOwnershipFailure :: orgId=%s :: userId=%s :: ownershipAction=%s :: err=%v", orgId, userId, action, err))
+		return err
+	}
+	return nil
+}
+
+// findMemberFingerPrint resolves the user id used in the API to the fingerprint members are keyed by
+func (os *organizationService) findMemberFingerPrint(orgId string, userId string, ctx context.Context) (string, error) {
+	if orgId == "" || userId == "" {
+		return "", &xrfErr.External{Source: "service/organizationService#findMemberFingerPrint", Message: "Invalid org or user id"}
+	}
+	savedUser, err := os.userRepo.GetUserById(userId, ctx)
+	if err != nil {
+		return "", err
+	}
+	if savedUser.FingerPrint == "" {
+		return "", &xrfErr.External{Source: "service/organizationService#findMemberFingerPrint", Message: constants.NotOrgMemberErrMsg}
+	}
+	return savedUser.FingerPrint, nil
+}
+
+func (os *organizationService) ListOrgs(request exchange.OrgListRequest, ctx context.Context) (*exchange.Page[exchange.OrgResponse], error) {
+	callerFp, _ := internal.UserFingerprint(ctx)
+	page, err := os.findOrgPage(callerFp, request, os.orgRepo.FindOrgs, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	orgPage := &exchange.Page[exchange.OrgResponse]{Items: make([]exchange.OrgResponse, 0), Limit: page.Limit, HasMore: page.HasMore, NextCursor: page.NextCursor}
+	for _, foundOrg := range page.Items {
+		orgPage.Items = append(orgPage.Items, *toOrgResponse(&foundOrg))
+	}
+	return orgPage, nil
+}
+
+// FindUserOrgs lists the orgs the user is a member of with the user's permissions and roles in each org, resolved
+// like FindOrgMembers resolves them. Users can only list their own orgs
+func (os *organizationService) FindUserOrgs(userId string, request exchange.OrgListRequest, ctx context.Context) (*exchange.Page[exchange.UserOrgResponse], error) {
+	callerFp, ok := internal.UserFingerprint(ctx)
+	if !ok {
+		return nil, &xrfErr.Forbidden{Source: "service/organizationService#findUserOrgs", Message: "caller is not authenticated"}
+	}
+	if userId == "" {
+		return nil, &xrfErr.External{Source: "service/organizationService#findUserOrgs", Message: "Invalid user id"}
+	}
+	savedUser, err := os.userRepo.GetUserById(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if savedUser.FingerPrint != callerFp {
+		return nil, &xrfErr.Forbidden{Source: "service/organizationService#findUserOrgs", Message: "users can only list their own orgs"}
+	}
+
+	request.MemberOnly = true
+	page, err := os.findOrgPage(callerFp, request, os.orgRepo.FindMemberOrgs, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	orgIds := make([]string, 0, len(page.Items))
+	roleIds := make([]string, 0)
+	for _, foundOrg := range page.Items {
+		orgIds = append(orgIds, foundOrg.Id)
+		roleIds = append(roleIds, foundOrg.Members[callerFp].Roles...)
+	}
+	foundRoles, err := os.roleRepo.FindRolesByIds(roleIds, ctx)
+	if err != nil {
+		os.log.Error(fmt.Sprintf("event=findUserOrgs :: action=findRoles :: userId=%s :: err=%v", userId, err))
+		return nil, err
+	}
+	// every permission visible in the orgs, implications are resolved against those of each org
+	visiblePermissions, err := os.permissionRepo.FindPermissionsVisibleIn(orgIds, ctx)
+	if err != nil {
+		os.log.Error(fmt.Sprintf("event=findUserOrgs :: action=findPermissions :: userId=%s :: err=%v", userId, err))
+		return nil, err
+	}
+	roleNames := make(map[string]string)
+	for _, foundRole := range foundRoles {
+		roleNames[foundRole.Id] = foundRole.Name
+	}
+
+	userOrgPage := &exchange.Page[exchange.UserOrgResponse]{Items: make([]exchange.UserOrgResponse, 0), Limit: page.Limit, HasMore: page.HasMore, NextCursor: page.NextCursor}
+	for _, foundOrg := range page.Items {
+		orgPermissions := make([]org.Permission, 0, len(visiblePermissions))
+		for _, permission := range visiblePermissions {
+			if permission.OrgId == "" || permission.OrgId == foundOrg.Id {
+				orgPermissions = append(orgPermissions, permission)
+			}
+		}
+		graph := org.NewPermissionGraph(orgPermissions)
+		member := foundOrg.Members[callerFp]
+		granted := member.GrantedPermissions(foundRoles)
+		userOrgPage.Items = append(userOrgPage.Items, exchange.UserOrgResponse{
+			OrgResponse:          *toOrgResponse(&foundOrg),
+			IsOwner:              member.Owner,
+			Permissions:          graph.Names(member.Permissions),
+			Roles:                namesOf(member.Roles, roleNames),
+			GrantedPermissions:   graph.Names(granted),
+			EffectivePermissions: graph.Names(graph.Effective(granted)),
+		})
+	}
+	return userOrgPage, nil
+}
+
+// findOrgPage finds one page of the orgs the viewer can see with the find function
+func (os *organizationService) findOrgPage(viewerFp string,
+	request exchange.OrgListRequest,
+	find func(*org.ListFilter, context.Context) ([]org.Organization, error),
+	ctx context.Context) (*exchange.Page[org.Organization], error) {
+	filter, err := org.CreateListFilter(viewerFp, request.Limit, request.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	filter.Category = request.Category
+	filter.IsAnonymous = request.IsAnonymous
+	filter.CreatedAfter = request.CreatedAfter
+	filter.CreatedBefore = request.CreatedBefore
+	filter.MemberOnly = request.MemberOnly
+
+	// one more org than the limit tells if there is a next page
+	query := *filter
+	query.Limit = filter.Limit + 1
+	foundOrgs, err := find(&query, ctx)
+	if err != nil {
+		os.log.Error(fmt.Sprintf("event=findOrgsFailure :: requestId=%s :: err=%v", internal.RequestId(ctx), err))
+		return nil, err
+	}
+
+	page := &exchange.Page[org.Organization]{Items: foundOrgs, Limit: filter.Limit}
+	if len(foundOrgs) > filter.Limit {
+		page.Items = foundOrgs[:filter.Limit]
+		page.HasMore = true
+		page.NextCursor = org.CursorOf(&page.Items[filter.Limit-1]).Encode()
+	}
+	return page, nil
+}
+
+// FindOrgMembers lists the members with their direct permissions and roles, the permissions these grant and
+// the effective permissions once implications are resolved
 func (os *organizationService) FindOrgMembers(orgId string, ctx context.Context) ([]exchange.OrgMemberResponse, error) {
 	savedOrg, err := os.orgRepo.GetOrgById(orgId, ctx)
 	if err != nil {
 		os.log.Error(fmt.Sprintf("event=findOrgMembers action=findOrgFailed :: orgId=%s :: err=%v", orgId, err))
 		return nil, err
 	}
-	uniquePermissionIds := make(map[string]string)
-
-	userPermissionMap := make(map[string][]string)
+	uniqueRoleIds := make(map[string]bool)
 	userFps := make([]string, 0)
 
 	for key, value := range savedOrg.Members { // key is user's fingerPrint
 		userFps = append(userFps, key)
-		// add everyUsers unique permissionId
-		for _, permissionId := range value.Permissions {
-			uniquePermissionIds[permissionId] = ""
+		for _, roleId := range value.Roles {
+			uniqueRoleIds[roleId] = true
 		}
-		userPermissionMap[key] = value.Permissions
 	}
-
-	allPermission := make([]string, 0)
-	for _, permId := range uniquePermissionIds {
-		allPermission = append(allPermission, permId)
+	allRoles := make([]string, 0, len(uniqueRoleIds))
+	for roleId := range uniqueRoleIds {
+		allRoles = append(allRoles, roleId)
 	}
 
 	var wg sync.WaitGroup
@@ -94,24 +365,28 @@ func (os *organizationService) FindOrgMembers(orgId string, ctx context.Context)
 	var foundUsers []user.User
 
 	// Call DB to find all users info asynchronously
-	//dbCtx, dbCancel := context.WithTimeout(ctx, 5*time.Second)
-	//defer dbCancel() // defer the Cancelling the dbCtx context after goroutines are done.
 	go func() {
 		defer wg.Done()
 		foundUsers, usersErr = os.userRepo.FindUsersByFingerPrints(userFps, ctx)
-		if err != nil {
-			os.log.Error(fmt.Sprintf("event=findOrgMembers :: action=findUsersByFingerPrints :: err=%v", err))
+		if usersErr != nil {
+			os.log.Error(fmt.Sprintf("event=findOrgMembers :: action=findUsersByFingerPrints :: err=%v", usersErr))
 		}
 	}()
 
 	var permissionErr error
-	var foundPermissions []org.Permission
-	// Call DB to get detailed info about each permission asynchronously
+	var foundRoles []org.Role
+	var allPermissions []org.Permission
+	// Call DB to get the members' roles and every permission, implications are resolved against all of them
 	go func() {
 		defer wg.Done()
-		foundPermissions, permissionErr = os.permissionRepo.FindPermissionsByIds(allPermission, ctx)
-		if err != nil {
-			os.log.Error(fmt.Sprintf("event=findOrgMembers :: action=findPermissions :: err=%v", err))
+		foundRoles, permissionErr = os.roleRepo.FindRolesByIds(allRoles, ctx)
+		if permissionErr != nil {
+			os.log.Error(fmt.Sprintf("event=findOrgMembers :: action=findRoles :: err=%v", permissionErr))
+			return
+		}
+		allPermissions, permissionErr = os.permissionRepo.FindOrgPermissions(orgId, ctx)
+		if permissionErr != nil {
+			os.log.Error(fmt.Sprintf("event=findOrgMembers :: action=findPermissions :: err=%v", permissionErr))
 		}
 	}()
 
@@ -125,21 +400,24 @@ func (os *organizationService) FindOrgMembers(orgId string, ctx context.Context)
 		return nil, permissionErr
 	}
 
-	for _, foundPermission := range foundPermissions {
-		uniquePermissionIds[foundPermission.Id] = foundPermission.Name
+	roleNames := make(map[string]string)
+	for _, foundRole := range foundRoles {
+		roleNames[foundRole.Id] = foundRole.Name
 	}
 
+	graph := org.NewPermissionGraph(allPermissions)
 	response := make([]exchange.OrgMemberResponse, 0)
 
 	for _, foundUser := range foundUsers {
-		userPermissions := make([]string, 0)
-		for _, userPermission := range userPermissionMap[foundUser.FingerPrint] {
-			userPermissions = append(userPermissions, uniquePermissionIds[userPermission])
-		}
+		member := savedOrg.Members[foundUser.FingerPrint]
+		granted := member.GrantedPermissions(foundRoles)
 		response = append(response, exchange.OrgMemberResponse{
-			Permissions: userPermissions,
-			UserId:      foundUser.Id,
-			Email:       foundUser.Email,
+			Permissions:          graph.Names(member.Permissions),
+			Roles:                namesOf(member.Roles, roleNames),
+			GrantedPermissions:   graph.Names(granted),
+			EffectivePermissions: graph.Names(graph.Effective(granted)),
+			UserId:               foundUser.Id,
+			Email:                foundUser.Email,
 		})
 	}
 
@@ -157,30 +435,22 @@ func (os *organizationService) findOrg(orgId string, ctx context.Context) (*org.
 	return savedOrg, nil
 }
 
-func (os *organizationService) validateAndCreateMembers(req []exchange.OrgMemberRequest, ctx context.Context) (map[string]org.Member, error) {
+// validateAndCreateMembers resolves the users and the permissions they get in the org, orgId is "" for a new org
+func (os *organizationService) validateAndCreateMembers(orgId string, req []exchange.OrgMemberRequest, ctx context.Context) (map[string]org.Member, error) {
 	externalErr := &xrfErr.External{Source: "service/organization#validateAndCreateMembers"}
 	if req == nil || len(req) == 0 {
 		externalErr.Message = "an org should have at least one member"
 		return nil, externalErr
 	}
-	hasOwner := false
 	userEmails := make([]string, 0)
 	seenMembers := make(map[string]bool) // avoid duplicates
 	for _, member := range req {
 		if !seenMembers[member.Email] {
 			userEmails = append(userEmails, member.Email)
-			if member.Owner {
-				hasOwner = true
-			}
 			seenMembers[member.Email] = true
 		}
 	}
 
-	if !hasOwner {
-		externalErr.Message = "an org should have at least one owner"
-		return nil, externalErr
-	}
-
 	foundUsers, err := os.userRepo.FindUsersByEmails(userEmails, ctx)
 	if err != nil {
 		os.log.Error(fmt.Sprintf("event=validateAndCreateMembers :: err=%v", err))
@@ -196,12 +466,17 @@ func (os *organizationService) validateAndCreateMembers(req []exchange.OrgMember
 		isOwner       bool
 		userFp        string
 		permissionIds []string
+		roleIds       []string
 	})
 
 	missingUsers := make([]string, 0)
 
 	for _, member := range req {
-		permissionMap, err := os.validatePermissions(member.Permissions, ctx)
+		permissionMap, err := os.validatePermissions(orgId, member.Permissions, ctx)
+		if err != nil {
+			return nil, err
+		}
+		roleMap, err := os.validateRoles(member.Roles, ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -215,10 +490,12 @@ func (os *organizationService) validateAndCreateMembers(req []exchange.OrgMember
 				isOwner       bool
 				userFp        string
 				permissionIds []string
+				roleIds       []string
 			}{
 				isOwner:       member.Owner,
 				userFp:        userObj.FingerPrint,
 				permissionIds: getUserPermissions(permissionMap, member.Permissions),
+				roleIds:       getUserPermissions(roleMap, member.Roles),
 			}
 		}
 	}
@@ -231,41 +508,85 @@ func (os *organizationService) validateAndCreateMembers(req []exchange.OrgMember
 
 	orgMembers := make(map[string]org.Member)
 	for _, value := range memberMap {
-		orgMembers[value.userFp] = *org.CreateMember(value.userFp, value.isOwner, value.permissionIds)
+		orgMember := org.CreateMember(value.userFp, value.isOwner, value.permissionIds)
+		if len(value.roleIds) > 0 {
+			orgMember.Roles = value.roleIds
+		}
+		orgMembers[value.userFp] = *orgMember
 	}
 	return orgMembers, nil
 }
 
-func (os *organizationService) validatePermissions(permissions []string, ctx context.Context) (map[string]string, error) {
+func (os *organizationService) validatePermissions(orgId string, permissions []string, ctx context.Context) (map[string]string, error) {
+	return validatePermissions(orgId, permissions, os.permissionRepo, os.log, ctx)
+}
+
+// validateRoles maps the role names to their ids, it fails if one of the roles doesn't exist
+func (os *organizationService) validateRoles(roles []string, ctx context.Context) (map[string]string, error) {
+	roleMap := make(map[string]string)
+	if len(roles) == 0 {
+		return roleMap, nil
+	}
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, strings.ToUpper(role))
+	}
+	savedRoles, err := os.roleRepo.FindRolesByNames(names, ctx)
+	if err != nil {
+		os.log.Error(fmt.Sprintf("event=validateRoles :: names=%v :: err=%v", roles, err))
+		return nil, err
+	}
+	for _, role := range savedRoles {
+		roleMap[role.Name] = role.Id
+	}
+
+	missingRoles := make([]string, 0)
+	for i, role := range roles {
+		if roleId, ok := roleMap[names[i]]; ok {
+			roleMap[role] = roleId
+		} else {
+			missingRoles = append(missingRoles, role)
+		}
+	}
+	if len(missingRoles) > 0 {
+		return nil, &xrfErr.External{
+			Source:  "service/organization#validateRoles",
+			Message: fmt.Sprintf("unknown roles %v", missingRoles),
+		}
+	}
+	return roleMap, nil
+}
+
+// validatePermissions maps the permission names to the ids of the global or org-scoped permissions with those names,
+// org-scoped permissions win over global ones. It fails if one of the permissions doesn't exist, orgId "" only
+// resolves global permissions
+func validatePermissions(orgId string, permissions []string, permissionRepo repository.PermissionRepository, log internal.Logger, ctx context.Context) (map[string]string, error) {
 	for _, permission := range permissions {
 		if err := validatePermissionName(permission); err != nil {
 			return nil, err
 		}
 	}
 
-	savedPermissions, err := os.permissionRepo.FindPermissionsByNames(permissions, ctx)
+	savedPermissions, err := permissionRepo.FindPermissionsByNames(orgId, permissions, ctx)
 	if err != nil {
-		os.log.Error(fmt.Sprintf("event=validatePermissions:: name=%s :: err=%v", permissions, err))
+		log.Error(fmt.Sprintf("event=validatePermissions :: orgId=%s :: name=%s :: err=%v", orgId, permissions, err))
 		return nil, err
 	}
-	permissionLen := len(permissions)
-	savedPermissionsLen := len(savedPermissions)
 	permissionMap := make(map[string]string)
 	// map permissions to their ids
 	for _, permission := range savedPermissions {
-		permissionMap[permission.Name] = permission.Id
+		if _, shadowed := permissionMap[permission.Name]; !shadowed || permission.OrgId != "" {
+			permissionMap[permission.Name] = permission.Id
+		}
 	}
 
-	if permissionLen != savedPermissionsLen {
-		missingPermissions := make([]string, permissionLen-savedPermissionsLen)
-
-		for _, permission := range permissions {
-			_, ok := permissionMap[permission]
-			if !ok {
-				missingPermissions = append(missingPermissions, permission)
-			}
+	missingPermissions := make([]string, 0)
+	for _, permission := range permissions {
+		if _, ok := permissionMap[permission]; !ok {
+			missingPermissions = append(missingPermissions, permission)
 		}
-
+	}
+	if len(missingPermissions) > 0 {
 		return nil, &xrfErr.External{
 			Source:  "service/organization#validatePermissions",
 			Message: fmt.Sprintf("unknown permisions ['%v']", missingPermissions),
@@ -282,6 +603,15 @@ func getUserPermissions(permissionMap map[string]string, permissionIds []string)
 	return result
 }
 
+func hasOwner(members map[string]org.Member) bool {
+	for _, member := range members {
+		if member.Owner {
+			return true
+		}
+	}
+	return false
+}
+
 func validateOrgName(name string) error {
 	externalErr := &xrfErr.External{Source: "service/organization#validateOrgName"}
 	if name == "" || len(name) < 3 || len(name) > 255 {
@@ -298,7 +628,7 @@ func toOrgResponse(domainOrg *org.Organization) *exchange.OrgResponse {
 		CreatedAt:    domainOrg.CreatedAt,
 		Description:  domainOrg.Description,
 		Name:         domainOrg.DisplayName,
-		MembersCount: len(domainOrg.Members),
+		MembersCount: len(domainOrg.MemberFps),
 		IsAnonymous:  domainOrg.IsAnonymous,
 	}
 }
@@ -310,5 +640,6 @@ func NewOrganizationService(config xrf.Security, logger internal.Logger, allRepo
 		orgRepo:        allRepos.OrgRepo,
 		userRepo:       allRepos.UserRepo,
 		permissionRepo: allRepos.PermissionRepo,
+		roleRepo:       allRepos.RoleRepo,
 	}
 }
@@ -0,0 +1,443 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+	"time"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/core/model/user"
+	"xrf197ilz35aq0/core/repository"
+	xrf "xrf197ilz35aq0/internal"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	xrfTest "xrf197ilz35aq0/internal/tests"
+)
+
+func newOrgTestRepos(orgs ...*org.Organization) *repository.Repositories {
+	return &repository.Repositories{
+		OrgRepo:        xrfTest.NewOrgRepositoryMock(orgs...),
+		UserRepo:       xrfTest.NewUserRepositoryMock(),
+		PermissionRepo: xrfTest.NewPermissionRepositoryMock(),
+		RoleRepo:       xrfTest.NewRoleRepositoryMock(),
+	}
+}
+
+func newTestOrg(t *testing.T, name string, members map[string]org.Member) *org.Organization {
+	t.Helper()
+	if members == nil {
+		members = map[string]org.Member{ownerFp: *org.CreateMember(ownerFp, true, []string{})}
+	}
+	testOrg, err := org.CreateOrganization(name, "", "", false, members)
+	xrf.AssertNoError(t, err)
+	return testOrg
+}
+
+func TestOrgServiceUpdateOrg(t *testing.T) {
+	existingOrg := newTestOrg(t, "xrfExisting", nil)
+	targetOrg := newTestOrg(t, "xrfTarget", nil)
+	orgService := NewOrganizationService(securityConfig, xrf.NewTestLogger(), newOrgTestRepos(existingOrg, targetOrg))
+
+	validName := " xrfRenamed "
+	shortName := "xr"
+	takenName := "XRFExisting"
+	description := "a new description"
+
+	tests := []struct {
+		name    string
+		orgId   string
+		request exchange.OrgUpdateRequest
+		wantErr bool
+	}{
+		{name: "renames the org", orgId: targetOrg.Id, request: exchange.OrgUpdateRequest{Name: &validName}},
+		{name: "updates only the description", orgId: targetOrg.Id, request: exchange.OrgUpdateRequest{Description: &description}},
+		{name: "rejects an empty update", orgId: targetOrg.Id, request: exchange.OrgUpdateRequest{}, wantErr: true},
+		{name: "rejects a short name", orgId: targetOrg.Id, request: exchange.OrgUpdateRequest{Name: &shortName}, wantErr: true},
+		{name: "rejects a name used by another org", orgId: targetOrg.Id, request: exchange.OrgUpdateRequest{Name: &takenName}, wantErr: true},
+		{name: "rejects an unknown org", orgId: "000", request: exchange.OrgUpdateRequest{Description: &description}, wantErr: true},
+		{name: "rejects an empty org id", orgId: "", request: exchange.OrgUpdateRequest{Description: &description}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orgService.UpdateOrg(tt.orgId, tt.request, context.TODO())
+			if tt.wantErr {
+				xrf.AssertError(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			xrf.AssertNoError(t, err)
+			if tt.request.Name != nil {
+				assert.Equal(t, "xrfRenamed", got.Name)
+			}
+			if tt.request.Description != nil {
+				assert.Equal(t, description, got.Description)
+			}
+		})
+	}
+}
+
+func TestOrgServiceMembers(t *testing.T) {
+	memberPermission := *org.CreatePermission(org.MembersPermission, "manage members")
+	repos := newOrgTestRepos()
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(readPermission, memberPermission)
+
+	users := map[string]*user.User{
+		ownerFp:  {Id: "1", FingerPrint: ownerFp, Email: "owner@xrf.com"},
+		readerFp: {Id: "2", FingerPrint: readerFp, Email: "reader@xrf.com"},
+		writerFp: {Id: "3", FingerPrint: writerFp, Email: "writer@xrf.com"},
+	}
+	for _, testUser := range users {
+		_, err := repos.UserRepo.CreateUser(testUser, context.TODO())
+		xrf.AssertNoError(t, err)
+	}
+
+	testOrg := newTestOrg(t, "xrfMembers", nil)
+	_, err := repos.OrgRepo.Create(testOrg, context.TODO())
+	xrf.AssertNoError(t, err)
+	orgService := NewOrganizationService(securityConfig, xrf.NewTestLogger(), repos)
+	ctx := context.TODO()
+
+	t.Run("adds members with their permissions", func(t *testing.T) {
+		err := orgService.AddMembers(testOrg.Id, []exchange.OrgMemberRequest{
+			{Email: users[readerFp].Email, Permissions: []string{org.ReadPermission}},
+			{Email: users[writerFp].Email, Permissions: []string{}},
+		}, ctx)
+		xrf.AssertNoError(t, err)
+
+		member, err := repos.OrgRepo.FindOrgMember(testOrg.Id, readerFp, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, []string{readPermission.Id}, member.Permissions)
+	})
+
+	t.Run("rejects existing members, unknown emails and unknown permissions", func(t *testing.T) {
+		requests := [][]exchange.OrgMemberRequest{
+			{{Email: users[readerFp].Email}},
+			{{Email: "unknown@xrf.com"}},
+			{{Email: "unknown@xrf.com", Permissions: []string{"ORG_UNKNOWN"}}},
+			{},
+		}
+		for _, request := range requests {
+			xrf.AssertError(t, orgService.AddMembers(testOrg.Id, request, ctx))
+		}
+		xrf.AssertError(t, orgService.AddMembers("000", []exchange.OrgMemberRequest{{Email: users[readerFp].Email}}, ctx))
+	})
+
+	t.Run("replaces a member's permissions", func(t *testing.T) {
+		err := orgService.UpdateMemberPermissions(testOrg.Id, users[readerFp].Id, []string{org.MembersPermission}, ctx)
+		xrf.AssertNoError(t, err)
+
+		member, err := repos.OrgRepo.FindOrgMember(testOrg.Id, readerFp, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, []string{memberPermission.Id}, member.Permissions)
+
+		xrf.AssertError(t, orgService.UpdateMemberPermissions(testOrg.Id, users[readerFp].Id, []string{"ORG_UNKNOWN"}, ctx))
+		xrf.AssertError(t, orgService.UpdateMemberPermissions(testOrg.Id, "unknownUserId", []string{}, ctx))
+	})
+
+	t.Run("removes members but never the last owner", func(t *testing.T) {
+		xrf.AssertNoError(t, orgService.RemoveMember(testOrg.Id, users[writerFp].Id, ctx))
+		member, err := repos.OrgRepo.FindOrgMember(testOrg.Id, writerFp, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Nil(t, member)
+
+		xrf.AssertError(t, orgService.RemoveMember(testOrg.Id, users[writerFp].Id, ctx))
+		xrf.AssertError(t, orgService.RemoveMember(testOrg.Id, users[ownerFp].Id, ctx))
+	})
+}
+
+func TestOrgServiceMemberRoles(t *testing.T) {
+	repos := newOrgTestRepos()
+	impliesRead := writePermission
+	impliesRead.Implies = []string{readPermission.Id}
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(readPermission, impliesRead)
+	repos.RoleRepo = xrfTest.NewRoleRepositoryMock(editorRole)
+
+	users := map[string]*user.User{
+		ownerFp:  {Id: "1", FingerPrint: ownerFp, Email: "owner@xrf.com"},
+		editorFp: {Id: "2", FingerPrint: editorFp, Email: "editor@xrf.com"},
+	}
+	for _, testUser := range users {
+		_, err := repos.UserRepo.CreateUser(testUser, context.TODO())
+		xrf.AssertNoError(t, err)
+	}
+
+	testOrg := newTestOrg(t, "xrfRoles", nil)
+	_, err := repos.OrgRepo.Create(testOrg, context.TODO())
+	xrf.AssertNoError(t, err)
+	orgService := NewOrganizationService(securityConfig, xrf.NewTestLogger(), repos)
+	ctx := context.TODO()
+
+	t.Run("adds members with roles and direct permissions", func(t *testing.T) {
+		err := orgService.AddMembers(testOrg.Id, []exchange.OrgMemberRequest{
+			{Email: users[editorFp].Email, Permissions: []string{org.WritePermission}, Roles: []string{"org_editor"}},
+		}, ctx)
+		xrf.AssertNoError(t, err)
+
+		member, err := repos.OrgRepo.FindOrgMember(testOrg.Id, editorFp, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, []string{editorRole.Id}, member.Roles)
+		assert.Equal(t, []string{writePermission.Id}, member.Permissions)
+	})
+
+	t.Run("members show direct, role, granted and effective permissions", func(t *testing.T) {
+		members, err := orgService.FindOrgMembers(testOrg.Id, ctx)
+		xrf.AssertNoError(t, err)
+		for _, member := range members {
+			if member.UserId != users[editorFp].Id {
+				continue
+			}
+			assert.Equal(t, []string{org.WritePermission}, member.Permissions)
+			assert.Equal(t, []string{editorRole.Name}, member.Roles)
+			assert.Equal(t, []string{org.WritePermission, org.ReadPermission}, member.GrantedPermissions)
+			assert.Equal(t, []string{org.WritePermission, org.ReadPermission}, member.EffectivePermissions)
+		}
+		assert.Len(t, members, 2)
+	})
+
+	t.Run("replaces a member's roles", func(t *testing.T) {
+		xrf.AssertError(t, orgService.UpdateMemberRoles(testOrg.Id, users[editorFp].Id, []string{"ORG_UNKNOWN"}, ctx))
+		xrf.AssertNoError(t, orgService.UpdateMemberRoles(testOrg.Id, users[editorFp].Id, []string{}, ctx))
+
+		member, err := repos.OrgRepo.FindOrgMember(testOrg.Id, editorFp, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Empty(t, member.Roles)
+
+		// the write permission still implies the read permission the role granted
+		members, err := orgService.FindOrgMembers(testOrg.Id, ctx)
+		xrf.AssertNoError(t, err)
+		for _, member := range members {
+			if member.UserId == users[editorFp].Id {
+				assert.Equal(t, []string{org.WritePermission}, member.GrantedPermissions)
+				assert.Equal(t, []string{org.WritePermission, org.ReadPermission}, member.EffectivePermissions)
+			}
+		}
+	})
+}
+
+func TestOrgServiceOwnership(t *testing.T) {
+	repos := newOrgTestRepos()
+	owner := &user.User{Id: "1", FingerPrint: ownerFp, Email: "owner@xrf.com"}
+	member := &user.User{Id: "2", FingerPrint: writerFp, Email: "member@xrf.com"}
+	for _, testUser := range []*user.User{owner, member} {
+		_, err := repos.UserRepo.CreateUser(testUser, context.TODO())
+		xrf.AssertNoError(t, err)
+	}
+
+	testOrg := newTestOrg(t, "xrfOwners", map[string]org.Member{
+		ownerFp:  *org.CreateMember(ownerFp, true, []string{}),
+		writerFp: *org.CreateMember(writerFp, false, []string{}),
+	})
+	_, err := repos.OrgRepo.Create(testOrg, context.TODO())
+	xrf.AssertNoError(t, err)
+	orgService := NewOrganizationService(securityConfig, xrf.NewTestLogger(), repos)
+
+	ownerCtx := xrf.WithUserFingerprint(context.TODO(), ownerFp)
+	memberCtx := xrf.WithUserFingerprint(context.TODO(), writerFp)
+	isOwner := func(userFp string) bool {
+		savedMember, err := repos.OrgRepo.FindOrgMember(testOrg.Id, userFp, context.TODO())
+		xrf.AssertNoError(t, err)
+		return savedMember.Owner
+	}
+
+	t.Run("an org is never left without an owner", func(t *testing.T) {
+		err := orgService.DemoteOwner(testOrg.Id, owner.Id, ownerCtx)
+		xrf.AssertError(t, err)
+		assert.True(t, isOwner(ownerFp))
+	})
+
+	t.Run("members that are not owners can not change ownership", func(t *testing.T) {
+		err := orgService.PromoteOwner(testOrg.Id, member.Id, memberCtx)
+		var forbiddenErr *xrfErr.Forbidden
+		assert.True(t, errors.As(err, &forbiddenErr))
+		assert.False(t, isOwner(writerFp))
+
+		err = orgService.PromoteOwner(testOrg.Id, member.Id, context.TODO())
+		assert.True(t, errors.As(err, &forbiddenErr))
+	})
+
+	t.Run("owners can be promoted and demoted", func(t *testing.T) {
+		xrf.AssertNoError(t, orgService.PromoteOwner(testOrg.Id, member.Id, ownerCtx))
+		assert.True(t, isOwner(writerFp))
+		xrf.AssertNoError(t, orgService.DemoteOwner(testOrg.Id, member.Id, ownerCtx))
+		assert.False(t, isOwner(writerFp))
+	})
+
+	t.Run("transfer hands over the caller's ownership", func(t *testing.T) {
+		xrf.AssertError(t, orgService.TransferOwnership(testOrg.Id, owner.Id, ownerCtx))
+		xrf.AssertNoError(t, orgService.TransferOwnership(testOrg.Id, member.Id, ownerCtx))
+		assert.True(t, isOwner(writerFp))
+		assert.False(t, isOwner(ownerFp))
+	})
+
+	t.Run("every change is recorded", func(t *testing.T) {
+		history := testOrg.OwnershipHistory
+		assert.Len(t, history, 3)
+		assert.Equal(t, org.TransferOwner, history[2].Action)
+		assert.Equal(t, writerFp, history[2].UserFp)
+		assert.Equal(t, ownerFp, history[2].ChangedBy)
+	})
+}
+
+func TestOrgServiceListOrgs(t *testing.T) {
+	repos := newOrgTestRepos()
+	created := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	outsiderMembers := map[string]org.Member{outsiderFp: *org.CreateMember(outsiderFp, true, []string{})}
+
+	orgs := []*org.Organization{
+		newTestOrg(t, "xrfFirst", nil),
+		newTestOrg(t, "xrfSecond", nil),
+		newTestOrg(t, "xrfThird", outsiderMembers),
+		newTestOrg(t, "xrfFourth", outsiderMembers),
+		newTestOrg(t, "xrfHidden", outsiderMembers),
+		newTestOrg(t, "xrfFifth", nil),
+	}
+	for i, testOrg := range orgs {
+		// two orgs created at the same time must still be listed once each
+		testOrg.CreatedAt = created.Add(time.Duration(i/2) * time.Hour)
+		testOrg.Category = "finance"
+		_, err := repos.OrgRepo.Create(testOrg, context.TODO())
+		xrf.AssertNoError(t, err)
+	}
+	orgs[1].Category = "sports"
+	orgs[4].IsAnonymous = true
+
+	orgService := NewOrganizationService(securityConfig, xrf.NewTestLogger(), repos)
+	ctx := xrf.WithUserFingerprint(context.TODO(), ownerFp)
+
+	listAll := func(request exchange.OrgListRequest) []string {
+		names := make([]string, 0)
+		for {
+			page, err := orgService.ListOrgs(request, ctx)
+			xrf.AssertNoError(t, err)
+			assert.LessOrEqual(t, len(page.Items), request.Limit)
+			for _, item := range page.Items {
+				names = append(names, item.Name)
+			}
+			if !page.HasMore {
+				return names
+			}
+			request.Cursor = page.NextCursor
+		}
+	}
+
+	t.Run("pages through every visible org newest first", func(t *testing.T) {
+		names := listAll(exchange.OrgListRequest{Limit: 2})
+		assert.Len(t, names, 5)
+		assert.NotContains(t, names, "xrfHidden")
+		assert.Equal(t, "xrfFifth", names[0])
+		assert.ElementsMatch(t, []string{"xrfFirst", "xrfSecond"}, names[3:])
+	})
+
+	t.Run("filters by membership, category and creation time", func(t *testing.T) {
+		names := listAll(exchange.OrgListRequest{Limit: 10, MemberOnly: true})
+		assert.ElementsMatch(t, []string{"xrfFirst", "xrfSecond", "xrfFifth"}, names)
+
+		names = listAll(exchange.OrgListRequest{Limit: 10, Category: "sports"})
+		assert.Equal(t, []string{"xrfSecond"}, names)
+
+		after := created.Add(30 * time.Minute)
+		before := created.Add(90 * time.Minute)
+		names = listAll(exchange.OrgListRequest{Limit: 10, CreatedAfter: &after, CreatedBefore: &before})
+		assert.ElementsMatch(t, []string{"xrfThird", "xrfFourth"}, names)
+	})
+
+	t.Run("anonymous orgs are listed for their members", func(t *testing.T) {
+		anonymous := true
+		page, err := orgService.ListOrgs(exchange.OrgListRequest{IsAnonymous: &anonymous}, xrf.WithUserFingerprint(context.TODO(), outsiderFp))
+		xrf.AssertNoError(t, err)
+		assert.Len(t, page.Items, 1)
+		assert.Equal(t, "xrfHidden", page.Items[0].Name)
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		_, err := orgService.ListOrgs(exchange.OrgListRequest{Cursor: "invalid"}, ctx)
+		xrf.AssertError(t, err)
+		_, err = orgService.ListOrgs(exchange.OrgListRequest{Limit: 1000}, ctx)
+		xrf.AssertError(t, err)
+		_, err = orgService.ListOrgs(exchange.OrgListRequest{}, context.TODO())
+		xrf.AssertError(t, err)
+	})
+}
+
+func TestOrgServiceFindUserOrgs(t *testing.T) {
+	repos := newOrgTestRepos()
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(readPermission, writePermission)
+	reader := &user.User{Id: "1", FingerPrint: readerFp, Email: "reader@xrf.com"}
+	_, err := repos.UserRepo.CreateUser(reader, context.TODO())
+	xrf.AssertNoError(t, err)
+
+	names := []string{"xrfOrgA", "xrfOrgB", "xrfOrgC"}
+	for i, name := range names {
+		members := map[string]org.Member{ownerFp: *org.CreateMember(ownerFp, true, []string{})}
+		if i > 0 {
+			members[readerFp] = *org.CreateMember(readerFp, i == 2, []string{readPermission.Id, writePermission.Id})
+		}
+		testOrg := newTestOrg(t, name, members)
+		testOrg.CreatedAt = testOrg.CreatedAt.Add(time.Duration(i) * time.Minute)
+		testOrg.IsAnonymous = i == 1
+		_, err := repos.OrgRepo.Create(testOrg, context.TODO())
+		xrf.AssertNoError(t, err)
+	}
+	orgService := NewOrganizationService(securityConfig, xrf.NewTestLogger(), repos)
+	readerCtx := xrf.WithUserFingerprint(context.TODO(), readerFp)
+
+	t.Run("lists the user's orgs with their membership", func(t *testing.T) {
+		page, err := orgService.FindUserOrgs(reader.Id, exchange.OrgListRequest{Limit: 1}, readerCtx)
+		xrf.AssertNoError(t, err)
+		assert.True(t, page.HasMore)
+		assert.Len(t, page.Items, 1)
+		assert.Equal(t, "xrfOrgC", page.Items[0].Name)
+		assert.True(t, page.Items[0].IsOwner)
+		assert.Equal(t, 2, page.Items[0].MembersCount)
+		assert.ElementsMatch(t, []string{org.ReadPermission, org.WritePermission}, page.Items[0].Permissions)
+
+		page, err = orgService.FindUserOrgs(reader.Id, exchange.OrgListRequest{Limit: 1, Cursor: page.NextCursor}, readerCtx)
+		xrf.AssertNoError(t, err)
+		assert.False(t, page.HasMore)
+		assert.Equal(t, "xrfOrgB", page.Items[0].Name)
+		assert.False(t, page.Items[0].IsOwner)
+	})
+
+	t.Run("membership changes are reflected", func(t *testing.T) {
+		page, err := orgService.FindUserOrgs(reader.Id, exchange.OrgListRequest{}, readerCtx)
+		xrf.AssertNoError(t, err)
+		xrf.AssertNoError(t, repos.OrgRepo.RemoveMember(page.Items[1].OrgId, readerFp, context.TODO()))
+
+		page, err = orgService.FindUserOrgs(reader.Id, exchange.OrgListRequest{}, readerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Len(t, page.Items, 1)
+	})
+
+	t.Run("permissions granted by roles are resolved", func(t *testing.T) {
+		repos.RoleRepo = xrfTest.NewRoleRepositoryMock(editorRole)
+		roleOrgService := NewOrganizationService(securityConfig, xrf.NewTestLogger(), repos)
+		roleOnly := newTestOrg(t, "xrfOrgD", map[string]org.Member{
+			ownerFp:  *org.CreateMember(ownerFp, true, []string{}),
+			readerFp: *org.CreateMember(readerFp, false, []string{}),
+		})
+		_, err := repos.OrgRepo.Create(roleOnly, context.TODO())
+		xrf.AssertNoError(t, err)
+		xrf.AssertNoError(t, repos.OrgRepo.SetMemberRoles(roleOnly.Id, readerFp, []string{editorRole.Id}, context.TODO()))
+
+		page, err := roleOrgService.FindUserOrgs(reader.Id, exchange.OrgListRequest{}, readerCtx)
+		xrf.AssertNoError(t, err)
+		index := slices.IndexFunc(page.Items, func(item exchange.UserOrgResponse) bool { return item.OrgId == roleOnly.Id })
+		if assert.GreaterOrEqual(t, index, 0) {
+			membership := page.Items[index]
+			assert.Empty(t, membership.Permissions)
+			assert.Equal(t, []string{editorRole.Name}, membership.Roles)
+			assert.ElementsMatch(t, []string{org.ReadPermission, org.WritePermission}, membership.GrantedPermissions)
+			assert.ElementsMatch(t, []string{org.ReadPermission, org.WritePermission}, membership.EffectivePermissions)
+		}
+	})
+
+	t.Run("users can only list their own orgs", func(t *testing.T) {
+		_, err := orgService.FindUserOrgs(reader.Id, exchange.OrgListRequest{}, xrf.WithUserFingerprint(context.TODO(), ownerFp))
+		var forbiddenErr *xrfErr.Forbidden
+		assert.True(t, errors.As(err, &forbiddenErr))
+		_, err = orgService.FindUserOrgs(reader.Id, exchange.OrgListRequest{}, context.TODO())
+		xrf.AssertError(t, err)
+	})
+}
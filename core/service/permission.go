@@ -2,39 +2,75 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"unicode"
 	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model"
+	"xrf197ilz35aq0/core/model/audit"
 	"xrf197ilz35aq0/core/model/org"
 	"xrf197ilz35aq0/core/repository"
 	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
 	xrfErr "xrf197ilz35aq0/internal/error"
 )
 
+// PermissionService manages global permissions and permissions scoped to an org. Only owners of an org can manage
+// its permissions and only its members can read them, global permissions are managed by admins
 type PermissionService interface {
 	CreatePermission(req *exchange.PermissionRequest, ctx context.Context) (string, error)
+	CreateOrgPermission(orgId string, req *exchange.PermissionRequest, ctx context.Context) (string, error)
+	ListOrgPermissions(orgId string, req exchange.PermissionListRequest, ctx context.Context) (*exchange.Page[exchange.PermissionResponse], error)
+	GetPermission(id string, ctx context.Context) (*exchange.PermissionResponse, error)
+	UpdatePermission(id string, req *exchange.PermissionUpdateRequest, ctx context.Context) (*exchange.PermissionResponse, error)
+	ListPermissions(req exchange.PermissionListRequest, ctx context.Context) (*exchange.Page[exchange.PermissionResponse], error)
+	DeletePermission(id string, cascade bool, ctx context.Context) (*exchange.PermissionDeleteResponse, error)
+	SetImplies(id string, req *exchange.PermissionImpliesRequest, ctx context.Context) (*exchange.PermissionResponse, error)
 }
 
+// maxReferences caps the orgs and the roles listed when a delete is refused
+const maxReferences = 50
+
 type permissionService struct {
 	log            internal.Logger
+	authorizer     Authorizer
+	orgRepo        repository.OrganizationRepository
+	roleRepo       repository.RoleRepository
+	auditRepo      repository.AuditRepository
 	permissionRepo repository.PermissionRepository
 }
 
 func (svc *permissionService) CreatePermission(req *exchange.PermissionRequest, ctx context.Context) (string, error) {
+	if err := svc.authorizer.AuthorizeAdmin(ctx); err != nil {
+		return "", err
+	}
+	return svc.createPermission("", req, ctx)
+}
+
+func (svc *permissionService) CreateOrgPermission(orgId string, req *exchange.PermissionRequest, ctx context.Context) (string, error) {
+	if err := svc.authorizer.AuthorizeOwner(orgId, ctx); err != nil {
+		return "", err
+	}
+	return svc.createPermission(orgId, req, ctx)
+}
+
+func (svc *permissionService) createPermission(orgId string, req *exchange.PermissionRequest, ctx context.Context) (string, error) {
 	err := validatePermissionName(req.Name)
 	if err != nil {
 		return "", err
 	}
 
-	newPermission := org.CreatePermission(req.Name, req.Name)
+	newPermission := org.CreateOrgPermission(orgId, req.Name, req.Description)
 	_, err = svc.permissionRepo.CreatePermission(newPermission, ctx)
 	if err != nil {
 		svc.log.Error(fmt.Sprintf("event=CreatePermission :: action=savePermissionToDB :: err=%v", err))
 		return "", err
 	}
 
-	savedPermission, err := svc.permissionRepo.FindPermissionByName(strings.ToUpper(req.Name), ctx)
+	savedPermission, err := svc.permissionRepo.FindPermissionByName(orgId, strings.ToUpper(req.Name), ctx)
 	if err != nil {
 		internalErr := &xrfErr.Internal{Err: err, Message: "internal error", Source: "core/service/permission#createPermission"}
 		svc.log.Error(fmt.Sprintf("event=CreatePermission :: action=savingPermissionToDB :: err=%v", err))
@@ -44,6 +80,305 @@ func (svc *permissionService) CreatePermission(req *exchange.PermissionRequest,
 	return savedPermission.Id, nil
 }
 
+func (svc *permissionService) GetPermission(id string, ctx context.Context) (*exchange.PermissionResponse, error) {
+	if id == "" {
+		return nil, &xrfErr.External{Source: "core/service/permission#getPermission", Message: "invalid permission id"}
+	}
+	permission, err := svc.permissionRepo.FindPermissionById(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if permission.OrgId != "" {
+		if err = svc.authorizer.Authorize(permission.OrgId, org.ReadPermission, ctx); err != nil {
+			return nil, err
+		}
+	}
+	return svc.toPermissionResponse(permission, ctx)
+}
+
+// UpdatePermission renames and/or describes the permission, names stay unique and uppercase. A renamed permission can
+// match other permissions' wildcards, renames that would create a cycle are rejected
+func (svc *permissionService) UpdatePermission(id string, req *exchange.PermissionUpdateRequest, ctx context.Context) (*exchange.PermissionResponse, error) {
+	if req.Name != nil {
+		if err := validatePermissionName(*req.Name); err != nil {
+			return nil, err
+		}
+	}
+	permission, err := svc.findManagedPermission(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = permission.Update(req.Name, req.Description); err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		orgPermissions, err := svc.permissionRepo.FindOrgPermissions(permission.OrgId, ctx)
+		if err != nil {
+			svc.log.Error(fmt.Sprintf("event=updatePermission :: action=findOrgPermissions :: permissionId=%s :: err=%v", id, err))
+			return nil, err
+		}
+		for i := range orgPermissions {
+			if orgPermissions[i].Id == id {
+				orgPermissions[i] = *permission
+			}
+		}
+		if err = org.NewPermissionGraph(orgPermissions).ValidateImplication(id, permission.Implies); err != nil {
+			return nil, err
+		}
+	}
+
+	err = svc.permissionRepo.UpdatePermission(permission, ctx)
+	if err != nil {
+		svc.log.Error(fmt.Sprintf("event=updatePermission :: permissionId=%s :: err=%v", id, err))
+		return nil, err
+	}
+	return svc.toPermissionResponse(permission, ctx)
+}
+
+// SetImplies replaces the permissions the permission implies, rules that would create a cycle are rejected
+// The permission can imply global permissions and, if it's org-scoped, permissions of its org
+func (svc *permissionService) SetImplies(id string, req *exchange.PermissionImpliesRequest, ctx context.Context) (*exchange.PermissionResponse, error) {
+	permission, err := svc.findManagedPermission(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+	orgPermissions, err := svc.permissionRepo.FindOrgPermissions(permission.OrgId, ctx)
+	if err != nil {
+		svc.log.Error(fmt.Sprintf("event=setImplies :: action=findOrgPermissions :: permissionId=%s :: err=%v", id, err))
+		return nil, err
+	}
+	graph := org.NewPermissionGraph(orgPermissions)
+
+	rules := make([]string, 0, len(req.Implies))
+	unknown := make([]string, 0)
+	for _, implied := range req.Implies {
+		rule := strings.ToUpper(strings.TrimSpace(implied))
+		if !org.IsWildcard(rule) {
+			var ok bool
+			if rule, ok = graph.Id(rule); !ok {
+				unknown = append(unknown, implied)
+				continue
+			}
+		}
+		if !slices.Contains(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, &xrfErr.External{Source: "core/service/permission#setImplies", Message: fmt.Sprintf("unknown permissions %v", unknown)}
+	}
+
+	if err = graph.ValidateImplication(id, rules); err != nil {
+		return nil, err
+	}
+	if err = svc.permissionRepo.SetPermissionImplies(id, rules, ctx); err != nil {
+		svc.log.Error(fmt.Sprintf("event=setImplies :: permissionId=%s :: err=%v", id, err))
+		return nil, err
+	}
+	permission.Implies = rules
+	return svc.toPermissionResponse(permission, ctx)
+}
+
+// findManagedPermission finds a permission the caller may change, only owners of its org can change org-scoped
+// permissions and only admins can change global ones. Members are authorized by permission name in every org, so a
+// renamed or re-implied global permission would change what members can do everywhere
+func (svc *permissionService) findManagedPermission(id string, ctx context.Context) (*org.Permission, error) {
+	permission, err := svc.permissionRepo.FindPermissionById(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if permission.OrgId != "" {
+		err = svc.authorizer.AuthorizeOwner(permission.OrgId, ctx)
+	} else {
+		err = svc.authorizer.AuthorizeAdmin(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return permission, nil
+}
+
+// ListPermissions lists global permissions by name, the cursor is the last name of the previous page
+func (svc *permissionService) ListPermissions(req exchange.PermissionListRequest, ctx context.Context) (*exchange.Page[exchange.PermissionResponse], error) {
+	return svc.listPermissions("", req, ctx)
+}
+
+// ListOrgPermissions lists the permissions scoped to the org, global permissions aren't included
+func (svc *permissionService) ListOrgPermissions(orgId string, req exchange.PermissionListRequest, ctx context.Context) (*exchange.Page[exchange.PermissionResponse], error) {
+	if err := svc.authorizer.Authorize(orgId, org.ReadPermission, ctx); err != nil {
+		return nil, err
+	}
+	return svc.listPermissions(orgId, req, ctx)
+}
+
+func (svc *permissionService) listPermissions(orgId string, req exchange.PermissionListRequest, ctx context.Context) (*exchange.Page[exchange.PermissionResponse], error) {
+	externalErr := &xrfErr.External{Source: "core/service/permission#listPermissions"}
+	if req.Limit < 0 || req.Limit > org.MaxListLimit {
+		externalErr.Message = "limit must be between 1 and 100"
+		return nil, externalErr
+	}
+	if req.Limit == 0 {
+		req.Limit = org.DefaultListLimit
+	}
+	afterName, err := base64.RawURLEncoding.DecodeString(req.Cursor)
+	if err != nil {
+		externalErr.Message = "invalid cursor"
+		return nil, externalErr
+	}
+
+	// one more permission than the limit tells if there is a next page
+	permissions, err := svc.permissionRepo.FindPermissions(orgId, string(afterName), req.Limit+1, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &exchange.Page[exchange.PermissionResponse]{Items: make([]exchange.PermissionResponse, 0), Limit: req.Limit}
+	if len(permissions) > req.Limit {
+		permissions = permissions[:req.Limit]
+		page.HasMore = true
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(permissions[req.Limit-1].Name))
+	}
+	impliedIds := make([]string, 0)
+	for _, permission := range permissions {
+		impliedIds = append(impliedIds, permission.Implies...)
+	}
+	impliedNames, err := findPermissionNames(impliedIds, svc.permissionRepo, ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range permissions {
+		page.Items = append(page.Items, *toPermissionResponse(&permission, impliedNames))
+	}
+	return page, nil
+}
+
+// DeletePermission deletes a permission no member or role holds. With cascade the permission is first removed from
+// every member, role and pending invitation, otherwise the delete is refused and the orgs and roles still using it are
+// returned. Both outcomes are audited. Global permissions are used by every org, only admins can delete them
+func (svc *permissionService) DeletePermission(id string, cascade bool, ctx context.Context) (*exchange.PermissionDeleteResponse, error) {
+	callerFp, ok := internal.UserFingerprint(ctx)
+	if !ok {
+		return nil, &xrfErr.Forbidden{Source: "core/service/permission#deletePermission", Message: "caller is not authenticated"}
+	}
+	permission, err := svc.findManagedPermission(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]any{constants.NAME: permission.Name, "cascade": cascade}
+	response := &exchange.PermissionDeleteResponse{PermissionId: id, Cascade: cascade}
+
+	if !cascade {
+		if err = svc.findReferences(response, ctx); err != nil {
+			return nil, err
+		}
+		if len(response.ReferencingOrgs) > 0 || len(response.ReferencingRoles) > 0 {
+			return svc.refuseDelete(response, callerFp, details, ctx)
+		}
+	}
+
+	entry := audit.CreateEntry(audit.PermissionDeleted, callerFp, audit.PermissionResource, id, details)
+	response.UpdatedOrgs, err = svc.permissionRepo.DeletePermission(id, cascade, entry, ctx)
+	if err != nil {
+		var externalErr *xrfErr.External
+		if !cascade && errors.As(err, &externalErr) && externalErr.Message == constants.PermissionInUseErrMsg {
+			// a member or a role was given the permission since its references were looked up
+			if err = svc.findReferences(response, ctx); err != nil {
+				return nil, err
+			}
+			return svc.refuseDelete(response, callerFp, details, ctx)
+		}
+		svc.log.Error(fmt.Sprintf("event=deletePermission :: permissionId=%s :: cascade=%t :: err=%v", id, cascade, err))
+		return nil, err
+	}
+	response.Deleted = true
+	return response, nil
+}
+
+// findReferences lists the orgs where a member holds the permission and the roles bundling it in the response
+func (svc *permissionService) findReferences(response *exchange.PermissionDeleteResponse, ctx context.Context) error {
+	id := response.PermissionId
+	referencingOrgs, err := svc.orgRepo.FindOrgsWithPermission(id, maxReferences, ctx)
+	if err != nil {
+		svc.log.Error(fmt.Sprintf("event=deletePermission :: action=findOrgsWithPermission :: permissionId=%s :: err=%v", id, err))
+		return err
+	}
+	referencingRoles, err := svc.roleRepo.FindRolesWithPermission(id, maxReferences, ctx)
+	if err != nil {
+		svc.log.Error(fmt.Sprintf("event=deletePermission :: action=findRolesWithPermission :: permissionId=%s :: err=%v", id, err))
+		return err
+	}
+
+	response.ReferencingOrgs = make([]exchange.OrgReference, 0, len(referencingOrgs))
+	for _, referencingOrg := range referencingOrgs {
+		response.ReferencingOrgs = append(response.ReferencingOrgs, exchange.OrgReference{
+			OrgId:       referencingOrg.Id,
+			DisplayName: referencingOrg.DisplayName,
+		})
+	}
+	response.ReferencingRoles = make([]exchange.RoleReference, 0, len(referencingRoles))
+	for _, referencingRole := range referencingRoles {
+		response.ReferencingRoles = append(response.ReferencingRoles, exchange.RoleReference{
+			RoleId: referencingRole.Id,
+			Name:   referencingRole.Name,
+		})
+	}
+	return nil
+}
+
+// refuseDelete audits the refused delete with the references found
+func (svc *permissionService) refuseDelete(response *exchange.PermissionDeleteResponse, callerFp string,
+	details map[string]any, ctx context.Context) (*exchange.PermissionDeleteResponse, error) {
+	id := response.PermissionId
+	orgIds := make([]string, 0, len(response.ReferencingOrgs))
+	for _, referencingOrg := range response.ReferencingOrgs {
+		orgIds = append(orgIds, referencingOrg.OrgId)
+	}
+	roleIds := make([]string, 0, len(response.ReferencingRoles))
+	for _, referencingRole := range response.ReferencingRoles {
+		roleIds = append(roleIds, referencingRole.RoleId)
+	}
+	details["orgIds"] = orgIds
+	details["roleIds"] = roleIds
+
+	entry := audit.CreateEntry(audit.PermissionDeleteRefused, callerFp, audit.PermissionResource, id, details)
+	if err := svc.auditRepo.Record(entry, ctx); err != nil {
+		svc.log.Error(fmt.Sprintf("event=deletePermission :: action=recordAudit :: permissionId=%s :: err=%v", id, err))
+		return nil, err
+	}
+	svc.log.Info(fmt.Sprintf("event=deletePermission :: deleted=false :: permissionId=%s :: referencingOrgs=%d :: referencingRoles=%d",
+		id, len(orgIds), len(roleIds)))
+	return response, nil
+}
+
+// toPermissionResponse looks up the names of the permissions the permission implies
+func (svc *permissionService) toPermissionResponse(permission *org.Permission, ctx context.Context) (*exchange.PermissionResponse, error) {
+	impliedNames, err := findPermissionNames(permission.Implies, svc.permissionRepo, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return toPermissionResponse(permission, impliedNames), nil
+}
+
+// toPermissionResponse shows implied permissions by name, wildcards are shown as they are
+func toPermissionResponse(permission *org.Permission, impliedNames map[string]string) *exchange.PermissionResponse {
+	implies := make([]string, 0, len(permission.Implies))
+	for _, rule := range permission.Implies {
+		if org.IsWildcard(rule) {
+			implies = append(implies, rule)
+		} else if name, ok := impliedNames[rule]; ok {
+			implies = append(implies, name)
+		}
+	}
+	return &exchange.PermissionResponse{
+		Id:          permission.Id,
+		OrgId:       permission.OrgId,
+		Name:        permission.Name,
+		Description: permission.Description,
+		Implies:     implies,
+		UpdatedAt:   model.NewTime(permission.UpdatedAt),
+	}
+}
+
 func validatePermissionName(name string) error {
 	externalErr := &xrfErr.External{Source: "core/service/permission#validatePermissionName"}
 	if name == "" || len(name) < 3 || len(name) > 63 {
@@ -80,9 +415,13 @@ func validatePermissionName(name string) error {
 	return nil
 }
 
-func NewPermissionService(log internal.Logger, permissionRepo repository.PermissionRepository) PermissionService {
+func NewPermissionService(log internal.Logger, authorizer Authorizer, allRepos *repository.Repositories) PermissionService {
 	return &permissionService{
 		log:            log,
-		permissionRepo: permissionRepo,
+		authorizer:     authorizer,
+		orgRepo:        allRepos.OrgRepo,
+		roleRepo:       allRepos.RoleRepo,
+		auditRepo:      allRepos.AuditRepo,
+		permissionRepo: allRepos.PermissionRepo,
 	}
 }
@@ -0,0 +1,446 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/audit"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/core/model/user"
+	"xrf197ilz35aq0/core/repository"
+	xrf "xrf197ilz35aq0/internal"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	xrfTest "xrf197ilz35aq0/internal/tests"
+)
+
+const (
+	adminUserId   = "adminTestUserId"
+	globalAdminFp = "globalAdminTestFingerPrint"
+)
+
+// newAdminContext saves the admin configured in securityConfig and returns a context they're the caller of
+func newAdminContext(t *testing.T, repos *repository.Repositories) context.Context {
+	t.Helper()
+	_, err := repos.UserRepo.CreateUser(&user.User{Id: adminUserId, FingerPrint: globalAdminFp, Email: "admin@xrf.com"}, context.TODO())
+	xrf.AssertNoError(t, err)
+	return xrf.WithUserFingerprint(context.TODO(), globalAdminFp)
+}
+
+func TestPermissionService(t *testing.T) {
+	repos := newOrgTestRepos()
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(readPermission, writePermission)
+	permService := NewPermissionService(xrf.NewTestLogger(), NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), repos), repos)
+	ctx := newAdminContext(t, repos)
+
+	t.Run("stores the description of new permissions", func(t *testing.T) {
+		id, err := permService.CreatePermission(&exchange.PermissionRequest{Name: "org_delete", Description: "delete the org"}, ctx)
+		xrf.AssertNoError(t, err)
+
+		permission, err := permService.GetPermission(id, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, "ORG_DELETE", permission.Name)
+		assert.Equal(t, "delete the org", permission.Description)
+	})
+
+	t.Run("unknown permissions are not found", func(t *testing.T) {
+		_, err := permService.GetPermission("000", ctx)
+		xrf.AssertError(t, err)
+		_, err = permService.GetPermission("", ctx)
+		xrf.AssertError(t, err)
+	})
+
+	t.Run("updates keep names unique and uppercase", func(t *testing.T) {
+		newName := "org_view"
+		description := "view the org"
+		taken := "org_write"
+		invalid := "org view"
+
+		tests := []struct {
+			name    string
+			id      string
+			request exchange.PermissionUpdateRequest
+			wantErr bool
+		}{
+			{name: "renames the permission", id: readPermission.Id, request: exchange.PermissionUpdateRequest{Name: &newName}},
+			{name: "updates only the description", id: readPermission.Id, request: exchange.PermissionUpdateRequest{Description: &description}},
+			{name: "rejects an empty update", id: readPermission.Id, request: exchange.PermissionUpdateRequest{}, wantErr: true},
+			{name: "rejects a name used by another permission", id: readPermission.Id, request: exchange.PermissionUpdateRequest{Name: &taken}, wantErr: true},
+			{name: "rejects an invalid name", id: readPermission.Id, request: exchange.PermissionUpdateRequest{Name: &invalid}, wantErr: true},
+			{name: "rejects an unknown permission", id: "000", request: exchange.PermissionUpdateRequest{Description: &description}, wantErr: true},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := permService.UpdatePermission(tt.id, &tt.request, ctx)
+				if tt.wantErr {
+					xrf.AssertError(t, err)
+					assert.Nil(t, got)
+					return
+				}
+				xrf.AssertNoError(t, err)
+				assert.Equal(t, "ORG_VIEW", got.Name)
+				if tt.request.Description != nil {
+					assert.Equal(t, description, got.Description)
+				}
+			})
+		}
+	})
+
+	t.Run("lists permissions by name one page at a time", func(t *testing.T) {
+		names := make([]string, 0)
+		request := exchange.PermissionListRequest{Limit: 2}
+		for {
+			page, err := permService.ListPermissions(request, ctx)
+			xrf.AssertNoError(t, err)
+			for _, permission := range page.Items {
+				names = append(names, permission.Name)
+			}
+			if !page.HasMore {
+				break
+			}
+			request.Cursor = page.NextCursor
+		}
+		assert.Equal(t, []string{"ORG_DELETE", "ORG_VIEW", org.WritePermission}, names)
+
+		_, err := permService.ListPermissions(exchange.PermissionListRequest{Cursor: "not a cursor"}, ctx)
+		xrf.AssertError(t, err)
+	})
+}
+
+func TestPermissionServiceSetImplies(t *testing.T) {
+	adminPermission := *org.CreatePermission("ORG_ADMIN", "")
+	repos := newOrgTestRepos()
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(readPermission, writePermission, adminPermission)
+	permService := NewPermissionService(xrf.NewTestLogger(), NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), repos), repos)
+	ctx := newAdminContext(t, repos)
+
+	tests := []struct {
+		name    string
+		id      string
+		implies []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "implies permissions by name", id: writePermission.Id, implies: []string{"org_read"}, want: []string{org.ReadPermission}},
+		{name: "implies wildcards", id: adminPermission.Id, implies: []string{"ORG_*", "ORG_*"}, want: []string{"ORG_*"}},
+		{name: "rejects cycles", id: readPermission.Id, implies: []string{"ORG_ADMIN"}, wantErr: true},
+		{name: "rejects unknown permissions", id: readPermission.Id, implies: []string{"ORG_UNKNOWN"}, wantErr: true},
+		{name: "rejects unknown implying permissions", id: "000", implies: []string{}, wantErr: true},
+		{name: "clears implications", id: adminPermission.Id, implies: []string{}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := permService.SetImplies(tt.id, &exchange.PermissionImpliesRequest{Implies: tt.implies}, ctx)
+			if tt.wantErr {
+				xrf.AssertError(t, err)
+				return
+			}
+			xrf.AssertNoError(t, err)
+			assert.Equal(t, tt.want, got.Implies)
+		})
+	}
+}
+
+func TestPermissionServiceRenameCycles(t *testing.T) {
+	adminPermission := *org.CreatePermission("ORG_ADMIN", "")
+	adminPermission.Implies = []string{"TEAM_*"}
+	viewerPermission := *org.CreatePermission("VIEWER", "")
+	viewerPermission.Implies = []string{adminPermission.Id}
+	repos := newOrgTestRepos()
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(adminPermission, viewerPermission)
+	permService := NewPermissionService(xrf.NewTestLogger(), NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), repos), repos)
+	ctx := newAdminContext(t, repos)
+
+	t.Run("rejects a name matching a wildcard that implies the permission back", func(t *testing.T) {
+		teamViewer := "team_viewer"
+		_, err := permService.UpdatePermission(viewerPermission.Id, &exchange.PermissionUpdateRequest{Name: &teamViewer}, ctx)
+		xrf.AssertError(t, err)
+
+		permission, err := repos.PermissionRepo.FindPermissionById(viewerPermission.Id, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, "VIEWER", permission.Name)
+	})
+
+	t.Run("renames outside the wildcard", func(t *testing.T) {
+		reportViewer := "report_viewer"
+		got, err := permService.UpdatePermission(viewerPermission.Id, &exchange.PermissionUpdateRequest{Name: &reportViewer}, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, "REPORT_VIEWER", got.Name)
+	})
+}
+
+func TestPermissionServiceGlobalPermissionsNeedAnAdmin(t *testing.T) {
+	members := map[string]org.Member{
+		ownerFp:  *org.CreateMember(ownerFp, true, []string{}),
+		readerFp: *org.CreateMember(readerFp, false, []string{readPermission.Id}),
+	}
+	testOrg := newTestOrg(t, "xrfGlobal", members)
+	repos := newOrgTestRepos(testOrg)
+	membersPermission := *org.CreatePermission(org.MembersPermission, "")
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(readPermission, membersPermission)
+	permService := NewPermissionService(xrf.NewTestLogger(), NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), repos), repos)
+	adminCtx := newAdminContext(t, repos)
+	renamed := "org_view"
+
+	writes := []struct {
+		name  string
+		write func(ctx context.Context) error
+	}{
+		{name: "create", write: func(ctx context.Context) error {
+			_, err := permService.CreatePermission(&exchange.PermissionRequest{Name: "org_audit"}, ctx)
+			return err
+		}},
+		{name: "rename", write: func(ctx context.Context) error {
+			_, err := permService.UpdatePermission(readPermission.Id, &exchange.PermissionUpdateRequest{Name: &renamed}, ctx)
+			return err
+		}},
+		{name: "imply", write: func(ctx context.Context) error {
+			_, err := permService.SetImplies(readPermission.Id, &exchange.PermissionImpliesRequest{Implies: []string{org.MembersPermission}}, ctx)
+			return err
+		}},
+	}
+	callers := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{name: "unauthenticated caller", ctx: context.TODO()},
+		{name: "member holding the permission", ctx: xrf.WithUserFingerprint(context.TODO(), readerFp)},
+		{name: "org owner", ctx: xrf.WithUserFingerprint(context.TODO(), ownerFp)},
+	}
+	for _, write := range writes {
+		for _, caller := range callers {
+			t.Run(fmt.Sprintf("%s can't %s a global permission", caller.name, write.name), func(t *testing.T) {
+				err := write.write(caller.ctx)
+				var forbiddenErr *xrfErr.Forbidden
+				assert.True(t, errors.As(err, &forbiddenErr))
+			})
+		}
+	}
+
+	permission, err := repos.PermissionRepo.FindPermissionById(readPermission.Id, adminCtx)
+	xrf.AssertNoError(t, err)
+	assert.Equal(t, org.ReadPermission, permission.Name)
+	assert.Empty(t, permission.Implies)
+
+	for _, write := range writes {
+		t.Run(fmt.Sprintf("admins %s global permissions", write.name), func(t *testing.T) {
+			xrf.AssertNoError(t, write.write(adminCtx))
+		})
+	}
+}
+
+func TestPermissionServiceDeletePermission(t *testing.T) {
+	unused := *org.CreatePermission("ORG_UNUSED", "")
+	bundled := *org.CreatePermission("ORG_BUNDLED", "")
+	bundler := org.Role{Id: "192837465", Name: "ORG_BUNDLER", Permissions: []string{bundled.Id}}
+	newService := func(t *testing.T) (PermissionService, *repository.Repositories, *org.Organization) {
+		members := map[string]org.Member{
+			ownerFp:  *org.CreateMember(ownerFp, true, []string{}),
+			readerFp: *org.CreateMember(readerFp, false, []string{readPermission.Id, writePermission.Id}),
+		}
+		testOrg := newTestOrg(t, "xrfPermissions", members)
+		repos := newOrgTestRepos(testOrg)
+		repos.AuditRepo = xrfTest.NewAuditRepositoryMock()
+		repos.RoleRepo = xrfTest.NewRoleRepositoryMock(bundler)
+		repos.PermissionRepo = xrfTest.NewLinkedPermissionRepositoryMock(repos.OrgRepo, repos.RoleRepo, repos.AuditRepo,
+			readPermission, writePermission, unused, bundled)
+		newAdminContext(t, repos)
+		return NewPermissionService(xrf.NewTestLogger(), NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), repos), repos), repos, testOrg
+	}
+	ctx := xrf.WithUserFingerprint(context.TODO(), globalAdminFp)
+
+	tests := []struct {
+		name         string
+		id           string
+		cascade      bool
+		wantErr      bool
+		wantDeleted  bool
+		wantUpdated  int64
+		wantAction   audit.Action
+		wantRefusals int
+	}{
+		{name: "refuses a permission still held by members", id: readPermission.Id, wantAction: audit.PermissionDeleteRefused, wantRefusals: 1},
+		{name: "deletes an unused permission", id: unused.Id, wantDeleted: true, wantAction: audit.PermissionDeleted},
+		{name: "cascade removes the permission from members", id: readPermission.Id, cascade: true, wantDeleted: true, wantUpdated: 1, wantAction: audit.PermissionDeleted},
+		{name: "unknown permission is not found", id: "000", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			permService, repos, testOrg := newService(t)
+			got, err := permService.DeletePermission(tt.id, tt.cascade, ctx)
+			if tt.wantErr {
+				xrf.AssertError(t, err)
+				assert.Empty(t, xrfTest.AuditEntries(repos.AuditRepo))
+				return
+			}
+			xrf.AssertNoError(t, err)
+			assert.Equal(t, tt.wantDeleted, got.Deleted)
+			assert.Equal(t, tt.wantUpdated, got.UpdatedOrgs)
+			assert.Len(t, got.ReferencingOrgs, tt.wantRefusals)
+
+			entries := xrfTest.AuditEntries(repos.AuditRepo)
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, tt.wantAction, entries[0].Action)
+				assert.Equal(t, globalAdminFp, entries[0].ActorFp)
+				assert.Equal(t, tt.id, entries[0].ResourceId)
+			}
+
+			_, err = repos.PermissionRepo.FindPermissionById(tt.id, ctx)
+			assert.Equal(t, tt.wantDeleted, err != nil)
+			member := testOrg.Members[readerFp]
+			if tt.cascade {
+				assert.Equal(t, []string{writePermission.Id}, member.Permissions)
+			} else {
+				assert.Len(t, member.Permissions, 2)
+			}
+		})
+	}
+
+	t.Run("refuses a permission bundled in a role, cascade removes it from the role", func(t *testing.T) {
+		permService, repos, _ := newService(t)
+		got, err := permService.DeletePermission(bundled.Id, false, ctx)
+		xrf.AssertNoError(t, err)
+		assert.False(t, got.Deleted)
+		assert.Empty(t, got.ReferencingOrgs)
+		assert.Equal(t, []exchange.RoleReference{{RoleId: bundler.Id, Name: bundler.Name}}, got.ReferencingRoles)
+
+		got, err = permService.DeletePermission(bundled.Id, true, ctx)
+		xrf.AssertNoError(t, err)
+		assert.True(t, got.Deleted)
+		role, err := repos.RoleRepo.FindRoleById(bundler.Id, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Empty(t, role.Permissions)
+
+		entries := xrfTest.AuditEntries(repos.AuditRepo)
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, audit.PermissionDeleteRefused, entries[0].Action)
+			assert.Equal(t, []string{bundler.Id}, entries[0].Details["roleIds"])
+			assert.Equal(t, audit.PermissionDeleted, entries[1].Action)
+		}
+	})
+
+	t.Run("refusals by the repository are audited with the references", func(t *testing.T) {
+		permService, repos, testOrg := newService(t)
+		repos.PermissionRepo = &grantingPermissionRepo{PermissionRepository: repos.PermissionRepo, orgRepo: repos.OrgRepo,
+			orgId: testOrg.Id, userFp: readerFp}
+		permService = NewPermissionService(xrf.NewTestLogger(), NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), repos), repos)
+
+		got, err := permService.DeletePermission(unused.Id, false, ctx)
+		xrf.AssertNoError(t, err)
+		assert.False(t, got.Deleted)
+		assert.Equal(t, []exchange.OrgReference{{OrgId: testOrg.Id, DisplayName: testOrg.DisplayName}}, got.ReferencingOrgs)
+
+		entries := xrfTest.AuditEntries(repos.AuditRepo)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, audit.PermissionDeleteRefused, entries[0].Action)
+			assert.Equal(t, []string{testOrg.Id}, entries[0].Details["orgIds"])
+		}
+		_, err = repos.PermissionRepo.FindPermissionById(unused.Id, ctx)
+		xrf.AssertNoError(t, err)
+	})
+
+	t.Run("unauthenticated callers are forbidden", func(t *testing.T) {
+		permService, _, _ := newService(t)
+		_, err := permService.DeletePermission(unused.Id, false, context.TODO())
+		xrf.AssertError(t, err)
+	})
+
+	t.Run("only admins delete global permissions", func(t *testing.T) {
+		for _, callerFp := range []string{readerFp, ownerFp} {
+			permService, repos, testOrg := newService(t)
+			_, err := permService.DeletePermission(readPermission.Id, true, xrf.WithUserFingerprint(context.TODO(), callerFp))
+			var forbiddenErr *xrfErr.Forbidden
+			assert.True(t, errors.As(err, &forbiddenErr))
+
+			assert.Empty(t, xrfTest.AuditEntries(repos.AuditRepo))
+			_, err = repos.PermissionRepo.FindPermissionById(readPermission.Id, ctx)
+			xrf.AssertNoError(t, err)
+			assert.Len(t, testOrg.Members[readerFp].Permissions, 2)
+		}
+	})
+}
+
+// grantingPermissionRepo gives the permission to a member right before deleting it, as a request racing the delete
+type grantingPermissionRepo struct {
+	repository.PermissionRepository
+	orgRepo repository.OrganizationRepository
+	orgId   string
+	userFp  string
+}
+
+func (r *grantingPermissionRepo) DeletePermission(id string, cascade bool, entry *audit.Entry, ctx context.Context) (int64, error) {
+	member, err := r.orgRepo.FindOrgMember(r.orgId, r.userFp, ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err = r.orgRepo.SetMemberPermissions(r.orgId, r.userFp, append(slices.Clone(member.Permissions), id), ctx); err != nil {
+		return 0, err
+	}
+	return r.PermissionRepository.DeletePermission(id, cascade, entry, ctx)
+}
+
+func TestPermissionServiceOrgPermissions(t *testing.T) {
+	globalReviewer := *org.CreatePermission("REVIEWER", "")
+	firstOrg := newTestOrg(t, "xrfFirst", nil)
+	secondOrg := newTestOrg(t, "xrfSecond", nil)
+	repos := newOrgTestRepos(firstOrg, secondOrg)
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(globalReviewer)
+	permService := NewPermissionService(xrf.NewTestLogger(), NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), repos), repos)
+	ownerCtx := xrf.WithUserFingerprint(context.TODO(), ownerFp)
+
+	t.Run("orgs define permissions with the same name", func(t *testing.T) {
+		request := &exchange.PermissionRequest{Name: "reviewer"}
+		firstId, err := permService.CreateOrgPermission(firstOrg.Id, request, ownerCtx)
+		xrf.AssertNoError(t, err)
+		secondId, err := permService.CreateOrgPermission(secondOrg.Id, request, ownerCtx)
+		xrf.AssertNoError(t, err)
+		assert.NotEqual(t, firstId, secondId)
+
+		_, err = permService.CreateOrgPermission(firstOrg.Id, request, ownerCtx)
+		xrf.AssertError(t, err)
+		_, err = permService.CreateOrgPermission(firstOrg.Id, request, xrf.WithUserFingerprint(context.TODO(), outsiderFp))
+		xrf.AssertError(t, err)
+	})
+
+	t.Run("lists only the org's permissions", func(t *testing.T) {
+		page, err := permService.ListOrgPermissions(firstOrg.Id, exchange.PermissionListRequest{}, ownerCtx)
+		xrf.AssertNoError(t, err)
+		if assert.Len(t, page.Items, 1) {
+			assert.Equal(t, firstOrg.Id, page.Items[0].OrgId)
+		}
+
+		page, err = permService.ListPermissions(exchange.PermissionListRequest{}, ownerCtx)
+		xrf.AssertNoError(t, err)
+		if assert.Len(t, page.Items, 1) {
+			assert.Equal(t, globalReviewer.Id, page.Items[0].Id)
+		}
+	})
+
+	t.Run("org permissions shadow global ones when resolving names", func(t *testing.T) {
+		firstReviewer, err := repos.PermissionRepo.FindPermissionByName(firstOrg.Id, "REVIEWER", ownerCtx)
+		xrf.AssertNoError(t, err)
+
+		permissionMap, err := validatePermissions(firstOrg.Id, []string{"REVIEWER"}, repos.PermissionRepo, xrf.NewTestLogger(), ownerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, firstReviewer.Id, permissionMap["REVIEWER"])
+
+		permissionMap, err = validatePermissions("", []string{"REVIEWER"}, repos.PermissionRepo, xrf.NewTestLogger(), ownerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, globalReviewer.Id, permissionMap["REVIEWER"])
+	})
+
+	t.Run("only owners of the org change its permissions", func(t *testing.T) {
+		firstReviewer, err := repos.PermissionRepo.FindPermissionByName(firstOrg.Id, "REVIEWER", ownerCtx)
+		xrf.AssertNoError(t, err)
+		description := "reviews"
+
+		_, err = permService.UpdatePermission(firstReviewer.Id, &exchange.PermissionUpdateRequest{Description: &description}, xrf.WithUserFingerprint(context.TODO(), outsiderFp))
+		xrf.AssertError(t, err)
+		updated, err := permService.UpdatePermission(firstReviewer.Id, &exchange.PermissionUpdateRequest{Description: &description}, ownerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, description, updated.Description)
+	})
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/core/repository"
+	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+// RankingService ranks users by the magnitude of their rung, among everyone or among the members of an org.
+// Org rankings are only visible to members that can read the org
+type RankingService interface {
+	Leaderboard(request exchange.LeaderboardRequest, ctx context.Context) (*exchange.LeaderboardResponse, error)
+	GetStanding(userId string, orgId string, ctx context.Context) (*exchange.StandingResponse, error)
+}
+
+type rankingService struct {
+	log        internal.Logger
+	authorizer Authorizer
+	orgRepo    repository.OrganizationRepository
+	userRepo   repository.UserRepository
+	rungRepo   repository.RungRepository
+}
+
+func (rs *rankingService) Leaderboard(request exchange.LeaderboardRequest, ctx context.Context) (*exchange.LeaderboardResponse, error) {
+	if request.Limit < 0 || request.Limit > org.MaxListLimit {
+		return nil, &xrfErr.External{Source: "core/service/ranking#leaderboard", Message: "limit must be between 1 and 100"}
+	}
+	if request.Limit == 0 {
+		request.Limit = org.DefaultListLimit
+	}
+	ownerFps, err := rs.rankedFps(request.OrgId, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rungs, err := rs.rungRepo.FindTopRungs(ownerFps, request.Limit, ctx)
+	if err != nil {
+		rs.log.Error(fmt.Sprintf("event=leaderboard :: action=findTopRungs :: orgId=%s :: err=%v", request.OrgId, err))
+		return nil, err
+	}
+	fps := make([]string, 0, len(rungs))
+	for _, ownerRung := range rungs {
+		fps = append(fps, ownerRung.OwnerFP())
+	}
+	owners, err := rs.userRepo.FindUsersByFingerPrints(fps, ctx)
+	if err != nil {
+		return nil, err
+	}
+	userIds := make(map[string]string)
+	for _, owner := range owners {
+		userIds[owner.FingerPrint] = owner.Id
+	}
+
+	entries := make([]exchange.LeaderboardEntry, 0, len(rungs))
+	for i, ownerRung := range rungs {
+		rank := int64(i + 1)
+		if i > 0 && entries[i-1].Magnitude == ownerRung.Magnitude() {
+			rank = entries[i-1].Rank
+		}
+		entries = append(entries, exchange.LeaderboardEntry{
+			Rank:      rank,
+			UserId:    userIds[ownerRung.OwnerFP()],
+			Magnitude: ownerRung.Magnitude(),
+		})
+	}
+	return &exchange.LeaderboardResponse{OrgId: request.OrgId, Entries: entries}, nil
+}
+
+func (rs *rankingService) GetStanding(userId string, orgId string, ctx context.Context) (*exchange.StandingResponse, error) {
+	ownerFps, err := rs.rankedFps(orgId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := rs.userRepo.GetUserById(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if owner == nil || owner.FingerPrint == "" {
+		return nil, &xrfErr.External{Source: "core/service/ranking#getStanding", Message: "User not found"}
+	}
+	if ownerFps != nil && !slices.Contains(ownerFps, owner.FingerPrint) {
+		return nil, &xrfErr.External{Source: "core/service/ranking#getStanding", Message: constants.NotOrgMemberErrMsg}
+	}
+
+	standing, err := rs.rungRepo.FindStanding(owner.FingerPrint, ownerFps, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &exchange.StandingResponse{
+		UserId:     userId,
+		OrgId:      orgId,
+		Magnitude:  standing.Magnitude,
+		Rank:       standing.Rank(),
+		Percentile: standing.Percentile(),
+		Ranked:     standing.Total,
+	}, nil
+}
+
+// rankedFps returns the fingerprints of the org's members, nil (everyone) without an org
+func (rs *rankingService) rankedFps(orgId string, ctx context.Context) ([]string, error) {
+	if orgId == "" {
+		return nil, nil
+	}
+	if err := rs.authorizer.Authorize(orgId, org.ReadPermission, ctx); err != nil {
+		return nil, err
+	}
+	foundOrg, err := rs.orgRepo.GetOrgById(orgId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	ownerFps := make([]string, 0, len(foundOrg.Members))
+	for memberFp := range foundOrg.Members {
+		ownerFps = append(ownerFps, memberFp)
+	}
+	return ownerFps, nil
+}
+
+func NewRankingService(logger internal.Logger, authorizer Authorizer, allRepos *repository.Repositories) RankingService {
+	return &rankingService{
+		log:        logger,
+		authorizer: authorizer,
+		orgRepo:    allRepos.OrgRepo,
+		userRepo:   allRepos.UserRepo,
+		rungRepo:   allRepos.RungRepo,
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/core/model/rung"
+	"xrf197ilz35aq0/core/model/user"
+	xrf "xrf197ilz35aq0/internal"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	xrfTest "xrf197ilz35aq0/internal/tests"
+)
+
+func TestRankingService(t *testing.T) {
+	repos := newRungTestRepos(t,
+		&user.User{Id: "1", FingerPrint: ownerFp, Email: "owner@xrf.com"},
+		&user.User{Id: "2", FingerPrint: readerFp, Email: "reader@xrf.com"},
+		&user.User{Id: "3", FingerPrint: writerFp, Email: "writer@xrf.com"},
+		&user.User{Id: "4", FingerPrint: outsiderFp, Email: "outsider@xrf.com"},
+	)
+	repos.OrgRepo = xrfTest.NewOrgRepositoryMock()
+	repos.RoleRepo = xrfTest.NewRoleRepositoryMock()
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(readPermission)
+	ctx := context.TODO()
+
+	// the average strategy makes a rating of r a magnitude of 10r
+	for ownerFp, rating := range map[string]int{ownerFp: 9, readerFp: 7, writerFp: 7, outsiderFp: 3} {
+		xrf.AssertNoError(t, repos.RungRepo.CreateRungIfMissing(ownerFp, ctx))
+		_, err := repos.RungRepo.AddTradeTrail(ownerFp, adminFp, "trade", rung.TrailMetaData{Rating: rating}, ctx)
+		xrf.AssertNoError(t, err)
+	}
+
+	testOrg := newTestOrg(t, "xrfRanking", map[string]org.Member{
+		ownerFp:  *org.CreateMember(ownerFp, true, []string{}),
+		readerFp: *org.CreateMember(readerFp, false, []string{readPermission.Id}),
+		writerFp: *org.CreateMember(writerFp, false, []string{}),
+	})
+	_, err := repos.OrgRepo.Create(testOrg, ctx)
+	xrf.AssertNoError(t, err)
+
+	rankingService := NewRankingService(xrf.NewTestLogger(), NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), repos), repos)
+	readerCtx := xrf.WithUserFingerprint(ctx, readerFp)
+	writerCtx := xrf.WithUserFingerprint(ctx, writerFp)
+
+	t.Run("ranks everyone with ties sharing a rank", func(t *testing.T) {
+		leaderboard, err := rankingService.Leaderboard(exchange.LeaderboardRequest{}, writerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, []exchange.LeaderboardEntry{
+			{Rank: 1, UserId: "1", Magnitude: 90},
+			{Rank: 2, UserId: "2", Magnitude: 70},
+			{Rank: 2, UserId: "3", Magnitude: 70},
+			{Rank: 4, UserId: "4", Magnitude: 30},
+		}, leaderboard.Entries)
+
+		leaderboard, err = rankingService.Leaderboard(exchange.LeaderboardRequest{Limit: 1}, writerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Len(t, leaderboard.Entries, 1)
+
+		_, err = rankingService.Leaderboard(exchange.LeaderboardRequest{Limit: 101}, writerCtx)
+		xrf.AssertError(t, err)
+	})
+
+	t.Run("ranks an org's members for members that can read it", func(t *testing.T) {
+		leaderboard, err := rankingService.Leaderboard(exchange.LeaderboardRequest{OrgId: testOrg.Id}, readerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Len(t, leaderboard.Entries, 3)
+		assert.Equal(t, "1", leaderboard.Entries[0].UserId)
+
+		_, err = rankingService.Leaderboard(exchange.LeaderboardRequest{OrgId: testOrg.Id}, writerCtx)
+		var forbiddenErr *xrfErr.Forbidden
+		assert.True(t, errors.As(err, &forbiddenErr))
+	})
+
+	t.Run("finds a user's rank and percentile", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			userId     string
+			orgId      string
+			rank       int64
+			percentile float64
+			ranked     int64
+			wantErr    bool
+		}{
+			{name: "top of everyone", userId: "1", rank: 1, percentile: 87.5, ranked: 4},
+			{name: "tied", userId: "3", rank: 2, percentile: 50, ranked: 4},
+			{name: "bottom of everyone", userId: "4", rank: 4, percentile: 12.5, ranked: 4},
+			{name: "among org members", userId: "3", orgId: testOrg.Id, rank: 2, percentile: 100.0 / 3, ranked: 3},
+			{name: "outsiders aren't ranked in the org", userId: "4", orgId: testOrg.Id, wantErr: true},
+			{name: "users without a rung", userId: "5", wantErr: true},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				standing, err := rankingService.GetStanding(tt.userId, tt.orgId, readerCtx)
+				if tt.wantErr {
+					xrf.AssertError(t, err)
+					return
+				}
+				xrf.AssertNoError(t, err)
+				assert.Equal(t, tt.rank, standing.Rank)
+				assert.InDelta(t, tt.percentile, standing.Percentile, 1e-9)
+				assert.Equal(t, tt.ranked, standing.Ranked)
+			})
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/core/repository"
+	"xrf197ilz35aq0/internal"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+type RoleService interface {
+	CreateRole(req *exchange.RoleRequest, ctx context.Context) (*exchange.RoleResponse, error)
+	GetRole(id string, ctx context.Context) (*exchange.RoleResponse, error)
+	ListRoles(req exchange.RoleListRequest, ctx context.Context) (*exchange.Page[exchange.RoleResponse], error)
+}
+
+type roleService struct {
+	log            internal.Logger
+	authorizer     Authorizer
+	roleRepo       repository.RoleRepository
+	permissionRepo repository.PermissionRepository
+}
+
+// CreateRole creates a role every org can grant, so only admins create roles
+func (svc *roleService) CreateRole(req *exchange.RoleRequest, ctx context.Context) (*exchange.RoleResponse, error) {
+	if err := svc.authorizer.AuthorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if err := validateRoleName(req.Name); err != nil {
+		return nil, err
+	}
+	permissionMap, err := validatePermissions("", req.Permissions, svc.permissionRepo, svc.log, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	newRole, err := org.CreateRole(req.Name, req.Description, getUserPermissions(permissionMap, req.Permissions))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = svc.roleRepo.CreateRole(newRole, ctx); err != nil {
+		svc.log.Error(fmt.Sprintf("event=createRole :: name=%s :: err=%v", newRole.Name, err))
+		return nil, err
+	}
+	return toRoleResponse(newRole, invertMap(permissionMap)), nil
+}
+
+func (svc *roleService) GetRole(id string, ctx context.Context) (*exchange.RoleResponse, error) {
+	if id == "" {
+		return nil, &xrfErr.External{Source: "core/service/role#getRole", Message: "invalid role id"}
+	}
+	role, err := svc.roleRepo.FindRoleById(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+	permissionNames, err := findPermissionNames(role.Permissions, svc.permissionRepo, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return toRoleResponse(role, permissionNames), nil
+}
+
+// ListRoles lists roles by name, the cursor is the last name of the previous page
+func (svc *roleService) ListRoles(req exchange.RoleListRequest, ctx context.Context) (*exchange.Page[exchange.RoleResponse], error) {
+	externalErr := &xrfErr.External{Source: "core/service/role#listRoles"}
+	if req.Limit < 0 || req.Limit > org.MaxListLimit {
+		externalErr.Message = "limit must be between 1 and 100"
+		return nil, externalErr
+	}
+	if req.Limit == 0 {
+		req.Limit = org.DefaultListLimit
+	}
+	afterName, err := base64.RawURLEncoding.DecodeString(req.Cursor)
+	if err != nil {
+		externalErr.Message = "invalid cursor"
+		return nil, externalErr
+	}
+
+	// one more role than the limit tells if there is a next page
+	roles, err := svc.roleRepo.FindRoles(string(afterName), req.Limit+1, ctx)
+	if err != nil {
+		return nil, err
+	}
+	page := &exchange.Page[exchange.RoleResponse]{Items: make([]exchange.RoleResponse, 0), Limit: req.Limit}
+	if len(roles) > req.Limit {
+		roles = roles[:req.Limit]
+		page.HasMore = true
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(roles[req.Limit-1].Name))
+	}
+
+	permissionIds := make([]string, 0)
+	for _, role := range roles {
+		permissionIds = append(permissionIds, role.Permissions...)
+	}
+	permissionNames, err := findPermissionNames(permissionIds, svc.permissionRepo, ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		page.Items = append(page.Items, *toRoleResponse(&role, permissionNames))
+	}
+	return page, nil
+}
+
+func toRoleResponse(role *org.Role, permissionNames map[string]string) *exchange.RoleResponse {
+	return &exchange.RoleResponse{
+		Id:          role.Id,
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: namesOf(role.Permissions, permissionNames),
+		UpdatedAt:   model.NewTime(role.UpdatedAt),
+	}
+}
+
+// findPermissionNames maps the permission ids to their names
+func findPermissionNames(permissionIds []string, permissionRepo repository.PermissionRepository, ctx context.Context) (map[string]string, error) {
+	savedPermissions, err := permissionRepo.FindPermissionsByIds(permissionIds, ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string)
+	for _, permission := range savedPermissions {
+		names[permission.Id] = permission.Name
+	}
+	return names, nil
+}
+
+// namesOf returns the names of the ids, ids without a name (e.g. deleted since) are left out
+func namesOf(ids []string, names map[string]string) []string {
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if name, ok := names[id]; ok {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func invertMap(m map[string]string) map[string]string {
+	inverted := make(map[string]string, len(m))
+	for key, value := range m {
+		inverted[value] = key
+	}
+	return inverted
+}
+
+func validateRoleName(name string) error {
+	externalErr := &xrfErr.External{Source: "core/service/role#validateRoleName"}
+	if len(name) < 3 || len(name) > 63 {
+		externalErr.Message = "role name should be between 3 and 63 characters"
+		return externalErr
+	}
+	if strings.IndexFunc(name, func(char rune) bool { return !unicode.IsLetter(char) && char != '_' }) >= 0 {
+		externalErr.Message = "role name should only contain letters and underscores"
+		return externalErr
+	}
+	return nil
+}
+
+func NewRoleService(log internal.Logger, authorizer Authorizer, allRepos *repository.Repositories) RoleService {
+	return &roleService{
+		log:            log,
+		authorizer:     authorizer,
+		roleRepo:       allRepos.RoleRepo,
+		permissionRepo: allRepos.PermissionRepo,
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/org"
+	xrf "xrf197ilz35aq0/internal"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	xrfTest "xrf197ilz35aq0/internal/tests"
+)
+
+func TestRoleService(t *testing.T) {
+	repos := newOrgTestRepos()
+	repos.PermissionRepo = xrfTest.NewPermissionRepositoryMock(readPermission, writePermission)
+	repos.RoleRepo = xrfTest.NewRoleRepositoryMock(editorRole)
+	roleService := NewRoleService(xrf.NewTestLogger(), NewOrgAuthorizer(securityConfig, xrf.NewTestLogger(), repos), repos)
+	ctx := newAdminContext(t, repos)
+
+	t.Run("only admins create roles", func(t *testing.T) {
+		for _, callerCtx := range []context.Context{context.TODO(), xrf.WithUserFingerprint(context.TODO(), ownerFp)} {
+			_, err := roleService.CreateRole(&exchange.RoleRequest{Name: "org_reader", Permissions: []string{org.ReadPermission}}, callerCtx)
+			var forbiddenErr *xrfErr.Forbidden
+			assert.True(t, errors.As(err, &forbiddenErr))
+		}
+		roles, err := repos.RoleRepo.FindRolesByNames([]string{"ORG_READER"}, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Empty(t, roles)
+	})
+
+	t.Run("creates roles bundling existing permissions", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			request exchange.RoleRequest
+			wantErr bool
+		}{
+			{name: "creates the role", request: exchange.RoleRequest{Name: "org_viewer", Permissions: []string{org.ReadPermission}}},
+			{name: "rejects a name used by another role", request: exchange.RoleRequest{Name: "org_editor", Permissions: []string{org.ReadPermission}}, wantErr: true},
+			{name: "rejects an invalid name", request: exchange.RoleRequest{Name: "org viewer", Permissions: []string{org.ReadPermission}}, wantErr: true},
+			{name: "rejects unknown permissions", request: exchange.RoleRequest{Name: "org_unknown", Permissions: []string{"ORG_UNKNOWN"}}, wantErr: true},
+			{name: "rejects a role without permissions", request: exchange.RoleRequest{Name: "org_empty"}, wantErr: true},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := roleService.CreateRole(&tt.request, ctx)
+				if tt.wantErr {
+					xrf.AssertError(t, err)
+					return
+				}
+				xrf.AssertNoError(t, err)
+				assert.Equal(t, "ORG_VIEWER", got.Name)
+				assert.Equal(t, []string{org.ReadPermission}, got.Permissions)
+			})
+		}
+	})
+
+	t.Run("finds roles with their permission names", func(t *testing.T) {
+		role, err := roleService.GetRole(editorRole.Id, ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, []string{org.ReadPermission, org.WritePermission}, role.Permissions)
+
+		_, err = roleService.GetRole("000", ctx)
+		xrf.AssertError(t, err)
+	})
+
+	t.Run("lists roles by name one page at a time", func(t *testing.T) {
+		page, err := roleService.ListRoles(exchange.RoleListRequest{Limit: 1}, ctx)
+		xrf.AssertNoError(t, err)
+		assert.True(t, page.HasMore)
+		assert.Equal(t, editorRole.Name, page.Items[0].Name)
+
+		page, err = roleService.ListRoles(exchange.RoleListRequest{Limit: 1, Cursor: page.NextCursor}, ctx)
+		xrf.AssertNoError(t, err)
+		assert.False(t, page.HasMore)
+		assert.Equal(t, "ORG_VIEWER", page.Items[0].Name)
+	})
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+	xrf "xrf197ilz35aq0"
+	"xrf197ilz35aq0/core/model/user"
+	"xrf197ilz35aq0/core/repository"
+	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/encryption"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	"xrf197ilz35aq0/internal/random"
+)
+
+const (
+	defaultRotationInterval  = 15 * time.Minute
+	defaultRotationBatchSize = 100
+	defaultRotationLease     = 10 * time.Minute
+)
+
+// ReEncrypter moves a user's data encrypted with earlier versions of their data key to the current version.
+// A failed rotation is retried, so re-encrypting has to be safe to repeat
+type ReEncrypter interface {
+	ReEncrypt(userFP string, keyring *user.Keyring, ctx context.Context) error
+}
+
+// KeyRotationService rotates the data keys of users that turned rotation on once they're due. The replaced key is
+// kept in the user's keyring until every ReEncrypter moved the user's data to the new key, so data stays decryptable
+// during the transition. Without a ReEncrypter nothing moves the data, so replaced keys are kept for good.
+// Settings are leased while they're rotated, which makes it safe to run from any instance
+type KeyRotationService interface {
+	// RotateDueKeys rotates keys until none are due or the batch is full, returns how many settings it went through
+	RotateDueKeys(ctx context.Context) (int, error)
+}
+
+type keyRotationService struct {
+	log          internal.Logger
+	config       xrf.KeyRotationConfig
+	instanceId   string
+	settingsRepo repository.SettingsRepository
+	keyProvider  encryption.KeyProvider
+	reEncrypters []ReEncrypter
+}
+
+func (ks *keyRotationService) RotateDueKeys(ctx context.Context) (int, error) {
+	processed := 0
+	for processed < ks.config.BatchSize {
+		claimed, err := ks.settingsRepo.ClaimKeyRotation(ks.instanceId, ks.config.LeaseFor, ctx)
+		if err != nil {
+			return processed, err
+		}
+		if claimed == nil {
+			break
+		}
+		processed++
+		if err = ks.rotate(claimed, ctx); err != nil {
+			// the lease is left to expire, the next instance to claim the settings retries the rotation
+			ks.log.Error(fmt.Sprintf("event=rotateKeyFailure :: userFP=%s :: err=%v", claimed.UserFingerprint[:5], err))
+		}
+	}
+	return processed, nil
+}
+
+func (ks *keyRotationService) rotate(settings *user.Settings, ctx context.Context) error {
+	now := time.Now()
+	if settings.IsRotationDue(now) {
+		if settings.WrappedKey == "" && settings.LegacyKey != "" {
+			// the plaintext key becomes the previous key, it's only stored wrapped from now on
+			wrappedKey, err := wrapDataKey(legacyDataKey(settings), settings.UserFingerprint, settings.KeyVersion, ks.keyProvider)
+			if err != nil {
+				return err
+			}
+			settings.WrappedKey, settings.LegacyKey = wrappedKey, ""
+		}
+		dataKey, err := encryption.GenerateKey(32)
+		if err != nil {
+			return err
+		}
+		previousVersion := settings.KeyVersion
+		wrappedKey, err := wrapDataKey(dataKey, settings.UserFingerprint, previousVersion+1, ks.keyProvider)
+		if err != nil {
+			return err
+		}
+
+		settings.Rotate(wrappedKey, now)
+		if err = ks.settingsRepo.SaveRotatedKey(settings, previousVersion, ks.instanceId, ctx); err != nil {
+			return err
+		}
+		ks.log.Info(fmt.Sprintf("event=rotateKey :: success=true :: userFP=%s :: keyVersion=%d",
+			settings.UserFingerprint[:5], settings.KeyVersion))
+	}
+
+	if settings.PendingReEncryption && len(ks.reEncrypters) > 0 {
+		keyring, err := unwrapKeyring(settings, ks.keyProvider)
+		if err != nil {
+			return err
+		}
+		for _, reEncrypter := range ks.reEncrypters {
+			if err = reEncrypter.ReEncrypt(settings.UserFingerprint, keyring, ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return ks.settingsRepo.CompleteKeyRotation(settings.UserFingerprint, ks.instanceId, len(ks.reEncrypters) > 0, ctx)
+}
+
+func NewKeyRotationService(
+	logger internal.Logger,
+	config xrf.KeyRotationConfig,
+	settingsRepo repository.SettingsRepository,
+	keyProvider encryption.KeyProvider,
+	reEncrypters ...ReEncrypter) KeyRotationService {
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultRotationBatchSize
+	}
+	if config.LeaseFor <= 0 {
+		config.LeaseFor = defaultRotationLease
+	}
+	if len(reEncrypters) == 0 {
+		logger.Warn("event=newKeyRotationService :: reEncrypters=0 :: message='data is not re-encrypted, previous keys are kept after every rotation'")
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "xrf"
+	}
+	return &keyRotationService{
+		log:          logger,
+		config:       config,
+		instanceId:   fmt.Sprintf("%s-%d", hostname, random.PositiveInt64()),
+		settingsRepo: settingsRepo,
+		keyProvider:  keyProvider,
+		reEncrypters: reEncrypters,
+	}
+}
+
+// KeyRotationScheduler runs the key rotation every interval, as long as it's within the off-peak window
+type KeyRotationScheduler struct {
+	log      internal.Logger
+	config   xrf.KeyRotationConfig
+	rotation KeyRotationService
+}
+
+// Run blocks until ctx is done
+func (ks *KeyRotationScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(ks.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if !ks.InWindow(now) {
+				continue
+			}
+			processed, err := ks.rotation.RotateDueKeys(ctx)
+			if err != nil {
+				ks.log.Error(fmt.Sprintf("event=keyRotationRun :: processed=%d :: err=%v", processed, err))
+				continue
+			}
+			if processed > 0 {
+				ks.log.Info(fmt.Sprintf("event=keyRotationRun :: success=true :: processed=%d", processed))
+			}
+		}
+	}
+}
+
+// InWindow reports whether rotations can start at the given time, an empty window (start == end) allows any time
+func (ks *KeyRotationScheduler) InWindow(at time.Time) bool {
+	start, end, hour := ks.config.WindowStart, ks.config.WindowEnd, at.UTC().Hour()
+	switch {
+	case start == end:
+		return true
+	case start < end:
+		return hour >= start && hour < end
+	default:
+		return hour >= start || hour < end
+	}
+}
+
+func NewKeyRotationScheduler(logger internal.Logger, config xrf.KeyRotationConfig, rotation KeyRotationService) (*KeyRotationScheduler, error) {
+	if config.WindowStart < 0 || config.WindowStart > 23 || config.WindowEnd < 0 || config.WindowEnd > 23 {
+		return nil, &xrfErr.Internal{Source: "core/service/rotation#newKeyRotationScheduler", Message: "key rotation window hours should be between 0 and 23"}
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultRotationInterval
+	}
+	return &KeyRotationScheduler{log: logger, config: config, rotation: rotation}, nil
+}
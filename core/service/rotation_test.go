@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+	xrfCfg "xrf197ilz35aq0"
+	"xrf197ilz35aq0/core/model/user"
+	"xrf197ilz35aq0/core/repository"
+	xrf "xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/encryption"
+	xrfTest "xrf197ilz35aq0/internal/tests"
+)
+
+// reEncrypterMock records the keyrings it's given, it fails while failWith is set
+type reEncrypterMock struct {
+	mu       sync.Mutex
+	failWith error
+	keyrings map[string][]*user.Keyring // userFP: keyrings
+}
+
+func (r *reEncrypterMock) ReEncrypt(userFP string, keyring *user.Keyring, _ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keyrings[userFP] = append(r.keyrings[userFP], keyring)
+	return r.failWith
+}
+
+func newReEncrypterMock() *reEncrypterMock {
+	return &reEncrypterMock{keyrings: make(map[string][]*user.Keyring)}
+}
+
+// createRotationSettings saves settings with a new data key, due for rotation if rotateAt is in the past
+func createRotationSettings(t *testing.T, settingsRepo repository.SettingsRepository, keyProvider encryption.KeyProvider,
+	userFP string, rotate bool, rotateAt time.Time) []byte {
+	t.Helper()
+	dataKey, err := encryption.GenerateKey(32)
+	xrf.AssertNoError(t, err)
+	wrappedKey, err := wrapDataKey(dataKey, userFP, 1, keyProvider)
+	xrf.AssertNoError(t, err)
+
+	settings := user.NewSettings(rotate, 90*24*time.Hour, userFP, wrappedKey)
+	settings.RotateAt = rotateAt
+	_, err = settingsRepo.CreateSettings(settings, context.TODO())
+	xrf.AssertNoError(t, err)
+	return dataKey
+}
+
+func TestKeyRotationService(t *testing.T) {
+	logger := xrf.NewTestLogger()
+	ctx := context.TODO()
+	rotationConfig := xrfCfg.KeyRotationConfig{BatchSize: 10, LeaseFor: time.Minute}
+
+	t.Run("rotates due keys and drops the previous key once data is re-encrypted", func(t *testing.T) {
+		settingsRepo := xrfTest.NewSettingsRepositoryMock()
+		keyProvider := newTestKeyProvider(t)
+		reEncrypter := newReEncrypterMock()
+		oldKey := createRotationSettings(t, settingsRepo, keyProvider, "dueFingerPrint", true, time.Now().Add(-time.Hour))
+		createRotationSettings(t, settingsRepo, keyProvider, "notDueFingerPrint", true, time.Now().Add(time.Hour))
+		createRotationSettings(t, settingsRepo, keyProvider, "rotationOffFingerPrint", false, time.Now().Add(-time.Hour))
+
+		rotation := NewKeyRotationService(logger, rotationConfig, settingsRepo, keyProvider, reEncrypter)
+		processed, err := rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, processed)
+
+		keyrings := reEncrypter.keyrings["dueFingerPrint"]
+		assert.Len(t, keyrings, 1)
+		assert.Equal(t, []int{1}, keyrings[0].Previous())
+		previousKey, ok := keyrings[0].Key(1)
+		assert.True(t, ok)
+		assert.Equal(t, oldKey, previousKey)
+		version, newKey := keyrings[0].Current()
+		assert.Equal(t, 2, version)
+		assert.NotEqual(t, oldKey, newKey)
+
+		rotated, err := settingsRepo.FetchUserSettings(ctx, "dueFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 2, rotated.KeyVersion)
+		assert.Empty(t, rotated.PreviousKeys)
+		assert.False(t, rotated.PendingReEncryption)
+		assert.Nil(t, rotated.RotationLease)
+		assert.True(t, rotated.RotateAt.After(time.Now()))
+
+		settingsService := NewSettingService(logger, settingsRepo, ctx, securityConfig, keyProvider)
+		currentKey, err := settingsService.DataKey("dueFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, newKey, currentKey)
+
+		notDue, err := settingsRepo.FetchUserSettings(ctx, "notDueFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, notDue.KeyVersion)
+		rotationOff, err := settingsRepo.FetchUserSettings(ctx, "rotationOffFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, rotationOff.KeyVersion)
+	})
+
+	t.Run("keeps the previous key decryptable until re-encryption succeeds", func(t *testing.T) {
+		settingsRepo := xrfTest.NewSettingsRepositoryMock()
+		keyProvider := newTestKeyProvider(t)
+		reEncrypter := newReEncrypterMock()
+		reEncrypter.failWith = errors.New("re-encryption failed")
+		oldKey := createRotationSettings(t, settingsRepo, keyProvider, "failingFingerPrint", true, time.Now().Add(-time.Hour))
+
+		shortLease := xrfCfg.KeyRotationConfig{BatchSize: 10, LeaseFor: 10 * time.Millisecond}
+		rotation := NewKeyRotationService(logger, shortLease, settingsRepo, keyProvider, reEncrypter)
+		processed, err := rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, processed)
+
+		settingsService := NewSettingService(logger, settingsRepo, ctx, securityConfig, keyProvider)
+		keyring, err := settingsService.Keyring("failingFingerPrint")
+		xrf.AssertNoError(t, err)
+		previousKey, ok := keyring.Key(1)
+		assert.True(t, ok)
+		assert.Equal(t, oldKey, previousKey)
+
+		// the failed rotation stays leased until the lease expires
+		processed, err = rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 0, processed)
+
+		time.Sleep(20 * time.Millisecond)
+		reEncrypter.failWith = nil
+		processed, err = rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, processed)
+
+		rotated, err := settingsRepo.FetchUserSettings(ctx, "failingFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 2, rotated.KeyVersion, "the retry re-encrypts without rotating again")
+		assert.Empty(t, rotated.PreviousKeys)
+		assert.False(t, rotated.PendingReEncryption)
+	})
+
+	t.Run("keeps previous keys without re-encrypters", func(t *testing.T) {
+		settingsRepo := xrfTest.NewSettingsRepositoryMock()
+		keyProvider := newTestKeyProvider(t)
+		oldKey := createRotationSettings(t, settingsRepo, keyProvider, "unmovedFingerPrint", true, time.Now().Add(-time.Hour))
+
+		rotation := NewKeyRotationService(logger, rotationConfig, settingsRepo, keyProvider)
+		processed, err := rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, processed)
+
+		rotated, err := settingsRepo.FetchUserSettings(ctx, "unmovedFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 2, rotated.KeyVersion)
+		assert.Len(t, rotated.PreviousKeys, 1)
+		assert.False(t, rotated.PendingReEncryption)
+		assert.Nil(t, rotated.RotationLease)
+
+		settingsService := NewSettingService(logger, settingsRepo, ctx, securityConfig, keyProvider)
+		keyring, err := settingsService.Keyring("unmovedFingerPrint")
+		xrf.AssertNoError(t, err)
+		previousKey, ok := keyring.Key(1)
+		assert.True(t, ok)
+		assert.Equal(t, oldKey, previousKey)
+
+		// the completed rotation isn't claimed again
+		processed, err = rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 0, processed)
+	})
+
+	t.Run("rotates keys of settings saved before rotations were scheduled", func(t *testing.T) {
+		settingsRepo := xrfTest.NewSettingsRepositoryMock()
+		keyProvider := newTestKeyProvider(t)
+		createRotationSettings(t, settingsRepo, keyProvider, "unscheduledFingerPrint", true, time.Time{})
+		unscheduled, err := settingsRepo.FetchUserSettings(ctx, "unscheduledFingerPrint")
+		xrf.AssertNoError(t, err)
+		// saved before rotateAt was stored, their key was due encryptAfter after they were created
+		unscheduled.CreatedAt = time.Now().Add(-unscheduled.EncryptAfter - time.Hour)
+		_, err = settingsRepo.CreateSettings(unscheduled, ctx)
+		xrf.AssertNoError(t, err)
+
+		rotation := NewKeyRotationService(logger, rotationConfig, settingsRepo, keyProvider)
+		processed, err := rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, processed)
+
+		rotated, err := settingsRepo.FetchUserSettings(ctx, "unscheduledFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 2, rotated.KeyVersion)
+		assert.True(t, rotated.RotateAt.After(time.Now()))
+	})
+
+	t.Run("wraps legacy plaintext keys before rotating them", func(t *testing.T) {
+		settingsRepo := xrfTest.NewSettingsRepositoryMock()
+		keyProvider := newTestKeyProvider(t)
+		legacyKey := xrf.RandomBytes(32)
+		legacy := user.NewSettings(true, 0, "legacyFingerPrint", "")
+		legacy.LegacyKey = base64.StdEncoding.EncodeToString(legacyKey)
+		legacy.RotateAt = time.Now().Add(-time.Hour)
+		_, err := settingsRepo.CreateSettings(legacy, ctx)
+		xrf.AssertNoError(t, err)
+
+		rotation := NewKeyRotationService(logger, rotationConfig, settingsRepo, keyProvider)
+		processed, err := rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, processed)
+
+		rotated, err := settingsRepo.FetchUserSettings(ctx, "legacyFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Empty(t, rotated.LegacyKey)
+		assert.Nil(t, rotated.RotationLease)
+		assert.True(t, rotated.RotateAt.After(time.Now()))
+
+		settingsService := NewSettingService(logger, settingsRepo, ctx, securityConfig, keyProvider)
+		keyring, err := settingsService.Keyring("legacyFingerPrint")
+		xrf.AssertNoError(t, err)
+		previousKey, ok := keyring.Key(1)
+		assert.True(t, ok)
+		assert.Equal(t, legacyKey, previousKey)
+
+		processed, err = rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 0, processed)
+	})
+
+	t.Run("instances running at the same time rotate each key once", func(t *testing.T) {
+		settingsRepo := xrfTest.NewSettingsRepositoryMock()
+		keyProvider := newTestKeyProvider(t)
+		reEncrypter := newReEncrypterMock()
+		userFPs := make([]string, 0)
+		for i := 0; i < 20; i++ {
+			userFP := fmt.Sprintf("concurrentFingerPrint%02d", i)
+			userFPs = append(userFPs, userFP)
+			createRotationSettings(t, settingsRepo, keyProvider, userFP, true, time.Now().Add(-time.Hour))
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		total := 0
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rotation := NewKeyRotationService(logger, rotationConfig, settingsRepo, keyProvider, reEncrypter)
+				for {
+					processed, err := rotation.RotateDueKeys(ctx)
+					xrf.AssertNoError(t, err)
+					mu.Lock()
+					total += processed
+					mu.Unlock()
+					if processed == 0 {
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, len(userFPs), total)
+		for _, userFP := range userFPs {
+			rotated, err := settingsRepo.FetchUserSettings(ctx, userFP)
+			xrf.AssertNoError(t, err)
+			assert.Equal(t, 2, rotated.KeyVersion)
+			assert.Len(t, reEncrypter.keyrings[userFP], 1)
+		}
+	})
+}
+
+func TestKeyRotationSchedulerInWindow(t *testing.T) {
+	logger := xrf.NewTestLogger()
+	at := func(hour int) time.Time { return time.Date(2024, 3, 4, hour, 30, 0, 0, time.UTC) }
+	tests := []struct {
+		name  string
+		start int
+		end   int
+		at    time.Time
+		want  bool
+	}{
+		{name: "inside a window", start: 1, end: 5, at: at(3), want: true},
+		{name: "at the start of a window", start: 1, end: 5, at: at(1), want: true},
+		{name: "at the end of a window", start: 1, end: 5, at: at(5), want: false},
+		{name: "outside a window", start: 1, end: 5, at: at(12), want: false},
+		{name: "before midnight in a window spanning it", start: 22, end: 4, at: at(23), want: true},
+		{name: "after midnight in a window spanning it", start: 22, end: 4, at: at(2), want: true},
+		{name: "outside a window spanning midnight", start: 22, end: 4, at: at(12), want: false},
+		{name: "any time without a window", start: 0, end: 0, at: at(12), want: true},
+		{name: "in UTC", start: 1, end: 5, at: time.Date(2024, 3, 4, 5, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60)), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := xrfCfg.KeyRotationConfig{WindowStart: tt.start, WindowEnd: tt.end}
+			scheduler, err := NewKeyRotationScheduler(logger, config, nil)
+			xrf.AssertNoError(t, err)
+			assert.Equal(t, tt.want, scheduler.InWindow(tt.at))
+		})
+	}
+
+	_, err := NewKeyRotationScheduler(logger, xrfCfg.KeyRotationConfig{WindowStart: 24}, nil)
+	xrf.AssertError(t, err)
+}
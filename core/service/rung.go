@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/rung"
+	"xrf197ilz35aq0/core/model/user"
+	"xrf197ilz35aq0/core/repository"
+	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+// defaultHistoryRange is how far back a rung's timeline goes when the request has no start
+const defaultHistoryRange = 90 * 24 * time.Hour
+
+// RungService captures the caller's trades with other users in those users' rungs. The caller (customer) has
+// to consent to trades with a user being captured before they can rate them, and can revoke it at any time
+type RungService interface {
+	GetRung(userId string, ctx context.Context) (*exchange.RungResponse, error)
+	GetHistory(userId string, request exchange.RungHistoryRequest, ctx context.Context) (*exchange.RungHistoryResponse, error)
+	AddTradeTrail(userId string, request exchange.TradeTrailRequest, ctx context.Context) (*exchange.RungResponse, error)
+	GiveConsent(userId string, request exchange.ConsentRequest, ctx context.Context) (*exchange.ConsentResponse, error)
+	GetConsent(userId string, ctx context.Context) (*exchange.ConsentResponse, error)
+	RevokeConsent(userId string, ctx context.Context) error
+}
+
+type rungService struct {
+	log         internal.Logger
+	userRepo    repository.UserRepository
+	rungRepo    repository.RungRepository
+	consentRepo repository.ConsentRepository
+}
+
+func (rs *rungService) GetRung(userId string, ctx context.Context) (*exchange.RungResponse, error) {
+	owner, err := rs.findUser(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	ownerRung, err := rs.rungRepo.FindRungByOwner(owner.FingerPrint, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rs.toRungResponse(userId, ownerRung, ctx)
+}
+
+// GetHistory returns the user's magnitude changes in the requested range, the last 90 days by default
+func (rs *rungService) GetHistory(userId string, request exchange.RungHistoryRequest, ctx context.Context) (*exchange.RungHistoryResponse, error) {
+	bucket, err := rung.ParseBucket(request.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	to := time.Now()
+	if request.To != nil {
+		to = *request.To
+	}
+	from := to.Add(-defaultHistoryRange)
+	if request.From != nil {
+		from = *request.From
+	}
+	if !from.Before(to) {
+		return nil, &xrfErr.External{Source: "service/rung#getHistory", Message: "history range should start before it ends"}
+	}
+
+	owner, err := rs.findUser(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := rs.rungRepo.FindHistory(owner.FingerPrint, from, to, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]exchange.TimelinePointResponse, 0)
+	for _, point := range rung.Downsample(snapshots, bucket) {
+		points = append(points, exchange.TimelinePointResponse{
+			At:        point.At,
+			Magnitude: point.Magnitude,
+			Min:       point.Min,
+			Max:       point.Max,
+			Changes:   point.Changes,
+		})
+	}
+	return &exchange.RungHistoryResponse{
+		UserId: userId,
+		From:   from,
+		To:     to,
+		Bucket: string(bucket),
+		Points: points,
+	}, nil
+}
+
+// AddTradeTrail rates a trade the caller had with the user, it's refused unless the caller has consented
+func (rs *rungService) AddTradeTrail(userId string, request exchange.TradeTrailRequest, ctx context.Context) (*exchange.RungResponse, error) {
+	callerFp, ok := internal.UserFingerprint(ctx)
+	if !ok {
+		return nil, &xrfErr.Forbidden{Source: "service/rung#addTradeTrail", Message: "caller is not authenticated"}
+	}
+	tradeId := strings.TrimSpace(request.TradeId)
+	// trade ids are keys of the stored trail
+	if tradeId == "" || strings.ContainsAny(tradeId, ".$") {
+		return nil, &xrfErr.External{Source: "service/rung#addTradeTrail", Message: "invalid trade id"}
+	}
+	owner, err := rs.findUser(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if owner.FingerPrint == callerFp {
+		return nil, &xrfErr.External{Source: "service/rung#addTradeTrail", Message: "users can't rate trades with themselves"}
+	}
+
+	consent, err := rs.consentRepo.FindGivenConsent(callerFp, owner.FingerPrint, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if consent == nil || !consent.IsValid() {
+		return nil, &xrfErr.Forbidden{
+			Source:  "service/rung#addTradeTrail",
+			Message: "trades can't be captured without the customer's consent",
+		}
+	}
+
+	if err := rs.rungRepo.CreateRungIfMissing(owner.FingerPrint, ctx); err != nil {
+		return nil, err
+	}
+	metadata := rung.TrailMetaData{Rating: request.Rating, Comment: request.Comment}
+	ownerRung, err := rs.rungRepo.AddTradeTrail(owner.FingerPrint, callerFp, tradeId, metadata, ctx)
+	if err != nil {
+		rs.log.Error(fmt.Sprintf("event=addTradeTrailFailure :: userId=%s :: tradeId=%s :: err=%v", userId, tradeId, err))
+		return nil, err
+	}
+	rs.log.Info(fmt.Sprintf("event=addTradeTrail :: success=true :: userId=%s :: tradeId=%s", userId, tradeId))
+	return rs.toRungResponse(userId, ownerRung, ctx)
+}
+
+func (rs *rungService) GiveConsent(userId string, request exchange.ConsentRequest, ctx context.Context) (*exchange.ConsentResponse, error) {
+	callerFp, ok := internal.UserFingerprint(ctx)
+	if !ok {
+		return nil, &xrfErr.Forbidden{Source: "service/rung#giveConsent", Message: "caller is not authenticated"}
+	}
+	owner, err := rs.findUser(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	consent, err := rung.CreateConsent(callerFp, owner.FingerPrint, request.Method, request.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = rs.consentRepo.CreateConsent(consent, ctx); err != nil {
+		return nil, err
+	}
+	rs.log.Info(fmt.Sprintf("event=giveConsent :: success=true :: userId=%s :: consentId=%s", userId, consent.Id))
+	return toConsentResponse(userId, consent), nil
+}
+
+func (rs *rungService) GetConsent(userId string, ctx context.Context) (*exchange.ConsentResponse, error) {
+	callerFp, ok := internal.UserFingerprint(ctx)
+	if !ok {
+		return nil, &xrfErr.Forbidden{Source: "service/rung#getConsent", Message: "caller is not authenticated"}
+	}
+	owner, err := rs.findUser(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	consent, err := rs.consentRepo.FindGivenConsent(callerFp, owner.FingerPrint, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if consent == nil {
+		return nil, &xrfErr.External{Source: "service/rung#getConsent", Message: constants.NotFoundConsentErrMsg}
+	}
+	return toConsentResponse(userId, consent), nil
+}
+
+func (rs *rungService) RevokeConsent(userId string, ctx context.Context) error {
+	callerFp, ok := internal.UserFingerprint(ctx)
+	if !ok {
+		return &xrfErr.Forbidden{Source: "service/rung#revokeConsent", Message: "caller is not authenticated"}
+	}
+	owner, err := rs.findUser(userId, ctx)
+	if err != nil {
+		return err
+	}
+	if err = rs.consentRepo.RevokeConsent(callerFp, owner.FingerPrint, ctx); err != nil {
+		return err
+	}
+	rs.log.Info(fmt.Sprintf("event=revokeConsent :: success=true :: userId=%s", userId))
+	return nil
+}
+
+func (rs *rungService) findUser(userId string, ctx context.Context) (*user.User, error) {
+	foundUser, err := rs.userRepo.GetUserById(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if foundUser == nil || foundUser.FingerPrint == "" {
+		return nil, &xrfErr.External{Source: "service/rung#findUser", Message: "User not found"}
+	}
+	return foundUser, nil
+}
+
+// toRungResponse lists the trails newest first, customers are shown by their user id
+func (rs *rungService) toRungResponse(userId string, ownerRung *rung.Rung, ctx context.Context) (*exchange.RungResponse, error) {
+	customerFps := make([]string, 0, len(ownerRung.TradeTrails()))
+	for customerFp := range ownerRung.TradeTrails() {
+		customerFps = append(customerFps, customerFp)
+	}
+	customers, err := rs.userRepo.FindUsersByFingerPrints(customerFps, ctx)
+	if err != nil {
+		return nil, err
+	}
+	customerIds := make(map[string]string)
+	for _, customer := range customers {
+		customerIds[customer.FingerPrint] = customer.Id
+	}
+
+	trails := make([]exchange.TrailResponse, 0, len(customerFps))
+	for customerFp, trail := range ownerRung.TradeTrails() {
+		trails = append(trails, exchange.TrailResponse{
+			CustomerId: customerIds[customerFp],
+			Score:      trail.Score(),
+			Trades:     trail.Trades(),
+			UpdatedAt:  trail.UpdatedAt(),
+		})
+	}
+	sort.Slice(trails, func(i, j int) bool { return trails[i].UpdatedAt.After(trails[j].UpdatedAt) })
+
+	return &exchange.RungResponse{
+		UserId:    userId,
+		Magnitude: ownerRung.Magnitude(),
+		UpdatedAt: ownerRung.Updated(),
+		Trails:    trails,
+	}, nil
+}
+
+func toConsentResponse(userId string, consent *rung.Consent) *exchange.ConsentResponse {
+	return &exchange.ConsentResponse{
+		ConsentId: consent.Id,
+		UserId:    userId,
+		Status:    string(consent.Status),
+		Method:    string(consent.Method),
+		UserAgent: consent.UserAgent,
+		GivenAt:   consent.GivenAt,
+		RevokedAt: consent.RevokedAt,
+	}
+}
+
+func NewRungService(logger internal.Logger, allRepos *repository.Repositories) RungService {
+	return &rungService{
+		log:         logger,
+		userRepo:    allRepos.UserRepo,
+		rungRepo:    allRepos.RungRepo,
+		consentRepo: allRepos.ConsentRepo,
+	}
+}
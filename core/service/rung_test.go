@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/rung"
+	"xrf197ilz35aq0/core/model/user"
+	"xrf197ilz35aq0/core/repository"
+	xrf "xrf197ilz35aq0/internal"
+	xrfErr "xrf197ilz35aq0/internal/error"
+	xrfTest "xrf197ilz35aq0/internal/tests"
+)
+
+var testScoring = rung.Scoring{Strategy: rung.AverageMagnitude{}}
+
+func newRungTestRepos(t *testing.T, users ...*user.User) *repository.Repositories {
+	t.Helper()
+	repos := &repository.Repositories{
+		UserRepo:    xrfTest.NewUserRepositoryMock(),
+		RungRepo:    xrfTest.NewRungRepositoryMock(testScoring),
+		ConsentRepo: xrfTest.NewConsentRepositoryMock(),
+	}
+	for _, testUser := range users {
+		_, err := repos.UserRepo.CreateUser(testUser, context.TODO())
+		xrf.AssertNoError(t, err)
+	}
+	return repos
+}
+
+func TestRungServiceTradeTrails(t *testing.T) {
+	seller := &user.User{Id: "1", FingerPrint: ownerFp, Email: "seller@xrf.com"}
+	buyer := &user.User{Id: "2", FingerPrint: writerFp, Email: "buyer@xrf.com"}
+	rungService := NewRungService(xrf.NewTestLogger(), newRungTestRepos(t, seller, buyer))
+	sellerCtx := xrf.WithUserFingerprint(context.TODO(), ownerFp)
+	buyerCtx := xrf.WithUserFingerprint(context.TODO(), writerFp)
+	trade := exchange.TradeTrailRequest{TradeId: "trade-1", Rating: 8, Comment: "fast delivery"}
+
+	t.Run("refuses trades without consent", func(t *testing.T) {
+		_, err := rungService.AddTradeTrail(seller.Id, trade, buyerCtx)
+		var forbiddenErr *xrfErr.Forbidden
+		assert.True(t, errors.As(err, &forbiddenErr))
+	})
+
+	t.Run("records how consent was given", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			userId  string
+			request exchange.ConsentRequest
+			ctx     context.Context
+			wantErr bool
+		}{
+			{name: "rejects an unknown method", userId: seller.Id, request: exchange.ConsentRequest{Method: "fax"}, ctx: buyerCtx, wantErr: true},
+			{name: "rejects consent to trades with yourself", userId: seller.Id, request: exchange.ConsentRequest{Method: "web"}, ctx: sellerCtx, wantErr: true},
+			{name: "rejects unknown users", userId: "404", request: exchange.ConsentRequest{Method: "web"}, ctx: buyerCtx, wantErr: true},
+			{name: "gives consent", userId: seller.Id, request: exchange.ConsentRequest{Method: "web", UserAgent: "xrf-test"}, ctx: buyerCtx},
+			{name: "rejects consent given twice", userId: seller.Id, request: exchange.ConsentRequest{Method: "api"}, ctx: buyerCtx, wantErr: true},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				consent, err := rungService.GiveConsent(tt.userId, tt.request, tt.ctx)
+				if tt.wantErr {
+					xrf.AssertError(t, err)
+					return
+				}
+				xrf.AssertNoError(t, err)
+				assert.Equal(t, string(rung.ConsentGiven), consent.Status)
+				assert.Equal(t, string(rung.ConsentWeb), consent.Method)
+				assert.Equal(t, "xrf-test", consent.UserAgent)
+			})
+		}
+	})
+
+	t.Run("captures trades once consent is given", func(t *testing.T) {
+		_, err := rungService.AddTradeTrail(seller.Id, exchange.TradeTrailRequest{TradeId: "a.b", Rating: 8}, buyerCtx)
+		xrf.AssertError(t, err)
+		_, err = rungService.AddTradeTrail(seller.Id, exchange.TradeTrailRequest{TradeId: "trade-2", Rating: 11}, buyerCtx)
+		xrf.AssertError(t, err)
+
+		rungResp, err := rungService.AddTradeTrail(seller.Id, trade, buyerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 80, rungResp.Magnitude)
+		assert.Len(t, rungResp.Trails, 1)
+		assert.Equal(t, buyer.Id, rungResp.Trails[0].CustomerId)
+		assert.Equal(t, 1, rungResp.Trails[0].Trades)
+
+		rungResp, err = rungService.GetRung(seller.Id, sellerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 80, rungResp.Magnitude)
+	})
+
+	t.Run("refuses trades once consent is revoked", func(t *testing.T) {
+		err := rungService.RevokeConsent(seller.Id, buyerCtx)
+		xrf.AssertNoError(t, err)
+		err = rungService.RevokeConsent(seller.Id, buyerCtx)
+		xrf.AssertError(t, err)
+		_, err = rungService.GetConsent(seller.Id, buyerCtx)
+		xrf.AssertError(t, err)
+
+		_, err = rungService.AddTradeTrail(seller.Id, exchange.TradeTrailRequest{TradeId: "trade-3", Rating: 2}, buyerCtx)
+		var forbiddenErr *xrfErr.Forbidden
+		assert.True(t, errors.As(err, &forbiddenErr))
+
+		rungResp, err := rungService.GetRung(seller.Id, sellerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 80, rungResp.Magnitude)
+	})
+
+	t.Run("users without trades have no rung", func(t *testing.T) {
+		_, err := rungService.GetRung(buyer.Id, sellerCtx)
+		xrf.AssertError(t, err)
+	})
+}
+
+func TestRungServiceHistory(t *testing.T) {
+	seller := &user.User{Id: "1", FingerPrint: ownerFp, Email: "seller@xrf.com"}
+	buyer := &user.User{Id: "2", FingerPrint: writerFp, Email: "buyer@xrf.com"}
+	repos := newRungTestRepos(t, seller, buyer)
+	rungService := NewRungService(xrf.NewTestLogger(), repos)
+	buyerCtx := xrf.WithUserFingerprint(context.TODO(), writerFp)
+
+	_, err := rungService.GiveConsent(seller.Id, exchange.ConsentRequest{Method: "api"}, buyerCtx)
+	xrf.AssertNoError(t, err)
+	for _, trade := range []exchange.TradeTrailRequest{
+		{TradeId: "trade-1", Rating: 8},
+		{TradeId: "trade-2", Rating: 8}, // the same score, no change of magnitude
+		{TradeId: "trade-3", Rating: 2},
+	} {
+		_, err := rungService.AddTradeTrail(seller.Id, trade, buyerCtx)
+		xrf.AssertNoError(t, err)
+	}
+
+	t.Run("records every change of magnitude", func(t *testing.T) {
+		history, err := rungService.GetHistory(seller.Id, exchange.RungHistoryRequest{}, buyerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Len(t, history.Points, 2)
+		assert.Equal(t, 80, history.Points[0].Magnitude)
+		assert.Equal(t, 60, history.Points[1].Magnitude)
+	})
+
+	t.Run("filters and downsamples the timeline", func(t *testing.T) {
+		lastQuarter := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+		xrfTest.AddRungSnapshots(repos.RungRepo,
+			rung.Snapshot{OwnerFp: ownerFp, Magnitude: 30, RecordedAt: lastQuarter},
+			rung.Snapshot{OwnerFp: ownerFp, Magnitude: 40, RecordedAt: lastQuarter.Add(time.Hour)},
+			rung.Snapshot{OwnerFp: ownerFp, Magnitude: 50, RecordedAt: lastQuarter.Add(48 * time.Hour)},
+		)
+		from, to := lastQuarter, lastQuarter.AddDate(0, 3, 0)
+
+		history, err := rungService.GetHistory(seller.Id, exchange.RungHistoryRequest{From: &from, To: &to, Bucket: "day"}, buyerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Len(t, history.Points, 2)
+		assert.Equal(t, exchange.TimelinePointResponse{At: lastQuarter, Magnitude: 40, Min: 30, Max: 40, Changes: 2}, history.Points[0])
+
+		history, err = rungService.GetHistory(seller.Id, exchange.RungHistoryRequest{From: &from, To: &to, Bucket: "week"}, buyerCtx)
+		xrf.AssertNoError(t, err)
+		assert.Len(t, history.Points, 1)
+		assert.Equal(t, 50, history.Points[0].Magnitude)
+	})
+
+	t.Run("rejects invalid ranges and buckets", func(t *testing.T) {
+		from := time.Now()
+		to := from.Add(-time.Hour)
+		_, err := rungService.GetHistory(seller.Id, exchange.RungHistoryRequest{From: &from, To: &to}, buyerCtx)
+		xrf.AssertError(t, err)
+		_, err = rungService.GetHistory(seller.Id, exchange.RungHistoryRequest{Bucket: "month"}, buyerCtx)
+		xrf.AssertError(t, err)
+	})
+}
@@ -4,22 +4,36 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"strconv"
+	"io"
 	"time"
 	xrf "xrf197ilz35aq0"
 	"xrf197ilz35aq0/core/exchange"
 	"xrf197ilz35aq0/core/model/user"
 	"xrf197ilz35aq0/core/repository"
 	"xrf197ilz35aq0/internal"
-	"xrf197ilz35aq0/internal/custom"
+	"xrf197ilz35aq0/internal/constants"
 	"xrf197ilz35aq0/internal/encryption"
 	xrfErr "xrf197ilz35aq0/internal/error"
-	"xrf197ilz35aq0/internal/random"
 )
 
+// streamContext is the associated data that tells streams apart from the other ciphertexts of a user
+const streamContext = "stream"
+
 type SettingsService interface {
 	GetUserSettings(userFPrint string) (*exchange.SettingResponse, error)
+	GetPasswordConfig(userFPrint string) (*xrf.PasswordConfig, error)
 	NewSettings(request *exchange.SettingRequest, userFPrint string) (*exchange.SettingResponse, error)
+	// DataKey unwraps the user's data key, it should only be called where the key is used and never be stored
+	DataKey(userFPrint string) ([]byte, error)
+	// Keyring unwraps every version of the user's data key, for data encrypted before the key was rotated
+	Keyring(userFPrint string) (*user.Keyring, error)
+	// EncryptStream encrypts what's written to the returned writer to w with the user's current key, for payloads
+	// too large to hold in memory (e.g. data exports). Closing the writer completes the stream, it doesn't close w.
+	// Key rotations retire previous keys once every registered ReEncrypter succeeds, so wherever streams are stored
+	// has to register a ReEncrypter moving them to the current key (see ReEncryptStream)
+	EncryptStream(userFPrint string, w io.Writer) (io.WriteCloser, error)
+	// DecryptStream decrypts a stream made by EncryptStream, with whichever version of the user's key it was made with
+	DecryptStream(userFPrint string, r io.Reader) (io.Reader, error)
 }
 
 type settingService struct {
@@ -27,19 +41,27 @@ type settingService struct {
 	log          internal.Logger
 	ctx          context.Context
 	settingsRepo repository.SettingsRepository
+	keyProvider  encryption.KeyProvider
 }
 
 func (s *settingService) NewSettings(request *exchange.SettingRequest, userFPrint string) (*exchange.SettingResponse, error) {
 	s.log.Debug(fmt.Sprintf("event=creatUserSettings :: action=creatingSettings :: userFP=%s", userFPrint[:5]))
 
 	rotateAfter := internal.AddMonths(time.Now(), request.RotateAfter)
+	var dataKey []byte
 	if len(request.EncryptionKey) == 0 {
-		request.EncryptionKey = s.generateEncryptionKey()
+		generated, err := encryption.GenerateKey(32)
+		if err != nil {
+			s.log.Error(fmt.Sprintf("event=generateEncryptionKeyFailure :: userFP=%s :: err=%v", userFPrint[:5], err))
+			return nil, &xrfErr.Internal{Source: "core/service/settings#newSettings", Message: "Generating user key failed", Err: err}
+		}
+		dataKey = generated
 	} else {
 		err := s.validateEncryptionKey(request)
 		if err != nil {
 			return nil, err
 		}
+		dataKey = []byte(request.EncryptionKey)
 	}
 
 	err := s.validateSettings(request)
@@ -49,10 +71,16 @@ func (s *settingService) NewSettings(request *exchange.SettingRequest, userFPrin
 
 	settings := user.NewSettings(
 		request.RotateKey,
-		time.Since(rotateAfter),
+		time.Until(rotateAfter),
 		userFPrint,
-		request.EncryptionKey,
+		"",
 	)
+	settings.WrappedKey, err = wrapDataKey(dataKey, userFPrint, settings.KeyVersion, s.keyProvider)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("event=wrapEncryptionKeyFailure :: userFP=%s :: err=%v", userFPrint[:5], err))
+		return nil, err
+	}
+	settings.UserKey = len(request.EncryptionKey) != 0
 	settings.Time = s.config.PasswordConfig.Time
 	settings.Memory = s.config.PasswordConfig.Memory
 	settings.Threads = s.config.PasswordConfig.Thread
@@ -74,6 +102,176 @@ func (s *settingService) GetUserSettings(userFPrint string) (*exchange.SettingRe
 	return toSettingsResponse(userSettings), nil
 }
 
+// GetPasswordConfig returns the argon2 parameters the user's password was hashed with
+func (s *settingService) GetPasswordConfig(userFPrint string) (*xrf.PasswordConfig, error) {
+	userSettings, err := s.settingsRepo.FetchUserSettings(s.ctx, userFPrint)
+	if err != nil {
+		return nil, err
+	}
+	return &xrf.PasswordConfig{
+		Time:   userSettings.Time,
+		Thread: userSettings.Threads,
+		Memory: userSettings.Memory,
+	}, nil
+}
+
+func (s *settingService) DataKey(userFPrint string) ([]byte, error) {
+	keyring, err := s.Keyring(userFPrint)
+	if err != nil {
+		return nil, err
+	}
+	_, dataKey := keyring.Current()
+	return dataKey, nil
+}
+
+func (s *settingService) Keyring(userFPrint string) (*user.Keyring, error) {
+	userSettings, err := s.settingsRepo.FetchUserSettings(s.ctx, userFPrint)
+	if err != nil {
+		return nil, err
+	}
+	if userSettings.WrappedKey == "" && userSettings.LegacyKey != "" {
+		return s.wrapLegacyKey(userSettings), nil
+	}
+
+	keyring, err := unwrapKeyring(userSettings, s.keyProvider)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("event=unwrapEncryptionKeyFailure :: userFP=%s :: err=%v", userFPrint[:5], err))
+		return nil, err
+	}
+	return keyring, nil
+}
+
+func (s *settingService) EncryptStream(userFPrint string, w io.Writer) (io.WriteCloser, error) {
+	keyring, err := s.Keyring(userFPrint)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamWriter(keyring, userFPrint, w)
+}
+
+func (s *settingService) DecryptStream(userFPrint string, r io.Reader) (io.Reader, error) {
+	keyring, err := s.Keyring(userFPrint)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamReader(keyring, userFPrint, r)
+}
+
+// ReEncryptStream writes the stream read from r, made by EncryptStream with any version of the keyring, to w
+// encrypted with the keyring's current version. It's meant for ReEncrypters of stored streams, with the keyring
+// they're given. What's written to w is only complete if it returns nil
+func ReEncryptStream(keyring *user.Keyring, userFP string, r io.Reader, w io.Writer) error {
+	reader, err := newStreamReader(keyring, userFP, r)
+	if err != nil {
+		return err
+	}
+	writer, err := newStreamWriter(keyring, userFP, w)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(writer, reader); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func newStreamWriter(keyring *user.Keyring, userFP string, w io.Writer) (io.WriteCloser, error) {
+	version, dataKey := keyring.Current()
+	return encryption.NewEncryptWriter(w, dataKey, user.KeyId(version), streamAAD(userFP))
+}
+
+func newStreamReader(keyring *user.Keyring, userFP string, r io.Reader) (io.Reader, error) {
+	return encryption.NewDecryptReader(r, keyring.Lookup, streamAAD(userFP))
+}
+
+// streamAAD binds a stream to the user, another user's stream won't decrypt even with the same key
+func streamAAD(userFP string) []byte {
+	return encryption.ContextAAD(streamContext, userFP)
+}
+
+// wrapLegacyKey wraps a key that was stored in plaintext and replaces it, generated keys were stored base64 encoded
+func (s *settingService) wrapLegacyKey(userSettings *user.Settings) *user.Keyring {
+	keyring := user.NewKeyring(userSettings.KeyVersion, map[int][]byte{userSettings.KeyVersion: legacyDataKey(userSettings)})
+	s.rewrapKeys(userSettings, keyring)
+	return keyring
+}
+
+func legacyDataKey(userSettings *user.Settings) []byte {
+	if decoded, err := base64.StdEncoding.DecodeString(userSettings.LegacyKey); err == nil && len(decoded) == 32 {
+		return decoded
+	}
+	return []byte(userSettings.LegacyKey)
+}
+
+// rewrapKeys stores the keyring's keys wrapped and bound to the user, it replaces keys that weren't wrapped at all.
+// The keys can still be used if it fails, it's retried the next time they're read
+func (s *settingService) rewrapKeys(userSettings *user.Settings, keyring *user.Keyring) {
+	userFP := userSettings.UserFingerprint
+	version, dataKey := keyring.Current()
+	wrappedKey, err := wrapDataKey(dataKey, userFP, version, s.keyProvider)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("event=rewrapKeysFailure :: userFP=%s :: err=%v", userFP[:5], err))
+		return
+	}
+	previousKeys := make([]user.WrappedDataKey, 0, len(userSettings.PreviousKeys))
+	for _, previous := range userSettings.PreviousKeys {
+		previousKey, _ := keyring.Key(previous.Version)
+		previous.WrappedKey, err = wrapDataKey(previousKey, userFP, previous.Version, s.keyProvider)
+		if err != nil {
+			s.log.Error(fmt.Sprintf("event=rewrapKeysFailure :: userFP=%s :: err=%v", userFP[:5], err))
+			return
+		}
+		previousKeys = append(previousKeys, previous)
+	}
+
+	if err = s.settingsRepo.RewrapKeys(userFP, version, wrappedKey, previousKeys, s.ctx); err != nil {
+		s.log.Error(fmt.Sprintf("event=rewrapKeysFailure :: userFP=%s :: err=%v", userFP[:5], err))
+		return
+	}
+	s.log.Info(fmt.Sprintf("event=rewrapKeys :: success=true :: userFP=%s", userFP[:5]))
+}
+
+// wrappedKeyAAD binds a wrapped data key to the user and the version it's stored as, so it can't be used as another
+// user's key or swapped with another version
+func wrappedKeyAAD(userFP string, version int) []byte {
+	return encryption.ContextAAD(constants.SettingsCollection, constants.WrappedKey, userFP, user.KeyId(version))
+}
+
+func wrapDataKey(dataKey []byte, userFP string, version int, keyProvider encryption.KeyProvider) (string, error) {
+	wrappedKey, err := encryption.WrapKey(dataKey, keyProvider, wrappedKeyAAD(userFP, version))
+	if err != nil {
+		return "", &xrfErr.Internal{Source: "core/service/settings#wrapDataKey", Message: "Wrapping user key failed", Err: err}
+	}
+	return wrappedKey, nil
+}
+
+// unwrapKeyring unwraps every version of the user's key, keys that aren't bound to the user and version fail
+func unwrapKeyring(userSettings *user.Settings, keyProvider encryption.KeyProvider) (*user.Keyring, error) {
+	internalErr := &xrfErr.Internal{Source: "core/service/settings#unwrapKeyring", Message: "Unwrapping user key failed"}
+	if userSettings.WrappedKey == "" {
+		internalErr.Message = "user has no encryption key"
+		return nil, internalErr
+	}
+
+	userFP := userSettings.UserFingerprint
+	keys := make(map[int][]byte)
+	current, err := encryption.UnwrapKey(userSettings.WrappedKey, keyProvider, wrappedKeyAAD(userFP, userSettings.KeyVersion))
+	if err != nil {
+		internalErr.Err = err
+		return nil, internalErr
+	}
+	keys[userSettings.KeyVersion] = current
+	for _, previous := range userSettings.PreviousKeys {
+		dataKey, err := encryption.UnwrapKey(previous.WrappedKey, keyProvider, wrappedKeyAAD(userFP, previous.Version))
+		if err != nil {
+			internalErr.Err = err
+			return nil, internalErr
+		}
+		keys[previous.Version] = dataKey
+	}
+	return user.NewKeyring(userSettings.KeyVersion, keys), nil
+}
+
 func (s *settingService) validateEncryptionKey(request *exchange.SettingRequest) error {
 	key := request.EncryptionKey
 	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
@@ -83,22 +281,11 @@ func (s *settingService) validateEncryptionKey(request *exchange.SettingRequest)
 }
 
 func toSettingsResponse(settings *user.Settings) *exchange.SettingResponse {
-	key := custom.NewSecret(settings.Key())
 	return &exchange.SettingResponse{
-		EncryptionKey: *key,
-		CreatedAt:     settings.CreatedAt,
-		UpdatedAt:     settings.LastModified,
-		RotateKey:     settings.RotateEncryptionKey,
-	}
-}
-
-func (s *settingService) generateEncryptionKey() string {
-	key, err := encryption.GenerateKey(32)
-	if err != nil {
-		s.log.Debug(fmt.Sprintf("event=%v :: error=%v", "generateEncryptionKeyFailure", err))
-		return strconv.FormatInt(random.PositiveInt64(), 10)
+		CreatedAt: settings.CreatedAt,
+		UpdatedAt: settings.LastModified,
+		RotateKey: settings.RotateEncryptionKey,
 	}
-	return base64.StdEncoding.EncodeToString(key)
 }
 
 func (s *settingService) validateSettings(request *exchange.SettingRequest) error {
@@ -117,11 +304,13 @@ func NewSettingService(
 	logger internal.Logger,
 	settingsRepo repository.SettingsRepository,
 	ctx context.Context,
-	config xrf.Security) SettingsService {
+	config xrf.Security,
+	keyProvider encryption.KeyProvider) SettingsService {
 	return &settingService{
 		ctx:          ctx,
 		log:          logger,
 		config:       config,
 		settingsRepo: settingsRepo,
+		keyProvider:  keyProvider,
 	}
 }
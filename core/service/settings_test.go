@@ -1,24 +1,34 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 	"xrf197ilz35aq0"
 	"xrf197ilz35aq0/core/exchange"
 	"xrf197ilz35aq0/core/model/user"
+	"xrf197ilz35aq0/core/repository"
 	xrf "xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/encryption"
 	xrfTest "xrf197ilz35aq0/internal/tests"
 )
 
 var encryptionTestKey = xrf.RandomBytes(32)
 var securityConfig = xrf197ilz35aq0.Security{
+	Admins: []string{adminUserId},
 	PasswordConfig: xrf197ilz35aq0.PasswordConfig{
 		Time:   6,
 		Thread: 3,
 		Memory: 120,
 	},
+	Invitation: xrf197ilz35aq0.InvitationConfig{ExpiresAfter: time.Hour},
 }
 
 func TestNewSettings(t *testing.T) {
@@ -72,7 +82,7 @@ func TestNewSettings(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			manager := NewSettingService(logger, settingsRepoMock, context.TODO(), securityConfig)
+			manager := NewSettingService(logger, settingsRepoMock, context.TODO(), securityConfig, newTestKeyProvider(t))
 			got, err := manager.NewSettings(tt.args.request, "userTestVVFingerXXPrintLL")
 			if !tt.wantErr(t, err, fmt.Sprintf("NewSettings(%v, %v)", tt.args.request, tt.args.userModel)) {
 				return
@@ -101,3 +111,243 @@ func createSettingRequest(key string, rotate bool, rotateAfter int) *exchange.Se
 	}
 	return request
 }
+
+func TestSettingsDataKey(t *testing.T) {
+	logger := xrf.NewTestLogger()
+	userKey := "a-user-provided-key-of-32-bytes!"
+	legacyKey, _ := encryption.GenerateKey(32)
+
+	tests := []struct {
+		name      string
+		setup     func(settingsRepo repository.SettingsRepository, manager SettingsService) string
+		wantKey   []byte
+		keyLength int
+	}{
+		{
+			name: "generated keys are only stored wrapped",
+			setup: func(_ repository.SettingsRepository, manager SettingsService) string {
+				_, err := manager.NewSettings(createSettingRequest("", false, 0), "generatedKeyFingerPrint")
+				xrf.AssertNoError(t, err)
+				return "generatedKeyFingerPrint"
+			},
+			keyLength: 32,
+		},
+		{
+			name: "user provided keys are only stored wrapped",
+			setup: func(_ repository.SettingsRepository, manager SettingsService) string {
+				_, err := manager.NewSettings(createSettingRequest(userKey, false, 0), "userKeyFingerPrint")
+				xrf.AssertNoError(t, err)
+				return "userKeyFingerPrint"
+			},
+			wantKey: []byte(userKey),
+		},
+		{
+			name: "legacy plaintext keys are wrapped on first use",
+			setup: func(settingsRepo repository.SettingsRepository, _ SettingsService) string {
+				legacy := user.NewSettings(false, 0, "legacyKeyFingerPrint", "")
+				legacy.LegacyKey = base64.StdEncoding.EncodeToString(legacyKey)
+				_, err := settingsRepo.CreateSettings(legacy, context.TODO())
+				xrf.AssertNoError(t, err)
+				return "legacyKeyFingerPrint"
+			},
+			wantKey: legacyKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settingsRepo := xrfTest.NewSettingsRepositoryMock()
+			manager := NewSettingService(logger, settingsRepo, context.TODO(), securityConfig, newTestKeyProvider(t))
+			userFP := tt.setup(settingsRepo, manager)
+
+			dataKey, err := manager.DataKey(userFP)
+			xrf.AssertNoError(t, err)
+			if tt.wantKey != nil {
+				assert.Equal(t, tt.wantKey, dataKey)
+			} else {
+				assert.Len(t, dataKey, tt.keyLength)
+			}
+
+			stored, err := settingsRepo.FetchUserSettings(context.TODO(), userFP)
+			xrf.AssertNoError(t, err)
+			assert.Empty(t, stored.LegacyKey)
+			assert.NotEmpty(t, stored.WrappedKey)
+			assert.NotContains(t, stored.WrappedKey, base64.StdEncoding.EncodeToString(dataKey))
+
+			again, err := manager.DataKey(userFP)
+			xrf.AssertNoError(t, err)
+			assert.Equal(t, dataKey, again)
+		})
+	}
+
+	t.Run("keys can't be unwrapped with another key-encryption key", func(t *testing.T) {
+		settingsRepo := xrfTest.NewSettingsRepositoryMock()
+		manager := NewSettingService(logger, settingsRepo, context.TODO(), securityConfig, newTestKeyProvider(t))
+		_, err := manager.NewSettings(createSettingRequest("", false, 0), "rotatedKekFingerPrint")
+		xrf.AssertNoError(t, err)
+
+		other := NewSettingService(logger, settingsRepo, context.TODO(), securityConfig, newTestKeyProvider(t))
+		_, err = other.DataKey("rotatedKekFingerPrint")
+		xrf.AssertError(t, err)
+	})
+}
+
+func TestSettingsKeysAreBoundToTheUser(t *testing.T) {
+	logger := xrf.NewTestLogger()
+	ctx := context.TODO()
+	keyProvider := newTestKeyProvider(t)
+
+	t.Run("a key copied to another user's settings can't be unwrapped", func(t *testing.T) {
+		settingsRepo := xrfTest.NewSettingsRepositoryMock()
+		manager := NewSettingService(logger, settingsRepo, ctx, securityConfig, keyProvider)
+		_, err := manager.NewSettings(createSettingRequest("", false, 0), "victimFingerPrint")
+		xrf.AssertNoError(t, err)
+		victim, err := settingsRepo.FetchUserSettings(ctx, "victimFingerPrint")
+		xrf.AssertNoError(t, err)
+
+		_, err = settingsRepo.CreateSettings(user.NewSettings(false, 0, "attackerFingerPrint", victim.WrappedKey), ctx)
+		xrf.AssertNoError(t, err)
+		_, err = manager.DataKey("attackerFingerPrint")
+		xrf.AssertError(t, err)
+	})
+
+	t.Run("a previous key swapped with the current one can't be unwrapped", func(t *testing.T) {
+		settingsRepo := xrfTest.NewSettingsRepositoryMock()
+		manager := NewSettingService(logger, settingsRepo, ctx, securityConfig, keyProvider)
+		wrappedV1, err := wrapDataKey(xrf.RandomBytes(32), "swappedFingerPrint", 1, keyProvider)
+		xrf.AssertNoError(t, err)
+		wrappedV2, err := wrapDataKey(xrf.RandomBytes(32), "swappedFingerPrint", 2, keyProvider)
+		xrf.AssertNoError(t, err)
+
+		swapped := user.NewSettings(false, 0, "swappedFingerPrint", wrappedV1)
+		swapped.KeyVersion = 2
+		swapped.PreviousKeys = []user.WrappedDataKey{{Version: 1, WrappedKey: wrappedV2}}
+		_, err = settingsRepo.CreateSettings(swapped, ctx)
+		xrf.AssertNoError(t, err)
+		_, err = manager.Keyring("swappedFingerPrint")
+		xrf.AssertError(t, err)
+	})
+
+	t.Run("a key wrapped without binding and copied from another user can't be unwrapped", func(t *testing.T) {
+		settingsRepo := xrfTest.NewSettingsRepositoryMock()
+		manager := NewSettingService(logger, settingsRepo, ctx, securityConfig, keyProvider)
+		dataKey, err := encryption.GenerateKey(32)
+		xrf.AssertNoError(t, err)
+		kek, err := keyProvider.KeyEncryptionKey()
+		xrf.AssertNoError(t, err)
+		unbound, err := encryption.EncryptWithKeyId(dataKey, kek, encryption.KeyId(kek))
+		xrf.AssertNoError(t, err)
+		unboundKey := base64.StdEncoding.EncodeToString(unbound)
+		_, err = settingsRepo.CreateSettings(user.NewSettings(false, 0, "attackerFingerPrint", unboundKey), ctx)
+		xrf.AssertNoError(t, err)
+
+		_, err = manager.DataKey("attackerFingerPrint")
+		xrf.AssertError(t, err)
+
+		stored, err := settingsRepo.FetchUserSettings(ctx, "attackerFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, unboundKey, stored.WrappedKey, "the key isn't rebound to the user")
+	})
+}
+
+func TestSettingsStreams(t *testing.T) {
+	logger := xrf.NewTestLogger()
+	ctx := context.TODO()
+	keyProvider := newTestKeyProvider(t)
+	settingsRepo := xrfTest.NewSettingsRepositoryMock()
+	manager := NewSettingService(logger, settingsRepo, ctx, securityConfig, keyProvider)
+	createRotationSettings(t, settingsRepo, keyProvider, "streamFingerPrint", true, time.Now().Add(-time.Hour))
+	createRotationSettings(t, settingsRepo, keyProvider, "otherFingerPrint", false, time.Time{})
+	export := xrf.RandomBytes(3*encryption.DefaultStreamChunk + 5)
+
+	var sealed bytes.Buffer
+	writer, err := manager.EncryptStream("streamFingerPrint", &sealed)
+	xrf.AssertNoError(t, err)
+	_, err = writer.Write(export)
+	xrf.AssertNoError(t, err)
+	xrf.AssertNoError(t, writer.Close())
+
+	decryptExport := func(userFP string) ([]byte, error) {
+		reader, err := manager.DecryptStream(userFP, bytes.NewReader(sealed.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(reader)
+	}
+	decrypted, err := decryptExport("streamFingerPrint")
+	xrf.AssertNoError(t, err)
+	assert.Equal(t, export, decrypted)
+
+	_, err = decryptExport("otherFingerPrint")
+	xrf.AssertError(t, err)
+
+	t.Run("streams made before a rotation decrypt after it", func(t *testing.T) {
+		rotation := NewKeyRotationService(logger, xrf197ilz35aq0.KeyRotationConfig{BatchSize: 10, LeaseFor: time.Minute}, settingsRepo, keyProvider)
+		processed, err := rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, processed)
+
+		rotated, err := settingsRepo.FetchUserSettings(ctx, "streamFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 2, rotated.KeyVersion)
+		assert.Nil(t, rotated.RotationLease, "the rotation completed")
+
+		decrypted, err := decryptExport("streamFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, export, decrypted)
+	})
+
+	t.Run("stored streams are re-encrypted before the previous key is retired", func(t *testing.T) {
+		createRotationSettings(t, settingsRepo, keyProvider, "storedFingerPrint", true, time.Now().Add(-time.Hour))
+		var original bytes.Buffer
+		writer, err := manager.EncryptStream("storedFingerPrint", &original)
+		xrf.AssertNoError(t, err)
+		_, err = writer.Write(export)
+		xrf.AssertNoError(t, err)
+		xrf.AssertNoError(t, writer.Close())
+		store := &streamStoreMock{streams: map[string][]byte{"storedFingerPrint": original.Bytes()}}
+
+		rotation := NewKeyRotationService(logger, xrf197ilz35aq0.KeyRotationConfig{BatchSize: 10, LeaseFor: time.Minute}, settingsRepo, keyProvider, store)
+		processed, err := rotation.RotateDueKeys(ctx)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, 1, processed)
+		rotated, err := settingsRepo.FetchUserSettings(ctx, "storedFingerPrint")
+		xrf.AssertNoError(t, err)
+		assert.Empty(t, rotated.PreviousKeys)
+
+		reader, err := manager.DecryptStream("storedFingerPrint", bytes.NewReader(store.streams["storedFingerPrint"]))
+		xrf.AssertNoError(t, err)
+		decrypted, err := io.ReadAll(reader)
+		xrf.AssertNoError(t, err)
+		assert.Equal(t, export, decrypted)
+
+		_, err = manager.DecryptStream("storedFingerPrint", bytes.NewReader(original.Bytes()))
+		xrf.AssertError(t, err)
+	})
+}
+
+// streamStoreMock keeps a stream per user and re-encrypts them when the user's key is rotated
+type streamStoreMock struct {
+	streams map[string][]byte // userFP: stream
+}
+
+func (s *streamStoreMock) ReEncrypt(userFP string, keyring *user.Keyring, _ context.Context) error {
+	var reEncrypted bytes.Buffer
+	if err := ReEncryptStream(keyring, userFP, bytes.NewReader(s.streams[userFP]), &reEncrypted); err != nil {
+		return err
+	}
+	s.streams[userFP] = reEncrypted.Bytes()
+	return nil
+}
+
+// newTestKeyProvider writes a new key-encryption key to a file only the test can see
+func newTestKeyProvider(t *testing.T) encryption.KeyProvider {
+	t.Helper()
+	kek, err := encryption.GenerateKey(32)
+	xrf.AssertNoError(t, err)
+	path := filepath.Join(t.TempDir(), "kek")
+	xrf.AssertNoError(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(kek)), 0o600))
+
+	provider, err := encryption.NewKeyProvider(encryption.FileKeyProvider, path)
+	xrf.AssertNoError(t, err)
+	return provider
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"golang.org/x/crypto/argon2"
 	"net/mail"
@@ -17,8 +18,10 @@ import (
 	"xrf197ilz35aq0/core/model/user"
 	"xrf197ilz35aq0/core/repository"
 	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
 	"xrf197ilz35aq0/internal/custom"
 	xrfErr "xrf197ilz35aq0/internal/error"
+	"xrf197ilz35aq0/internal/token"
 )
 
 var internalError *xrfErr.Internal
@@ -27,13 +30,17 @@ var internalError *xrfErr.Internal
 type UserService interface {
 	GetUserById(userId string) (*exchange.UserResponse, error)
 	CreateUser(request *exchange.UserRequest) (*exchange.UserResponse, error)
+	Authenticate(request *exchange.LoginRequest, ctx context.Context) (*exchange.LoginResponse, error)
 }
 
+const tokenType = "Bearer"
+
 type service struct {
 	log             internal.Logger
 	config          xrf.Security
 	settingsService SettingsService
 	ctx             context.Context
+	tokenSigner     *token.Signer
 	userRepo        repository.UserRepository
 }
 
@@ -53,7 +60,7 @@ func (uc *service) CreateUser(request *exchange.UserRequest) (*exchange.UserResp
 		return nil, err
 	}
 
-	hashedPassword, err := uc.hashPassword(request.Password.Data())
+	hashedPassword, err := hashPassword(request.Password.Data(), uc.config.PasswordConfig)
 	if err != nil {
 		internalError.Err = err
 		internalError.Message = "Something went wrong"
@@ -112,6 +119,85 @@ func (uc *service) GetUserById(userId string) (*exchange.UserResponse, error) {
 	return response, nil
 }
 
+// Authenticate verifies the user's password against the argon2 hash stored for them and
+// issues a session token if they match.
+// The same error is returned for unknown emails and wrong passwords to avoid leaking which emails exist
+func (uc *service) Authenticate(request *exchange.LoginRequest, ctx context.Context) (*exchange.LoginResponse, error) {
+	requestId := internal.RequestId(ctx)
+	invalidCredentialsErr := &xrfErr.External{
+		Source:  "core/service/user#authenticate",
+		Message: constants.InvalidCredentialsErrMsg,
+	}
+
+	email := strings.TrimSpace(request.Email)
+	if email == "" || request.Password.Data() == "" {
+		uc.log.Warn(fmt.Sprintf("event=authenticate :: success=false :: requestId=%s :: reason=missingCredentials", requestId))
+		return nil, invalidCredentialsErr
+	}
+
+	savedUser, err := uc.userRepo.FindUserByEmail(email, ctx)
+	if err != nil {
+		var externalErr *xrfErr.External
+		if errors.As(err, &externalErr) {
+			uc.log.Warn(fmt.Sprintf("event=authenticate :: success=false :: requestId=%s :: reason=unknownEmail", requestId))
+			return nil, invalidCredentialsErr
+		}
+		uc.log.Error(fmt.Sprintf("event=authenticate :: action=findUserByEmail :: requestId=%s :: err=%v", requestId, err))
+		return nil, err
+	}
+
+	passwordConfig, err := uc.settingsService.GetPasswordConfig(savedUser.FingerPrint)
+	if err != nil {
+		uc.log.Error(fmt.Sprintf("event=authenticate :: action=getPasswordConfig :: requestId=%s :: userId=%s :: err=%v", requestId, savedUser.Id, err))
+		return nil, &xrfErr.Internal{Source: "core/service/user#authenticate", Message: "Something went wrong", Err: err}
+	}
+
+	isValid, err := verifyPassword(
+		passwordConfig.Thread,
+		passwordConfig.Memory,
+		uint32(passwordConfig.Time),
+		request.Password.Data(),
+		savedUser.Password)
+	if err != nil {
+		uc.log.Error(fmt.Sprintf("event=authenticate :: action=verifyPassword :: requestId=%s :: userId=%s :: err=%v", requestId, savedUser.Id, err))
+		return nil, &xrfErr.Internal{Source: "core/service/user#authenticate", Message: "Something went wrong", Err: err}
+	}
+	if !isValid && passwordConfig.Thread != legacyPasswordThreads() {
+		// passwords hashed before the thread count was configured used one thread per CPU, whatever their settings say
+		isValid, err = verifyPassword(
+			legacyPasswordThreads(),
+			passwordConfig.Memory,
+			uint32(passwordConfig.Time),
+			request.Password.Data(),
+			savedUser.Password)
+		if err != nil {
+			uc.log.Error(fmt.Sprintf("event=authenticate :: action=verifyLegacyPassword :: requestId=%s :: userId=%s :: err=%v", requestId, savedUser.Id, err))
+			return nil, &xrfErr.Internal{Source: "core/service/user#authenticate", Message: "Something went wrong", Err: err}
+		}
+		if isValid {
+			uc.rehashPassword(savedUser, request.Password.Data(), *passwordConfig, ctx)
+		}
+	}
+	if !isValid {
+		uc.log.Warn(fmt.Sprintf("event=authenticate :: success=false :: requestId=%s :: userId=%s :: reason=invalidPassword", requestId, savedUser.Id))
+		return nil, invalidCredentialsErr
+	}
+
+	sessionToken, claims, err := uc.tokenSigner.Issue(savedUser.FingerPrint, savedUser.Id)
+	if err != nil {
+		uc.log.Error(fmt.Sprintf("event=authenticate :: action=issueToken :: requestId=%s :: userId=%s :: err=%v", requestId, savedUser.Id, err))
+		return nil, &xrfErr.Internal{Source: "core/service/user#authenticate", Message: "Something went wrong", Err: err}
+	}
+	uc.log.Info(fmt.Sprintf("event=authenticate :: success=true :: requestId=%s :: userId=%s", requestId, savedUser.Id))
+
+	return &exchange.LoginResponse{
+		UserId:    savedUser.Id,
+		Token:     sessionToken,
+		TokenType: tokenType,
+		ExpiresAt: claims.Expiry(),
+	}, nil
+}
+
 func (uc *service) validateUser(request *exchange.UserRequest) error {
 	// is validEmail
 	_, err := mail.ParseAddress(request.Email.Data())
@@ -161,7 +247,28 @@ func (uc *service) validatePassword(password string) error {
 	return nil
 }
 
-func (uc *service) hashPassword(password string) (string, error) {
+// rehashPassword hashes the password again with the parameters stored in the user's settings, so the next
+// login verifies it without the legacy fallback. The login goes on when it fails, the fallback still verifies it
+func (uc *service) rehashPassword(savedUser *user.User, password string, passwordConfig xrf.PasswordConfig, ctx context.Context) {
+	requestId := internal.RequestId(ctx)
+	hashedPassword, err := hashPassword(password, passwordConfig)
+	if err != nil {
+		uc.log.Error(fmt.Sprintf("event=authenticate :: action=rehashPassword :: requestId=%s :: userId=%s :: err=%v", requestId, savedUser.Id, err))
+		return
+	}
+	if _, err = uc.userRepo.UpdatePassword(savedUser.FingerPrint, hashedPassword, ctx); err != nil {
+		uc.log.Error(fmt.Sprintf("event=authenticate :: action=updatePassword :: requestId=%s :: userId=%s :: err=%v", requestId, savedUser.Id, err))
+		return
+	}
+	uc.log.Info(fmt.Sprintf("event=authenticate :: action=rehashPassword :: success=true :: requestId=%s :: userId=%s", requestId, savedUser.Id))
+}
+
+// legacyPasswordThreads is the thread count passwords were hashed with before it was configured
+func legacyPasswordThreads() uint8 {
+	return uint8(runtime.NumCPU())
+}
+
+func hashPassword(password string, passwordConfig xrf.PasswordConfig) (string, error) {
 	internalError := &xrfErr.Internal{
 		Source: "core/service/settings#hashPassword",
 	}
@@ -179,9 +286,10 @@ func (uc *service) hashPassword(password string) (string, error) {
 	//   - memory:  Memory usage in KiB (higher is more resistant to GPU cracking).
 	//   - threads: Number of parallel threads (can improve performance).
 	//   - keyLen: Length of the generated hash in bytes.
-	var argonThreads = uint8(runtime.NumCPU())
-	var argonMemory = uc.config.PasswordConfig.Memory
-	var argonTime = uint32(uc.config.PasswordConfig.Time)
+	// The same parameters are stored in the user's settings and are needed to verify the password
+	var argonThreads = passwordConfig.Thread
+	var argonMemory = passwordConfig.Memory
+	var argonTime = uint32(passwordConfig.Time)
 
 	hash := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, 32)
 
@@ -232,6 +340,7 @@ func NewUserService(
 	log internal.Logger,
 	userSettings SettingsService,
 	userRepo repository.UserRepository,
+	tokenSigner *token.Signer,
 	ctx context.Context, config xrf.Security) UserService {
 
 	return &service{
@@ -239,6 +348,7 @@ func NewUserService(
 		log:             log,
 		config:          config,
 		userRepo:        userRepo,
+		tokenSigner:     tokenSigner,
 		settingsService: userSettings,
 	}
 }
@@ -2,13 +2,18 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"testing"
 	"time"
+	xrfCfg "xrf197ilz35aq0"
 	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/model/user"
 	xrf "xrf197ilz35aq0/internal"
 	"xrf197ilz35aq0/internal/custom"
 	xrfTest "xrf197ilz35aq0/internal/tests"
+	"xrf197ilz35aq0/internal/token"
 )
 
 const (
@@ -17,7 +22,8 @@ const (
 )
 
 type settingServiceMock struct {
-	Called map[string]int
+	Called         map[string]int
+	passwordConfig *xrfCfg.PasswordConfig // the stored parameters, securityConfig's when nil
 }
 
 func newSettingServiceMock() *settingServiceMock {
@@ -38,7 +44,52 @@ func (s *settingServiceMock) GetUserSettings(_ string) (*exchange.SettingRespons
 }
 
 var settingResponseMock = &exchange.SettingResponse{
-	EncryptionKey: *custom.NewSecret[string](string(encryptionTestKey)),
+	RotateKey: true,
+}
+
+func (s *settingServiceMock) GetPasswordConfig(_ string) (*xrfCfg.PasswordConfig, error) {
+	method := "getPasswordConfig"
+	count, ok := s.Called[method]
+	if !ok {
+		s.Called[method] = 1
+	} else {
+		s.Called[method] = count + 1
+	}
+	passwordConfig := securityConfig.PasswordConfig
+	if s.passwordConfig != nil {
+		passwordConfig = *s.passwordConfig
+	}
+	return &passwordConfig, nil
+}
+
+func (s *settingServiceMock) DataKey(_ string) ([]byte, error) {
+	method := "dataKey"
+	count, ok := s.Called[method]
+	if !ok {
+		s.Called[method] = 1
+	} else {
+		s.Called[method] = count + 1
+	}
+	return encryptionTestKey, nil
+}
+
+func (s *settingServiceMock) Keyring(_ string) (*user.Keyring, error) {
+	method := "keyring"
+	count, ok := s.Called[method]
+	if !ok {
+		s.Called[method] = 1
+	} else {
+		s.Called[method] = count + 1
+	}
+	return user.NewKeyring(1, map[int][]byte{1: encryptionTestKey}), nil
+}
+
+func (s *settingServiceMock) EncryptStream(_ string, _ io.Writer) (io.WriteCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *settingServiceMock) DecryptStream(_ string, _ io.Reader) (io.Reader, error) {
+	return nil, errors.New("not implemented")
 }
 
 func (s *settingServiceMock) NewSettings(_ *exchange.SettingRequest, _ string) (*exchange.SettingResponse, error) {
@@ -73,7 +124,7 @@ func TestUserServiceCreateUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			uc := NewUserService(logger, settingServiceMock, userRepo, context.TODO(), securityConfig)
+			uc := NewUserService(logger, settingServiceMock, userRepo, newTestTokenSigner(t), context.TODO(), securityConfig)
 			got, err := uc.CreateUser(tt.request)
 			if tt.wantErr {
 				xrf.AssertError(t, err)
@@ -117,6 +168,96 @@ func TestGetUserById(t *testing.T) {
 	}
 }
 
+func TestUserServiceAuthenticate(t *testing.T) {
+	logger := xrf.NewTestLogger()
+	userRepo := xrfTest.NewUserRepositoryMock()
+	settingServiceMock := newSettingServiceMock()
+	tokenSigner := newTestTokenSigner(t)
+
+	uc := NewUserService(logger, settingServiceMock, userRepo, tokenSigner, context.TODO(), securityConfig)
+	created, err := uc.CreateUser(createUserRequest(validEmailAddress, strongPassword))
+	xrf.AssertNoError(t, err)
+
+	tests := []struct {
+		name    string
+		wantErr bool
+		request *exchange.LoginRequest
+	}{
+		{name: "valid credentials issue a token", wantErr: false, request: createLoginRequest(validEmailAddress, strongPassword)},
+		{name: "email is trimmed before lookup", wantErr: false, request: createLoginRequest(" "+validEmailAddress+" ", strongPassword)},
+		{name: "wrong password is rejected", wantErr: true, request: createLoginRequest(validEmailAddress, "strong32#Passwort")},
+		{name: "unknown email is rejected", wantErr: true, request: createLoginRequest("unknown@xrfaq.com", strongPassword)},
+		{name: "missing password is rejected", wantErr: true, request: createLoginRequest(validEmailAddress, "")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uc.Authenticate(tt.request, xrf.WithRequestId(context.TODO(), "testRequestId"))
+			if tt.wantErr {
+				xrf.AssertError(t, err)
+				assert.Nil(t, got)
+			} else {
+				xrf.AssertNoError(t, err)
+				assert.Equal(t, created.UserId, got.UserId)
+				assert.True(t, got.ExpiresAt.After(time.Now()))
+
+				claims, err := tokenSigner.Verify(got.Token)
+				xrf.AssertNoError(t, err)
+				assert.Equal(t, created.UserId, claims.UserId)
+			}
+		})
+	}
+}
+
+func TestUserServiceAuthenticateLegacyPasswords(t *testing.T) {
+	userRepo := xrfTest.NewUserRepositoryMock()
+	settingServiceMock := newSettingServiceMock()
+	// the stored thread count never matches the one the password was hashed with before it was configured
+	storedConfig := securityConfig.PasswordConfig
+	storedConfig.Thread = legacyPasswordThreads() + 1
+	settingServiceMock.passwordConfig = &storedConfig
+	uc := NewUserService(xrf.NewTestLogger(), settingServiceMock, userRepo, newTestTokenSigner(t), context.TODO(), securityConfig)
+
+	legacyConfig := storedConfig
+	legacyConfig.Thread = legacyPasswordThreads()
+	legacyHash, err := hashPassword(strongPassword, legacyConfig)
+	xrf.AssertNoError(t, err)
+	legacyUser := user.NewUser("firstName", "lastName", validEmailAddress, legacyHash)
+	_, err = userRepo.CreateUser(legacyUser, context.TODO())
+	xrf.AssertNoError(t, err)
+
+	_, err = uc.Authenticate(createLoginRequest(validEmailAddress, "strong32#Passwort"), context.TODO())
+	xrf.AssertError(t, err)
+	unchanged, err := userRepo.FindUserByEmail(validEmailAddress, context.TODO())
+	xrf.AssertNoError(t, err)
+	assert.Equal(t, legacyHash, unchanged.Password)
+
+	got, err := uc.Authenticate(createLoginRequest(validEmailAddress, strongPassword), context.TODO())
+	xrf.AssertNoError(t, err)
+	assert.Equal(t, legacyUser.Id, got.UserId)
+
+	rehashed, err := userRepo.FindUserByEmail(validEmailAddress, context.TODO())
+	xrf.AssertNoError(t, err)
+	assert.NotEqual(t, legacyHash, rehashed.Password)
+	isValid, err := verifyPassword(storedConfig.Thread, storedConfig.Memory, uint32(storedConfig.Time), strongPassword, rehashed.Password)
+	xrf.AssertNoError(t, err)
+	assert.True(t, isValid)
+}
+
+func newTestTokenSigner(t *testing.T) *token.Signer {
+	t.Helper()
+	signer, err := token.NewSigner(xrf.RandomBytes(32), time.Hour)
+	xrf.AssertNoError(t, err)
+	return signer
+}
+
+func createLoginRequest(email, password string) *exchange.LoginRequest {
+	return &exchange.LoginRequest{
+		Email:    email,
+		Password: *custom.NewSecret(password),
+	}
+}
+
 func createUserRequest(email, password string) *exchange.UserRequest {
 	secretEmail := custom.NewSecret(email)
 	secretPass := custom.NewSecret(password)
@@ -1,31 +1,78 @@
 package constants
 
 const (
-	V1           = "v1"
-	API          = "api"
-	SLASH        = "/"
-	DASH         = "-"
-	EMPTY        = ""
-	EQUALS       = "="
-	UNDERSCORE   = "_"
-	NAME         = "name"
-	EMAIL        = "email"
-	OrgId        = "orgId"
-	USERID       = "userId"
-	PASSWORD     = "password"
-	IsAnonymous  = "isAnonymous"
-	FINGERPRINT  = "fingerPrint"
-	PermissionId = "permissionId"
+	V1               = "v1"
+	API              = "api"
+	SLASH            = "/"
+	DASH             = "-"
+	EMPTY            = ""
+	EQUALS           = "="
+	UNDERSCORE       = "_"
+	NAME             = "name"
+	EMAIL            = "email"
+	OWNER            = "owner"
+	MEMBERS          = "members"
+	PERMISSIONS      = "permissions"
+	MemberFps        = "memberFps"
+	OrgId            = "orgId"
+	USERID           = "userId"
+	PASSWORD         = "password"
+	IsAnonymous      = "isAnonymous"
+	DisplayName      = "displayName"
+	Category         = "category"
+	Description      = "description"
+	CreatedAt        = "createdAt"
+	UpdatedAt        = "updatedAt"
+	FINGERPRINT      = "fingerPrint"
+	PermissionId     = "permissionId"
+	OwnershipHistory = "ownershipHistory"
+	InvitationId     = "invitationId"
+	TokenHash        = "tokenHash"
+	Status           = "status"
+	ExpiresAt        = "expiresAt"
+	ResourceType     = "resourceType"
+	ResourceId       = "resourceId"
+	RoleId           = "roleId"
+	ROLES            = "roles"
+	IMPLIES          = "implies"
+	OwnerFp          = "ownerFp"
+	Version          = "version"
+	Magnitude        = "magnitude"
+	TradeTrails      = "tradeTrails"
+	CustomerFp       = "customerFp"
+	ConsentId        = "consentId"
+	RevokedAt        = "revokedAt"
+	RecordedAt       = "recordedAt"
+	WrappedKey       = "wrappedKey"
+	LegacyKey        = "encryptionKey"
+	LastModified     = "lastModified"
+	KeyVersion       = "keyVersion"
+	PreviousKeys     = "previousKeys"
+	PendingReEncrypt = "pendingReEncryption"
+	RotateKey        = "rotateKey"
+	RotateAt         = "rotateAt"
+	EncryptAfter     = "encryptAfter"
+	RotationLease    = "rotationLease"
 )
 
 // Error Constants
 
 const (
-	DuplicateNameDBErr = "name already exists"
-	NotFoundOrgErrMsg  = "organization not found"
+	DuplicateNameDBErr       = "name already exists"
+	NotFoundOrgErrMsg        = "organization not found"
+	InvalidCredentialsErrMsg = "invalid email or password"
+	NotOrgMemberErrMsg       = "user is not a member of the organization"
+	LastOrgOwnerErrMsg       = "an org should always have at least one owner"
+	NotFoundInvitationErrMsg = "invitation not found or has expired"
+	NotFoundPermissionErrMsg = "permission not found"
+	PermissionInUseErrMsg    = "permission is still used by org members or roles"
+	NotFoundRoleErrMsg       = "role not found"
+	NotFoundRungErrMsg       = "rung not found"
+	NotFoundConsentErrMsg    = "consent not found"
 )
 
 const ContentType = "Content-Type"
+const Authorization = "Authorization"
 const SlashAPI = SLASH + API // "/api"
 const ContentTypeJson = "application/json"
 
@@ -36,6 +83,12 @@ const (
 	SettingsCollection = "settings"
 	PermissionsCol     = "permission"
 	OrgCollection      = "organization"
+	InvitationCol      = "invitation"
+	AuditCollection    = "audit"
+	RoleCol            = "role"
+	RungCol            = "rung"
+	ConsentCol         = "consent"
+	RungHistoryCol     = "rungHistory"
 )
 
 // AllCollections !IMPORTANT: make sure to always add all collection names to this list
@@ -44,4 +97,10 @@ var AllCollections = [...]string{
 	PermissionsCol,
 	UserCollection,
 	SettingsCollection,
+	InvitationCol,
+	AuditCollection,
+	RoleCol,
+	RungCol,
+	ConsentCol,
+	RungHistoryCol,
 }
@@ -0,0 +1,38 @@
+package internal
+
+import "context"
+
+type contextKey string
+
+const (
+	requestIdKey       contextKey = "requestId"
+	userFingerprintKey contextKey = "userFingerprint"
+)
+
+// WithRequestId returns a copy of ctx carrying the id of the request being served
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+// RequestId returns the request id stored in ctx or an empty string if there's none
+func RequestId(ctx context.Context) string {
+	requestId, ok := ctx.Value(requestIdKey).(string)
+	if !ok {
+		return ""
+	}
+	return requestId
+}
+
+// WithUserFingerprint returns a copy of ctx carrying the fingerprint of the authenticated caller
+func WithUserFingerprint(ctx context.Context, userFP string) context.Context {
+	return context.WithValue(ctx, userFingerprintKey, userFP)
+}
+
+// UserFingerprint returns the fingerprint of the authenticated caller, false if the request wasn't authenticated
+func UserFingerprint(ctx context.Context) (string, bool) {
+	userFP, ok := ctx.Value(userFingerprintKey).(string)
+	if !ok || userFP == "" {
+		return "", false
+	}
+	return userFP, true
+}
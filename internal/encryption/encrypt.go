@@ -1,8 +1,6 @@
 package encryption
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
@@ -19,45 +17,9 @@ const maxKeySize = 256
 
 // https://docs.google.com/document/d/1uqD8gAjpAN4EWsmg7yv1AbcKL_8lJxXGNTfO70YII_0
 
-// Encrypt has Separate Nonces: We generate gcmNonce and aadNonce separately.
+// Encrypt seals plaintext in an envelope (see envelope.go) without a key id
 func Encrypt(plaintext []byte, key []byte) ([]byte, error) {
-	if len(plaintext) < 3 {
-		return nil, &Error{
-			message: "plaintext should at least be of length 3",
-		}
-	}
-	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
-		return nil, &Error{
-			message: "Invalid key size. Key must be 16, 24, or 32 bytes",
-		}
-	}
-	// Create the AES cipher block using the provided key
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create a GCM cipher using the block
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	// Generate a nonce for the GCM encryption
-	gcmNonce := make([]byte, aesgcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, gcmNonce); err != nil {
-		return nil, err
-	}
-
-	// Generate a separate nonce for the additional authenticated data (AAD) Additional Authenticated Data
-	aadNonce := make([]byte, aesgcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, aadNonce); err != nil {
-		return nil, err
-	}
-
-	// Encrypt the plaintext using the GCM, providing both nonces and any additional data
-	ciphertext := aesgcm.Seal(nil, gcmNonce, plaintext, aadNonce)
-	return append(gcmNonce, append(aadNonce, ciphertext...)...), nil
+	return EncryptWithKeyId(plaintext, key, "")
 }
 
 // EncryptAndEncode fixes issue where trying to store encrypted data, which is essentially random bytes, directly
@@ -72,19 +34,44 @@ func EncryptAndEncode(plaintext []byte, key []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
+// Decrypt dispatches on the format of the ciphertext, envelopes and legacy (gcmNonce | aadNonce | ciphertext) ones
 func Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
+	return DecryptWithAAD(ciphertext, key, nil)
+}
+
+// DecryptWithAAD decrypts a ciphertext sealed with EncryptWithAAD and the same aad. Legacy ciphertexts aren't bound
+// to any context, they're only decrypted without aad
+func DecryptWithAAD(ciphertext []byte, key []byte, aad []byte) ([]byte, error) {
 	if len(key) < minKeySize {
 		return nil, &Error{
 			message: "for security, encryption key should at least be 32 bytes",
 		}
 	}
 
-	block, err := aes.NewCipher(key)
+	envelope, err := ParseEnvelope(ciphertext)
 	if err != nil {
+		if aad != nil {
+			return nil, &Error{message: "ciphertext isn't bound to a context"}
+		}
+		return decryptLegacy(ciphertext, key)
+	}
+	plaintext, err := envelope.OpenWithAAD(key, aad)
+	if err != nil {
+		// a legacy ciphertext starts with a random nonce, which can look like an envelope's header
+		if aad == nil {
+			if legacyPlaintext, legacyErr := decryptLegacy(ciphertext, key); legacyErr == nil {
+				return legacyPlaintext, nil
+			}
+		}
 		return nil, err
 	}
+	return plaintext, nil
+}
 
-	aesgcm, err := cipher.NewGCM(block)
+// decryptLegacy decrypts ciphertexts made before envelopes, they have separate nonces: the gcm nonce and one
+// that is used as the additional authenticated data (AAD)
+func decryptLegacy(ciphertext []byte, key []byte) ([]byte, error) {
+	aesgcm, err := newAESGCM(key)
 	if err != nil {
 		return nil, err
 	}
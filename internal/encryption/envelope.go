@@ -0,0 +1,168 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Envelope layout, every field before the nonce is the header and is authenticated with the ciphertext:
+//
+//	magic (2) | version (1) | algorithm (1) | key id length (1) | key id | nonce | ciphertext and tag
+//
+// The additional authenticated data (AAD) is the header followed by the caller's associated data, which isn't stored.
+// Ciphertexts made before the envelope (gcmNonce | aadNonce | ciphertext) have no header, they're still decrypted
+const (
+	EnvelopeVersion byte = 1
+	maxKeyIdLength       = 255
+)
+
+var envelopeMagic = []byte{'x', 'E'}
+
+// Algorithm identifies the cipher an envelope was sealed with
+type Algorithm byte
+
+const (
+	AESGCM Algorithm = 1 // AES (128, 192 or 256, by the key's size) in Galois/Counter Mode
+)
+
+// Envelope is a parsed, still encrypted, ciphertext
+type Envelope struct {
+	Version    byte
+	Algorithm  Algorithm
+	KeyId      string
+	Nonce      []byte
+	Ciphertext []byte
+	header     []byte
+}
+
+// KeyLookup returns the key with the given id, false if there's no such key
+type KeyLookup func(keyId string) ([]byte, bool)
+
+// KeyId derives an id for a key that isn't versioned otherwise, it identifies the key without revealing it
+func KeyId(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ContextAAD encodes the context a ciphertext belongs to (e.g. the user's fingerprint, the collection and the field)
+// as associated data. Parts are length prefixed, so different parts never encode the same
+func ContextAAD(parts ...string) []byte {
+	aad := make([]byte, 0)
+	for _, part := range parts {
+		aad = binary.BigEndian.AppendUint32(aad, uint32(len(part)))
+		aad = append(aad, part...)
+	}
+	return aad
+}
+
+// EncryptWithKeyId seals plaintext in an envelope naming the key it was encrypted with
+func EncryptWithKeyId(plaintext []byte, key []byte, keyId string) ([]byte, error) {
+	return EncryptWithAAD(plaintext, key, keyId, nil)
+}
+
+// EncryptWithAAD seals plaintext in an envelope bound to aad (see ContextAAD), it can only be decrypted with the
+// same aad. That keeps a ciphertext copied to another user's record, or another field, from decrypting
+func EncryptWithAAD(plaintext []byte, key []byte, keyId string, aad []byte) ([]byte, error) {
+	if len(plaintext) < 3 {
+		return nil, &Error{message: "plaintext should at least be of length 3"}
+	}
+	if len(keyId) > maxKeyIdLength {
+		return nil, &Error{message: fmt.Sprintf("key id should at most be %d bytes", maxKeyIdLength)}
+	}
+	aesgcm, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(envelopeMagic)+3+len(keyId))
+	header = append(header, envelopeMagic...)
+	header = append(header, EnvelopeVersion, byte(AESGCM), byte(len(keyId)))
+	header = append(header, keyId...)
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, 0, len(header)+len(nonce)+len(plaintext)+aesgcm.Overhead())
+	sealed = append(append(sealed, header...), nonce...)
+	return aesgcm.Seal(sealed, nonce, plaintext, append(header, aad...)), nil
+}
+
+// ParseEnvelope reads the header of an envelope, it errs on anything that isn't one (like legacy ciphertexts)
+func ParseEnvelope(data []byte) (*Envelope, error) {
+	invalidErr := &Error{message: "ciphertext is not a valid envelope"}
+	prefix := len(envelopeMagic) + 3
+	if len(data) < prefix || !bytes.Equal(data[:len(envelopeMagic)], envelopeMagic) {
+		return nil, invalidErr
+	}
+	version, algorithm, keyIdLength := data[2], Algorithm(data[3]), int(data[4])
+	if version != EnvelopeVersion {
+		return nil, &Error{message: fmt.Sprintf("unsupported envelope version %d", version)}
+	}
+	if algorithm != AESGCM {
+		return nil, &Error{message: fmt.Sprintf("unsupported envelope algorithm %d", algorithm)}
+	}
+
+	headerLength := prefix + keyIdLength
+	// a gcm nonce and tag are both 12 and 16 bytes long
+	if len(data) < headerLength+12+16 {
+		return nil, invalidErr
+	}
+	return &Envelope{
+		Version:    version,
+		Algorithm:  algorithm,
+		KeyId:      string(data[prefix:headerLength]),
+		Nonce:      data[headerLength : headerLength+12],
+		Ciphertext: data[headerLength+12:],
+		header:     data[:headerLength],
+	}, nil
+}
+
+// Open decrypts an envelope sealed without associated data
+func (e *Envelope) Open(key []byte) ([]byte, error) {
+	return e.OpenWithAAD(key, nil)
+}
+
+// OpenWithAAD decrypts the envelope with key, it fails if the ciphertext or header were tampered with or aad
+// isn't what the envelope was sealed with
+func (e *Envelope) OpenWithAAD(key []byte, aad []byte) ([]byte, error) {
+	aesgcm, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesgcm.Open(nil, e.Nonce, e.Ciphertext, append(bytes.Clone(e.header), aad...))
+}
+
+// DecryptWithLookup decrypts an envelope with the key it names, legacy ciphertexts are looked up with an empty id
+func DecryptWithLookup(ciphertext []byte, lookup KeyLookup) ([]byte, error) {
+	envelope, envelopeErr := ParseEnvelope(ciphertext)
+	keyId := ""
+	if envelopeErr == nil {
+		keyId = envelope.KeyId
+	}
+	key, ok := lookup(keyId)
+	if !ok {
+		return nil, &Error{message: fmt.Sprintf("no key with id %q", keyId)}
+	}
+	return Decrypt(ciphertext, key)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return nil, &Error{
+			message: "Invalid key size. Key must be 16, 24, or 32 bytes",
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
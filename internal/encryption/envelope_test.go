@@ -0,0 +1,253 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"xrf197ilz35aq0/internal"
+)
+
+// encryptLegacy encrypts like Encrypt did before envelopes, with the given gcm nonce
+func encryptLegacy(t *testing.T, plaintext []byte, key []byte, gcmNonce []byte) []byte {
+	t.Helper()
+	aesgcm, err := newAESGCM(key)
+	internal.AssertNoError(t, err)
+	aadNonce := internal.RandomBytes(aesgcm.NonceSize())
+	ciphertext := aesgcm.Seal(nil, gcmNonce, plaintext, aadNonce)
+	return append(append(append([]byte{}, gcmNonce...), aadNonce...), ciphertext...)
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	keyIds := []string{"", "v1", KeyId(encryptionKey), strings.Repeat("k", maxKeyIdLength)}
+	for _, keySize := range []int{16, 24, 32} {
+		for _, size := range []int{3, 16, 1024, 64 * 1024} {
+			for _, keyId := range keyIds {
+				t.Run(fmt.Sprintf("key=%d :: plaintext=%d :: keyId=%d", keySize, size, len(keyId)), func(t *testing.T) {
+					key := internal.RandomBytes(keySize)
+					plaintext := internal.RandomBytes(size)
+
+					sealed, err := EncryptWithKeyId(plaintext, key, keyId)
+					internal.AssertNoError(t, err)
+
+					envelope, err := ParseEnvelope(sealed)
+					internal.AssertNoError(t, err)
+					assert.Equal(t, EnvelopeVersion, envelope.Version)
+					assert.Equal(t, AESGCM, envelope.Algorithm)
+					assert.Equal(t, keyId, envelope.KeyId)
+					assert.Len(t, envelope.Nonce, 12)
+
+					opened, err := envelope.Open(key)
+					internal.AssertNoError(t, err)
+					assert.Equal(t, plaintext, opened)
+
+					if keySize >= minKeySize {
+						decrypted, err := Decrypt(sealed, key)
+						internal.AssertNoError(t, err)
+						assert.Equal(t, plaintext, decrypted)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestEnvelopeTamper(t *testing.T) {
+	sealed, err := EncryptWithKeyId(plaintext, encryptionKey, "v1")
+	internal.AssertNoError(t, err)
+
+	t.Run("flipping any bit fails", func(t *testing.T) {
+		for i := range sealed {
+			for bit := 0; bit < 8; bit++ {
+				tampered := append([]byte{}, sealed...)
+				tampered[i] ^= 1 << bit
+				decrypted, err := Decrypt(tampered, encryptionKey)
+				assert.Error(t, err, "byte %d, bit %d", i, bit)
+				assert.Nil(t, decrypted)
+			}
+		}
+	})
+	t.Run("truncating fails", func(t *testing.T) {
+		for length := 0; length < len(sealed); length++ {
+			decrypted, err := Decrypt(sealed[:length], encryptionKey)
+			assert.Error(t, err, "length %d", length)
+			assert.Nil(t, decrypted)
+		}
+	})
+	t.Run("appending fails", func(t *testing.T) {
+		_, err := Decrypt(append(append([]byte{}, sealed...), 0), encryptionKey)
+		internal.AssertError(t, err)
+	})
+	t.Run("swapping the key id fails", func(t *testing.T) {
+		other, err := EncryptWithKeyId(plaintext, encryptionKey, "v2")
+		internal.AssertNoError(t, err)
+		swapped := append([]byte{}, sealed...)
+		swapped[len(envelopeMagic)+3+1] = other[len(envelopeMagic)+3+1]
+		_, err = Decrypt(swapped, encryptionKey)
+		internal.AssertError(t, err)
+	})
+	t.Run("another key fails", func(t *testing.T) {
+		_, err := Decrypt(sealed, internal.RandomBytes(32))
+		internal.AssertError(t, err)
+	})
+}
+
+func TestParseEnvelope(t *testing.T) {
+	sealed, err := EncryptWithKeyId(plaintext, encryptionKey, "v1")
+	internal.AssertNoError(t, err)
+	withByte := func(index int, value byte) []byte {
+		changed := append([]byte{}, sealed...)
+		changed[index] = value
+		return changed
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "parses an envelope", data: sealed},
+		{name: "errs on empty data", data: nil, wantErr: "not a valid envelope"},
+		{name: "errs without the magic", data: withByte(0, 'y'), wantErr: "not a valid envelope"},
+		{name: "errs on an unknown version", data: withByte(2, 9), wantErr: "unsupported envelope version 9"},
+		{name: "errs on an unknown algorithm", data: withByte(3, 9), wantErr: "unsupported envelope algorithm 9"},
+		{name: "errs on a key id longer than the data", data: withByte(4, 255), wantErr: "not a valid envelope"},
+		{name: "errs without a tag", data: sealed[:len(envelopeMagic)+3+2+12+15], wantErr: "not a valid envelope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope, err := ParseEnvelope(tt.data)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, envelope)
+				return
+			}
+			internal.AssertNoError(t, err)
+			assert.Equal(t, "v1", envelope.KeyId)
+		})
+	}
+
+	_, err = EncryptWithKeyId(plaintext, encryptionKey, strings.Repeat("k", maxKeyIdLength+1))
+	internal.AssertError(t, err)
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	nonce := func(prefix ...byte) []byte {
+		gcmNonce := make([]byte, 12)
+		_, _ = rand.Read(gcmNonce)
+		copy(gcmNonce, prefix)
+		return gcmNonce
+	}
+	tests := []struct {
+		name     string
+		gcmNonce []byte
+	}{
+		{name: "decrypts legacy ciphertexts", gcmNonce: nonce()},
+		{name: "decrypts legacy ciphertexts that look like an envelope", gcmNonce: nonce('x', 'E', EnvelopeVersion, byte(AESGCM), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			legacy := encryptLegacy(t, plaintext, encryptionKey, tt.gcmNonce)
+
+			decrypted, err := Decrypt(legacy, encryptionKey)
+			internal.AssertNoError(t, err)
+			assert.Equal(t, plaintext, decrypted)
+
+			decrypted, err = DecodeAndDecrypt(base64.StdEncoding.EncodeToString(legacy), encryptionKey)
+			internal.AssertNoError(t, err)
+			assert.Equal(t, plaintext, decrypted)
+
+			tampered := append([]byte{}, legacy...)
+			tampered[len(tampered)-1] ^= 1
+			_, err = Decrypt(tampered, encryptionKey)
+			internal.AssertError(t, err)
+		})
+	}
+}
+
+func TestDecryptWithLookup(t *testing.T) {
+	keys := map[string][]byte{"": internal.RandomBytes(32), "v1": internal.RandomBytes(32), "v2": internal.RandomBytes(32)}
+	lookup := func(keyId string) ([]byte, bool) {
+		key, ok := keys[keyId]
+		return key, ok
+	}
+
+	for _, keyId := range []string{"v1", "v2"} {
+		sealed, err := EncryptWithKeyId(plaintext, keys[keyId], keyId)
+		internal.AssertNoError(t, err)
+		decrypted, err := DecryptWithLookup(sealed, lookup)
+		internal.AssertNoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	}
+
+	legacy := encryptLegacy(t, plaintext, keys[""], internal.RandomBytes(12))
+	decrypted, err := DecryptWithLookup(legacy, lookup)
+	internal.AssertNoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	unknown, err := EncryptWithKeyId(plaintext, keys["v1"], "v3")
+	internal.AssertNoError(t, err)
+	_, err = DecryptWithLookup(unknown, lookup)
+	assert.ErrorContains(t, err, `no key with id "v3"`)
+}
+
+func TestEncryptWithAAD(t *testing.T) {
+	aad := ContextAAD("user-a", "settings", "wrappedKey")
+	sealed, err := EncryptWithAAD(plaintext, encryptionKey, "v1", aad)
+	internal.AssertNoError(t, err)
+
+	decrypted, err := DecryptWithAAD(sealed, encryptionKey, ContextAAD("user-a", "settings", "wrappedKey"))
+	internal.AssertNoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	tests := []struct {
+		name string
+		aad  []byte
+	}{
+		{name: "fails for another user", aad: ContextAAD("user-b", "settings", "wrappedKey")},
+		{name: "fails for another field", aad: ContextAAD("user-a", "settings", "encryptionKey")},
+		{name: "fails for parts split differently", aad: ContextAAD("user-as", "ettings", "wrappedKey")},
+		{name: "fails for fewer parts", aad: ContextAAD("user-a", "settings")},
+		{name: "fails without associated data", aad: nil},
+		{name: "fails with empty associated data", aad: []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decrypted, err := DecryptWithAAD(sealed, encryptionKey, tt.aad)
+			internal.AssertError(t, err)
+			assert.Nil(t, decrypted)
+		})
+	}
+
+	t.Run("fails when the associated data was tampered with", func(t *testing.T) {
+		for i := range aad {
+			tampered := append([]byte{}, aad...)
+			tampered[i] ^= 1
+			_, err := DecryptWithAAD(sealed, encryptionKey, tampered)
+			assert.Error(t, err, "byte %d", i)
+		}
+	})
+	t.Run("ciphertexts without associated data only decrypt without it", func(t *testing.T) {
+		unbound, err := Encrypt(plaintext, encryptionKey)
+		internal.AssertNoError(t, err)
+		_, err = DecryptWithAAD(unbound, encryptionKey, aad)
+		internal.AssertError(t, err)
+		decrypted, err := DecryptWithAAD(unbound, encryptionKey, nil)
+		internal.AssertNoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+	t.Run("legacy ciphertexts can't be bound to a context", func(t *testing.T) {
+		legacy := encryptLegacy(t, plaintext, encryptionKey, internal.RandomBytes(12))
+		_, err := DecryptWithAAD(legacy, encryptionKey, aad)
+		assert.ErrorContains(t, err, "isn't bound to a context")
+	})
+}
+
+func TestContextAAD(t *testing.T) {
+	assert.Equal(t, ContextAAD("a", "b"), ContextAAD("a", "b"))
+	assert.NotEqual(t, ContextAAD("ab", ""), ContextAAD("a", "b"))
+	assert.NotEqual(t, ContextAAD("a", "b"), ContextAAD("b", "a"))
+	assert.NotEqual(t, ContextAAD("a"), ContextAAD("a", ""))
+}
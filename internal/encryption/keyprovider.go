@@ -0,0 +1,106 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	EnvKeyProvider  = "env"
+	FileKeyProvider = "file"
+)
+
+// KeyProvider supplies the key-encryption key (KEK) that per-user data keys are wrapped with.
+// The KEK never leaves the provider's source in plaintext other than in memory
+type KeyProvider interface {
+	KeyEncryptionKey() ([]byte, error)
+}
+
+// envKeyProvider reads a base64 encoded KEK from an environment variable
+type envKeyProvider struct {
+	variable string
+}
+
+func (p *envKeyProvider) KeyEncryptionKey() ([]byte, error) {
+	encoded := os.Getenv(p.variable)
+	if encoded == "" {
+		return nil, &Error{message: fmt.Sprintf("missing key-encryption key environment variable %s", p.variable)}
+	}
+	return decodeKeyEncryptionKey(encoded)
+}
+
+// fileKeyProvider reads a base64 encoded KEK from a local file, meant for development and tests
+type fileKeyProvider struct {
+	path string
+}
+
+func (p *fileKeyProvider) KeyEncryptionKey() ([]byte, error) {
+	encoded, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, &Error{message: fmt.Sprintf("reading key-encryption key file failed: %v", err)}
+	}
+	return decodeKeyEncryptionKey(string(encoded))
+}
+
+func decodeKeyEncryptionKey(encoded string) ([]byte, error) {
+	kek, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, &Error{message: "key-encryption key should be base64 encoded"}
+	}
+	if len(kek) != minKeySize {
+		return nil, &Error{message: fmt.Sprintf("key-encryption key should be %d bytes", minKeySize)}
+	}
+	return kek, nil
+}
+
+// NewKeyProvider creates the provider named by kind (env or file), source is the variable name or file path
+func NewKeyProvider(kind string, source string) (KeyProvider, error) {
+	if source == "" {
+		return nil, &Error{message: "key provider needs a source"}
+	}
+	switch kind {
+	case EnvKeyProvider:
+		return &envKeyProvider{variable: source}, nil
+	case FileKeyProvider:
+		return &fileKeyProvider{path: source}, nil
+	default:
+		return nil, &Error{message: fmt.Sprintf("unknown key provider %q, should be one of env or file", kind)}
+	}
+}
+
+// WrapKey encrypts a data key with the provider's KEK, bound to aad (see ContextAAD). Only the wrapped (base64) form
+// should be stored
+func WrapKey(dataKey []byte, provider KeyProvider, aad []byte) (string, error) {
+	kek, err := provider.KeyEncryptionKey()
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := EncryptWithAAD(dataKey, kek, KeyId(kek), aad)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(wrappedKey), nil
+}
+
+// UnwrapKey decrypts a data key wrapped with WrapKey and the same aad, it should only be called where the key is used.
+// Keys that aren't bound to aad (another context's, or wrapped without one) aren't unwrapped
+func UnwrapKey(wrappedKey string, provider KeyProvider, aad []byte) ([]byte, error) {
+	kek, err := provider.KeyEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := DecryptWithAAD(ciphertext, kek, aad)
+	if err != nil {
+		if envelope, envelopeErr := ParseEnvelope(ciphertext); envelopeErr == nil && envelope.KeyId != KeyId(kek) {
+			return nil, &Error{message: fmt.Sprintf("key was wrapped with another key-encryption key (%s)", envelope.KeyId)}
+		}
+		return nil, err
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,98 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"xrf197ilz35aq0/internal"
+)
+
+func TestNewKeyProvider(t *testing.T) {
+	kek := internal.RandomBytes(32)
+	encoded := base64.StdEncoding.EncodeToString(kek)
+	kekFile := filepath.Join(t.TempDir(), "kek")
+	internal.AssertNoError(t, os.WriteFile(kekFile, []byte(encoded+"\n"), 0o600))
+	shortFile := filepath.Join(t.TempDir(), "short")
+	internal.AssertNoError(t, os.WriteFile(shortFile, []byte(base64.StdEncoding.EncodeToString(kek[:16])), 0o600))
+	t.Setenv("XRF_TEST_KEK", encoded)
+	t.Setenv("XRF_TEST_INVALID_KEK", "not base64!")
+
+	tests := []struct {
+		name      string
+		kind      string
+		source    string
+		shouldErr bool
+		readErr   bool // the provider is created but reading the key fails
+	}{
+		{name: "reads the key from an environment variable", kind: EnvKeyProvider, source: "XRF_TEST_KEK"},
+		{name: "reads the key from a file", kind: FileKeyProvider, source: kekFile},
+		{name: "errs on an unknown provider", kind: "vault", source: "XRF_TEST_KEK", shouldErr: true},
+		{name: "errs without a source", kind: EnvKeyProvider, shouldErr: true},
+		{name: "errs on a missing variable", kind: EnvKeyProvider, source: "XRF_TEST_MISSING_KEK", readErr: true},
+		{name: "errs on a key that isn't base64", kind: EnvKeyProvider, source: "XRF_TEST_INVALID_KEK", readErr: true},
+		{name: "errs on a missing file", kind: FileKeyProvider, source: filepath.Join(t.TempDir(), "missing"), readErr: true},
+		{name: "errs on a key shorter than 32 bytes", kind: FileKeyProvider, source: shortFile, readErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider, err := NewKeyProvider(test.kind, test.source)
+			if test.shouldErr {
+				internal.AssertError(t, err)
+				return
+			}
+			internal.AssertNoError(t, err)
+
+			got, err := provider.KeyEncryptionKey()
+			if test.readErr {
+				internal.AssertError(t, err)
+				return
+			}
+			internal.AssertNoError(t, err)
+			assert.Equal(t, kek, got)
+		})
+	}
+}
+
+func TestWrapKey(t *testing.T) {
+	t.Setenv("XRF_TEST_KEK", base64.StdEncoding.EncodeToString(internal.RandomBytes(32)))
+	t.Setenv("XRF_TEST_OTHER_KEK", base64.StdEncoding.EncodeToString(internal.RandomBytes(32)))
+	provider, _ := NewKeyProvider(EnvKeyProvider, "XRF_TEST_KEK")
+	other, _ := NewKeyProvider(EnvKeyProvider, "XRF_TEST_OTHER_KEK")
+	dataKey := internal.RandomBytes(32)
+	aad := ContextAAD("settings", "wrappedKey", "user-a", "v1")
+
+	wrapped, err := WrapKey(dataKey, provider, aad)
+	internal.AssertNoError(t, err)
+	assert.NotContains(t, wrapped, base64.StdEncoding.EncodeToString(dataKey))
+
+	unwrapped, err := UnwrapKey(wrapped, provider, aad)
+	internal.AssertNoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	_, err = UnwrapKey(wrapped, other, aad)
+	assert.ErrorContains(t, err, "another key-encryption key")
+
+	_, err = UnwrapKey(wrapped, provider, ContextAAD("settings", "wrappedKey", "user-b", "v1"))
+	internal.AssertError(t, err)
+
+	kek, _ := provider.KeyEncryptionKey()
+	unbound := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{name: "rejects keys wrapped before envelopes", ciphertext: encryptLegacy(t, dataKey, kek, internal.RandomBytes(12))},
+		{name: "rejects keys wrapped without associated data", ciphertext: func() []byte {
+			sealed, err := EncryptWithKeyId(dataKey, kek, KeyId(kek))
+			internal.AssertNoError(t, err)
+			return sealed
+		}()},
+	}
+	for _, tt := range unbound {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := UnwrapKey(base64.StdEncoding.EncodeToString(tt.ciphertext), provider, aad)
+			internal.AssertError(t, err)
+		})
+	}
+}
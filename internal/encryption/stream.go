@@ -0,0 +1,269 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"math"
+)
+
+// Stream layout, the header is authenticated with every chunk:
+//
+//	magic (2) | version (1) | algorithm (1) | chunk size (4) | key id length (1) | key id | salt (16) | nonce prefix (7)
+//	chunk 0 | chunk 1 | ... | final chunk
+//
+// Each stream encrypts with its own key, derived from the caller's key and the salt. A chunk is chunk size bytes of
+// plaintext sealed with the nonce: nonce prefix (7) | chunk index (4) | final flag (1). Chunks can't be reordered
+// (their index is in the nonce) or dropped from the end (the last one read has to be the one marked final)
+const (
+	StreamVersion        byte = 1
+	DefaultStreamChunk        = 64 * 1024
+	maxStreamChunk            = 16 * 1024 * 1024
+	streamSaltSize            = 16
+	streamNoncePrefixLen      = 7
+	gcmTagSize                = 16
+)
+
+var streamMagic = []byte{'x', 'S'}
+
+var errStreamTruncated = &Error{message: "stream is truncated, its final chunk is missing"}
+
+type streamCipher struct {
+	aead        cipher.AEAD
+	noncePrefix []byte
+	aad         []byte // header followed by the caller's associated data
+	index       uint64
+}
+
+// nonce of the current chunk, the index only ever goes up so no nonce is used twice within a stream
+func (s *streamCipher) nonce(final bool) ([]byte, error) {
+	if s.index > math.MaxUint32 {
+		return nil, &Error{message: "stream has too many chunks"}
+	}
+	nonce := make([]byte, 0, len(s.noncePrefix)+5)
+	nonce = append(nonce, s.noncePrefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, uint32(s.index))
+	if final {
+		return append(nonce, 1), nil
+	}
+	return append(nonce, 0), nil
+}
+
+func newStreamCipher(key []byte, salt []byte, noncePrefix []byte, aad []byte) (*streamCipher, error) {
+	if _, err := newAESGCM(key); err != nil {
+		return nil, err
+	}
+	streamKey := make([]byte, len(key))
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, aad), streamKey); err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(streamKey)
+	if err != nil {
+		return nil, err
+	}
+	return &streamCipher{aead: aead, noncePrefix: noncePrefix, aad: aad}, nil
+}
+
+// encryptWriter buffers a chunk of plaintext and only seals it once more is written, so the last one (sealed by
+// Close) can be marked final
+type encryptWriter struct {
+	w      io.Writer
+	cipher *streamCipher
+	chunk  []byte
+	sealed []byte
+	closed bool
+}
+
+// NewEncryptWriter encrypts everything written to it to w, in chunks of DefaultStreamChunk bytes. The stream is only
+// complete once Close is called, it doesn't close w
+func NewEncryptWriter(w io.Writer, key []byte, keyId string, aad []byte) (io.WriteCloser, error) {
+	return newEncryptWriter(w, key, keyId, aad, DefaultStreamChunk)
+}
+
+func newEncryptWriter(w io.Writer, key []byte, keyId string, aad []byte, chunkSize int) (io.WriteCloser, error) {
+	if len(keyId) > maxKeyIdLength {
+		return nil, &Error{message: fmt.Sprintf("key id should at most be %d bytes", maxKeyIdLength)}
+	}
+	if chunkSize <= 0 || chunkSize > maxStreamChunk {
+		return nil, &Error{message: fmt.Sprintf("chunk size should be between 1 and %d bytes", maxStreamChunk)}
+	}
+	random := make([]byte, streamSaltSize+streamNoncePrefixLen)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return nil, err
+	}
+	salt, noncePrefix := random[:streamSaltSize], random[streamSaltSize:]
+
+	header := make([]byte, 0, len(streamMagic)+7+len(keyId)+len(random))
+	header = append(header, streamMagic...)
+	header = append(header, StreamVersion, byte(AESGCM))
+	header = binary.BigEndian.AppendUint32(header, uint32(chunkSize))
+	header = append(header, byte(len(keyId)))
+	header = append(header, keyId...)
+	header = append(header, random...)
+
+	streamCipher, err := newStreamCipher(key, salt, noncePrefix, append(bytes.Clone(header), aad...))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:      w,
+		cipher: streamCipher,
+		chunk:  make([]byte, 0, chunkSize),
+		sealed: make([]byte, 0, chunkSize+gcmTagSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, &Error{message: "write to a closed stream"}
+	}
+	written := 0
+	for len(p) > 0 {
+		if len(e.chunk) == cap(e.chunk) {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.chunk[len(e.chunk):cap(e.chunk)], p)
+		e.chunk = e.chunk[:len(e.chunk)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals what's left as the final chunk
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+func (e *encryptWriter) flush(final bool) error {
+	nonce, err := e.cipher.nonce(final)
+	if err != nil {
+		return err
+	}
+	e.sealed = e.cipher.aead.Seal(e.sealed[:0], nonce, e.chunk, e.cipher.aad)
+	e.cipher.index++
+	e.chunk = e.chunk[:0]
+	_, err = e.w.Write(e.sealed)
+	return err
+}
+
+// decryptReader opens a chunk at a time, it looks one byte past each full chunk to tell whether it's the final one
+type decryptReader struct {
+	r         *bufio.Reader
+	cipher    *streamCipher
+	sealed    []byte
+	plaintext []byte
+	done      bool
+	err       error
+}
+
+// NewDecryptReader decrypts a stream written by NewEncryptWriter with the key lookup finds by the stream's key id.
+// Reading fails (and nothing more is returned) once a chunk doesn't authenticate or the stream ends before its final
+// chunk, data read before that should be discarded
+func NewDecryptReader(r io.Reader, lookup KeyLookup, aad []byte) (io.Reader, error) {
+	reader := bufio.NewReader(r)
+	prefix := make([]byte, len(streamMagic)+7)
+	if _, err := io.ReadFull(reader, prefix); err != nil {
+		return nil, &Error{message: "stream header is too short"}
+	}
+	if !bytes.Equal(prefix[:len(streamMagic)], streamMagic) {
+		return nil, &Error{message: "data is not an encrypted stream"}
+	}
+	if prefix[2] != StreamVersion {
+		return nil, &Error{message: fmt.Sprintf("unsupported stream version %d", prefix[2])}
+	}
+	if Algorithm(prefix[3]) != AESGCM {
+		return nil, &Error{message: fmt.Sprintf("unsupported stream algorithm %d", prefix[3])}
+	}
+	chunkSize := int(binary.BigEndian.Uint32(prefix[4:8]))
+	if chunkSize <= 0 || chunkSize > maxStreamChunk {
+		return nil, &Error{message: fmt.Sprintf("stream chunk size %d is out of range", chunkSize)}
+	}
+
+	rest := make([]byte, int(prefix[8])+streamSaltSize+streamNoncePrefixLen)
+	if _, err := io.ReadFull(reader, rest); err != nil {
+		return nil, &Error{message: "stream header is too short"}
+	}
+	keyIdLength := int(prefix[8])
+	keyId := string(rest[:keyIdLength])
+	salt := rest[keyIdLength : keyIdLength+streamSaltSize]
+	noncePrefix := rest[keyIdLength+streamSaltSize:]
+
+	key, ok := lookup(keyId)
+	if !ok {
+		return nil, &Error{message: fmt.Sprintf("no key with id %q", keyId)}
+	}
+	header := append(prefix, rest...)
+	streamCipher, err := newStreamCipher(key, salt, noncePrefix, append(header, aad...))
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:      reader,
+		cipher: streamCipher,
+		sealed: make([]byte, chunkSize+gcmTagSize),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plaintext) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.plaintext)
+	d.plaintext = d.plaintext[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	final := n < len(d.sealed)
+	if !final {
+		if _, err = d.r.Peek(1); errors.Is(err, io.EOF) {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if n < gcmTagSize {
+		return errStreamTruncated
+	}
+
+	nonce, err := d.cipher.nonce(final)
+	if err != nil {
+		return err
+	}
+	plaintext, err := d.cipher.aead.Open(d.sealed[:0], nonce, d.sealed[:n], d.cipher.aad)
+	if err != nil {
+		// a stream cut right after a full chunk ends with a chunk that isn't marked final, which fails the same way
+		return &Error{message: "stream chunk failed to authenticate, or the stream was truncated"}
+	}
+	d.cipher.index++
+	d.plaintext = plaintext
+	d.done = final
+	return nil
+}
@@ -0,0 +1,224 @@
+package encryption
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"testing/iotest"
+	"xrf197ilz35aq0/internal"
+)
+
+const testChunk = 64
+
+func keyLookup(keyId string, key []byte) KeyLookup {
+	return func(id string) ([]byte, bool) {
+		return key, id == keyId
+	}
+}
+
+func encryptStream(t *testing.T, plaintext []byte, key []byte, aad []byte, chunkSize int) []byte {
+	t.Helper()
+	var sealed bytes.Buffer
+	writer, err := newEncryptWriter(&sealed, key, "v1", aad, chunkSize)
+	internal.AssertNoError(t, err)
+	_, err = writer.Write(plaintext)
+	internal.AssertNoError(t, err)
+	internal.AssertNoError(t, writer.Close())
+	return sealed.Bytes()
+}
+
+func decryptStream(sealed []byte, key []byte, aad []byte) ([]byte, error) {
+	reader, err := NewDecryptReader(bytes.NewReader(sealed), keyLookup("v1", key), aad)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	aad := ContextAAD("stream", "user-a")
+	sizes := []int{0, 1, testChunk - 1, testChunk, testChunk + 1, 3 * testChunk, 10*testChunk + 7}
+	for _, keySize := range []int{16, 24, 32} {
+		for _, size := range sizes {
+			t.Run(fmt.Sprintf("key=%d :: plaintext=%d", keySize, size), func(t *testing.T) {
+				key := internal.RandomBytes(keySize)
+				plaintext := internal.RandomBytes(size)
+				sealed := encryptStream(t, plaintext, key, aad, testChunk)
+
+				decrypted, err := decryptStream(sealed, key, aad)
+				internal.AssertNoError(t, err)
+				assert.Equal(t, len(plaintext), len(decrypted))
+				assert.True(t, bytes.Equal(plaintext, decrypted))
+			})
+		}
+	}
+
+	t.Run("writes and reads in any sizes", func(t *testing.T) {
+		plaintext := internal.RandomBytes(5*testChunk + 3)
+		var sealed bytes.Buffer
+		writer, err := newEncryptWriter(&sealed, encryptionKey, "v1", aad, testChunk)
+		internal.AssertNoError(t, err)
+		for _, part := range [][]byte{plaintext[:1], plaintext[1:100], plaintext[100:101], plaintext[101:]} {
+			_, err = writer.Write(part)
+			internal.AssertNoError(t, err)
+		}
+		internal.AssertNoError(t, writer.Close())
+		_, err = writer.Write(plaintext)
+		internal.AssertError(t, err)
+
+		reader, err := NewDecryptReader(iotest.OneByteReader(&sealed), keyLookup("v1", encryptionKey), aad)
+		internal.AssertNoError(t, err)
+		decrypted, err := io.ReadAll(iotest.OneByteReader(reader))
+		internal.AssertNoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+
+	t.Run("uses the default chunk size", func(t *testing.T) {
+		plaintext := internal.RandomBytes(2*DefaultStreamChunk + 1)
+		var sealed bytes.Buffer
+		writer, err := NewEncryptWriter(&sealed, encryptionKey, "v1", aad)
+		internal.AssertNoError(t, err)
+		_, err = writer.Write(plaintext)
+		internal.AssertNoError(t, err)
+		internal.AssertNoError(t, writer.Close())
+
+		decrypted, err := decryptStream(sealed.Bytes(), encryptionKey, aad)
+		internal.AssertNoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+}
+
+func TestStreamTamper(t *testing.T) {
+	aad := ContextAAD("stream", "user-a")
+	plaintext := internal.RandomBytes(3*testChunk + 10)
+	sealed := encryptStream(t, plaintext, encryptionKey, aad, testChunk)
+	headerLength := len(streamMagic) + 7 + len("v1") + streamSaltSize + streamNoncePrefixLen
+	sealedChunk := testChunk + gcmTagSize
+
+	t.Run("flipping any bit fails", func(t *testing.T) {
+		for i := range sealed {
+			tampered := bytes.Clone(sealed)
+			tampered[i] ^= 1 << (i % 8)
+			_, err := decryptStream(tampered, encryptionKey, aad)
+			assert.Error(t, err, "byte %d", i)
+		}
+	})
+	t.Run("truncating fails", func(t *testing.T) {
+		for length := 0; length < len(sealed); length++ {
+			_, err := decryptStream(sealed[:length], encryptionKey, aad)
+			assert.Error(t, err, "length %d", length)
+		}
+	})
+	t.Run("dropping the final chunk at a chunk boundary fails", func(t *testing.T) {
+		// a full last chunk is the final one, the cut streams end in full chunks that aren't
+		aligned := encryptStream(t, internal.RandomBytes(3*testChunk), encryptionKey, aad, testChunk)
+		for _, chunks := range []int{0, 1, 2} {
+			_, err := decryptStream(aligned[:headerLength+chunks*sealedChunk], encryptionKey, aad)
+			assert.Error(t, err, "chunks %d", chunks)
+		}
+	})
+	t.Run("reordering chunks fails", func(t *testing.T) {
+		reordered := bytes.Clone(sealed[:headerLength])
+		reordered = append(reordered, sealed[headerLength+sealedChunk:headerLength+2*sealedChunk]...)
+		reordered = append(reordered, sealed[headerLength:headerLength+sealedChunk]...)
+		reordered = append(reordered, sealed[headerLength+2*sealedChunk:]...)
+		_, err := decryptStream(reordered, encryptionKey, aad)
+		internal.AssertError(t, err)
+	})
+	t.Run("appending data fails", func(t *testing.T) {
+		_, err := decryptStream(append(bytes.Clone(sealed), 0), encryptionKey, aad)
+		internal.AssertError(t, err)
+	})
+	t.Run("splicing chunks from another stream fails", func(t *testing.T) {
+		other := encryptStream(t, plaintext, encryptionKey, aad, testChunk)
+		spliced := bytes.Clone(sealed)
+		copy(spliced[headerLength:], other[headerLength:headerLength+sealedChunk])
+		_, err := decryptStream(spliced, encryptionKey, aad)
+		internal.AssertError(t, err)
+	})
+	t.Run("another context fails", func(t *testing.T) {
+		_, err := decryptStream(sealed, encryptionKey, ContextAAD("stream", "user-b"))
+		internal.AssertError(t, err)
+	})
+	t.Run("an unknown key id fails", func(t *testing.T) {
+		_, err := NewDecryptReader(bytes.NewReader(sealed), keyLookup("v2", encryptionKey), aad)
+		assert.ErrorContains(t, err, `no key with id "v1"`)
+	})
+	t.Run("data read before a failure is returned with it", func(t *testing.T) {
+		tampered := bytes.Clone(sealed)
+		tampered[len(tampered)-1] ^= 1
+		decrypted, err := decryptStream(tampered, encryptionKey, aad)
+		internal.AssertError(t, err)
+		assert.Equal(t, plaintext[:3*testChunk], decrypted)
+	})
+}
+
+func benchmarkSizes() []int {
+	return []int{1 << 20, 16 << 20, 64 << 20}
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	for _, size := range benchmarkSizes() {
+		plaintext := internal.RandomBytes(size)
+		b.Run(fmt.Sprintf("whole/%dMiB", size>>20), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if _, err := Encrypt(plaintext, encryptionKey); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("stream/%dMiB", size>>20), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				writer, err := NewEncryptWriter(io.Discard, encryptionKey, "v1", nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err = io.Copy(writer, bytes.NewReader(plaintext)); err != nil {
+					b.Fatal(err)
+				}
+				if err = writer.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	for _, size := range benchmarkSizes() {
+		plaintext := internal.RandomBytes(size)
+		sealed, err := Encrypt(plaintext, encryptionKey)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var stream bytes.Buffer
+		writer, _ := NewEncryptWriter(&stream, encryptionKey, "v1", nil)
+		_, _ = writer.Write(plaintext)
+		_ = writer.Close()
+
+		b.Run(fmt.Sprintf("whole/%dMiB", size>>20), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if _, err := Decrypt(sealed, encryptionKey); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("stream/%dMiB", size>>20), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				reader, err := NewDecryptReader(bytes.NewReader(stream.Bytes()), keyLookup("v1", encryptionKey), nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err = io.Copy(io.Discard, reader); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -61,3 +61,17 @@ func (ie *Internal) String() string {
 	}
 	return str
 }
+
+// Forbidden is returned when the caller is known but isn't allowed to perform an action
+type Forbidden struct {
+	Message string
+	Source  string
+}
+
+func (f *Forbidden) Error() string {
+	return fmt.Sprintf("%s", f.Message)
+}
+
+func (f *Forbidden) String() string {
+	return fmt.Sprintf("message=%s :: source%s", f.Message, f.Source)
+}
@@ -2,9 +2,20 @@ package tests
 
 import (
 	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"io"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"xrf197ilz35aq0/core/model/audit"
+	"xrf197ilz35aq0/core/model/org"
+	"xrf197ilz35aq0/core/model/rung"
 	"xrf197ilz35aq0/core/model/user"
 	"xrf197ilz35aq0/core/repository"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
 )
 
 // MockFileDataCopier for os.Open
@@ -42,9 +53,10 @@ func (m *MockFileDataCopier) Read(p []byte) (n int, err error) {
 
 type userRepositoryMock struct {
 	Called map[string]int
+	users  map[string]user.User // email: user
 }
 
-func (u *userRepositoryMock) FindUsersByFingerPrints(_ []string, _ context.Context) (*[]user.User, error) {
+func (u *userRepositoryMock) FindUsersByFingerPrints(fingerPrints []string, _ context.Context) ([]user.User, error) {
 	method := "FindUsersByFingerPrints"
 	count, ok := u.Called[method]
 	if !ok {
@@ -52,10 +64,10 @@ func (u *userRepositoryMock) FindUsersByFingerPrints(_ []string, _ context.Conte
 	} else {
 		u.Called[method] = count + 1
 	}
-	return &[]user.User{}, nil
+	return u.findUsers(func(savedUser user.User) string { return savedUser.FingerPrint }, fingerPrints), nil
 }
 
-func (u *userRepositoryMock) FindUsersByEmails(_ []string, _ context.Context) (*[]user.User, error) {
+func (u *userRepositoryMock) FindUsersByEmails(emails []string, _ context.Context) ([]user.User, error) {
 	method := "FindUsersByEmails"
 	count, ok := u.Called[method]
 	if !ok {
@@ -63,10 +75,38 @@ func (u *userRepositoryMock) FindUsersByEmails(_ []string, _ context.Context) (*
 	} else {
 		u.Called[method] = count + 1
 	}
-	return &[]user.User{}, nil
+	return u.findUsers(func(savedUser user.User) string { return savedUser.Email }, emails), nil
 }
 
-func (u *userRepositoryMock) GetUserById(_ string, _ context.Context) (*user.User, error) {
+func (u *userRepositoryMock) findUsers(field func(user.User) string, values []string) []user.User {
+	result := make([]user.User, 0)
+	for _, value := range values {
+		for _, savedUser := range u.users {
+			if field(savedUser) == value {
+				result = append(result, savedUser)
+			}
+		}
+	}
+	return result
+}
+
+func (u *userRepositoryMock) FindUserByEmail(email string, _ context.Context) (*user.User, error) {
+	method := "FindUserByEmail"
+	count, ok := u.Called[method]
+	if !ok {
+		u.Called[method] = 1
+	} else {
+		u.Called[method] = count + 1
+	}
+
+	savedUser, ok := u.users[email]
+	if !ok {
+		return nil, &xrfErr.External{Message: "User not found"}
+	}
+	return &savedUser, nil
+}
+
+func (u *userRepositoryMock) GetUserById(id string, _ context.Context) (*user.User, error) {
 	method := "GetUserById"
 	count, ok := u.Called[method]
 	if !ok {
@@ -75,10 +115,15 @@ func (u *userRepositoryMock) GetUserById(_ string, _ context.Context) (*user.Use
 		u.Called[method] = count + 1
 	}
 
+	for _, savedUser := range u.users {
+		if savedUser.Id == id {
+			return &savedUser, nil
+		}
+	}
 	return &user.User{}, nil
 }
 
-func (u *userRepositoryMock) UpdatePassword(_ string, _ string, _ context.Context) (bool, error) {
+func (u *userRepositoryMock) UpdatePassword(userFPrint string, newPassword string, _ context.Context) (bool, error) {
 	method := "UpdatePassword"
 	count, ok := u.Called[method]
 	if !ok {
@@ -87,10 +132,16 @@ func (u *userRepositoryMock) UpdatePassword(_ string, _ string, _ context.Contex
 		u.Called[method] = count + 1
 	}
 
+	for email, savedUser := range u.users {
+		if savedUser.FingerPrint == userFPrint {
+			savedUser.Password = newPassword
+			u.users[email] = savedUser
+		}
+	}
 	return true, nil
 }
 
-func (u *userRepositoryMock) CreateUser(_ *user.User, _ context.Context) (string, error) {
+func (u *userRepositoryMock) CreateUser(newUser *user.User, _ context.Context) (string, error) {
 	method := "CreateUser"
 	count, ok := u.Called[method]
 	if !ok {
@@ -98,20 +149,26 @@ func (u *userRepositoryMock) CreateUser(_ *user.User, _ context.Context) (string
 	} else {
 		u.Called[method] = count + 1
 	}
+	u.users[newUser.Email] = *newUser
 	return "MockUserId12345", nil
 }
 
 func NewUserRepositoryMock() repository.UserRepository {
 	return &userRepositoryMock{
 		Called: make(map[string]int),
+		users:  make(map[string]user.User),
 	}
 }
 
 type settingsRepositoryMock struct {
-	Called map[string]int
+	mu       sync.Mutex
+	Called   map[string]int
+	settings map[string]*user.Settings // fingerPrint: settings
 }
 
-func (s *settingsRepositoryMock) FetchUserSettings(_ context.Context, _ string) (settings *user.Settings, err error) {
+func (s *settingsRepositoryMock) FetchUserSettings(_ context.Context, userFP string) (settings *user.Settings, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	method := "FetchUserSettings"
 	count, ok := s.Called[method]
 	if !ok {
@@ -119,10 +176,15 @@ func (s *settingsRepositoryMock) FetchUserSettings(_ context.Context, _ string)
 	} else {
 		s.Called[method] = count + 1
 	}
+	if found, ok := s.settings[userFP]; ok {
+		return copySettings(found), nil
+	}
 	return &user.Settings{}, nil
 }
 
 func (s *settingsRepositoryMock) CreateSettings(settings *user.Settings, _ context.Context) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	method := "CreateSettings"
 	count, ok := s.Called[method]
 	if !ok {
@@ -130,12 +192,873 @@ func (s *settingsRepositoryMock) CreateSettings(settings *user.Settings, _ conte
 	} else {
 		s.Called[method] = count + 1
 	}
-
+	s.settings[settings.UserFingerprint] = copySettings(settings)
 	return settings, nil
 }
 
+func (s *settingsRepositoryMock) RewrapKeys(userFP string, keyVersion int, wrappedKey string,
+	previousKeys []user.WrappedDataKey, _ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found, ok := s.settings[userFP]
+	if !ok || found.KeyVersion != keyVersion {
+		return nil
+	}
+	for _, previous := range previousKeys {
+		if !slices.ContainsFunc(found.PreviousKeys, func(stored user.WrappedDataKey) bool { return stored.Version == previous.Version }) {
+			return nil
+		}
+	}
+	found.WrappedKey = wrappedKey
+	if len(previousKeys) > 0 {
+		found.PreviousKeys = slices.Clone(previousKeys)
+	}
+	found.LegacyKey = ""
+	found.LastModified = time.Now()
+	return nil
+}
+
+func (s *settingsRepositoryMock) ClaimKeyRotation(owner string, leaseFor time.Duration, _ context.Context) (*user.Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	fps := make([]string, 0, len(s.settings))
+	for fp := range s.settings {
+		fps = append(fps, fp)
+	}
+	sort.Strings(fps)
+	for _, fp := range fps {
+		found := s.settings[fp]
+		if !found.IsRotationDue(now) && !found.PendingReEncryption {
+			continue
+		}
+		if found.RotationLease != nil && found.RotationLease.ExpiresAt.After(now) {
+			continue
+		}
+		found.RotationLease = &user.RotationLease{Owner: owner, ExpiresAt: now.Add(leaseFor)}
+		return copySettings(found), nil
+	}
+	return nil, nil
+}
+
+func (s *settingsRepositoryMock) SaveRotatedKey(settings *user.Settings, previousVersion int, owner string, _ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found, ok := s.settings[settings.UserFingerprint]
+	if !ok || found.KeyVersion != previousVersion || !holdsLease(found, owner) {
+		return &xrfErr.Internal{Message: "key rotation lease was lost"}
+	}
+	found.WrappedKey = settings.WrappedKey
+	found.LegacyKey = ""
+	found.KeyVersion = settings.KeyVersion
+	found.PreviousKeys = slices.Clone(settings.PreviousKeys)
+	found.PendingReEncryption = settings.PendingReEncryption
+	found.RotateAt = settings.RotateAt
+	found.LastModified = settings.LastModified
+	return nil
+}
+
+func (s *settingsRepositoryMock) CompleteKeyRotation(userFP string, owner string, retirePreviousKeys bool, _ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found, ok := s.settings[userFP]
+	if !ok || found.RotationLease == nil || found.RotationLease.Owner != owner {
+		return &xrfErr.Internal{Message: "key rotation lease was lost"}
+	}
+	found.PendingReEncryption = false
+	if retirePreviousKeys {
+		found.PreviousKeys = nil
+	}
+	found.RotationLease = nil
+	return nil
+}
+
+func holdsLease(settings *user.Settings, owner string) bool {
+	lease := settings.RotationLease
+	return lease != nil && lease.Owner == owner && lease.ExpiresAt.After(time.Now())
+}
+
+func copySettings(settings *user.Settings) *user.Settings {
+	copied := *settings
+	copied.PreviousKeys = slices.Clone(settings.PreviousKeys)
+	if settings.RotationLease != nil {
+		lease := *settings.RotationLease
+		copied.RotationLease = &lease
+	}
+	return &copied
+}
+
 func NewSettingsRepositoryMock() repository.SettingsRepository {
 	return &settingsRepositoryMock{
-		Called: make(map[string]int),
+		Called:   make(map[string]int),
+		settings: make(map[string]*user.Settings),
+	}
+}
+
+// orgRepositoryMock is an in-memory OrganizationRepository
+type orgRepositoryMock struct {
+	orgs map[string]*org.Organization // orgId: org
+}
+
+func (o *orgRepositoryMock) Create(organization *org.Organization, _ context.Context) (string, error) {
+	for _, savedOrg := range o.orgs {
+		if savedOrg.Name == organization.Name {
+			return "", &xrfErr.External{Message: "org with name '" + organization.DisplayName + "' already exists"}
+		}
+	}
+	o.orgs[organization.Id] = organization
+	return organization.Id, nil
+}
+
+func (o *orgRepositoryMock) GetOrgById(id string, _ context.Context) (*org.Organization, error) {
+	savedOrg, ok := o.orgs[id]
+	if !ok || savedOrg.IsAnonymous {
+		return nil, &xrfErr.External{Message: constants.NotFoundOrgErrMsg}
+	}
+	return savedOrg, nil
+}
+
+func (o *orgRepositoryMock) FindOrgsWithPermission(permissionId string, limit int, _ context.Context) ([]org.Organization, error) {
+	result := make([]org.Organization, 0)
+	for _, savedOrg := range o.orgs {
+		for _, member := range savedOrg.Members {
+			if slices.Contains(member.Permissions, permissionId) {
+				result = append(result, org.Organization{Id: savedOrg.Id, Name: savedOrg.Name, DisplayName: savedOrg.DisplayName})
+				break
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (o *orgRepositoryMock) FindOrgMember(orgId string, userFp string, _ context.Context) (*org.Member, error) {
+	savedOrg, ok := o.orgs[orgId]
+	if !ok {
+		return nil, &xrfErr.External{Message: constants.NotFoundOrgErrMsg}
+	}
+	member, ok := savedOrg.Members[userFp]
+	if !ok {
+		return nil, nil
+	}
+	return &member, nil
+}
+
+func (o *orgRepositoryMock) UpdateOrg(orgId string, update *org.Update, _ context.Context) (*org.Organization, error) {
+	savedOrg, ok := o.orgs[orgId]
+	if !ok {
+		return nil, &xrfErr.External{Message: constants.NotFoundOrgErrMsg}
+	}
+	if update.DisplayName != nil {
+		for _, other := range o.orgs {
+			if other.Id != orgId && other.Name == update.Name() {
+				return nil, &xrfErr.External{Message: "org with name '" + *update.DisplayName + "' already exists"}
+			}
+		}
+		savedOrg.DisplayName = *update.DisplayName
+		savedOrg.Name = update.Name()
+	}
+	if update.Category != nil {
+		savedOrg.Category = *update.Category
+	}
+	if update.Description != nil {
+		savedOrg.Description = *update.Description
+	}
+	if update.IsAnonymous != nil {
+		savedOrg.IsAnonymous = *update.IsAnonymous
+	}
+	savedOrg.UpdatedAt = update.UpdatedAt
+	return savedOrg, nil
+}
+
+func (o *orgRepositoryMock) AddMembers(orgId string, members []org.Member, _ context.Context) error {
+	savedOrg, ok := o.orgs[orgId]
+	if !ok {
+		return &xrfErr.External{Message: constants.NotFoundOrgErrMsg}
+	}
+	for _, member := range members {
+		if _, ok := savedOrg.Members[member.Fingerprint]; ok {
+			return &xrfErr.External{Message: "user is already a member of the organization"}
+		}
+	}
+	for _, member := range members {
+		savedOrg.Members[member.Fingerprint] = member
+		savedOrg.MemberFps = append(savedOrg.MemberFps, member.Fingerprint)
+	}
+	return nil
+}
+
+func (o *orgRepositoryMock) RemoveMember(orgId string, userFp string, _ context.Context) error {
+	savedOrg, err := o.findMemberOrg(orgId, userFp)
+	if err != nil {
+		return err
+	}
+	for fp, member := range savedOrg.Members {
+		if fp != userFp && member.Owner {
+			delete(savedOrg.Members, userFp)
+			savedOrg.MemberFps = slices.DeleteFunc(savedOrg.MemberFps, func(memberFp string) bool { return memberFp == userFp })
+			return nil
+		}
+	}
+	return &xrfErr.External{Message: constants.LastOrgOwnerErrMsg}
+}
+
+func (o *orgRepositoryMock) SetMemberPermissions(orgId string, userFp string, permissionIds []string, _ context.Context) error {
+	savedOrg, err := o.findMemberOrg(orgId, userFp)
+	if err != nil {
+		return err
+	}
+	member := savedOrg.Members[userFp]
+	member.Permissions = permissionIds
+	savedOrg.Members[userFp] = member
+	return nil
+}
+
+func (o *orgRepositoryMock) SetMemberRoles(orgId string, userFp string, roleIds []string, _ context.Context) error {
+	savedOrg, err := o.findMemberOrg(orgId, userFp)
+	if err != nil {
+		return err
+	}
+	member := savedOrg.Members[userFp]
+	member.Roles = roleIds
+	savedOrg.Members[userFp] = member
+	return nil
+}
+
+func (o *orgRepositoryMock) ChangeOwnership(orgId string, change *org.OwnershipChange, _ context.Context) error {
+	savedOrg, err := o.findMemberOrg(orgId, change.UserFp)
+	if err != nil {
+		return err
+	}
+	if changedBy, ok := savedOrg.Members[change.ChangedBy]; !ok || !changedBy.Owner {
+		return &xrfErr.Forbidden{Message: "only owners can change the ownership of an org"}
+	}
+
+	owners := make(map[string]bool)
+	for fp, member := range savedOrg.Members {
+		owners[fp] = member.Owner
+	}
+	switch change.Action {
+	case org.PromoteOwner:
+		owners[change.UserFp] = true
+	case org.DemoteOwner:
+		owners[change.UserFp] = false
+	case org.TransferOwner:
+		owners[change.UserFp] = true
+		owners[change.ChangedBy] = false
+	}
+	hasOwner := false
+	for _, isOwner := range owners {
+		hasOwner = hasOwner || isOwner
+	}
+	if !hasOwner {
+		return &xrfErr.External{Message: constants.LastOrgOwnerErrMsg}
+	}
+
+	for fp, isOwner := range owners {
+		member := savedOrg.Members[fp]
+		member.Owner = isOwner
+		savedOrg.Members[fp] = member
+	}
+	savedOrg.OwnershipHistory = append(savedOrg.OwnershipHistory, *change)
+	return nil
+}
+
+func (o *orgRepositoryMock) FindOrgs(filter *org.ListFilter, _ context.Context) ([]org.Organization, error) {
+	result := make([]org.Organization, 0)
+	for _, savedOrg := range o.orgs {
+		if isVisible(filter, savedOrg) {
+			result = append(result, *savedOrg)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].Id > result[j].Id
+		}
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	if len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+	return result, nil
+}
+
+// isVisible reports if the org matches the filter, it mirrors the query used by the repository
+func isVisible(f *org.ListFilter, organization *org.Organization) bool {
+	_, isMember := organization.Members[f.ViewerFp]
+	switch {
+	case f.MemberOnly && !isMember,
+		organization.IsAnonymous && !isMember,
+		f.Category != "" && organization.Category != f.Category,
+		f.IsAnonymous != nil && organization.IsAnonymous != *f.IsAnonymous,
+		f.CreatedAfter != nil && !organization.CreatedAt.After(*f.CreatedAfter),
+		f.CreatedBefore != nil && !organization.CreatedAt.Before(*f.CreatedBefore):
+		return false
+	}
+	if f.After != nil {
+		return organization.CreatedAt.Before(f.After.CreatedAt) ||
+			(organization.CreatedAt.Equal(f.After.CreatedAt) && organization.Id < f.After.OrgId)
+	}
+	return true
+}
+
+func (o *orgRepositoryMock) FindMemberOrgs(filter *org.ListFilter, ctx context.Context) ([]org.Organization, error) {
+	memberFilter := *filter
+	memberFilter.MemberOnly = true
+	orgs, err := o.FindOrgs(&memberFilter, ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orgs {
+		orgs[i].Members = map[string]org.Member{filter.ViewerFp: orgs[i].Members[filter.ViewerFp]}
+	}
+	return orgs, nil
+}
+
+func (o *orgRepositoryMock) findMemberOrg(orgId string, userFp string) (*org.Organization, error) {
+	savedOrg, ok := o.orgs[orgId]
+	if !ok {
+		return nil, &xrfErr.External{Message: constants.NotFoundOrgErrMsg}
+	}
+	if _, ok := savedOrg.Members[userFp]; !ok {
+		return nil, &xrfErr.External{Message: constants.NotOrgMemberErrMsg}
+	}
+	return savedOrg, nil
+}
+
+func NewOrgRepositoryMock(orgs ...*org.Organization) repository.OrganizationRepository {
+	orgMap := make(map[string]*org.Organization)
+	for _, savedOrg := range orgs {
+		orgMap[savedOrg.Id] = savedOrg
+	}
+	return &orgRepositoryMock{orgs: orgMap}
+}
+
+// permissionRepositoryMock is an in-memory PermissionRepository
+type permissionRepositoryMock struct {
+	permissions map[string]org.Permission // permissionId: permission
+	orgs        *orgRepositoryMock        // orgs referencing permissions, nil if none do
+	roles       *roleRepositoryMock       // roles referencing permissions, nil if none do
+	audits      *auditRepositoryMock
+}
+
+func (p *permissionRepositoryMock) DeletePermission(id string, cascade bool, entry *audit.Entry, ctx context.Context) (int64, error) {
+	if _, ok := p.permissions[id]; !ok {
+		return 0, &xrfErr.External{Message: constants.NotFoundPermissionErrMsg}
+	}
+	var updated int64
+	if p.roles != nil {
+		referencing, _ := p.roles.FindRolesWithPermission(id, len(p.roles.roles), ctx)
+		if len(referencing) > 0 && !cascade {
+			return 0, &xrfErr.External{Message: constants.PermissionInUseErrMsg}
+		}
+		for _, referenced := range referencing {
+			referenced.Permissions = slices.DeleteFunc(slices.Clone(referenced.Permissions), func(permissionId string) bool {
+				return permissionId == id
+			})
+			p.roles.roles[referenced.Id] = referenced
+		}
+	}
+	if p.orgs != nil {
+		referencing, _ := p.orgs.FindOrgsWithPermission(id, len(p.orgs.orgs), ctx)
+		if len(referencing) > 0 && !cascade {
+			return 0, &xrfErr.External{Message: constants.PermissionInUseErrMsg}
+		}
+		for _, referenced := range referencing {
+			savedOrg := p.orgs.orgs[referenced.Id]
+			for fp, member := range savedOrg.Members {
+				member.Permissions = slices.DeleteFunc(slices.Clone(member.Permissions), func(permissionId string) bool {
+					return permissionId == id
+				})
+				savedOrg.Members[fp] = member
+			}
+			updated++
+		}
+	}
+	delete(p.permissions, id)
+	for permissionId, permission := range p.permissions {
+		permission.Implies = slices.DeleteFunc(slices.Clone(permission.Implies), func(implied string) bool { return implied == id })
+		p.permissions[permissionId] = permission
+	}
+	if p.audits != nil {
+		_ = p.audits.Record(entry, ctx)
+	}
+	return updated, nil
+}
+
+func (p *permissionRepositoryMock) CreatePermission(permission *org.Permission, _ context.Context) (string, error) {
+	for _, savedPermission := range p.permissions {
+		if savedPermission.OrgId == permission.OrgId && savedPermission.Name == permission.Name {
+			return "", &xrfErr.External{Message: "permission name already exists"}
+		}
+	}
+	p.permissions[permission.Id] = *permission
+	return permission.Id, nil
+}
+
+func (p *permissionRepositoryMock) UpdatePermission(permission *org.Permission, _ context.Context) error {
+	if _, ok := p.permissions[permission.Id]; !ok {
+		return &xrfErr.External{Message: constants.NotFoundPermissionErrMsg}
+	}
+	for _, savedPermission := range p.permissions {
+		if savedPermission.Id != permission.Id && savedPermission.OrgId == permission.OrgId && savedPermission.Name == permission.Name {
+			return &xrfErr.External{Message: "permission name already exists"}
+		}
+	}
+	p.permissions[permission.Id] = *permission
+	return nil
+}
+
+func (p *permissionRepositoryMock) FindOrgPermissions(orgId string, _ context.Context) ([]org.Permission, error) {
+	result := make([]org.Permission, 0, len(p.permissions))
+	for _, permission := range p.permissions {
+		if permission.OrgId == "" || permission.OrgId == orgId {
+			result = append(result, permission)
+		}
+	}
+	return result, nil
+}
+
+func (p *permissionRepositoryMock) FindPermissionsVisibleIn(orgIds []string, _ context.Context) ([]org.Permission, error) {
+	result := make([]org.Permission, 0, len(p.permissions))
+	for _, permission := range p.permissions {
+		if permission.OrgId == "" || slices.Contains(orgIds, permission.OrgId) {
+			result = append(result, permission)
+		}
+	}
+	return result, nil
+}
+
+func (p *permissionRepositoryMock) SetPermissionImplies(id string, implies []string, _ context.Context) error {
+	permission, ok := p.permissions[id]
+	if !ok {
+		return &xrfErr.External{Message: constants.NotFoundPermissionErrMsg}
+	}
+	permission.Implies = implies
+	p.permissions[id] = permission
+	return nil
+}
+
+func (p *permissionRepositoryMock) FindPermissionById(id string, _ context.Context) (*org.Permission, error) {
+	permission, ok := p.permissions[id]
+	if !ok {
+		return nil, &xrfErr.External{Message: constants.NotFoundPermissionErrMsg}
+	}
+	return &permission, nil
+}
+
+func (p *permissionRepositoryMock) FindPermissionByName(orgId string, name string, _ context.Context) (*org.Permission, error) {
+	for _, permission := range p.permissions {
+		if permission.OrgId == orgId && permission.Name == name {
+			return &permission, nil
+		}
+	}
+	return nil, &xrfErr.External{Message: constants.NotFoundPermissionErrMsg}
+}
+
+func (p *permissionRepositoryMock) FindPermissionsByIds(ids []string, _ context.Context) ([]org.Permission, error) {
+	result := make([]org.Permission, 0)
+	for _, id := range ids {
+		if permission, ok := p.permissions[id]; ok {
+			result = append(result, permission)
+		}
+	}
+	return result, nil
+}
+
+func (p *permissionRepositoryMock) FindPermissionsByNames(orgId string, names []string, _ context.Context) ([]org.Permission, error) {
+	result := make([]org.Permission, 0)
+	for _, name := range names {
+		for _, permission := range p.permissions {
+			if permission.Name == name && (permission.OrgId == "" || permission.OrgId == orgId) {
+				result = append(result, permission)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (p *permissionRepositoryMock) FindPermissions(orgId string, afterName string, limit int, _ context.Context) ([]org.Permission, error) {
+	result := make([]org.Permission, 0)
+	for _, permission := range p.permissions {
+		if permission.OrgId == orgId && permission.Name > afterName {
+			result = append(result, permission)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func NewPermissionRepositoryMock(permissions ...org.Permission) repository.PermissionRepository {
+	permissionMap := make(map[string]org.Permission)
+	for _, permission := range permissions {
+		permissionMap[permission.Id] = permission
+	}
+	return &permissionRepositoryMock{permissions: permissionMap}
+}
+
+// NewLinkedPermissionRepositoryMock returns a PermissionRepository whose deletes see and update the orgs in orgRepo
+// and the roles in roleRepo and record audit entries in auditRepo, all must be mocks from this package
+func NewLinkedPermissionRepositoryMock(orgRepo repository.OrganizationRepository, roleRepo repository.RoleRepository,
+	auditRepo repository.AuditRepository, permissions ...org.Permission) repository.PermissionRepository {
+	mock := NewPermissionRepositoryMock(permissions...).(*permissionRepositoryMock)
+	mock.orgs = orgRepo.(*orgRepositoryMock)
+	mock.roles = roleRepo.(*roleRepositoryMock)
+	mock.audits = auditRepo.(*auditRepositoryMock)
+	return mock
+}
+
+// roleRepositoryMock is an in-memory RoleRepository
+type roleRepositoryMock struct {
+	roles map[string]org.Role // roleId: role
+}
+
+func (r *roleRepositoryMock) CreateRole(role *org.Role, _ context.Context) (string, error) {
+	for _, saved := range r.roles {
+		if saved.Name == role.Name {
+			return "", &xrfErr.External{Message: "role name already exists"}
+		}
+	}
+	r.roles[role.Id] = *role
+	return role.Id, nil
+}
+
+func (r *roleRepositoryMock) FindRoleById(id string, _ context.Context) (*org.Role, error) {
+	role, ok := r.roles[id]
+	if !ok {
+		return nil, &xrfErr.External{Message: constants.NotFoundRoleErrMsg}
+	}
+	return &role, nil
+}
+
+func (r *roleRepositoryMock) FindRolesByIds(ids []string, _ context.Context) ([]org.Role, error) {
+	result := make([]org.Role, 0)
+	for _, id := range ids {
+		if role, ok := r.roles[id]; ok {
+			result = append(result, role)
+		}
+	}
+	return result, nil
+}
+
+func (r *roleRepositoryMock) FindRolesByNames(names []string, _ context.Context) ([]org.Role, error) {
+	result := make([]org.Role, 0)
+	for _, role := range r.roles {
+		if slices.Contains(names, role.Name) {
+			result = append(result, role)
+		}
+	}
+	return result, nil
+}
+
+func (r *roleRepositoryMock) FindRoles(afterName string, limit int, _ context.Context) ([]org.Role, error) {
+	result := make([]org.Role, 0)
+	for _, role := range r.roles {
+		if role.Name > afterName {
+			result = append(result, role)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (r *roleRepositoryMock) FindRolesWithPermission(permissionId string, limit int, _ context.Context) ([]org.Role, error) {
+	result := make([]org.Role, 0)
+	for _, role := range r.roles {
+		if slices.Contains(role.Permissions, permissionId) {
+			result = append(result, role)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func NewRoleRepositoryMock(roles ...org.Role) repository.RoleRepository {
+	roleMap := make(map[string]org.Role)
+	for _, role := range roles {
+		roleMap[role.Id] = role
+	}
+	return &roleRepositoryMock{roles: roleMap}
+}
+
+// auditRepositoryMock is an in-memory AuditRepository
+type auditRepositoryMock struct {
+	Entries []audit.Entry
+}
+
+func (a *auditRepositoryMock) Record(entry *audit.Entry, _ context.Context) error {
+	a.Entries = append(a.Entries, *entry)
+	return nil
+}
+
+func NewAuditRepositoryMock() repository.AuditRepository {
+	return &auditRepositoryMock{}
+}
+
+// AuditEntries returns the entries recorded by an audit repository mock
+func AuditEntries(repo repository.AuditRepository) []audit.Entry {
+	return repo.(*auditRepositoryMock).Entries
+}
+
+// rungRepositoryMock is an in-memory RungRepository, rungs are stored encoded so callers never share one
+type rungRepositoryMock struct {
+	mu      sync.Mutex
+	rungs   map[string][]byte // ownerFp: encoded rung
+	history []rung.Snapshot
+	scoring rung.Scoring
+}
+
+func (r *rungRepositoryMock) CreateRung(ownerRung *rung.Rung, _ context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.rungs[ownerRung.OwnerFP()]; ok {
+		return 0, &xrfErr.External{Message: "user already has a rung"}
+	}
+	data, err := bson.Marshal(ownerRung)
+	if err != nil {
+		return 0, err
+	}
+	r.rungs[ownerRung.OwnerFP()] = data
+	return ownerRung.Id(), nil
+}
+
+func (r *rungRepositoryMock) CreateRungIfMissing(ownerFp string, ctx context.Context) error {
+	_, err := r.CreateRung(rung.NewRung(ownerFp), ctx)
+	var externalErr *xrfErr.External
+	if errors.As(err, &externalErr) {
+		return nil
+	}
+	return err
+}
+
+func (r *rungRepositoryMock) FindRungByOwner(ownerFp string, _ context.Context) (*rung.Rung, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.find(ownerFp)
+}
+
+func (r *rungRepositoryMock) AddTradeTrail(ownerFp, customerFp, tradeId string, metadata rung.TrailMetaData, _ context.Context) (*rung.Rung, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ownerRung, err := r.find(ownerFp)
+	if err != nil {
+		return nil, err
+	}
+	previous := ownerRung.Magnitude()
+	if _, err = ownerRung.AddTradeTrail(customerFp, tradeId, metadata, r.scoring); err != nil {
+		return nil, err
+	}
+	if ownerRung.Magnitude() != previous {
+		r.history = append(r.history, *rung.NewSnapshot(ownerRung, previous))
+	}
+	data, err := bson.Marshal(ownerRung)
+	if err != nil {
+		return nil, err
+	}
+	r.rungs[ownerFp] = data
+	return ownerRung, nil
+}
+
+func (r *rungRepositoryMock) FindTopRungs(ownerFps []string, limit int, _ context.Context) ([]rung.Rung, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rungs, err := r.findOwners(ownerFps)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(rungs, func(i, j int) bool {
+		if rungs[i].Magnitude() != rungs[j].Magnitude() {
+			return rungs[i].Magnitude() > rungs[j].Magnitude()
+		}
+		return rungs[i].OwnerFP() < rungs[j].OwnerFP()
+	})
+	if len(rungs) > limit {
+		rungs = rungs[:limit]
+	}
+	return rungs, nil
+}
+
+func (r *rungRepositoryMock) FindStanding(ownerFp string, ownerFps []string, _ context.Context) (*rung.Standing, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ownerRung, err := r.find(ownerFp)
+	if err != nil {
+		return nil, err
+	}
+	rungs, err := r.findOwners(ownerFps)
+	if err != nil {
+		return nil, err
+	}
+	standing := &rung.Standing{Magnitude: ownerRung.Magnitude(), Total: int64(len(rungs))}
+	for _, other := range rungs {
+		if other.Magnitude() > standing.Magnitude {
+			standing.Above++
+		} else if other.Magnitude() == standing.Magnitude {
+			standing.Equal++
+		}
+	}
+	return standing, nil
+}
+
+// findOwners returns the rungs of ownerFps, every rung if it's nil
+func (r *rungRepositoryMock) findOwners(ownerFps []string) ([]rung.Rung, error) {
+	rungs := make([]rung.Rung, 0)
+	for ownerFp := range r.rungs {
+		if ownerFps != nil && !slices.Contains(ownerFps, ownerFp) {
+			continue
+		}
+		ownerRung, err := r.find(ownerFp)
+		if err != nil {
+			return nil, err
+		}
+		rungs = append(rungs, *ownerRung)
+	}
+	return rungs, nil
+}
+
+func (r *rungRepositoryMock) FindHistory(ownerFp string, from time.Time, to time.Time, _ context.Context) ([]rung.Snapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshots := make([]rung.Snapshot, 0)
+	for _, snapshot := range r.history {
+		if snapshot.OwnerFp == ownerFp && !snapshot.RecordedAt.Before(from) && snapshot.RecordedAt.Before(to) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// AddRungSnapshots appends snapshots to the history of a rung repository mock
+func AddRungSnapshots(repo repository.RungRepository, snapshots ...rung.Snapshot) {
+	mock := repo.(*rungRepositoryMock)
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	mock.history = append(mock.history, snapshots...)
+}
+
+func (r *rungRepositoryMock) find(ownerFp string) (*rung.Rung, error) {
+	data, ok := r.rungs[ownerFp]
+	if !ok {
+		return nil, &xrfErr.External{Message: constants.NotFoundRungErrMsg}
+	}
+	var ownerRung rung.Rung
+	if err := bson.Unmarshal(data, &ownerRung); err != nil {
+		return nil, err
+	}
+	return &ownerRung, nil
+}
+
+// consentRepositoryMock is an in-memory ConsentRepository
+type consentRepositoryMock struct {
+	consents []*rung.Consent
+}
+
+func (c *consentRepositoryMock) CreateConsent(consent *rung.Consent, ctx context.Context) (string, error) {
+	if given, _ := c.FindGivenConsent(consent.CustomerFp, consent.OwnerFp, ctx); given != nil {
+		return "", &xrfErr.External{Message: "consent was already given"}
+	}
+	c.consents = append(c.consents, consent)
+	return consent.Id, nil
+}
+
+func (c *consentRepositoryMock) FindGivenConsent(customerFp string, ownerFp string, _ context.Context) (*rung.Consent, error) {
+	for _, consent := range c.consents {
+		if consent.CustomerFp == customerFp && consent.OwnerFp == ownerFp && consent.Status == rung.ConsentGiven {
+			found := *consent
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *consentRepositoryMock) RevokeConsent(customerFp string, ownerFp string, _ context.Context) error {
+	for _, consent := range c.consents {
+		if consent.CustomerFp == customerFp && consent.OwnerFp == ownerFp && consent.Status == rung.ConsentGiven {
+			now := time.Now()
+			consent.Status = rung.ConsentRevoked
+			consent.RevokedAt = &now
+			return nil
+		}
+	}
+	return &xrfErr.External{Message: constants.NotFoundConsentErrMsg}
+}
+
+func NewConsentRepositoryMock() repository.ConsentRepository {
+	return &consentRepositoryMock{}
+}
+
+func NewRungRepositoryMock(scoring rung.Scoring) repository.RungRepository {
+	return &rungRepositoryMock{rungs: make(map[string][]byte), scoring: scoring}
+}
+
+// invitationRepositoryMock is an in-memory InvitationRepository
+type invitationRepositoryMock struct {
+	invitations map[string]*org.Invitation // invitationId: invitation
+}
+
+func (i *invitationRepositoryMock) CreateInvitation(invitation *org.Invitation, _ context.Context) (string, error) {
+	for _, saved := range i.invitations {
+		if saved.OrgId == invitation.OrgId && saved.Email == invitation.Email && saved.Status == org.InvitationPending {
+			return "", &xrfErr.External{Message: "'" + invitation.Email + "' already has a pending invitation to this org"}
+		}
+	}
+	i.invitations[invitation.Id] = invitation
+	return invitation.Id, nil
+}
+
+func (i *invitationRepositoryMock) FindPendingInvitations(orgId string, _ context.Context) ([]org.Invitation, error) {
+	result := make([]org.Invitation, 0)
+	for _, saved := range i.invitations {
+		if saved.OrgId == orgId && saved.Status == org.InvitationPending && !saved.IsExpired(time.Now()) {
+			result = append(result, *saved)
+		}
+	}
+	return result, nil
+}
+
+func (i *invitationRepositoryMock) RevokeInvitation(orgId string, invitationId string, _ context.Context) error {
+	saved, ok := i.invitations[invitationId]
+	if !ok || saved.OrgId != orgId || saved.Status != org.InvitationPending {
+		return &xrfErr.External{Message: constants.NotFoundInvitationErrMsg}
+	}
+	saved.Status = org.InvitationRevoked
+	return nil
+}
+
+func (i *invitationRepositoryMock) ClaimInvitation(tokenHash string, email string, _ context.Context) (*org.Invitation, error) {
+	for _, saved := range i.invitations {
+		if saved.TokenHash == tokenHash && saved.Email == email && saved.Status == org.InvitationPending && !saved.IsExpired(time.Now()) {
+			saved.Status = org.InvitationAccepted
+			claimed := *saved
+			return &claimed, nil
+		}
+	}
+	return nil, &xrfErr.External{Message: constants.NotFoundInvitationErrMsg}
+}
+
+func (i *invitationRepositoryMock) ReleaseInvitation(invitationId string, _ context.Context) error {
+	if saved, ok := i.invitations[invitationId]; ok && saved.Status == org.InvitationAccepted {
+		saved.Status = org.InvitationPending
+	}
+	return nil
+}
+
+func NewInvitationRepositoryMock(invitations ...*org.Invitation) repository.InvitationRepository {
+	invitationMap := make(map[string]*org.Invitation)
+	for _, invitation := range invitations {
+		invitationMap[invitation.Id] = invitation
 	}
+	return &invitationRepositoryMock{invitations: invitationMap}
 }
@@ -0,0 +1,118 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"xrf197ilz35aq0/internal/random"
+)
+
+// For HMAC-SHA256 the secret should at least be as long as the hash output (32 bytes)
+const minSecretSize = 32
+
+const separator = "."
+
+var (
+	ErrInvalidToken = errors.New("invalid session token")
+	ErrExpiredToken = errors.New("session token has expired")
+)
+
+// Claims are the facts a session token asserts about its holder
+type Claims struct {
+	Id        string `json:"jti"`
+	Subject   string `json:"sub"` // the user's fingerprint
+	UserId    string `json:"uid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (c *Claims) Expiry() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// Signer issues and verifies session tokens signed with HMAC-SHA256.
+// A token is made up of two base64 (url-safe) parts: payload.signature
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func (s *Signer) Issue(subject, userId string) (string, *Claims, error) {
+	if subject == "" {
+		return "", nil, fmt.Errorf("token subject should not be empty")
+	}
+	now := s.now()
+	claims := &Claims{
+		Subject:   subject,
+		UserId:    userId,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.ttl).Unix(),
+		Id:        strconv.FormatInt(random.PositiveInt64(), 10),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal token claims: %w", err)
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	signature := base64.RawURLEncoding.EncodeToString(s.sign([]byte(encodedPayload)))
+
+	return encodedPayload + separator + signature, claims, nil
+}
+
+func (s *Signer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, separator)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	// Use a constant-time comparison to prevent timing attacks
+	if !hmac.Equal(signature, s.sign([]byte(parts[0]))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if !s.now().Before(claims.Expiry()) {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+func (s *Signer) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func NewSigner(secret []byte, ttl time.Duration) (*Signer, error) {
+	if len(secret) < minSecretSize {
+		return nil, fmt.Errorf("token secret should at least be %d bytes", minSecretSize)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("token ttl should be greater than 0")
+	}
+	return &Signer{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package token
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"xrf197ilz35aq0/internal"
+)
+
+var tokenSecret = internal.RandomBytes(32)
+
+func TestNewSigner(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  []byte
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{name: "creates a signer", secret: tokenSecret, ttl: time.Hour, wantErr: false},
+		{name: "fails if secret is too short", secret: internal.RandomBytes(31), ttl: time.Hour, wantErr: true},
+		{name: "fails if ttl is not positive", secret: tokenSecret, ttl: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := NewSigner(tt.secret, tt.ttl)
+			if tt.wantErr {
+				internal.AssertError(t, err)
+				assert.Nil(t, signer)
+			} else {
+				internal.AssertNoError(t, err)
+				assert.NotNil(t, signer)
+			}
+		})
+	}
+}
+
+func TestSignerIssueAndVerify(t *testing.T) {
+	signer, err := NewSigner(tokenSecret, time.Hour)
+	internal.AssertNoError(t, err)
+
+	t.Run("verifies a token it issued", func(t *testing.T) {
+		token, issued, err := signer.Issue("userFingerprint", "1234")
+		internal.AssertNoError(t, err)
+
+		claims, err := signer.Verify(token)
+		internal.AssertNoError(t, err)
+		assert.Equal(t, issued, claims)
+		assert.Equal(t, "userFingerprint", claims.Subject)
+	})
+
+	t.Run("fails to issue a token without a subject", func(t *testing.T) {
+		_, _, err := signer.Issue("", "1234")
+		internal.AssertError(t, err)
+	})
+
+	t.Run("rejects a tampered token", func(t *testing.T) {
+		token, _, err := signer.Issue("userFingerprint", "1234")
+		internal.AssertNoError(t, err)
+
+		other, _, err := signer.Issue("otherFingerprint", "5678")
+		internal.AssertNoError(t, err)
+
+		tampered := other[:len(other)-len(token)/2] + token[len(token)-len(token)/2:]
+		_, err = signer.Verify(tampered)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("rejects a token signed with another secret", func(t *testing.T) {
+		otherSigner, err := NewSigner(internal.RandomBytes(32), time.Hour)
+		internal.AssertNoError(t, err)
+		token, _, err := otherSigner.Issue("userFingerprint", "1234")
+		internal.AssertNoError(t, err)
+
+		_, err = signer.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("rejects malformed tokens", func(t *testing.T) {
+		for _, token := range []string{"", ".", "abc", "abc.", ".abc", "a.b.c"} {
+			_, err := signer.Verify(token)
+			assert.ErrorIs(t, err, ErrInvalidToken, token)
+		}
+	})
+
+	t.Run("rejects an expired token", func(t *testing.T) {
+		token, _, err := signer.Issue("userFingerprint", "1234")
+		internal.AssertNoError(t, err)
+
+		expiredSigner := *signer
+		expiredSigner.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		_, err = expiredSigner.Verify(token)
+		assert.ErrorIs(t, err, ErrExpiredToken)
+	})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/service"
+	xrf "xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+)
+
+type AuthHandler struct {
+	logger      xrf.Logger
+	router      *mux.Router
+	userService service.UserService
+}
+
+func NewAuthHandler(logger xrf.Logger, userService service.UserService, router *mux.Router) *AuthHandler {
+	return &AuthHandler{
+		logger:      logger,
+		router:      router,
+		userService: userService,
+	}
+}
+
+func (handler *AuthHandler) login(w http.ResponseWriter, r *http.Request) {
+	var loginReq exchange.LoginRequest
+	err := decodeJSONBody(r, &loginReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+
+	loginResp, err := handler.userService.Authenticate(&loginReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	resp := dataResponse{Data: loginResp, Code: http.StatusOK}
+	writeResponse(resp, w, handler.logger)
+}
+
+func (handler *AuthHandler) RegisterAndListen() {
+	slashAPISlashAuth := fmt.Sprintf("%s/%s/%s", constants.SlashAPI, constants.V1, "auth") // "/api/v1/auth"
+
+	handler.router.HandleFunc(fmt.Sprintf("%s/login", slashAPISlashAuth), handler.login).Methods(POST)
+}
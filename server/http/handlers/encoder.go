@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"xrf197ilz35aq0/core/exchange"
 	xrf "xrf197ilz35aq0/internal"
 	"xrf197ilz35aq0/internal/constants"
 	xrfErr "xrf197ilz35aq0/internal/error"
@@ -15,16 +16,23 @@ type dataResponse struct {
 	Data interface{} `json:"data,omitempty"`
 }
 
-type errorResponse struct {
+// ErrorResponse is the body of every error response, including those written by the middlewares
+type ErrorResponse struct {
 	Error string `json:"error"`
 	Code  int    `json:"code"`
 }
 
+// pagination is written next to the data of list responses, a client gets the next page by
+// sending NextCursor back as the cursor query parameter
 type pagination struct {
-	Offset int `json:"offset"`
-	Limit  int `json:"limit"`
-	Total  int `json:"total"`
-	Start  int `json:"start"`
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"hasMore"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type paginatedResponse struct {
+	dataResponse
+	Pagination *pagination `json:"pagination"`
 }
 
 func writeResponse(data dataResponse, w http.ResponseWriter, logger xrf.Logger) {
@@ -41,16 +49,19 @@ func writePaginatedResponse(data dataResponse, pag *pagination, w http.ResponseW
 			logger.Error(fmt.Sprintf("event=writeResponseFailure :: error encoding response: %v", err))
 		}
 	} else {
-		err := json.NewEncoder(w).Encode(struct {
-			*pagination
-			dataResponse
-		}{})
+		err := json.NewEncoder(w).Encode(paginatedResponse{dataResponse: data, Pagination: pag})
 		if err != nil {
 			logger.Error(fmt.Sprintf("event=writePaginatedResponseFailure :: error encoding response: %v", err))
 		}
 	}
 }
 
+// writePage writes a page of a list with its pagination
+func writePage[T any](page *exchange.Page[T], w http.ResponseWriter, logger xrf.Logger) {
+	data := dataResponse{Data: page.Items, Code: http.StatusOK}
+	writePaginatedResponse(data, &pagination{Limit: page.Limit, HasMore: page.HasMore, NextCursor: page.NextCursor}, w, logger)
+}
+
 func writeErrorResponse(error error, w http.ResponseWriter, logger xrf.Logger) {
 	msg := "Something went wrong"
 	statusCode := http.StatusInternalServerError
@@ -58,6 +69,7 @@ func writeErrorResponse(error error, w http.ResponseWriter, logger xrf.Logger) {
 	var decoderError *decoderErr
 	var internalError *xrfErr.Internal
 	var externalError *xrfErr.External
+	var forbiddenError *xrfErr.Forbidden
 
 	switch {
 	case errors.As(error, &decoderError):
@@ -73,17 +85,23 @@ func writeErrorResponse(error error, w http.ResponseWriter, logger xrf.Logger) {
 		errors.As(error, &externalErr)
 		statusCode = externalErrorCode(externalError.Message)
 		msg = externalErr.Message
+	case errors.As(error, &forbiddenError):
+		statusCode = http.StatusForbidden
+		msg = forbiddenError.Message
 	default:
 		statusCode = http.StatusInternalServerError
 		msg = "Something went wrong"
 	}
 
+	WriteError(statusCode, msg, w, logger)
+}
+
+// WriteError writes an ErrorResponse with the status code
+func WriteError(statusCode int, msg string, w http.ResponseWriter, logger xrf.Logger) {
 	w.Header().Set(constants.ContentType, constants.ContentTypeJson)
 	w.WriteHeader(statusCode)
 
-	errResp := errorResponse{Error: msg, Code: statusCode}
-
-	err := json.NewEncoder(w).Encode(errResp)
+	err := json.NewEncoder(w).Encode(ErrorResponse{Error: msg, Code: statusCode})
 	if err != nil {
 		logger.Error(fmt.Sprintf("error writing error response: %s", err))
 	}
@@ -93,6 +111,13 @@ func externalErrorCode(errorMessage string) int {
 	switch errorMessage {
 	case constants.NotFoundOrgErrMsg:
 		return http.StatusNotFound
+	case constants.InvalidCredentialsErrMsg:
+		return http.StatusUnauthorized
+	case constants.NotOrgMemberErrMsg, constants.NotFoundInvitationErrMsg, constants.NotFoundPermissionErrMsg,
+		constants.NotFoundRungErrMsg, constants.NotFoundConsentErrMsg:
+		return http.StatusNotFound
+	case constants.LastOrgOwnerErrMsg, constants.PermissionInUseErrMsg:
+		return http.StatusConflict
 	default:
 		return http.StatusBadRequest
 	}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/service"
+	xrf "xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+type InvitationHandler struct {
+	logger            xrf.Logger
+	router            *mux.Router
+	invitationService service.InvitationService
+}
+
+func NewInvitationHandler(logger xrf.Logger, invitationService service.InvitationService, router *mux.Router) *InvitationHandler {
+	return &InvitationHandler{
+		logger:            logger,
+		router:            router,
+		invitationService: invitationService,
+	}
+}
+
+func (handler *InvitationHandler) inviteMember(w http.ResponseWriter, r *http.Request) {
+	orgId, isValid := getAndValidateId(r, "orgId")
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid org id"}, w, handler.logger)
+		return
+	}
+
+	var invitationReq exchange.InvitationRequest
+	err := decodeJSONBody(r, &invitationReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	invitation, err := handler.invitationService.InviteMember(orgId, invitationReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=inviteMember :: orgId=%s :: invitationId=%s", orgId, invitation.InvitationId))
+
+	resp := dataResponse{Data: invitation, Code: http.StatusCreated}
+	writeResponse(resp, w, handler.logger)
+}
+
+func (handler *InvitationHandler) findPendingInvitations(w http.ResponseWriter, r *http.Request) {
+	orgId, isValid := getAndValidateId(r, "orgId")
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid org id"}, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	invitations, err := handler.invitationService.FindPendingInvitations(orgId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	resp := dataResponse{Data: invitations, Code: http.StatusOK}
+	writeResponse(resp, w, handler.logger)
+}
+
+func (handler *InvitationHandler) revokeInvitation(w http.ResponseWriter, r *http.Request) {
+	orgId, isValid := getAndValidateId(r, "orgId")
+	invitationId, isValidInvitation := getAndValidateId(r, "invitationId")
+	if !isValid || !isValidInvitation {
+		writeErrorResponse(&xrfErr.External{Message: "invalid org or invitation id"}, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	err := handler.invitationService.RevokeInvitation(orgId, invitationId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=revokeInvitation :: orgId=%s :: invitationId=%s", orgId, invitationId))
+	writeOrgIdResponse(orgId, w, handler.logger)
+}
+
+func (handler *InvitationHandler) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var acceptReq exchange.AcceptInvitationRequest
+	err := decodeJSONBody(r, &acceptReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	orgId, err := handler.invitationService.AcceptInvitation(acceptReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeOrgIdResponse(orgId, w, handler.logger)
+}
+
+func (handler *InvitationHandler) RegisterAndListen() {
+	slashAPIV1 := fmt.Sprintf("%s/%s", constants.SlashAPI, constants.V1)                     // "/api/v1"
+	orgInvitationsUrl := fmt.Sprintf("%s/org/{%s}/invitations", slashAPIV1, constants.OrgId) // "/api/v1/org/{orgId}/invitations"
+
+	handler.router.HandleFunc(orgInvitationsUrl, handler.inviteMember).Methods(POST)
+	handler.router.HandleFunc(orgInvitationsUrl, handler.findPendingInvitations).Methods(GET)
+	handler.router.HandleFunc(fmt.Sprintf("%s/{invitationId}", orgInvitationsUrl), handler.revokeInvitation).Methods(DELETE)
+	handler.router.HandleFunc(fmt.Sprintf("%s/invitations/accept", slashAPIV1), handler.acceptInvitation).Methods(POST)
+}
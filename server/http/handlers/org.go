@@ -36,20 +36,82 @@ func (handler *OrgHandler) createOrg(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// create a new org
-	resp, err := handler.orgService.CreateOrg(orgReq, context.Background())
+	resp, err := handler.orgService.CreateOrg(orgReq, r.Context())
 	if err != nil {
 		writeErrorResponse(err, w, handler.logger)
 		return
 	}
-	dataResp := dataResponse{
-		Code: 200,
-		Data: struct {
-			OrgId string `json:"orgId"`
-		}{
-			OrgId: resp,
-		},
+	writeOrgIdResponse(resp, w, handler.logger)
+}
+
+func (handler *OrgHandler) listOrgs(w http.ResponseWriter, r *http.Request) {
+	listReq, err := orgListRequest(r)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	page, err := handler.orgService.ListOrgs(*listReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
 	}
-	writeResponse(dataResp, w, handler.logger)
+	writePage(page, w, handler.logger)
+}
+
+func (handler *OrgHandler) findUserOrgs(w http.ResponseWriter, r *http.Request) {
+	userId, isValid := getAndValidateId(r, "userId")
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid user id"}, w, handler.logger)
+		return
+	}
+	listReq, err := orgListRequest(r)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	page, err := handler.orgService.FindUserOrgs(userId, *listReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writePage(page, w, handler.logger)
+}
+
+// orgListRequest reads the list filters from the query e.g. ?category=finance&member=true&cursor=...&limit=20
+func orgListRequest(r *http.Request) (*exchange.OrgListRequest, error) {
+	query := r.URL.Query()
+	listReq := &exchange.OrgListRequest{
+		Category: query.Get("category"),
+		Cursor:   query.Get("cursor"),
+	}
+
+	var err error
+	if listReq.Limit, err = queryInt(r, "limit"); err != nil {
+		return nil, err
+	}
+	if listReq.IsAnonymous, err = queryBool(r, "anonymous"); err != nil {
+		return nil, err
+	}
+	if listReq.CreatedAfter, err = queryTime(r, "createdAfter"); err != nil {
+		return nil, err
+	}
+	if listReq.CreatedBefore, err = queryTime(r, "createdBefore"); err != nil {
+		return nil, err
+	}
+	memberOnly, err := queryBool(r, "member")
+	if err != nil {
+		return nil, err
+	}
+	listReq.MemberOnly = memberOnly != nil && *memberOnly
+	return listReq, nil
 }
 
 func (handler *OrgHandler) getOrg(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +123,7 @@ func (handler *OrgHandler) getOrg(w http.ResponseWriter, r *http.Request) {
 		writeErrorResponse(externalError, w, handler.logger)
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
 	defer cancel()
 	foundOrg, err := handler.orgService.GetOrgById(orgId, ctx)
 	if err != nil {
@@ -84,7 +146,7 @@ func (handler *OrgHandler) findOrgMembers(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
 	defer cancel()
 
 	foundOrgs, err := handler.orgService.FindOrgMembers(orgId, ctx)
@@ -98,15 +160,234 @@ func (handler *OrgHandler) findOrgMembers(w http.ResponseWriter, r *http.Request
 }
 
 func (handler *OrgHandler) updateOrg(w http.ResponseWriter, r *http.Request) {
-	// TODO
+	orgId, isValid := getAndValidateId(r, "orgId")
+	if !isValid {
+		externalError := &xrfErr.External{
+			Message: "invalid org id",
+		}
+		writeErrorResponse(externalError, w, handler.logger)
+		return
+	}
+
+	var updateReq exchange.OrgUpdateRequest
+	err := decodeJSONBody(r, &updateReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	updatedOrg, err := handler.orgService.UpdateOrg(orgId, updateReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=updateOrg :: orgId=%s", orgId))
+
+	resp := dataResponse{Data: updatedOrg, Code: http.StatusOK}
+	writeResponse(resp, w, handler.logger)
+}
+
+func (handler *OrgHandler) addOrgMembers(w http.ResponseWriter, r *http.Request) {
+	orgId, isValid := getAndValidateId(r, "orgId")
+	if !isValid {
+		externalError := &xrfErr.External{
+			Message: "invalid org id",
+		}
+		writeErrorResponse(externalError, w, handler.logger)
+		return
+	}
+
+	var membersReq []exchange.OrgMemberRequest
+	err := decodeJSONBody(r, &membersReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	err = handler.orgService.AddMembers(orgId, membersReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=addOrgMembers :: orgId=%s :: count=%d", orgId, len(membersReq)))
+	writeOrgIdResponse(orgId, w, handler.logger)
+}
+
+func (handler *OrgHandler) removeOrgMember(w http.ResponseWriter, r *http.Request) {
+	orgId, userId, isValid := getOrgAndUserIds(r)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid org or user id"}, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	err := handler.orgService.RemoveMember(orgId, userId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=removeOrgMember :: orgId=%s :: userId=%s", orgId, userId))
+	writeOrgIdResponse(orgId, w, handler.logger)
+}
+
+func (handler *OrgHandler) updateMemberPermissions(w http.ResponseWriter, r *http.Request) {
+	orgId, userId, isValid := getOrgAndUserIds(r)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid org or user id"}, w, handler.logger)
+		return
+	}
+
+	var permissionsReq exchange.OrgMemberPermissionsRequest
+	err := decodeJSONBody(r, &permissionsReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	err = handler.orgService.UpdateMemberPermissions(orgId, userId, permissionsReq.Permissions, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=updateMemberPermissions :: orgId=%s :: userId=%s", orgId, userId))
+	writeOrgIdResponse(orgId, w, handler.logger)
+}
+
+func (handler *OrgHandler) updateMemberRoles(w http.ResponseWriter, r *http.Request) {
+	orgId, userId, isValid := getOrgAndUserIds(r)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid org or user id"}, w, handler.logger)
+		return
+	}
+
+	var rolesReq exchange.OrgMemberRolesRequest
+	err := decodeJSONBody(r, &rolesReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	err = handler.orgService.UpdateMemberRoles(orgId, userId, rolesReq.Roles, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=updateMemberRoles :: orgId=%s :: userId=%s", orgId, userId))
+	writeOrgIdResponse(orgId, w, handler.logger)
+}
+
+func (handler *OrgHandler) promoteOwner(w http.ResponseWriter, r *http.Request) {
+	handler.changeOwnership(w, r, handler.orgService.PromoteOwner)
+}
+
+func (handler *OrgHandler) demoteOwner(w http.ResponseWriter, r *http.Request) {
+	handler.changeOwnership(w, r, handler.orgService.DemoteOwner)
+}
+
+func (handler *OrgHandler) changeOwnership(w http.ResponseWriter, r *http.Request, change func(string, string, context.Context) error) {
+	orgId, userId, isValid := getOrgAndUserIds(r)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid org or user id"}, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	err := change(orgId, userId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=changeOwnership :: orgId=%s :: userId=%s :: method=%s", orgId, userId, r.Method))
+	writeOrgIdResponse(orgId, w, handler.logger)
+}
+
+func (handler *OrgHandler) transferOwnership(w http.ResponseWriter, r *http.Request) {
+	orgId, isValid := getAndValidateId(r, "orgId")
+	if !isValid {
+		externalError := &xrfErr.External{
+			Message: "invalid org id",
+		}
+		writeErrorResponse(externalError, w, handler.logger)
+		return
+	}
+
+	var transferReq exchange.OwnershipTransferRequest
+	err := decodeJSONBody(r, &transferReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	err = handler.orgService.TransferOwnership(orgId, transferReq.UserId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=transferOwnership :: orgId=%s :: userId=%s", orgId, transferReq.UserId))
+	writeOrgIdResponse(orgId, w, handler.logger)
+}
+
+func writeOrgIdResponse(orgId string, w http.ResponseWriter, logger xrf.Logger) {
+	dataResp := dataResponse{
+		Code: 200,
+		Data: struct {
+			OrgId string `json:"orgId"`
+		}{
+			OrgId: orgId,
+		},
+	}
+	writeResponse(dataResp, w, logger)
+}
+
+func getOrgAndUserIds(r *http.Request) (string, string, bool) {
+	orgId, isValid := getAndValidateId(r, "orgId")
+	if !isValid {
+		return "", "", false
+	}
+	userId, isValid := getAndValidateId(r, "userId")
+	if !isValid {
+		return "", "", false
+	}
+	return orgId, userId, true
 }
 
 func (handler *OrgHandler) RegisterAndListen() {
 	slashAPISlashOrg := fmt.Sprintf("%s/%s/%s", constants.SlashAPI, constants.V1, "org") // "/api/v1/org"
 	findByOrgIdUrl := fmt.Sprintf("%s/{%s}", slashAPISlashOrg, constants.OrgId)          // "/api/v1/org/{orgId}"
-	//findByOrgMembers := fmt.Sprintf("/%s/members", findByOrgIdUrl)                       // "/api/v1/org/{orgId}/members"
+	orgMembersUrl := fmt.Sprintf("%s/members", findByOrgIdUrl)                           // "/api/v1/org/{orgId}/members"
+	orgMemberUrl := fmt.Sprintf("%s/{userId}", orgMembersUrl)                            // "/api/v1/org/{orgId}/members/{userId}"
+	orgOwnersUrl := fmt.Sprintf("%s/owners", findByOrgIdUrl)                             // "/api/v1/org/{orgId}/owners"
 
 	handler.router.HandleFunc(findByOrgIdUrl, handler.getOrg).Methods(GET)
+	handler.router.HandleFunc(findByOrgIdUrl, handler.updateOrg).Methods(PATCH)
 	handler.router.HandleFunc(slashAPISlashOrg, handler.createOrg).Methods(POST)
-	handler.router.HandleFunc("/api/v1/org/{orgId}/members", handler.findOrgMembers).Methods(GET)
+	handler.router.HandleFunc(slashAPISlashOrg, handler.listOrgs).Methods(GET)
+	handler.router.HandleFunc(fmt.Sprintf("%s/%s/user/{userId}/orgs", constants.SlashAPI, constants.V1), handler.findUserOrgs).Methods(GET)
+	handler.router.HandleFunc(orgMembersUrl, handler.findOrgMembers).Methods(GET)
+	handler.router.HandleFunc(orgMembersUrl, handler.addOrgMembers).Methods(POST)
+	handler.router.HandleFunc(orgMemberUrl, handler.removeOrgMember).Methods(DELETE)
+	handler.router.HandleFunc(fmt.Sprintf("%s/permissions", orgMemberUrl), handler.updateMemberPermissions).Methods(PUT)
+	handler.router.HandleFunc(fmt.Sprintf("%s/roles", orgMemberUrl), handler.updateMemberRoles).Methods(PUT)
+	handler.router.HandleFunc(fmt.Sprintf("%s/transfer", orgOwnersUrl), handler.transferOwnership).Methods(POST)
+	handler.router.HandleFunc(fmt.Sprintf("%s/{userId}", orgOwnersUrl), handler.promoteOwner).Methods(PUT)
+	handler.router.HandleFunc(fmt.Sprintf("%s/{userId}", orgOwnersUrl), handler.demoteOwner).Methods(DELETE)
 }
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/service"
+	xrf "xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+type RankingHandler struct {
+	logger         xrf.Logger
+	router         *mux.Router
+	rankingService service.RankingService
+}
+
+func NewRankingHandler(logger xrf.Logger, rankingService service.RankingService, router *mux.Router) *RankingHandler {
+	return &RankingHandler{
+		logger:         logger,
+		router:         router,
+		rankingService: rankingService,
+	}
+}
+
+// leaderboard ranks every user unless the orgId query parameter limits it to the org's members
+func (handler *RankingHandler) leaderboard(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	leaderboardReq := exchange.LeaderboardRequest{OrgId: r.URL.Query().Get(constants.OrgId), Limit: limit}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	leaderboard, err := handler.rankingService.Leaderboard(leaderboardReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Data: leaderboard, Code: http.StatusOK}, w, handler.logger)
+}
+
+func (handler *RankingHandler) getStanding(w http.ResponseWriter, r *http.Request) {
+	userId, isValid := getAndValidateId(r, constants.USERID)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid user id"}, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	standing, err := handler.rankingService.GetStanding(userId, r.URL.Query().Get(constants.OrgId), ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Data: standing, Code: http.StatusOK}, w, handler.logger)
+}
+
+func (handler *RankingHandler) RegisterAndListen() {
+	slashAPIV1 := fmt.Sprintf("%s/%s", constants.SlashAPI, constants.V1) // "/api/v1"
+
+	handler.router.HandleFunc(fmt.Sprintf("%s/leaderboard", slashAPIV1), handler.leaderboard).Methods(GET)
+	handler.router.HandleFunc(fmt.Sprintf("%s/rung/{%s}/standing", slashAPIV1, constants.USERID), handler.getStanding).Methods(GET)
+}
@@ -1,14 +1,19 @@
 package handlers
 
 import (
+	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
+	"strconv"
+	"time"
+	xrfErr "xrf197ilz35aq0/internal/error"
 )
 
 const (
 	GET    = "GET"
 	PUT    = "PUT"
 	POST   = "POST"
+	PATCH  = "PATCH"
 	DELETE = "DELETE"
 )
 
@@ -21,3 +26,46 @@ func getAndValidateId(req *http.Request, reqIdKey string) (string, bool) {
 
 	return idVal, true
 }
+
+// queryInt returns 0 when the query parameter isn't set
+func queryInt(req *http.Request, key string) (int, error) {
+	value := req.URL.Query().Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalidQueryParam(key)
+	}
+	return number, nil
+}
+
+// queryBool returns nil when the query parameter isn't set
+func queryBool(req *http.Request, key string) (*bool, error) {
+	value := req.URL.Query().Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	boolean, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, invalidQueryParam(key)
+	}
+	return &boolean, nil
+}
+
+// queryTime parses RFC 3339 times e.g. 2024-10-01T00:00:00Z, it returns nil when the query parameter isn't set
+func queryTime(req *http.Request, key string) (*time.Time, error) {
+	value := req.URL.Query().Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, invalidQueryParam(key)
+	}
+	return &parsed, nil
+}
+
+func invalidQueryParam(key string) error {
+	return &xrfErr.External{Source: "handlers/request#query", Message: fmt.Sprintf("invalid '%s' query parameter", key)}
+}
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
+	"time"
 	"xrf197ilz35aq0/core/exchange"
 	"xrf197ilz35aq0/core/service"
 	xrf "xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
 )
 
 type PermissionHandler struct {
@@ -24,7 +28,7 @@ func (handler *PermissionHandler) createPermission(w http.ResponseWriter, r *htt
 	}
 
 	// create a new permission
-	resp, err := handler.permService.CreatePermission(permissionReq, context.Background())
+	resp, err := handler.permService.CreatePermission(permissionReq, r.Context())
 	if err != nil {
 		writeErrorResponse(err, w, handler.logger)
 		return
@@ -40,8 +44,190 @@ func (handler *PermissionHandler) createPermission(w http.ResponseWriter, r *htt
 	writeResponse(dataResp, w, handler.logger)
 }
 
+func (handler *PermissionHandler) createOrgPermission(w http.ResponseWriter, r *http.Request) {
+	orgId, isValid := getAndValidateId(r, constants.OrgId)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid org id"}, w, handler.logger)
+		return
+	}
+
+	var permissionReq exchange.PermissionRequest
+	err := decodeJSONBody(r, &permissionReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	permissionId, err := handler.permService.CreateOrgPermission(orgId, &permissionReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	permission, err := handler.permService.GetPermission(permissionId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Data: permission, Code: http.StatusCreated}, w, handler.logger)
+}
+
+func (handler *PermissionHandler) listOrgPermissions(w http.ResponseWriter, r *http.Request) {
+	orgId, isValid := getAndValidateId(r, constants.OrgId)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid org id"}, w, handler.logger)
+		return
+	}
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	listReq := exchange.PermissionListRequest{Cursor: r.URL.Query().Get("cursor"), Limit: limit}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	page, err := handler.permService.ListOrgPermissions(orgId, listReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writePage(page, w, handler.logger)
+}
+
+func (handler *PermissionHandler) getPermission(w http.ResponseWriter, r *http.Request) {
+	permissionId, isValid := getAndValidateId(r, constants.PermissionId)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid permission id"}, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	permission, err := handler.permService.GetPermission(permissionId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Data: permission, Code: http.StatusOK}, w, handler.logger)
+}
+
+func (handler *PermissionHandler) updatePermission(w http.ResponseWriter, r *http.Request) {
+	permissionId, isValid := getAndValidateId(r, constants.PermissionId)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid permission id"}, w, handler.logger)
+		return
+	}
+
+	var updateReq exchange.PermissionUpdateRequest
+	err := decodeJSONBody(r, &updateReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	permission, err := handler.permService.UpdatePermission(permissionId, &updateReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=updatePermission :: permissionId=%s", permissionId))
+	writeResponse(dataResponse{Data: permission, Code: http.StatusOK}, w, handler.logger)
+}
+
+func (handler *PermissionHandler) setImplies(w http.ResponseWriter, r *http.Request) {
+	permissionId, isValid := getAndValidateId(r, constants.PermissionId)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid permission id"}, w, handler.logger)
+		return
+	}
+
+	var impliesReq exchange.PermissionImpliesRequest
+	err := decodeJSONBody(r, &impliesReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	permission, err := handler.permService.SetImplies(permissionId, &impliesReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=setImplies :: permissionId=%s", permissionId))
+	writeResponse(dataResponse{Data: permission, Code: http.StatusOK}, w, handler.logger)
+}
+
+func (handler *PermissionHandler) listPermissions(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	listReq := exchange.PermissionListRequest{Cursor: r.URL.Query().Get("cursor"), Limit: limit}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	page, err := handler.permService.ListPermissions(listReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writePage(page, w, handler.logger)
+}
+
+// deletePermission refuses with 409 and the orgs still using the permission unless cascade=true is set
+func (handler *PermissionHandler) deletePermission(w http.ResponseWriter, r *http.Request) {
+	permissionId, isValid := getAndValidateId(r, constants.PermissionId)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid permission id"}, w, handler.logger)
+		return
+	}
+	cascade, err := queryBool(r, "cascade")
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	// a cascade rewrites every org using the permission
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*30)
+	defer cancel()
+
+	resp, err := handler.permService.DeletePermission(permissionId, cascade != nil && *cascade, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	code := http.StatusOK
+	if !resp.Deleted {
+		code = http.StatusConflict
+	}
+	writeResponse(dataResponse{Data: resp, Code: code}, w, handler.logger)
+}
+
 func (handler *PermissionHandler) RegisterAndListen() {
+	permissionUrl := fmt.Sprintf("/permission/{%s}", constants.PermissionId)                                          // "/permission/{permissionId}"
+	orgPermissionsUrl := fmt.Sprintf("%s/%s/org/{%s}/permissions", constants.SlashAPI, constants.V1, constants.OrgId) // "/api/v1/org/{orgId}/permissions"
+
 	handler.router.HandleFunc("/permission", handler.createPermission).Methods("POST")
+	handler.router.HandleFunc("/permission", handler.listPermissions).Methods(GET)
+	handler.router.HandleFunc(permissionUrl, handler.getPermission).Methods(GET)
+	handler.router.HandleFunc(permissionUrl, handler.updatePermission).Methods(PATCH)
+	handler.router.HandleFunc(permissionUrl, handler.deletePermission).Methods(DELETE)
+	handler.router.HandleFunc(fmt.Sprintf("%s/implies", permissionUrl), handler.setImplies).Methods(PUT)
+	handler.router.HandleFunc(orgPermissionsUrl, handler.createOrgPermission).Methods(POST)
+	handler.router.HandleFunc(orgPermissionsUrl, handler.listOrgPermissions).Methods(GET)
 }
 
 func NewPermHandler(logger xrf.Logger, router *mux.Router, service service.PermissionService) *PermissionHandler {
@@ -51,3 +237,79 @@ func NewPermHandler(logger xrf.Logger, router *mux.Router, service service.Permi
 		permService: service,
 	}
 }
+
+type RoleHandler struct {
+	logger      xrf.Logger
+	router      *mux.Router
+	roleService service.RoleService
+}
+
+func (handler *RoleHandler) createRole(w http.ResponseWriter, r *http.Request) {
+	var roleReq exchange.RoleRequest
+	err := decodeJSONBody(r, &roleReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	role, err := handler.roleService.CreateRole(&roleReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Data: role, Code: http.StatusCreated}, w, handler.logger)
+}
+
+func (handler *RoleHandler) getRole(w http.ResponseWriter, r *http.Request) {
+	roleId, isValid := getAndValidateId(r, constants.RoleId)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid role id"}, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	role, err := handler.roleService.GetRole(roleId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Data: role, Code: http.StatusOK}, w, handler.logger)
+}
+
+func (handler *RoleHandler) listRoles(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	listReq := exchange.RoleListRequest{Cursor: r.URL.Query().Get("cursor"), Limit: limit}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	page, err := handler.roleService.ListRoles(listReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writePage(page, w, handler.logger)
+}
+
+func (handler *RoleHandler) RegisterAndListen() {
+	handler.router.HandleFunc("/role", handler.createRole).Methods(POST)
+	handler.router.HandleFunc("/role", handler.listRoles).Methods(GET)
+	handler.router.HandleFunc(fmt.Sprintf("/role/{%s}", constants.RoleId), handler.getRole).Methods(GET)
+}
+
+func NewRoleHandler(logger xrf.Logger, router *mux.Router, service service.RoleService) *RoleHandler {
+	return &RoleHandler{
+		logger:      logger,
+		router:      router,
+		roleService: service,
+	}
+}
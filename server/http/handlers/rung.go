@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+	"xrf197ilz35aq0/core/exchange"
+	"xrf197ilz35aq0/core/service"
+	xrf "xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	xrfErr "xrf197ilz35aq0/internal/error"
+)
+
+type RungHandler struct {
+	logger      xrf.Logger
+	router      *mux.Router
+	rungService service.RungService
+}
+
+func NewRungHandler(logger xrf.Logger, rungService service.RungService, router *mux.Router) *RungHandler {
+	return &RungHandler{
+		logger:      logger,
+		router:      router,
+		rungService: rungService,
+	}
+}
+
+func (handler *RungHandler) getRung(w http.ResponseWriter, r *http.Request) {
+	userId, isValid := getAndValidateId(r, constants.USERID)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid user id"}, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	rungResp, err := handler.rungService.GetRung(userId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Data: rungResp, Code: http.StatusOK}, w, handler.logger)
+}
+
+// getHistory takes the range as RFC 3339 from and to query parameters and an optional day or week bucket
+func (handler *RungHandler) getHistory(w http.ResponseWriter, r *http.Request) {
+	userId, isValid := getAndValidateId(r, constants.USERID)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid user id"}, w, handler.logger)
+		return
+	}
+	from, err := queryTime(r, "from")
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	to, err := queryTime(r, "to")
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	historyReq := exchange.RungHistoryRequest{From: from, To: to, Bucket: r.URL.Query().Get("bucket")}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+
+	history, err := handler.rungService.GetHistory(userId, historyReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Data: history, Code: http.StatusOK}, w, handler.logger)
+}
+
+func (handler *RungHandler) addTradeTrail(w http.ResponseWriter, r *http.Request) {
+	userId, isValid := getAndValidateId(r, constants.USERID)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid user id"}, w, handler.logger)
+		return
+	}
+
+	var trailReq exchange.TradeTrailRequest
+	err := decodeJSONBody(r, &trailReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+
+	// a rung updated concurrently is reloaded and retried
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+
+	rungResp, err := handler.rungService.AddTradeTrail(userId, trailReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	handler.logger.Debug(fmt.Sprintf("event=addTradeTrail :: userId=%s", userId))
+	writeResponse(dataResponse{Data: rungResp, Code: http.StatusOK}, w, handler.logger)
+}
+
+func (handler *RungHandler) giveConsent(w http.ResponseWriter, r *http.Request) {
+	userId, isValid := getAndValidateId(r, constants.USERID)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid user id"}, w, handler.logger)
+		return
+	}
+
+	var consentReq exchange.ConsentRequest
+	err := decodeJSONBody(r, &consentReq)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	consentReq.UserAgent = r.UserAgent()
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	consent, err := handler.rungService.GiveConsent(userId, consentReq, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Data: consent, Code: http.StatusCreated}, w, handler.logger)
+}
+
+func (handler *RungHandler) getConsent(w http.ResponseWriter, r *http.Request) {
+	userId, isValid := getAndValidateId(r, constants.USERID)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid user id"}, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	consent, err := handler.rungService.GetConsent(userId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Data: consent, Code: http.StatusOK}, w, handler.logger)
+}
+
+func (handler *RungHandler) revokeConsent(w http.ResponseWriter, r *http.Request) {
+	userId, isValid := getAndValidateId(r, constants.USERID)
+	if !isValid {
+		writeErrorResponse(&xrfErr.External{Message: "invalid user id"}, w, handler.logger)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+
+	err := handler.rungService.RevokeConsent(userId, ctx)
+	if err != nil {
+		writeErrorResponse(err, w, handler.logger)
+		return
+	}
+	writeResponse(dataResponse{Code: http.StatusOK}, w, handler.logger)
+}
+
+func (handler *RungHandler) RegisterAndListen() {
+	rungUrl := fmt.Sprintf("%s/%s/rung/{%s}", constants.SlashAPI, constants.V1, constants.USERID) // "/api/v1/rung/{userId}"
+	consentUrl := fmt.Sprintf("%s/consent", rungUrl)
+
+	handler.router.HandleFunc(rungUrl, handler.getRung).Methods(GET)
+	handler.router.HandleFunc(fmt.Sprintf("%s/history", rungUrl), handler.getHistory).Methods(GET)
+	handler.router.HandleFunc(fmt.Sprintf("%s/trails", rungUrl), handler.addTradeTrail).Methods(POST)
+	handler.router.HandleFunc(consentUrl, handler.giveConsent).Methods(PUT)
+	handler.router.HandleFunc(consentUrl, handler.getConsent).Methods(GET)
+	handler.router.HandleFunc(consentUrl, handler.revokeConsent).Methods(DELETE)
+}
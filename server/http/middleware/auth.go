@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	"xrf197ilz35aq0/internal/token"
+	"xrf197ilz35aq0/server/http/handlers"
+)
+
+const bearerPrefix = "Bearer "
+
+// PublicRoute is a route that can be called without a session token.
+// Path is the route's path template as registered on the router e.g. "/api/v1/user"
+type PublicRoute struct {
+	Method string
+	Path   string
+}
+
+// AuthHandler is a middleware that rejects requests without a valid bearer token.
+type AuthHandler struct {
+	logger       internal.Logger
+	tokenSigner  *token.Signer
+	publicRoutes map[PublicRoute]bool
+}
+
+func (ah *AuthHandler) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ah.isPublic(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		requestId := internal.RequestId(r.Context())
+
+		authHeader := r.Header.Get(constants.Authorization)
+		if !strings.HasPrefix(authHeader, bearerPrefix) {
+			ah.logger.Warn(fmt.Sprintf("event=authenticateRequest :: success=false :: requestId=%s :: reason=missingBearerToken", requestId))
+			ah.writeUnauthorized(w, "missing bearer token")
+			return
+		}
+
+		claims, err := ah.tokenSigner.Verify(strings.TrimSpace(strings.TrimPrefix(authHeader, bearerPrefix)))
+		if err != nil {
+			ah.logger.Warn(fmt.Sprintf("event=authenticateRequest :: success=false :: requestId=%s :: reason=%v", requestId, err))
+			msg := "invalid bearer token"
+			if errors.Is(err, token.ErrExpiredToken) {
+				msg = "bearer token has expired"
+			}
+			ah.writeUnauthorized(w, msg)
+			return
+		}
+
+		ctx := internal.WithUserFingerprint(r.Context(), claims.Subject)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (ah *AuthHandler) isPublic(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	pathTemplate, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+	return ah.publicRoutes[PublicRoute{Method: r.Method, Path: pathTemplate}]
+}
+
+func (ah *AuthHandler) writeUnauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", strings.TrimSpace(bearerPrefix))
+	handlers.WriteError(http.StatusUnauthorized, msg, w, ah.logger)
+}
+
+func NewAuthHandler(logger internal.Logger, tokenSigner *token.Signer, publicRoutes []PublicRoute) *AuthHandler {
+	routes := make(map[PublicRoute]bool)
+	for _, route := range publicRoutes {
+		routes[route] = true
+	}
+	return &AuthHandler{
+		logger:       logger,
+		tokenSigner:  tokenSigner,
+		publicRoutes: routes,
+	}
+}
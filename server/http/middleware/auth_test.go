@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"xrf197ilz35aq0/internal"
+	"xrf197ilz35aq0/internal/constants"
+	"xrf197ilz35aq0/internal/token"
+	"xrf197ilz35aq0/server/http/handlers"
+)
+
+func TestAuthHandler(t *testing.T) {
+	signer, err := token.NewSigner(internal.RandomBytes(32), time.Hour)
+	internal.AssertNoError(t, err)
+	otherSigner, err := token.NewSigner(internal.RandomBytes(32), time.Hour)
+	internal.AssertNoError(t, err)
+
+	validToken, _, err := signer.Issue("callerFingerprint", "1234")
+	internal.AssertNoError(t, err)
+	foreignToken, _, err := otherSigner.Issue("callerFingerprint", "1234")
+	internal.AssertNoError(t, err)
+
+	var seenFingerprint string
+	router := mux.NewRouter()
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		seenFingerprint, _ = internal.UserFingerprint(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}).Methods(http.MethodGet)
+
+	publicRoutes := []PublicRoute{
+		{Method: http.MethodGet, Path: "/health"},
+		{Method: http.MethodPost, Path: "/api/v1/user"},
+	}
+	router.Use(NewAuthHandler(internal.NewTestLogger(), signer, publicRoutes).Handler)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		authHeader string
+		wantStatus int
+	}{
+		{name: "public route without token", method: http.MethodGet, path: "/health", wantStatus: http.StatusOK},
+		{name: "public signup route without token", method: http.MethodPost, path: "/api/v1/user", wantStatus: http.StatusCreated},
+		{name: "protected route without token", method: http.MethodGet, path: "/api/v1/user/1234", wantStatus: http.StatusUnauthorized},
+		{name: "protected route with non bearer header", method: http.MethodGet, path: "/api/v1/user/1234", authHeader: "Basic abc", wantStatus: http.StatusUnauthorized},
+		{name: "protected route with invalid token", method: http.MethodGet, path: "/api/v1/user/1234", authHeader: "Bearer abc.def", wantStatus: http.StatusUnauthorized},
+		{name: "protected route with token signed by another secret", method: http.MethodGet, path: "/api/v1/user/1234", authHeader: "Bearer " + foreignToken, wantStatus: http.StatusUnauthorized},
+		{name: "protected route with valid token", method: http.MethodGet, path: "/api/v1/user/1234", authHeader: "Bearer " + validToken, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seenFingerprint = ""
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.authHeader != "" {
+				req.Header.Set(constants.Authorization, tt.authHeader)
+			}
+			recorder := httptest.NewRecorder()
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.wantStatus == http.StatusUnauthorized {
+				var errResp handlers.ErrorResponse
+				internal.AssertNoError(t, json.NewDecoder(recorder.Body).Decode(&errResp))
+				assert.Equal(t, http.StatusUnauthorized, errResp.Code)
+				assert.NotEmpty(t, errResp.Error)
+			}
+			if tt.authHeader == "Bearer "+validToken {
+				assert.Equal(t, "callerFingerprint", seenFingerprint)
+			}
+		})
+	}
+}
@@ -57,8 +57,8 @@ func (lh *LoggerHandler) Handler(next http.Handler) http.Handler {
 		}
 		wrappedWriter.Header().Set("Request-Trace-Id", requestId)
 
-		// Call the next handler.
-		next.ServeHTTP(wrappedWriter, r)
+		// Call the next handler, making the request id available to the layers below
+		next.ServeHTTP(wrappedWriter, r.WithContext(internal.WithRequestId(r.Context(), requestId)))
 
 		// Stop the timer.
 		duration := time.Since(start)
@@ -13,6 +13,7 @@ import (
 	"xrf197ilz35aq0/core/service"
 	"xrf197ilz35aq0/internal"
 	xrfErr "xrf197ilz35aq0/internal/error"
+	"xrf197ilz35aq0/internal/token"
 	"xrf197ilz35aq0/server/http/handlers"
 	"xrf197ilz35aq0/server/http/middleware"
 )
@@ -25,18 +26,30 @@ type ApiServer struct {
 	userService service.UserService
 	ctx         context.Context
 	services    Services
+	tokenSigner *token.Signer
 }
 
 type Services struct {
 	OrgService        service.OrgService
 	UserService       service.UserService
 	PermissionService service.PermissionService
+	InvitationService service.InvitationService
+	RoleService       service.RoleService
+	RungService       service.RungService
+	RankingService    service.RankingService
 }
 
 var apiInternalErr = &xrfErr.Internal{
 	Source: "cmd/http/run#start",
 }
 
+// publicRoutes can be called without a session token, every other route requires one
+var publicRoutes = []middleware.PublicRoute{
+	{Method: handlers.GET, Path: "/health"},
+	{Method: handlers.POST, Path: "/api/v1/user"},
+	{Method: handlers.POST, Path: "/api/v1/auth/login"},
+}
+
 func (server *ApiServer) Start() {
 	if server.started {
 		return
@@ -44,14 +57,22 @@ func (server *ApiServer) Start() {
 	started := time.Now()
 
 	loggerMiddleware := middleware.NewLoggerHandler(server.logger)
+	authMiddleware := middleware.NewAuthHandler(server.logger, server.tokenSigner, publicRoutes)
 
 	// handlers
 	handlers.NewHealthRoutes(server.logger, server.router).RegisterAndListen()
 	handlers.NewOrgHandler(server.logger, server.services.OrgService, server.router).RegisterAndListen()
 	handlers.NewPermHandler(server.logger, server.router, server.services.PermissionService).RegisterAndListen()
+	handlers.NewRoleHandler(server.logger, server.router, server.services.RoleService).RegisterAndListen()
 	handlers.NewUserHandler(server.logger, server.services.UserService, server.router).RegisterAndListen()
+	handlers.NewAuthHandler(server.logger, server.services.UserService, server.router).RegisterAndListen()
+	handlers.NewInvitationHandler(server.logger, server.services.InvitationService, server.router).RegisterAndListen()
+	handlers.NewRungHandler(server.logger, server.services.RungService, server.router).RegisterAndListen()
+	handlers.NewRankingHandler(server.logger, server.services.RankingService, server.router).RegisterAndListen()
 
+	// middlewares run in the order they're added, the logger has to run first to set the request id
 	server.router.Use(loggerMiddleware.Handler)
+	server.router.Use(authMiddleware.Handler)
 
 	// start the server
 	appConfig := server.config.Application
@@ -120,12 +141,19 @@ func (server *ApiServer) Stop() {
 	server.started = false
 }
 
-func NewHttpServer(logger internal.Logger, router *mux.Router, config xrf197ilz35aq0.Config, services Services, ctx context.Context) *ApiServer {
+func NewHttpServer(
+	logger internal.Logger,
+	router *mux.Router,
+	config xrf197ilz35aq0.Config,
+	services Services,
+	tokenSigner *token.Signer,
+	ctx context.Context) *ApiServer {
 	return &ApiServer{
-		ctx:      ctx,
-		logger:   logger,
-		router:   router,
-		config:   config,
-		services: services,
+		ctx:         ctx,
+		logger:      logger,
+		router:      router,
+		config:      config,
+		services:    services,
+		tokenSigner: tokenSigner,
 	}
 }
@@ -19,7 +19,7 @@ func NewClient(ctx context.Context, dbUri, dbName string) (*mongo.Client, error)
 	}
 
 	// Send a ping to confirm a successful connection
-	if err := client.Database(dbName).RunCommand(ctx, bson.D{{"ping", 1}}).Err(); err != nil {
+	if err := client.Database(dbName).RunCommand(ctx, bson.D{{Key: "ping", Value: 1}}).Err(); err != nil {
 		return nil, err
 	}
 	return client, nil